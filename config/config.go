@@ -1,13 +1,99 @@
 package config
 
 import (
+	"log/slog"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
 	Port        string
 	Environment string
 	AppName     string
+	// GRPCPort is the port of the gRPC user service, served beside the
+	// HTTP API
+	GRPCPort string
+	// LogLevel is the minimum level logged: debug, info, warn or error
+	LogLevel string
+	// SlowQueryThreshold is the repository call duration logged as a warning
+	SlowQueryThreshold time.Duration
+	// TraceExporter selects where spans go: none, stdout, file or otlp.
+	// The OTLP exporter reads the standard OTEL_EXPORTER_OTLP_* variables.
+	TraceExporter string
+	// TraceFile is the file the file exporter appends spans to
+	TraceFile string
+	// DBTimeout bounds the database work of each request; queries
+	// still running when it passes are cancelled and the request fails
+	// with 504. Zero disables it.
+	DBTimeout time.Duration
+	// ImportTimeout replaces DBTimeout for bulk imports
+	ImportTimeout time.Duration
+	// ImportMaxBytes bounds the file sent to a bulk import, which unlike
+	// other request bodies is streamed rather than held in memory
+	ImportMaxBytes int
+	// ExportTimeout bounds a user export, including the time spent
+	// sending it to the client
+	ExportTimeout time.Duration
+	// ShutdownDelay is how long /readyz reports shutting down before the
+	// listener closes, so load balancers stop sending new requests first
+	ShutdownDelay time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// once the listener has closed
+	ShutdownTimeout time.Duration
+	// ReadinessTimeout bounds each /readyz dependency check
+	ReadinessTimeout time.Duration
+	// ReadinessMinFreeDiskMB is the free space /readyz requires next to
+	// the database file
+	ReadinessMinFreeDiskMB int
+	// MemberTiers holds tier rules as "Name:min_points" pairs, e.g.
+	// "Bronze:0,Silver:1000,Gold:5000,Platinum:10000". Empty means defaults.
+	MemberTiers string
+	// RolePermissions maps roles to permissions as
+	// "role=perm,perm;role=perm", e.g. "admin=*;support=users:read".
+	// Empty means the default admin, support and finance roles.
+	RolePermissions string
+	// RateLimits holds token bucket rules as "tier/group=rate:burst", e.g.
+	// "*/*=10:20;partner/*=50:100". Empty means the default limits.
+	RateLimits string
+	// RateLimitQuotas holds daily quotas as "tier=requests", e.g.
+	// "standard=50000". Empty means no quotas.
+	RateLimitQuotas string
+	// IdempotencyTTL is how long the response to a request sent with an
+	// Idempotency-Key is replayed for retries with the same key
+	IdempotencyTTL time.Duration
+	// SoftDeleteRetention is how long a deleted user can still be restored
+	// before the purge worker removes it for good
+	SoftDeleteRetention time.Duration
+	// PurgeInterval is how often the purge worker runs
+	PurgeInterval time.Duration
+	// WebhookPollInterval is how often the webhook worker looks for new
+	// events and deliveries due for a retry
+	WebhookPollInterval time.Duration
+	// WebhookTimeout bounds one webhook request
+	WebhookTimeout time.Duration
+	// WebhookMaxAttempts is how many times a delivery is tried before it is
+	// dead, and WebhookRetryBase the wait after its first failure, doubled
+	// after each further one
+	WebhookMaxAttempts int
+	WebhookRetryBase   time.Duration
+	// OutboxRetention is how long an outbox event is kept once every
+	// webhook delivery of it has succeeded; the purge worker's interval
+	// applies
+	OutboxRetention time.Duration
+	// EventStreamPollInterval is how often event streams check the log for
+	// new events, and EventStreamHeartbeat how long a quiet stream waits
+	// before sending a heartbeat comment
+	EventStreamPollInterval time.Duration
+	EventStreamHeartbeat    time.Duration
+
+	// JWT verification: a shared HS256 secret and/or a local JWKS file
+	// (reloaded on change for key rotation), with optional iss/aud checks
+	JWTSecret    string
+	JWTJWKSFile  string
+	JWTIssuer    string
+	JWTAudience  string
+	JWTClockSkew time.Duration
 }
 
 // LoadConfig loads configuration from environment variables
@@ -16,6 +102,52 @@ func LoadConfig() *Config {
 		Port:        getEnv("PORT", "3000"),
 		Environment: getEnv("ENVIRONMENT", "development"),
 		AppName:     getEnv("APP_NAME", "Workshop 4 API"),
+		GRPCPort:    getEnv("GRPC_PORT", "50051"),
+
+		LogLevel:           getEnv("LOG_LEVEL", "info"),
+		SlowQueryThreshold: getEnvDuration("SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+
+		TraceExporter: getEnv("TRACE_EXPORTER", "none"),
+		TraceFile:     getEnv("TRACE_FILE", "traces.jsonl"),
+
+		DBTimeout:     getEnvDurationAllowZero("DB_TIMEOUT", 5*time.Second),
+		ImportTimeout: getEnvDuration("IMPORT_TIMEOUT", 10*time.Minute),
+		ExportTimeout: getEnvDuration("EXPORT_TIMEOUT", 30*time.Minute),
+
+		ImportMaxBytes: getEnvInt("IMPORT_MAX_BYTES", 512<<20),
+
+		ShutdownDelay:   getEnvDuration("SHUTDOWN_DELAY", 0),
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+
+		ReadinessTimeout:       getEnvDuration("READINESS_TIMEOUT", 2*time.Second),
+		ReadinessMinFreeDiskMB: getEnvInt("READINESS_MIN_FREE_DISK_MB", 100),
+
+		MemberTiers: getEnv("MEMBER_TIERS", ""),
+
+		RolePermissions: getEnv("ROLE_PERMISSIONS", ""),
+
+		RateLimits:      getEnv("RATE_LIMITS", ""),
+		RateLimitQuotas: getEnv("RATE_LIMIT_QUOTAS", ""),
+
+		IdempotencyTTL: getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		SoftDeleteRetention: getEnvDuration("SOFT_DELETE_RETENTION", 30*24*time.Hour),
+		PurgeInterval:       getEnvDuration("PURGE_INTERVAL", time.Hour),
+
+		WebhookPollInterval: getEnvDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		WebhookTimeout:      getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts:  getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookRetryBase:    getEnvDuration("WEBHOOK_RETRY_BASE", 30*time.Second),
+		OutboxRetention:     getEnvDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+
+		EventStreamPollInterval: getEnvDuration("EVENT_STREAM_POLL_INTERVAL", time.Second),
+		EventStreamHeartbeat:    getEnvDuration("EVENT_STREAM_HEARTBEAT", 15*time.Second),
+
+		JWTSecret:    getEnv("JWT_SECRET", ""),
+		JWTJWKSFile:  getEnv("JWT_JWKS_FILE", ""),
+		JWTIssuer:    getEnv("JWT_ISSUER", ""),
+		JWTAudience:  getEnv("JWT_AUDIENCE", ""),
+		JWTClockSkew: getEnvDuration("JWT_CLOCK_SKEW", 30*time.Second),
 	}
 }
 
@@ -26,3 +158,47 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvInt reads a non-negative integer, keeping the default when the
+// variable is unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		slog.Warn("invalid integer, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvDuration reads a duration such as "720h" or "15m", keeping the default
+// when the variable is unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		slog.Warn("invalid duration, using default", "key", key, "value", value, "default", defaultValue.String())
+		return defaultValue
+	}
+	return duration
+}
+
+// getEnvDurationAllowZero is getEnvDuration for settings that 0 turns off
+func getEnvDurationAllowZero(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		slog.Warn("invalid duration, using default", "key", key, "value", value, "default", defaultValue.String())
+		return defaultValue
+	}
+	return duration
+}
@@ -2,48 +2,182 @@ package database
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
-// InitDB initializes the SQLite database
+// Path is the SQLite database file
+const Path = "./users.db"
+
+// InitDB opens the SQLite database and brings its schema up to date
 func InitDB() error {
+	if err := OpenDB(); err != nil {
+		return err
+	}
+
+	if err := InitSchema(DB); err != nil {
+		return err
+	}
+
+	slog.Info("database initialized")
+	return nil
+}
+
+// OpenDB opens the SQLite database without touching its schema
+func OpenDB() error {
 	var err error
-	DB, err = sql.Open("sqlite3", "./users.db")
+	DB, err = Open(Path)
 	if err != nil {
 		return err
 	}
 
 	// Test connection
-	if err = DB.Ping(); err != nil {
+	return DB.Ping()
+}
+
+// Open opens the SQLite database at path. Transactions begin IMMEDIATE,
+// taking the write lock up front: a deferred transaction that reads and then
+// writes, as the points ledger does, cannot wait for a concurrent writer and
+// fails with "database is locked" instead, while an immediate one waits for
+// the busy timeout.
+func Open(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", path+"?_txlock=immediate")
+}
+
+// InitSchema applies any pending migrations. It is safe to run on every start.
+func InitSchema(db *sql.DB) error {
+	if err := CheckFTS5(db); err != nil {
 		return err
 	}
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		slog.Info("applied migrations", "count", applied)
+	}
+	return nil
+}
 
-	// Create users table
-	createTableQuery := `
-	CREATE TABLE IF NOT EXISTS users (
+// adoptLegacySchema brings a users table created before migrations existed
+// to the shape of the baseline migration, whose IF NOT EXISTS statements
+// then record it as applied without recreating anything
+func adoptLegacySchema(db *sql.DB) error {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'`).Scan(&exists)
+	if err != nil || exists == 0 {
+		return err
+	}
+
+	if err = addColumnIfMissing(db, "users", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(db, "users", "deleted_at", "DATETIME"); err != nil {
+		return err
+	}
+	return dropInlineEmailConstraint(db)
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is
+// already there, so databases created by older releases pick it up
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+// dropInlineEmailConstraint rebuilds a users table created with the original
+// "email TEXT NOT NULL UNIQUE" column, whose constraint would also count
+// soft-deleted rows. SQLite cannot drop a constraint, so the table is copied.
+// Indexes are recreated by the baseline migration and search triggers by
+// the users_fts migration afterwards.
+func dropInlineEmailConstraint(db *sql.DB) error {
+	var inline int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = 'users' AND name LIKE 'sqlite_autoindex_users_%'`).Scan(&inline)
+	if err != nil || inline == 0 {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Matches the table in migrations/0001_create_users.up.sql
+	rebuildQuery := `
+	CREATE TABLE users_rebuild (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		first_name TEXT NOT NULL,
 		last_name TEXT NOT NULL,
-		email TEXT NOT NULL UNIQUE,
+		email TEXT NOT NULL,
 		phone TEXT,
 		address TEXT,
 		avatar TEXT,
 		member_level TEXT DEFAULT 'Bronze',
 		point_balance INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_at DATETIME
+	);
+	INSERT INTO users_rebuild SELECT
+		id, first_name, last_name, email, phone, address, avatar, member_level,
+		point_balance, created_at, updated_at, version, deleted_at
+	FROM users;
+	DROP TABLE users;
+	ALTER TABLE users_rebuild RENAME TO users;`
 
-	_, err = DB.Exec(createTableQuery)
-	if err != nil {
+	if _, err := tx.Exec(rebuildQuery); err != nil {
 		return err
 	}
 
-	log.Println("✅ Database initialized successfully")
+	slog.Info("rebuilt users table to scope email uniqueness to active users")
+	return tx.Commit()
+}
+
+// ErrFTS5Unavailable fails a build of go-sqlite3 without the sqlite_fts5
+// tag, which cannot apply or use the member search migration
+var ErrFTS5Unavailable = errors.New("SQLite was built without FTS5; build with -tags sqlite_fts5")
+
+// CheckFTS5 returns ErrFTS5Unavailable unless SQLite has FTS5 compiled in.
+// The users_fts triggers need FTS5 for every write to users, so a build
+// without it must not open a migrated database either.
+func CheckFTS5(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrFTS5Unavailable
+	}
 	return nil
 }
 
@@ -51,6 +185,6 @@ func InitDB() error {
 func CloseDB() {
 	if DB != nil {
 		DB.Close()
-		log.Println("🔒 Database connection closed")
+		slog.Info("database connection closed")
 	}
 }
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	// Every pooled connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count)
+	assert.NoError(t, err)
+	return count > 0
+}
+
+var testMigrationFiles = fstest.MapFS{
+	"migrations/0001_create_a.up.sql":   {Data: []byte(`CREATE TABLE a (id INTEGER);`)},
+	"migrations/0001_create_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+	"migrations/0002_create_b.up.sql":   {Data: []byte(`CREATE TABLE b (id INTEGER);`)},
+	"migrations/0002_create_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+}
+
+func testMigrator(t *testing.T, db *sql.DB, files fstest.MapFS) *Migrator {
+	migrations, err := LoadMigrations(files)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	return &Migrator{db: db, migrations: migrations}
+}
+
+func TestMigrator_UpDownRedo(t *testing.T) {
+	db := openTestDB(t)
+	m := testMigrator(t, db, testMigrationFiles)
+
+	n, err := m.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.True(t, tableExists(t, db, "b"))
+
+	n, err = m.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = m.Down(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, tableExists(t, db, "b"))
+	assert.True(t, tableExists(t, db, "a"))
+
+	pending, err := m.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pending)
+
+	// Redo acts on the latest applied migration, now 0001
+	assert.NoError(t, m.Redo())
+	assert.True(t, tableExists(t, db, "a"))
+
+	statuses, err := m.Status()
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 2) {
+		assert.NotNil(t, statuses[0].AppliedAt)
+		assert.Nil(t, statuses[1].AppliedAt)
+	}
+}
+
+func TestMigrator_FailedMigrationIsRolledBack(t *testing.T) {
+	db := openTestDB(t)
+	files := fstest.MapFS{
+		"migrations/0001_broken.up.sql": {Data: []byte(`CREATE TABLE c (id INTEGER); INSERT INTO missing VALUES (1);`)},
+	}
+	m := testMigrator(t, db, files)
+
+	_, err := m.Up()
+	assert.Error(t, err)
+	assert.False(t, tableExists(t, db, "c"))
+
+	pending, _ := m.Pending()
+	assert.Equal(t, 1, pending)
+}
+
+func TestMigrator_DetectsModifiedMigration(t *testing.T) {
+	db := openTestDB(t)
+	_, err := testMigrator(t, db, testMigrationFiles).Up()
+	assert.NoError(t, err)
+
+	edited := fstest.MapFS{}
+	for name, file := range testMigrationFiles {
+		edited[name] = file
+	}
+	edited["migrations/0001_create_a.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE a (id INTEGER, name TEXT);`)}
+	m := testMigrator(t, db, edited)
+
+	_, err = m.Up()
+	assert.True(t, errors.Is(err, ErrMigrationModified))
+
+	statuses, _ := m.Status()
+	assert.True(t, statuses[0].Modified)
+}
+
+func TestMigrator_RejectsUnknownMigration(t *testing.T) {
+	db := openTestDB(t)
+	_, err := testMigrator(t, db, testMigrationFiles).Up()
+	assert.NoError(t, err)
+
+	older := fstest.MapFS{
+		"migrations/0001_create_a.up.sql": testMigrationFiles["migrations/0001_create_a.up.sql"],
+	}
+	_, err = testMigrator(t, db, older).Up()
+	assert.True(t, errors.Is(err, ErrMigrationUnknown))
+}
+
+func TestMigrator_Check(t *testing.T) {
+	db := openTestDB(t)
+	m := testMigrator(t, db, testMigrationFiles)
+
+	err := m.Check()
+	assert.True(t, errors.Is(err, ErrMigrationsPending))
+	assert.EqualError(t, err, "2 migrations pending")
+
+	_, err = m.Up()
+	assert.NoError(t, err)
+	assert.NoError(t, m.Check())
+
+	older := fstest.MapFS{
+		"migrations/0001_create_a.up.sql": testMigrationFiles["migrations/0001_create_a.up.sql"],
+	}
+	assert.True(t, errors.Is(testMigrator(t, db, older).Check(), ErrMigrationUnknown))
+}
+
+func TestLoadMigrations_RejectsBadFileName(t *testing.T) {
+	_, err := LoadMigrations(fstest.MapFS{"migrations/create_a.sql": {Data: []byte(`SELECT 1;`)}})
+	assert.Error(t, err)
+}
+
+func TestInitSchema_AdoptsLegacyDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	// The users table as created before migrations existed
+	_, err := db.Exec(`
+	CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		first_name TEXT NOT NULL,
+		last_name TEXT NOT NULL,
+		email TEXT NOT NULL UNIQUE,
+		phone TEXT,
+		address TEXT,
+		avatar TEXT,
+		member_level TEXT DEFAULT 'Bronze',
+		point_balance INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO users (first_name, last_name, email) VALUES ('สมชาย', 'ใจดี', 'somchai@example.com');`)
+	assert.NoError(t, err)
+
+	assert.NoError(t, InitSchema(db))
+
+	var email string
+	var version int
+	err = db.QueryRow(`SELECT email, version FROM users WHERE deleted_at IS NULL`).Scan(&email, &version)
+	assert.NoError(t, err)
+	assert.Equal(t, "somchai@example.com", email)
+	assert.Equal(t, 1, version)
+	assert.True(t, tableExists(t, db, "point_transactions"))
+
+	// Existing users are indexed for search
+	var indexed int
+	err = db.QueryRow(`SELECT COUNT(*) FROM users_fts WHERE users_fts MATCH '"somchai"'`).Scan(&indexed)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, indexed)
+
+	// Email uniqueness now only covers active users
+	_, err = db.Exec(`UPDATE users SET deleted_at = CURRENT_TIMESTAMP`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO users (first_name, last_name, email) VALUES ('สมชาย', 'ใหม่', 'somchai@example.com')`)
+	assert.NoError(t, err)
+
+	migrator, _ := NewMigrator(db)
+	pending, err := migrator.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pending)
+}
+
+func TestInitSchema_SearchIndexFollowsUsers(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, CheckFTS5(db))
+	assert.NoError(t, InitSchema(db))
+
+	matches := func(term string) int {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM users_fts WHERE users_fts MATCH ?`, `"`+term+`"`).Scan(&count)
+		assert.NoError(t, err)
+		return count
+	}
+
+	_, err := db.Exec(`INSERT INTO users (first_name, last_name, email) VALUES ('มาลี', 'สุขสันต์', 'malee@example.com')`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, matches("มาลี"))
+
+	_, err = db.Exec(`UPDATE users SET first_name = 'มานี'`)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, matches("มาลี"))
+	assert.Equal(t, 1, matches("มานี"))
+
+	_, err = db.Exec(`DELETE FROM users`)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, matches("มานี"))
+
+	// Rolling the migration back removes the index and its triggers
+	migrator, _ := NewMigrator(db)
+	_, err = migrator.Down(1)
+	assert.NoError(t, err)
+	assert.False(t, tableExists(t, db, "users_fts"))
+	_, err = db.Exec(`INSERT INTO users (first_name, last_name, email) VALUES ('มาลี', 'สุขสันต์', 'malee@example.com')`)
+	assert.NoError(t, err)
+}
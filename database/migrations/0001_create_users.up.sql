@@ -0,0 +1,24 @@
+-- Baseline users table. Email uniqueness is enforced by a partial index over
+-- active users so a soft-deleted member's email can be reused.
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	phone TEXT,
+	address TEXT,
+	avatar TEXT,
+	member_level TEXT DEFAULT 'Bronze',
+	point_balance INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	version INTEGER NOT NULL DEFAULT 1,
+	deleted_at DATETIME
+);
+
+-- Indexes backing the filters and sorts of the user listing
+CREATE INDEX IF NOT EXISTS idx_users_member_level ON users(member_level);
+CREATE INDEX IF NOT EXISTS idx_users_point_balance ON users(point_balance);
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_active ON users(email) WHERE deleted_at IS NULL;
@@ -0,0 +1,12 @@
+-- Points ledger; every balance change of a user is one row
+CREATE TABLE IF NOT EXISTS point_transactions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	type TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	balance_after INTEGER NOT NULL,
+	description TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_point_transactions_user_id ON point_transactions(user_id, id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS quota_usage;
+ALTER TABLE api_keys DROP COLUMN rate_limit_tier;
@@ -0,0 +1,10 @@
+-- Rate limit tier of each API key, matched against the RATE_LIMITS rules
+ALTER TABLE api_keys ADD COLUMN rate_limit_tier TEXT NOT NULL DEFAULT 'standard';
+
+-- Requests counted against each client's daily quota, by UTC day
+CREATE TABLE quota_usage (
+	client TEXT NOT NULL,
+	day TEXT NOT NULL,
+	used INTEGER NOT NULL,
+	PRIMARY KEY (client, day)
+);
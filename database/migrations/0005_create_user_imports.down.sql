@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_import_rejections;
+DROP TABLE IF EXISTS user_imports;
@@ -0,0 +1,21 @@
+-- Bulk user imports and the rows each one rejected, kept so the rejection
+-- report can be downloaded after the import has finished
+CREATE TABLE user_imports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	format TEXT NOT NULL,
+	dry_run BOOLEAN NOT NULL,
+	total INTEGER NOT NULL DEFAULT 0,
+	imported INTEGER NOT NULL DEFAULT 0,
+	rejected INTEGER NOT NULL DEFAULT 0,
+	created_by TEXT,
+	created_at DATETIME NOT NULL,
+	finished_at DATETIME
+);
+
+CREATE TABLE user_import_rejections (
+	import_id INTEGER NOT NULL REFERENCES user_imports(id) ON DELETE CASCADE,
+	line INTEGER NOT NULL,
+	email TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	PRIMARY KEY (import_id, line)
+);
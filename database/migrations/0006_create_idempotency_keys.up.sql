@@ -0,0 +1,16 @@
+-- Idempotency-Key values sent with POST requests, per client, and the
+-- response replayed when the request is retried. status is 0 while the
+-- first request with the key is still running.
+CREATE TABLE idempotency_keys (
+	client TEXT NOT NULL,
+	idempotency_key TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	status INTEGER NOT NULL DEFAULT 0,
+	headers TEXT,
+	body BLOB,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	PRIMARY KEY (client, idempotency_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
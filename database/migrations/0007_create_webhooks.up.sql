@@ -0,0 +1,43 @@
+-- The outbox: user changes, written in the same transaction as the change.
+-- enqueued_at is set once the event has been fanned out to the webhook
+-- subscriptions that want it.
+CREATE TABLE outbox_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	enqueued_at DATETIME
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events(id) WHERE enqueued_at IS NULL;
+
+-- Endpoints outbox events are delivered to. event_types is a space-separated
+-- list, empty for every type. The secret is kept as is since deliveries are
+-- signed with it.
+CREATE TABLE webhook_subscriptions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL,
+	event_types TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	secret TEXT NOT NULL,
+	created_by TEXT,
+	created_at DATETIME NOT NULL
+);
+
+-- One row per event and subscription, retried until delivered or dead
+CREATE TABLE webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions(id),
+	event_id INTEGER NOT NULL REFERENCES outbox_events(id),
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at DATETIME,
+	last_status_code INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	delivered_at DATETIME,
+	UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
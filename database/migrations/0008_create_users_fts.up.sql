@@ -0,0 +1,33 @@
+-- Member search index. FTS5 is only compiled into go-sqlite3 with the
+-- sqlite_fts5 build tag. The trigram tokenizer is used because Thai is
+-- written without spaces between words, so word tokenizers cannot match part
+-- of a Thai name; trigrams match any fragment of three characters or more in
+-- any script.
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+	first_name, last_name, email, phone, address,
+	content = 'users', content_rowid = 'id',
+	tokenize = 'trigram'
+);
+
+-- Keep the index in sync with users. Triggers are dropped along with the
+-- table, so a migration that rebuilds users must recreate them.
+CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+	INSERT INTO users_fts(rowid, first_name, last_name, email, phone, address)
+	VALUES (new.id, new.first_name, new.last_name, new.email, new.phone, new.address);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+	INSERT INTO users_fts(users_fts, rowid, first_name, last_name, email, phone, address)
+	VALUES ('delete', old.id, old.first_name, old.last_name, old.email, old.phone, old.address);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE ON users BEGIN
+	INSERT INTO users_fts(users_fts, rowid, first_name, last_name, email, phone, address)
+	VALUES ('delete', old.id, old.first_name, old.last_name, old.email, old.phone, old.address);
+	INSERT INTO users_fts(rowid, first_name, last_name, email, phone, address)
+	VALUES (new.id, new.first_name, new.last_name, new.email, new.phone, new.address);
+END;
+
+-- Index the users that already exist, including those of a database indexed
+-- before this migration
+INSERT INTO users_fts(users_fts) VALUES ('rebuild');
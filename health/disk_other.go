@@ -0,0 +1,10 @@
+//go:build !unix
+
+package health
+
+import "errors"
+
+// freeSpace is not implemented on this platform; the disk check passes
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,196 @@
+// Package health serves the liveness and readiness probes. /healthz only
+// reports that the process is serving; /readyz runs the registered
+// dependency checks and fails while any of them does, or once the server
+// has started shutting down, so load balancers stop routing to it.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+	"workshop_4/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// errTimeout reports a check that did not finish within the timeout
+var errTimeout = errors.New("check timed out")
+
+// Check reports whether one dependency is usable. It should give up when
+// ctx is done.
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one check as reported by /readyz
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// namedCheck is a registered check
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker holds the readiness checks and the shutdown state
+type Checker struct {
+	checks       []namedCheck
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a checker whose checks each get timeout to finish
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a readiness check under name
+func (h *Checker) Add(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// SetShuttingDown makes readiness fail from now on, without running the
+// checks, so traffic drains away before the server stops
+func (h *Checker) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Run runs every check concurrently and reports whether all passed
+func (h *Checker) Run(ctx context.Context) (map[string]CheckResult, bool) {
+	results := make(map[string]CheckResult, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			result := h.run(ctx, c.check)
+			mu.Lock()
+			results[c.name] = result
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, result := range results {
+		if result.Status != StatusOK {
+			ready = false
+		}
+	}
+	return results, ready
+}
+
+// run runs one check, abandoning it once the timeout passes
+func (h *Checker) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errTimeout
+	}
+
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Liveness handles GET /healthz
+func (h *Checker) Liveness() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status": StatusOK,
+		})
+	}
+}
+
+// Readiness handles GET /readyz. It answers 200 with each check's status
+// and latency when every check passes, and 503 otherwise.
+func (h *Checker) Readiness() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+
+		if h.shuttingDown.Load() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "shutting_down",
+			})
+		}
+
+		checks, ready := h.Run(c.UserContext())
+		if !ready {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "not_ready",
+				"checks": checks,
+			})
+		}
+		return c.JSON(fiber.Map{
+			"status": "ready",
+			"checks": checks,
+		})
+	}
+}
+
+// DatabaseCheck pings the database
+func DatabaseCheck(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// MigrationsCheck fails while the schema is not the one this build
+// expects, such as during a deploy whose migrations have not run yet
+func MigrationsCheck(db *sql.DB) Check {
+	return func(context.Context) error {
+		migrator, err := database.NewMigrator(db)
+		if err != nil {
+			return err
+		}
+		return migrator.Check()
+	}
+}
+
+// DiskSpaceCheck fails when the file system holding path has less than
+// minFree bytes available, since SQLite cannot write without room for its
+// journal
+func DiskSpaceCheck(path string, minFree uint64) Check {
+	dir := filepath.Dir(path)
+	return func(context.Context) error {
+		free, err := freeSpace(dir)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d MB free in %s, need %d MB", free>>20, dir, minFree>>20)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"workshop_4/database"
+
+	"github.com/gofiber/fiber/v2"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+type readyBody struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func probe(t *testing.T, h *Checker) (int, readyBody) {
+	app := fiber.New()
+	app.Get("/readyz", h.Readiness())
+	resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body readyBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestReadiness_AllChecksPass(t *testing.T) {
+	h := NewChecker(time.Second)
+	h.Add("a", func(context.Context) error { return nil })
+	h.Add("b", func(context.Context) error { return nil })
+
+	status, body := probe(t, h)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "ready", body.Status)
+	assert.Equal(t, StatusOK, body.Checks["a"].Status)
+	assert.Equal(t, StatusOK, body.Checks["b"].Status)
+}
+
+func TestReadiness_FailingCheck(t *testing.T) {
+	h := NewChecker(time.Second)
+	h.Add("a", func(context.Context) error { return nil })
+	h.Add("b", func(context.Context) error { return errors.New("broken") })
+
+	status, body := probe(t, h)
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+	assert.Equal(t, "not_ready", body.Status)
+	assert.Equal(t, StatusOK, body.Checks["a"].Status)
+	assert.Equal(t, CheckResult{Status: StatusFail, LatencyMs: body.Checks["b"].LatencyMs, Error: "broken"}, body.Checks["b"])
+}
+
+func TestReadiness_SlowCheckTimesOut(t *testing.T) {
+	h := NewChecker(20 * time.Millisecond)
+	h.Add("slow", func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	status, body := probe(t, h)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+	assert.Equal(t, errTimeout.Error(), body.Checks["slow"].Error)
+}
+
+func TestReadiness_ShuttingDown(t *testing.T) {
+	ran := false
+	h := NewChecker(time.Second)
+	h.Add("a", func(context.Context) error {
+		ran = true
+		return nil
+	})
+	h.SetShuttingDown()
+
+	status, body := probe(t, h)
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+	assert.Equal(t, "shutting_down", body.Status)
+	assert.False(t, ran)
+}
+
+func TestDatabaseChecks(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, DatabaseCheck(db)(ctx))
+	assert.True(t, errors.Is(MigrationsCheck(db)(ctx), database.ErrMigrationsPending))
+
+	if err := database.InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, MigrationsCheck(db)(ctx))
+
+	db.Close()
+	assert.Error(t, DatabaseCheck(db)(ctx))
+}
+
+func TestDiskSpaceCheck(t *testing.T) {
+	path := t.TempDir() + "/users.db"
+	ctx := context.Background()
+	assert.NoError(t, DiskSpaceCheck(path, 1)(ctx))
+	assert.ErrorContains(t, DiskSpaceCheck(path, 1<<62)(ctx), "MB free")
+}
+
+func TestLiveness(t *testing.T) {
+	h := NewChecker(time.Second)
+	h.Add("broken", func(context.Context) error { return errors.New("broken") })
+	h.SetShuttingDown()
+
+	app := fiber.New()
+	app.Get("/healthz", h.Liveness())
+	resp, err := app.Test(httptest.NewRequest("GET", "/healthz", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,57 @@
+package domain
+
+import "time"
+
+// DefaultRateLimitTier is the rate limit tier of keys issued without one
+const DefaultRateLimitTier = "standard"
+
+// APIKey is a credential issued to a service-to-service client. Only a hash
+// of the secret is stored; the secret itself is shown once, when issued.
+type APIKey struct {
+	ID   int
+	Name string
+	// Prefix is the start of the secret, kept so a key can be recognised
+	Prefix  string
+	KeyHash string
+	// Scopes are the permissions the key grants; keys have no roles
+	Scopes []Permission
+	// RateLimitTier selects the key's rate limits and daily quota
+	RateLimitTier string
+	CreatedBy     string
+	CreatedAt     time.Time
+	ExpiresAt     *time.Time
+	LastUsedAt    *time.Time
+	RevokedAt     *time.Time
+}
+
+// IsExpired reports whether the key has passed its expiry at now
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// IsRevoked reports whether the key has been revoked
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Validate validates the API key entity
+func (k *APIKey) Validate() error {
+	if k.Name == "" {
+		return ErrAPIKeyNameRequired
+	}
+	if k.RateLimitTier == "" {
+		return ErrAPIKeyTierRequired
+	}
+	if len(k.Scopes) == 0 {
+		return ErrAPIKeyScopesRequired
+	}
+	for _, scope := range k.Scopes {
+		if !scope.IsKnown() {
+			return ErrInvalidAPIKeyScope
+		}
+	}
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(k.CreatedAt) {
+		return ErrInvalidAPIKeyExpiry
+	}
+	return nil
+}
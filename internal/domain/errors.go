@@ -10,7 +10,55 @@ var (
 	ErrEmailRequired       = errors.New("email is required")
 	ErrInvalidEmail        = errors.New("invalid email format")
 	ErrDuplicateEmail      = errors.New("email already exists")
+	ErrVersionConflict     = errors.New("user was modified by another request")
 	ErrInvalidUserID       = errors.New("invalid user ID")
 	ErrInvalidMemberLevel  = errors.New("invalid member level")
 	ErrInvalidPointBalance = errors.New("point balance cannot be negative")
+
+	ErrInvalidPointAmount          = errors.New("invalid point amount")
+	ErrInvalidPointTransactionType = errors.New("invalid point transaction type")
+
+	ErrInvalidSortField  = errors.New("invalid sort field")
+	ErrInvalidCursor     = errors.New("invalid pagination cursor")
+	ErrInvalidPagination = errors.New("invalid pagination parameters")
+	ErrInvalidFilter     = errors.New("invalid filter parameters")
+	ErrInvalidSearch     = errors.New("search query is required")
+
+	ErrForbidden = errors.New("forbidden")
+
+	ErrAPIKeyNotFound       = errors.New("API key not found")
+	ErrAPIKeyNameRequired   = errors.New("API key name is required")
+	ErrAPIKeyScopesRequired = errors.New("API key needs at least one scope")
+	ErrAPIKeyTierRequired   = errors.New("API key rate limit tier is required")
+	ErrInvalidAPIKeyScope   = errors.New("invalid API key scope")
+	ErrInvalidAPIKeyExpiry  = errors.New("API key expiry must be in the future")
+	ErrInvalidAPIKey        = errors.New("invalid API key")
+
+	ErrUserImportNotFound = errors.New("import not found")
+	ErrInvalidImportFile  = errors.New("invalid import file")
+
+	ErrInvalidBatch          = errors.New("invalid batch")
+	ErrInvalidBatchOperation = errors.New("invalid batch operation")
+	ErrBatchRolledBack       = errors.New("not applied: another operation of the atomic batch failed")
+
+	ErrWebhookNotFound         = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidWebhookURL       = errors.New("webhook URL must be an absolute http or https URL")
+	ErrInvalidEventType        = errors.New("invalid event type")
+	ErrInvalidLastEventID      = errors.New("invalid Last-Event-ID: must be an event ID")
 )
+
+// ForbiddenError reports an action the caller lacks a permission for. It
+// matches ErrForbidden with errors.Is.
+type ForbiddenError struct {
+	Permission Permission
+}
+
+func (e *ForbiddenError) Error() string {
+	return "missing permission: " + string(e.Permission)
+}
+
+// Is makes errors.Is(err, ErrForbidden) hold for every ForbiddenError
+func (e *ForbiddenError) Is(target error) bool {
+	return target == ErrForbidden
+}
@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// User lifecycle event types
+const (
+	EventUserCreated     = "user.created"
+	EventUserUpdated     = "user.updated"
+	EventUserDeleted     = "user.deleted"
+	EventUserRestored    = "user.restored"
+	EventUserTierChanged = "user.tier_changed"
+	// EventUserPointsChanged is a change of a user's point balance, through
+	// the ledger or an update
+	EventUserPointsChanged = "user.points_changed"
+)
+
+// EventTypes lists every event type
+var EventTypes = []string{
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserDeleted,
+	EventUserRestored,
+	EventUserTierChanged,
+	EventUserPointsChanged,
+}
+
+// IsEventType reports whether t is one of EventTypes
+func IsEventType(t string) bool {
+	for _, eventType := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a change to a user, recorded in the outbox in the same
+// transaction as the change itself
+type Event struct {
+	ID     int
+	Type   string
+	UserID int
+	// Data is the JSON payload describing the change
+	Data      []byte
+	CreatedAt time.Time
+}
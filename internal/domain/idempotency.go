@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// IdempotencyKey is an Idempotency-Key a client sent with a request, and
+// the response to replay when the request is retried
+type IdempotencyKey struct {
+	Client string
+	Key    string
+	// Fingerprint identifies the request the key was first sent with
+	Fingerprint string
+	// Status is the response status, or 0 while the request is running
+	Status    int
+	Headers   map[string]string
+	Body      []byte
+	CreatedAt time.Time
+	// ExpiresAt is when the key may be used afresh; while the request is
+	// running it bounds how long a crashed request holds the key
+	ExpiresAt time.Time
+}
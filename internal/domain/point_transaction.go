@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+// PointTransactionType identifies the kind of ledger entry
+type PointTransactionType string
+
+// Point transaction types
+const (
+	PointTransactionEarn   PointTransactionType = "earn"
+	PointTransactionRedeem PointTransactionType = "redeem"
+	PointTransactionAdjust PointTransactionType = "adjust"
+)
+
+// PointTransaction represents a single entry in a member's points ledger.
+// Amount is signed: earnings are positive, redemptions are negative and
+// adjustments may be either.
+type PointTransaction struct {
+	ID           int
+	UserID       int
+	Type         PointTransactionType
+	Amount       int
+	BalanceAfter int
+	Description  string
+	CreatedAt    time.Time
+}
+
+// Validate validates the point transaction entity
+func (t *PointTransaction) Validate() error {
+	if t.UserID <= 0 {
+		return ErrInvalidUserID
+	}
+	switch t.Type {
+	case PointTransactionEarn:
+		if t.Amount <= 0 {
+			return ErrInvalidPointAmount
+		}
+	case PointTransactionRedeem:
+		if t.Amount >= 0 {
+			return ErrInvalidPointAmount
+		}
+	case PointTransactionAdjust:
+		if t.Amount == 0 {
+			return ErrInvalidPointAmount
+		}
+	default:
+		return ErrInvalidPointTransactionType
+	}
+	return nil
+}
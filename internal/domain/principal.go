@@ -0,0 +1,57 @@
+package domain
+
+// Permission is the right to perform one kind of action
+type Permission string
+
+// User API permissions
+const (
+	// PermUsersRead allows reading and searching active users and their ledger
+	PermUsersRead Permission = "users:read"
+	// PermUsersReadDeleted allows listing and reading soft-deleted users
+	PermUsersReadDeleted Permission = "users:read_deleted"
+	// PermUsersCreate allows creating users with no opening balance
+	PermUsersCreate Permission = "users:create"
+	// PermUsersEditContact allows changing name, email, phone, address and avatar
+	PermUsersEditContact Permission = "users:edit_contact"
+	// PermUsersEditPoints allows changing point_balance and member_level and
+	// recording ledger transactions
+	PermUsersEditPoints Permission = "users:edit_points"
+	// PermUsersDelete allows deleting and restoring users
+	PermUsersDelete Permission = "users:delete"
+	// PermAPIKeysManage allows issuing, listing and revoking API keys
+	PermAPIKeysManage Permission = "api_keys:manage"
+	// PermWebhooksManage allows managing webhook subscriptions and replaying
+	// their deliveries
+	PermWebhooksManage Permission = "webhooks:manage"
+)
+
+// Permissions lists every permission
+var Permissions = []Permission{
+	PermUsersRead,
+	PermUsersReadDeleted,
+	PermUsersCreate,
+	PermUsersEditContact,
+	PermUsersEditPoints,
+	PermUsersDelete,
+	PermAPIKeysManage,
+	PermWebhooksManage,
+}
+
+// IsKnown reports whether the permission is one of Permissions
+func (p Permission) IsKnown() bool {
+	for _, permission := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal is the authenticated caller an action is performed for
+type Principal struct {
+	Subject string
+	Roles   []string
+	// Scopes are permissions granted directly rather than through a role,
+	// as for API keys
+	Scopes []Permission
+}
@@ -1,11 +1,164 @@
 package domain
 
-// UserRepository defines the interface for user data operations
+import (
+	"context"
+	"time"
+)
+
+// UserRepository defines the interface for user data operations. Reads only
+// see active users; soft-deleted users are reached through FindDeletedByID or
+// a filter with IncludeDeleted. Every method gives up when ctx is done,
+// returning ctx.Err().
 type UserRepository interface {
-	FindAll() ([]*User, error)
-	FindByID(id int) (*User, error)
-	FindByEmail(email string) (*User, error)
-	Create(user *User) error
-	Update(user *User) error
-	Delete(id int) error
+	FindAll(ctx context.Context) ([]*User, error)
+	// FindPage returns the users matching the query in the query's sort order
+	FindPage(ctx context.Context, query UserListQuery) ([]*User, error)
+	// Each calls fn with every user matching the filter in sort order,
+	// reading them a batch at a time, and stops at the first error fn
+	// returns. Users changed while it runs may be seen in either state.
+	Each(ctx context.Context, filter UserFilter, sort []SortField, fn func(*User) error) error
+	// Count returns the number of users matching the filter
+	Count(ctx context.Context, filter UserFilter) (int, error)
+	FindByID(ctx context.Context, id int) (*User, error)
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	// Search finds users by any fragment of name, email, phone or address,
+	// best matches first
+	Search(ctx context.Context, query string, limit int) ([]*UserSearchResult, error)
+	Create(ctx context.Context, user *User) error
+	// CreateBatch creates the users in one transaction. A user whose email
+	// is taken is skipped and its entry in the returned slice set to
+	// ErrDuplicateEmail; any other failure rolls the whole batch back.
+	CreateBatch(ctx context.Context, users []*User) ([]error, error)
+	// ExistingEmails returns which of emails belong to active users
+	ExistingEmails(ctx context.Context, emails []string) (map[string]bool, error)
+	// Update saves the user if its stored version still equals user.Version,
+	// then increments user.Version; otherwise it returns ErrVersionConflict
+	Update(ctx context.Context, user *User) error
+	// Delete soft-deletes the user if its stored version equals version,
+	// otherwise it returns ErrVersionConflict
+	Delete(ctx context.Context, id int, version int) error
+	// FindDeletedByID retrieves a soft-deleted user by ID
+	FindDeletedByID(ctx context.Context, id int) (*User, error)
+	// Restore undoes a soft delete if the stored version equals version. It
+	// returns ErrDuplicateEmail if an active user has taken the email since.
+	Restore(ctx context.Context, id int, version int) error
+	// Purge permanently removes users soft-deleted before the given time,
+	// along with their ledger entries and outbox events, and returns how many
+	// were removed
+	Purge(ctx context.Context, before time.Time) (int, error)
+	// InTransaction calls fn with a variant of the repository whose calls
+	// all run in one transaction, committed if fn returns nil and rolled
+	// back otherwise. A call that fails inside it undoes only its own
+	// writes, so fn may carry on after an expected error.
+	InTransaction(ctx context.Context, fn func(UserRepository) error) error
+	// AppendEvents records events in the outbox; within InTransaction they
+	// are stored exactly when the change they describe is
+	AppendEvents(ctx context.Context, events ...*Event) error
+}
+
+// PointTransactionRepository defines the interface for points ledger operations
+type PointTransactionRepository interface {
+	// Record applies the transaction amount to the user's balance and appends
+	// the ledger entry atomically. It fills in ID, BalanceAfter and CreatedAt.
+	// apply, if not nil, is called within the transaction with the user as
+	// the entry leaves them and the filled in entry. It may change the user's
+	// member level, which is saved with the balance, and the events it
+	// returns are written to the outbox in the same transaction.
+	Record(ctx context.Context, tx *PointTransaction, apply func(*User, *PointTransaction) []*Event) error
+	FindByUserID(ctx context.Context, userID int) ([]*PointTransaction, error)
+}
+
+// APIKeyRepository defines the interface for API key storage
+type APIKeyRepository interface {
+	// Create stores the key and fills in its ID
+	Create(ctx context.Context, key *APIKey) error
+	FindAll(ctx context.Context) ([]*APIKey, error)
+	FindByID(ctx context.Context, id int) (*APIKey, error)
+	// FindByHash retrieves the key whose secret hashes to hash, revoked or not
+	FindByHash(ctx context.Context, hash string) (*APIKey, error)
+	// Revoke marks the key revoked at the given time unless it already is
+	Revoke(ctx context.Context, id int, at time.Time) error
+	// TouchLastUsed records that the key was used at the given time
+	TouchLastUsed(ctx context.Context, id int, at time.Time) error
+}
+
+// UserImportRepository stores bulk imports and the rows they rejected
+type UserImportRepository interface {
+	// Create stores a started import and fills in its ID
+	Create(ctx context.Context, imp *UserImport) error
+	// Finish stores the import's counts and finish time
+	Finish(ctx context.Context, imp *UserImport) error
+	FindByID(ctx context.Context, id int) (*UserImport, error)
+	// AddRejections appends rejected rows to the import's report
+	AddRejections(ctx context.Context, importID int, rejections []*ImportRejection) error
+	// EachRejection calls fn with the import's rejected rows in line order,
+	// stopping at the first error fn returns
+	EachRejection(ctx context.Context, importID int, fn func(*ImportRejection) error) error
+}
+
+// QuotaRepository persists request counts against daily quotas
+type QuotaRepository interface {
+	// Consume counts one request by client on day, a UTC date such as
+	// "2024-01-31", unless limit requests were already counted. It returns
+	// the count and whether the request was within the limit. Counts of
+	// earlier days are deleted.
+	Consume(ctx context.Context, client, day string, limit int) (int, bool, error)
+}
+
+// IdempotencyRepository stores Idempotency-Key values and their responses
+type IdempotencyRepository interface {
+	// Reserve stores key as running, unless the client holds an unexpired
+	// key of the same name, which it returns instead
+	Reserve(ctx context.Context, key *IdempotencyKey) (*IdempotencyKey, error)
+	// Complete stores the response and new expiry of a key Reserve stored
+	Complete(ctx context.Context, key *IdempotencyKey) error
+	// Release deletes a key whose request is still running
+	Release(ctx context.Context, client, key string) error
+	// DeleteExpired deletes the keys that expired before the given time and
+	// returns how many there were
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+// WebhookRepository stores webhook subscriptions and the delivery of outbox
+// events to them
+type WebhookRepository interface {
+	// CreateSubscription stores the subscription and fills in its ID
+	CreateSubscription(ctx context.Context, sub *WebhookSubscription) error
+	FindSubscriptions(ctx context.Context) ([]*WebhookSubscription, error)
+	FindSubscriptionByID(ctx context.Context, id int) (*WebhookSubscription, error)
+	// DeleteSubscription deletes the subscription and its deliveries
+	DeleteSubscription(ctx context.Context, id int) error
+	// EnqueueDeliveries takes up to limit outbox events not yet enqueued and
+	// creates a pending delivery, due at now, for every subscription that
+	// wants each. It returns how many events it took.
+	EnqueueDeliveries(ctx context.Context, now time.Time, limit int) (int, error)
+	// FindDueDeliveries returns up to limit pending deliveries due by now,
+	// oldest first, with their events
+	FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error)
+	// UpdateDelivery stores the outcome of a delivery attempt
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// FindDeliveries returns up to limit deliveries of the subscription,
+	// newest first, only those in status unless it is empty
+	FindDeliveries(ctx context.Context, subscriptionID int, status string, limit int) ([]*WebhookDelivery, error)
+	FindDeliveryByID(ctx context.Context, id int) (*WebhookDelivery, error)
+	// RequeueDelivery makes a delivery pending again, due at now, with its
+	// attempts reset
+	RequeueDelivery(ctx context.Context, id int, now time.Time) error
+	// RequeueDeadDeliveries requeues every dead delivery of the subscription
+	// and returns how many there were
+	RequeueDeadDeliveries(ctx context.Context, subscriptionID int, now time.Time) (int, error)
+	// DeleteDeliveredEvents deletes the outbox events created before the
+	// given time that have been fanned out and delivered to every
+	// subscription that wanted them, along with those deliveries, and
+	// returns how many events there were
+	DeleteDeliveredEvents(ctx context.Context, before time.Time) (int, error)
+}
+
+// EventRepository reads the outbox as a log of events
+type EventRepository interface {
+	// FindAfter returns up to limit events with IDs above afterID, in order,
+	// only those of the given types unless there are none
+	FindAfter(ctx context.Context, afterID int, types []string, limit int) ([]*Event, error)
+	// LastID returns the ID of the latest event, 0 if there are none
+	LastID(ctx context.Context) (int, error)
 }
@@ -15,6 +15,10 @@ type User struct {
 	PointBalance int
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	// Version increases on every change and backs optimistic concurrency
+	Version int
+	// DeletedAt is set while the user is soft-deleted and awaiting purge
+	DeletedAt *time.Time
 }
 
 // Validate validates the user entity
@@ -28,6 +32,9 @@ func (u *User) Validate() error {
 	if u.Email == "" {
 		return ErrEmailRequired
 	}
+	if u.PointBalance < 0 {
+		return ErrInvalidPointBalance
+	}
 	return nil
 }
 
@@ -36,6 +43,11 @@ func (u *User) GetFullName() string {
 	return u.FirstName + " " + u.LastName
 }
 
+// IsDeleted checks if user has been soft-deleted
+func (u *User) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
 // IsActive checks if user has member level
 func (u *User) IsActive() bool {
 	return u.MemberLevel != ""
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// UserImport records one bulk import of users and its outcome
+type UserImport struct {
+	ID int
+	// Format is the file format, "csv" or "ndjson"
+	Format string
+	// DryRun imports validate every row but insert nothing
+	DryRun bool
+	// Total counts the rows read, Imported those inserted, or that would
+	// have been in a dry run, and Rejected the rest
+	Total     int
+	Imported  int
+	Rejected  int
+	CreatedBy string
+	CreatedAt time.Time
+	// FinishedAt is nil while the import is running, or if it failed
+	FinishedAt *time.Time
+}
+
+// ImportRejection is a row an import did not insert, and why
+type ImportRejection struct {
+	// Line is the row's line in the file, counting a CSV header as line 1
+	Line   int
+	Email  string
+	Reason string
+}
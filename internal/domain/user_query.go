@@ -0,0 +1,63 @@
+package domain
+
+import "time"
+
+// UserSortFields lists the user fields a listing can be sorted on
+var UserSortFields = []string{
+	"id",
+	"first_name",
+	"last_name",
+	"email",
+	"phone",
+	"address",
+	"avatar",
+	"member_level",
+	"point_balance",
+	"created_at",
+	"updated_at",
+}
+
+// SortField is one key of a multi-key sort
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// UserFilter narrows a user listing. Nil bounds are not applied.
+// Soft-deleted users are left out unless IncludeDeleted is set.
+type UserFilter struct {
+	MemberLevel    string
+	PointsMin      *int
+	PointsMax      *int
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	IncludeDeleted bool
+}
+
+// UserCursor marks a position in a sorted user listing for keyset pagination.
+// Values holds the boundary row's value for each field of the query's Sort,
+// in the same order. Backward fetches the rows before the boundary instead
+// of after it.
+type UserCursor struct {
+	Values   []interface{}
+	Backward bool
+}
+
+// UserListQuery describes a page of users to fetch. Sort must end with a
+// unique field (normally id) so that keyset cursors are unambiguous.
+type UserListQuery struct {
+	Filter UserFilter
+	Sort   []SortField
+	Limit  int
+	Offset int
+	Cursor *UserCursor
+}
+
+// UserSearchResult is one ranked hit of a member search. Highlights maps a
+// matched field name to its value as HTML, escaped and with matches wrapped
+// in <mark></mark>; lower Rank values are better matches.
+type UserSearchResult struct {
+	User       *User
+	Rank       float64
+	Highlights map[string]string
+}
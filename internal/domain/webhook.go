@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Webhook delivery states
+const (
+	// DeliveryPending deliveries are due at NextAttemptAt
+	DeliveryPending = "pending"
+	// DeliveryDelivered deliveries were accepted with a 2xx response
+	DeliveryDelivered = "delivered"
+	// DeliveryDead deliveries failed every attempt and wait for a replay
+	DeliveryDead = "dead"
+)
+
+// WebhookSubscription is an endpoint that events are delivered to
+type WebhookSubscription struct {
+	ID  int
+	URL string
+	// EventTypes are the events delivered; empty means every event
+	EventTypes  []string
+	Description string
+	// Secret is the key deliveries are signed with
+	Secret    string
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+// Validate validates the subscription's URL and event types
+func (s *WebhookSubscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	for _, eventType := range s.EventTypes {
+		if !IsEventType(eventType) {
+			return ErrInvalidEventType
+		}
+	}
+	return nil
+}
+
+// Wants reports whether events of the type are delivered to the subscription
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if strings.EqualFold(t, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is the delivery of one event to one subscription
+type WebhookDelivery struct {
+	ID             int
+	SubscriptionID int
+	Event          *Event
+	Status         string
+	Attempts       int
+	// NextAttemptAt is when a pending delivery is next tried
+	NextAttemptAt *time.Time
+	// LastStatusCode is the response status of the last attempt, 0 if none
+	// was received
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
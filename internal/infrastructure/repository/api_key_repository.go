@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// sqliteAPIKeyRepository implements domain.APIKeyRepository
+type sqliteAPIKeyRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteAPIKeyRepository creates a new SQLite API key repository
+func NewSQLiteAPIKeyRepository(db *sql.DB) domain.APIKeyRepository {
+	return &sqliteAPIKeyRepository{db: db}
+}
+
+// apiKeyColumns is the column list shared by every api_keys SELECT, in scanAPIKey order
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, rate_limit_tier, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (*domain.APIKey, error) {
+	key := &domain.APIKey{}
+	var scopes string
+	var createdBy sql.NullString
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.RateLimitTier,
+		&createdBy,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.CreatedBy = createdBy.String
+	for _, scope := range strings.Fields(scopes) {
+		key.Scopes = append(key.Scopes, domain.Permission(scope))
+	}
+	return key, nil
+}
+
+// joinScopes stores scopes as a space-separated list, the OAuth scope form
+func joinScopes(scopes []domain.Permission) string {
+	parts := make([]string, len(scopes))
+	for i, scope := range scopes {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " ")
+}
+
+// utcOrNil converts an optional time to UTC for storage
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// Create stores a new API key
+func (r *sqliteAPIKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	query := `INSERT INTO api_keys (name, prefix, key_hash, scopes, rate_limit_tier, created_by, created_at, expires_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		joinScopes(key.Scopes),
+		key.RateLimitTier,
+		key.CreatedBy,
+		key.CreatedAt.UTC(),
+		utcOrNil(key.ExpiresAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	key.ID = int(id)
+	return nil
+}
+
+// FindAll retrieves every API key, newest first
+func (r *sqliteAPIKeyRepository) FindAll(ctx context.Context) ([]*domain.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*domain.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// FindByID retrieves an API key by ID
+func (r *sqliteAPIKeyRepository) FindByID(ctx context.Context, id int) (*domain.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+// FindByHash retrieves an API key by the hash of its secret
+func (r *sqliteAPIKeyRepository) FindByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+// Revoke marks an API key revoked; revoking it again keeps the first time
+func (r *sqliteAPIKeyRepository) Revoke(ctx context.Context, id int, at time.Time) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`, at.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed records when an API key was last used
+func (r *sqliteAPIKeyRepository) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, at.UTC(), id)
+	return err
+}
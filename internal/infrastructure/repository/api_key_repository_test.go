@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyRepository_CreateAndFind(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := NewSQLiteAPIKeyRepository(db)
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	key := &domain.APIKey{
+		Name:      "POS backend",
+		Prefix:    "wk_abcdefgh",
+		KeyHash:   "hash-1",
+		Scopes:    []domain.Permission{domain.PermUsersRead, domain.PermUsersEditPoints},
+		CreatedBy: "admin-1",
+		CreatedAt: time.Now(),
+		ExpiresAt: &expiresAt,
+	}
+	assert.NoError(t, repo.Create(ctx, key))
+	assert.NotZero(t, key.ID)
+
+	found, err := repo.FindByHash(ctx, "hash-1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, key.ID, found.ID)
+		assert.Equal(t, "POS backend", found.Name)
+		assert.Equal(t, key.Scopes, found.Scopes)
+		assert.Equal(t, "admin-1", found.CreatedBy)
+		assert.WithinDuration(t, expiresAt, *found.ExpiresAt, time.Second)
+		assert.Nil(t, found.LastUsedAt)
+		assert.Nil(t, found.RevokedAt)
+	}
+
+	missing, err := repo.FindByHash(ctx, "no-such-hash")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// Secrets are unique by hash
+	assert.Error(t, repo.Create(ctx, &domain.APIKey{Name: "dup", Prefix: "wk_x", KeyHash: "hash-1", Scopes: key.Scopes, CreatedAt: time.Now()}))
+}
+
+func TestAPIKeyRepository_RevokeAndTouch(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := NewSQLiteAPIKeyRepository(db)
+
+	key := &domain.APIKey{Name: "shop", Prefix: "wk_x", KeyHash: "h", Scopes: []domain.Permission{domain.PermUsersRead}, CreatedAt: time.Now()}
+	assert.NoError(t, repo.Create(ctx, key))
+
+	usedAt := time.Now()
+	assert.NoError(t, repo.TouchLastUsed(ctx, key.ID, usedAt))
+
+	first := time.Now()
+	assert.NoError(t, repo.Revoke(ctx, key.ID, first))
+	// Revoking again keeps the original time
+	assert.NoError(t, repo.Revoke(ctx, key.ID, first.Add(time.Hour)))
+	assert.Equal(t, domain.ErrAPIKeyNotFound, repo.Revoke(ctx, 999, first))
+
+	found, err := repo.FindByID(ctx, key.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.WithinDuration(t, usedAt, *found.LastUsedAt, time.Second)
+		assert.WithinDuration(t, first, *found.RevokedAt, time.Second)
+		assert.True(t, found.IsRevoked())
+	}
+
+	keys, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
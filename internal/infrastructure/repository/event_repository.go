@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"workshop_4/internal/domain"
+)
+
+// sqliteEventRepository implements domain.EventRepository over the outbox
+type sqliteEventRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteEventRepository creates a new SQLite event log repository
+func NewSQLiteEventRepository(db *sql.DB) domain.EventRepository {
+	return &sqliteEventRepository{db: db}
+}
+
+// FindAfter retrieves the events following afterID, oldest first
+func (r *sqliteEventRepository) FindAfter(ctx context.Context, afterID int, types []string, limit int) ([]*domain.Event, error) {
+	query := `SELECT id, type, user_id, data, created_at FROM outbox_events WHERE id > ?`
+	args := []interface{}{afterID}
+	if len(types) > 0 {
+		query += ` AND type IN (?` + strings.Repeat(", ?", len(types)-1) + `)`
+		for _, t := range types {
+			args = append(args, t)
+		}
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.Event
+	for rows.Next() {
+		event := &domain.Event{}
+		var data string
+		if err := rows.Scan(&event.ID, &event.Type, &event.UserID, &data, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Data = []byte(data)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// LastID returns the ID of the latest event
+func (r *sqliteEventRepository) LastID(ctx context.Context) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM outbox_events`).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventRepository_FindAfter(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	users := NewSQLiteUserRepository(db)
+	repo := NewSQLiteEventRepository(db)
+
+	last, err := repo.LastID(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, last)
+
+	var logged []*domain.Event
+	for _, eventType := range []string{domain.EventUserCreated, domain.EventUserPointsChanged, domain.EventUserUpdated, domain.EventUserPointsChanged} {
+		logged = append(logged, &domain.Event{Type: eventType, UserID: 7, Data: []byte(`{"user_id":7}`), CreatedAt: time.Now()})
+	}
+	assert.NoError(t, users.AppendEvents(ctx, logged...))
+
+	last, err = repo.LastID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, logged[3].ID, last)
+
+	events, err := repo.FindAfter(ctx, logged[0].ID, nil, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, logged[1].ID, events[0].ID)
+		assert.Equal(t, domain.EventUserPointsChanged, events[0].Type)
+		assert.Equal(t, 7, events[0].UserID)
+		assert.JSONEq(t, `{"user_id":7}`, string(events[0].Data))
+		assert.Equal(t, logged[2].ID, events[1].ID)
+	}
+
+	// Only the types asked for, still in order
+	events, err = repo.FindAfter(ctx, 0, []string{domain.EventUserPointsChanged}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, logged[1].ID, events[0].ID)
+		assert.Equal(t, logged[3].ID, events[1].ID)
+	}
+
+	events, err = repo.FindAfter(ctx, last, nil, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
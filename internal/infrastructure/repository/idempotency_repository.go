@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// sqliteIdempotencyRepository implements domain.IdempotencyRepository
+type sqliteIdempotencyRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteIdempotencyRepository creates a new SQLite idempotency key repository
+func NewSQLiteIdempotencyRepository(db *sql.DB) domain.IdempotencyRepository {
+	return &sqliteIdempotencyRepository{db: db}
+}
+
+// Reserve inserts the key, or takes over an expired one, in one statement so
+// that of two concurrent requests with the same key only one runs. The
+// upsert returns no row when the existing key has not expired.
+func (r *sqliteIdempotencyRepository) Reserve(ctx context.Context, key *domain.IdempotencyKey) (*domain.IdempotencyKey, error) {
+	query := `INSERT INTO idempotency_keys (client, idempotency_key, fingerprint, status, created_at, expires_at)
+	          VALUES (?, ?, ?, 0, ?, ?)
+	          ON CONFLICT (client, idempotency_key) DO UPDATE SET
+	              fingerprint = excluded.fingerprint, status = 0, headers = NULL, body = NULL,
+	              created_at = excluded.created_at, expires_at = excluded.expires_at
+	          WHERE idempotency_keys.expires_at <= excluded.created_at
+	          RETURNING status`
+
+	// The existing key can expire or be released between the two statements,
+	// in which case the insert is tried again
+	for {
+		var status int
+		err := r.db.QueryRowContext(ctx, query, key.Client, key.Key, key.Fingerprint, key.CreatedAt.UTC(), key.ExpiresAt.UTC()).Scan(&status)
+		if err == nil {
+			return nil, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		existing, err := r.find(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return existing, nil
+		}
+	}
+}
+
+// find retrieves the unexpired key of the same client and name as key
+func (r *sqliteIdempotencyRepository) find(ctx context.Context, key *domain.IdempotencyKey) (*domain.IdempotencyKey, error) {
+	query := `SELECT fingerprint, status, headers, body, created_at, expires_at FROM idempotency_keys
+	          WHERE client = ? AND idempotency_key = ? AND expires_at > ?`
+
+	existing := &domain.IdempotencyKey{Client: key.Client, Key: key.Key}
+	var headers sql.NullString
+	err := r.db.QueryRowContext(ctx, query, key.Client, key.Key, key.CreatedAt.UTC()).Scan(
+		&existing.Fingerprint,
+		&existing.Status,
+		&headers,
+		&existing.Body,
+		&existing.CreatedAt,
+		&existing.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if headers.Valid {
+		if err := json.Unmarshal([]byte(headers.String), &existing.Headers); err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// Complete stores the response of a running key
+func (r *sqliteIdempotencyRepository) Complete(ctx context.Context, key *domain.IdempotencyKey) error {
+	headers, err := json.Marshal(key.Headers)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `UPDATE idempotency_keys SET status = ?, headers = ?, body = ?, expires_at = ?
+	                                WHERE client = ? AND idempotency_key = ? AND fingerprint = ? AND status = 0`,
+		key.Status, string(headers), key.Body, key.ExpiresAt.UTC(), key.Client, key.Key, key.Fingerprint)
+	return err
+}
+
+// Release deletes a running key
+func (r *sqliteIdempotencyRepository) Release(ctx context.Context, client, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE client = ? AND idempotency_key = ? AND status = 0`, client, key)
+	return err
+}
+
+// DeleteExpired deletes the keys that expired before the given time
+func (r *sqliteIdempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyRepository(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := NewSQLiteIdempotencyRepository(db)
+
+	now := time.Now()
+	key := func(client, fingerprint string, at time.Time) *domain.IdempotencyKey {
+		return &domain.IdempotencyKey{Client: client, Key: "order-1", Fingerprint: fingerprint,
+			CreatedAt: at, ExpiresAt: at.Add(time.Minute)}
+	}
+
+	existing, err := repo.Reserve(ctx, key("api_key:1", "a", now))
+	assert.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// Running: the second request sees the reservation
+	existing, err = repo.Reserve(ctx, key("api_key:1", "b", now))
+	assert.NoError(t, err)
+	if assert.NotNil(t, existing) {
+		assert.Equal(t, "a", existing.Fingerprint)
+		assert.Zero(t, existing.Status)
+	}
+
+	// Keys are per client
+	existing, _ = repo.Reserve(ctx, key("api_key:2", "a", now))
+	assert.Nil(t, existing)
+
+	done := key("api_key:1", "a", now)
+	done.Status = 201
+	done.Headers = map[string]string{"Content-Type": "application/json"}
+	done.Body = []byte(`{"success":true}`)
+	done.ExpiresAt = now.Add(time.Hour)
+	assert.NoError(t, repo.Complete(ctx, done))
+
+	// Completed keys are not released
+	assert.NoError(t, repo.Release(ctx, "api_key:1", "order-1"))
+	existing, _ = repo.Reserve(ctx, key("api_key:1", "a", now.Add(30*time.Minute)))
+	if assert.NotNil(t, existing) {
+		assert.Equal(t, 201, existing.Status)
+		assert.Equal(t, done.Headers, existing.Headers)
+		assert.Equal(t, done.Body, existing.Body)
+	}
+
+	// Expired keys are taken over, and running ones released
+	existing, _ = repo.Reserve(ctx, key("api_key:1", "c", now.Add(2*time.Hour)))
+	assert.Nil(t, existing)
+	assert.NoError(t, repo.Release(ctx, "api_key:1", "order-1"))
+	existing, _ = repo.Reserve(ctx, key("api_key:1", "d", now.Add(2*time.Hour)))
+	assert.Nil(t, existing)
+
+	deleted, err := repo.DeleteExpired(ctx, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted, "api_key:2's reservation")
+}
@@ -0,0 +1,551 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"workshop_4/internal/domain"
+	"workshop_4/logging"
+)
+
+// Observer is called as a repository method starts, with the call's context
+// and the repository and method name, and returns a function to call with
+// the method's error when it returns
+type Observer func(ctx context.Context, repository, method string) func(err error)
+
+// expectedErrors are outcomes repositories report through errors rather
+// than failures of the database
+var expectedErrors = []error{
+	domain.ErrUserNotFound,
+	domain.ErrVersionConflict,
+	domain.ErrDuplicateEmail,
+	domain.ErrInvalidPointBalance,
+	domain.ErrInvalidSortField,
+	domain.ErrInvalidCursor,
+	domain.ErrAPIKeyNotFound,
+	domain.ErrUserImportNotFound,
+	domain.ErrWebhookNotFound,
+	domain.ErrWebhookDeliveryNotFound,
+}
+
+// IsDatabaseError reports whether a repository call failed, as opposed to
+// succeeding or reporting one of expectedErrors
+func IsDatabaseError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, expected := range expectedErrors {
+		if errors.Is(err, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoggingObserver logs every call at debug level, calls slower than slow at
+// warn and database failures at error, each with its duration. Calls made
+// for a request are logged with the request's logger from the context, so
+// they carry its request and trace IDs; others are logged with logger.
+func LoggingObserver(logger *slog.Logger, slow time.Duration) Observer {
+	return func(ctx context.Context, repository, method string) func(error) {
+		start := time.Now()
+		return func(err error) {
+			elapsed := time.Since(start)
+			attrs := []slog.Attr{
+				slog.String("repository", repository),
+				slog.String("method", method),
+				slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+			}
+			level := slog.LevelDebug
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+				if IsDatabaseError(err) {
+					level = slog.LevelError
+				}
+			}
+			if level < slog.LevelWarn && slow > 0 && elapsed >= slow {
+				level = slog.LevelWarn
+			}
+			callLogger, ok := logging.FromContext(ctx)
+			if !ok {
+				callLogger = logger
+			}
+			callLogger.LogAttrs(ctx, level, "repository call", attrs...)
+		}
+	}
+}
+
+// observers is the list of observers a repository reports to
+type observers []Observer
+
+// start starts every observer and returns a function ending them all
+func (o observers) start(ctx context.Context, repository, method string) func(error) {
+	ends := make([]func(error), len(o))
+	for i, observer := range o {
+		ends[i] = observer(ctx, repository, method)
+	}
+	return func(err error) {
+		for _, end := range ends {
+			end(err)
+		}
+	}
+}
+
+// observedUserRepository reports every call of a domain.UserRepository to
+// its observers
+type observedUserRepository struct {
+	next      domain.UserRepository
+	observers observers
+}
+
+// NewObservedUserRepository wraps a user repository so every call is
+// reported to the observers
+func NewObservedUserRepository(next domain.UserRepository, obs ...Observer) domain.UserRepository {
+	return &observedUserRepository{next: next, observers: obs}
+}
+
+func (r *observedUserRepository) FindAll(ctx context.Context) ([]*domain.User, error) {
+	end := r.observers.start(ctx, "users", "FindAll")
+	users, err := r.next.FindAll(ctx)
+	end(err)
+	return users, err
+}
+
+func (r *observedUserRepository) FindPage(ctx context.Context, query domain.UserListQuery) ([]*domain.User, error) {
+	end := r.observers.start(ctx, "users", "FindPage")
+	users, err := r.next.FindPage(ctx, query)
+	end(err)
+	return users, err
+}
+
+// Each is observed as the FindPage call of each batch rather than as a
+// whole, so that time spent in fn, such as writing to a slow client, and
+// fn's errors are not reported as the database's
+func (r *observedUserRepository) Each(ctx context.Context, filter domain.UserFilter, sort []domain.SortField, fn func(*domain.User) error) error {
+	return eachUser(ctx, r.FindPage, filter, sort, fn)
+}
+
+func (r *observedUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int, error) {
+	end := r.observers.start(ctx, "users", "Count")
+	count, err := r.next.Count(ctx, filter)
+	end(err)
+	return count, err
+}
+
+func (r *observedUserRepository) FindByID(ctx context.Context, id int) (*domain.User, error) {
+	end := r.observers.start(ctx, "users", "FindByID")
+	user, err := r.next.FindByID(ctx, id)
+	end(err)
+	return user, err
+}
+
+func (r *observedUserRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	end := r.observers.start(ctx, "users", "FindByEmail")
+	user, err := r.next.FindByEmail(ctx, email)
+	end(err)
+	return user, err
+}
+
+func (r *observedUserRepository) Search(ctx context.Context, query string, limit int) ([]*domain.UserSearchResult, error) {
+	end := r.observers.start(ctx, "users", "Search")
+	results, err := r.next.Search(ctx, query, limit)
+	end(err)
+	return results, err
+}
+
+func (r *observedUserRepository) Create(ctx context.Context, user *domain.User) error {
+	end := r.observers.start(ctx, "users", "Create")
+	err := r.next.Create(ctx, user)
+	end(err)
+	return err
+}
+
+func (r *observedUserRepository) CreateBatch(ctx context.Context, users []*domain.User) ([]error, error) {
+	end := r.observers.start(ctx, "users", "CreateBatch")
+	errs, err := r.next.CreateBatch(ctx, users)
+	end(err)
+	return errs, err
+}
+
+func (r *observedUserRepository) ExistingEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	end := r.observers.start(ctx, "users", "ExistingEmails")
+	existing, err := r.next.ExistingEmails(ctx, emails)
+	end(err)
+	return existing, err
+}
+
+func (r *observedUserRepository) Update(ctx context.Context, user *domain.User) error {
+	end := r.observers.start(ctx, "users", "Update")
+	err := r.next.Update(ctx, user)
+	end(err)
+	return err
+}
+
+func (r *observedUserRepository) Delete(ctx context.Context, id int, version int) error {
+	end := r.observers.start(ctx, "users", "Delete")
+	err := r.next.Delete(ctx, id, version)
+	end(err)
+	return err
+}
+
+func (r *observedUserRepository) FindDeletedByID(ctx context.Context, id int) (*domain.User, error) {
+	end := r.observers.start(ctx, "users", "FindDeletedByID")
+	user, err := r.next.FindDeletedByID(ctx, id)
+	end(err)
+	return user, err
+}
+
+func (r *observedUserRepository) Restore(ctx context.Context, id int, version int) error {
+	end := r.observers.start(ctx, "users", "Restore")
+	err := r.next.Restore(ctx, id, version)
+	end(err)
+	return err
+}
+
+func (r *observedUserRepository) Purge(ctx context.Context, before time.Time) (int, error) {
+	end := r.observers.start(ctx, "users", "Purge")
+	purged, err := r.next.Purge(ctx, before)
+	end(err)
+	return purged, err
+}
+
+func (r *observedUserRepository) AppendEvents(ctx context.Context, events ...*domain.Event) error {
+	end := r.observers.start(ctx, "outbox_events", "AppendEvents")
+	err := r.next.AppendEvents(ctx, events...)
+	end(err)
+	return err
+}
+
+// InTransaction is observed as a whole, and fn's repository reports every
+// call made in the transaction as well. An error fn returns is the
+// caller's, so only failures to begin or commit are reported.
+func (r *observedUserRepository) InTransaction(ctx context.Context, fn func(domain.UserRepository) error) error {
+	end := r.observers.start(ctx, "users", "InTransaction")
+	var fnErr error
+	err := r.next.InTransaction(ctx, func(tx domain.UserRepository) error {
+		fnErr = fn(&observedUserRepository{next: tx, observers: r.observers})
+		return fnErr
+	})
+	if err == fnErr {
+		end(nil)
+	} else {
+		end(err)
+	}
+	return err
+}
+
+// observedPointTransactionRepository reports every call of a
+// domain.PointTransactionRepository to its observers
+type observedPointTransactionRepository struct {
+	next      domain.PointTransactionRepository
+	observers observers
+}
+
+// NewObservedPointTransactionRepository wraps a points ledger repository so
+// every call is reported to the observers
+func NewObservedPointTransactionRepository(next domain.PointTransactionRepository, obs ...Observer) domain.PointTransactionRepository {
+	return &observedPointTransactionRepository{next: next, observers: obs}
+}
+
+func (r *observedPointTransactionRepository) Record(ctx context.Context, pt *domain.PointTransaction, apply func(*domain.User, *domain.PointTransaction) []*domain.Event) error {
+	end := r.observers.start(ctx, "point_transactions", "Record")
+	err := r.next.Record(ctx, pt, apply)
+	end(err)
+	return err
+}
+
+func (r *observedPointTransactionRepository) FindByUserID(ctx context.Context, userID int) ([]*domain.PointTransaction, error) {
+	end := r.observers.start(ctx, "point_transactions", "FindByUserID")
+	transactions, err := r.next.FindByUserID(ctx, userID)
+	end(err)
+	return transactions, err
+}
+
+// observedAPIKeyRepository reports every call of a domain.APIKeyRepository
+// to its observers
+type observedAPIKeyRepository struct {
+	next      domain.APIKeyRepository
+	observers observers
+}
+
+// NewObservedAPIKeyRepository wraps an API key repository so every call is
+// reported to the observers
+func NewObservedAPIKeyRepository(next domain.APIKeyRepository, obs ...Observer) domain.APIKeyRepository {
+	return &observedAPIKeyRepository{next: next, observers: obs}
+}
+
+func (r *observedAPIKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	end := r.observers.start(ctx, "api_keys", "Create")
+	err := r.next.Create(ctx, key)
+	end(err)
+	return err
+}
+
+func (r *observedAPIKeyRepository) FindAll(ctx context.Context) ([]*domain.APIKey, error) {
+	end := r.observers.start(ctx, "api_keys", "FindAll")
+	keys, err := r.next.FindAll(ctx)
+	end(err)
+	return keys, err
+}
+
+func (r *observedAPIKeyRepository) FindByID(ctx context.Context, id int) (*domain.APIKey, error) {
+	end := r.observers.start(ctx, "api_keys", "FindByID")
+	key, err := r.next.FindByID(ctx, id)
+	end(err)
+	return key, err
+}
+
+func (r *observedAPIKeyRepository) FindByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	end := r.observers.start(ctx, "api_keys", "FindByHash")
+	key, err := r.next.FindByHash(ctx, hash)
+	end(err)
+	return key, err
+}
+
+func (r *observedAPIKeyRepository) Revoke(ctx context.Context, id int, at time.Time) error {
+	end := r.observers.start(ctx, "api_keys", "Revoke")
+	err := r.next.Revoke(ctx, id, at)
+	end(err)
+	return err
+}
+
+func (r *observedAPIKeyRepository) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	end := r.observers.start(ctx, "api_keys", "TouchLastUsed")
+	err := r.next.TouchLastUsed(ctx, id, at)
+	end(err)
+	return err
+}
+
+// observedUserImportRepository reports every call of a
+// domain.UserImportRepository to its observers
+type observedUserImportRepository struct {
+	next      domain.UserImportRepository
+	observers observers
+}
+
+// NewObservedUserImportRepository wraps a user import repository so every
+// call is reported to the observers
+func NewObservedUserImportRepository(next domain.UserImportRepository, obs ...Observer) domain.UserImportRepository {
+	return &observedUserImportRepository{next: next, observers: obs}
+}
+
+func (r *observedUserImportRepository) Create(ctx context.Context, imp *domain.UserImport) error {
+	end := r.observers.start(ctx, "user_imports", "Create")
+	err := r.next.Create(ctx, imp)
+	end(err)
+	return err
+}
+
+func (r *observedUserImportRepository) Finish(ctx context.Context, imp *domain.UserImport) error {
+	end := r.observers.start(ctx, "user_imports", "Finish")
+	err := r.next.Finish(ctx, imp)
+	end(err)
+	return err
+}
+
+func (r *observedUserImportRepository) FindByID(ctx context.Context, id int) (*domain.UserImport, error) {
+	end := r.observers.start(ctx, "user_imports", "FindByID")
+	imp, err := r.next.FindByID(ctx, id)
+	end(err)
+	return imp, err
+}
+
+func (r *observedUserImportRepository) AddRejections(ctx context.Context, importID int, rejections []*domain.ImportRejection) error {
+	end := r.observers.start(ctx, "user_imports", "AddRejections")
+	err := r.next.AddRejections(ctx, importID, rejections)
+	end(err)
+	return err
+}
+
+func (r *observedUserImportRepository) EachRejection(ctx context.Context, importID int, fn func(*domain.ImportRejection) error) error {
+	end := r.observers.start(ctx, "user_imports", "EachRejection")
+	err := r.next.EachRejection(ctx, importID, fn)
+	end(err)
+	return err
+}
+
+// observedQuotaRepository reports every call of a domain.QuotaRepository to
+// its observers
+type observedQuotaRepository struct {
+	next      domain.QuotaRepository
+	observers observers
+}
+
+// NewObservedQuotaRepository wraps a quota repository so every call is
+// reported to the observers
+func NewObservedQuotaRepository(next domain.QuotaRepository, obs ...Observer) domain.QuotaRepository {
+	return &observedQuotaRepository{next: next, observers: obs}
+}
+
+func (r *observedQuotaRepository) Consume(ctx context.Context, client, day string, limit int) (int, bool, error) {
+	end := r.observers.start(ctx, "quota_usage", "Consume")
+	used, ok, err := r.next.Consume(ctx, client, day, limit)
+	end(err)
+	return used, ok, err
+}
+
+// observedIdempotencyRepository reports every call of a
+// domain.IdempotencyRepository to its observers
+type observedIdempotencyRepository struct {
+	next      domain.IdempotencyRepository
+	observers observers
+}
+
+// NewObservedIdempotencyRepository wraps an idempotency key repository so
+// every call is reported to the observers
+func NewObservedIdempotencyRepository(next domain.IdempotencyRepository, obs ...Observer) domain.IdempotencyRepository {
+	return &observedIdempotencyRepository{next: next, observers: obs}
+}
+
+func (r *observedIdempotencyRepository) Reserve(ctx context.Context, key *domain.IdempotencyKey) (*domain.IdempotencyKey, error) {
+	end := r.observers.start(ctx, "idempotency_keys", "Reserve")
+	existing, err := r.next.Reserve(ctx, key)
+	end(err)
+	return existing, err
+}
+
+func (r *observedIdempotencyRepository) Complete(ctx context.Context, key *domain.IdempotencyKey) error {
+	end := r.observers.start(ctx, "idempotency_keys", "Complete")
+	err := r.next.Complete(ctx, key)
+	end(err)
+	return err
+}
+
+func (r *observedIdempotencyRepository) Release(ctx context.Context, client, key string) error {
+	end := r.observers.start(ctx, "idempotency_keys", "Release")
+	err := r.next.Release(ctx, client, key)
+	end(err)
+	return err
+}
+
+func (r *observedIdempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	end := r.observers.start(ctx, "idempotency_keys", "DeleteExpired")
+	deleted, err := r.next.DeleteExpired(ctx, before)
+	end(err)
+	return deleted, err
+}
+
+// observedWebhookRepository reports every call of a domain.WebhookRepository
+// to its observers
+type observedWebhookRepository struct {
+	next      domain.WebhookRepository
+	observers observers
+}
+
+// NewObservedWebhookRepository wraps a webhook repository so every call is
+// reported to the observers
+func NewObservedWebhookRepository(next domain.WebhookRepository, obs ...Observer) domain.WebhookRepository {
+	return &observedWebhookRepository{next: next, observers: obs}
+}
+
+func (r *observedWebhookRepository) CreateSubscription(ctx context.Context, sub *domain.WebhookSubscription) error {
+	end := r.observers.start(ctx, "webhook_subscriptions", "CreateSubscription")
+	err := r.next.CreateSubscription(ctx, sub)
+	end(err)
+	return err
+}
+
+func (r *observedWebhookRepository) FindSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	end := r.observers.start(ctx, "webhook_subscriptions", "FindSubscriptions")
+	subs, err := r.next.FindSubscriptions(ctx)
+	end(err)
+	return subs, err
+}
+
+func (r *observedWebhookRepository) FindSubscriptionByID(ctx context.Context, id int) (*domain.WebhookSubscription, error) {
+	end := r.observers.start(ctx, "webhook_subscriptions", "FindSubscriptionByID")
+	sub, err := r.next.FindSubscriptionByID(ctx, id)
+	end(err)
+	return sub, err
+}
+
+func (r *observedWebhookRepository) DeleteSubscription(ctx context.Context, id int) error {
+	end := r.observers.start(ctx, "webhook_subscriptions", "DeleteSubscription")
+	err := r.next.DeleteSubscription(ctx, id)
+	end(err)
+	return err
+}
+
+func (r *observedWebhookRepository) EnqueueDeliveries(ctx context.Context, now time.Time, limit int) (int, error) {
+	end := r.observers.start(ctx, "webhook_deliveries", "EnqueueDeliveries")
+	enqueued, err := r.next.EnqueueDeliveries(ctx, now, limit)
+	end(err)
+	return enqueued, err
+}
+
+func (r *observedWebhookRepository) FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	end := r.observers.start(ctx, "webhook_deliveries", "FindDueDeliveries")
+	deliveries, err := r.next.FindDueDeliveries(ctx, now, limit)
+	end(err)
+	return deliveries, err
+}
+
+func (r *observedWebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	end := r.observers.start(ctx, "webhook_deliveries", "UpdateDelivery")
+	err := r.next.UpdateDelivery(ctx, delivery)
+	end(err)
+	return err
+}
+
+func (r *observedWebhookRepository) FindDeliveries(ctx context.Context, subscriptionID int, status string, limit int) ([]*domain.WebhookDelivery, error) {
+	end := r.observers.start(ctx, "webhook_deliveries", "FindDeliveries")
+	deliveries, err := r.next.FindDeliveries(ctx, subscriptionID, status, limit)
+	end(err)
+	return deliveries, err
+}
+
+func (r *observedWebhookRepository) FindDeliveryByID(ctx context.Context, id int) (*domain.WebhookDelivery, error) {
+	end := r.observers.start(ctx, "webhook_deliveries", "FindDeliveryByID")
+	delivery, err := r.next.FindDeliveryByID(ctx, id)
+	end(err)
+	return delivery, err
+}
+
+func (r *observedWebhookRepository) RequeueDelivery(ctx context.Context, id int, now time.Time) error {
+	end := r.observers.start(ctx, "webhook_deliveries", "RequeueDelivery")
+	err := r.next.RequeueDelivery(ctx, id, now)
+	end(err)
+	return err
+}
+
+func (r *observedWebhookRepository) RequeueDeadDeliveries(ctx context.Context, subscriptionID int, now time.Time) (int, error) {
+	end := r.observers.start(ctx, "webhook_deliveries", "RequeueDeadDeliveries")
+	requeued, err := r.next.RequeueDeadDeliveries(ctx, subscriptionID, now)
+	end(err)
+	return requeued, err
+}
+
+func (r *observedWebhookRepository) DeleteDeliveredEvents(ctx context.Context, before time.Time) (int, error) {
+	end := r.observers.start(ctx, "outbox_events", "DeleteDeliveredEvents")
+	deleted, err := r.next.DeleteDeliveredEvents(ctx, before)
+	end(err)
+	return deleted, err
+}
+
+// observedEventRepository reports every call of a domain.EventRepository to
+// its observers
+type observedEventRepository struct {
+	next      domain.EventRepository
+	observers observers
+}
+
+// NewObservedEventRepository wraps an event log repository so every call is
+// reported to the observers
+func NewObservedEventRepository(next domain.EventRepository, obs ...Observer) domain.EventRepository {
+	return &observedEventRepository{next: next, observers: obs}
+}
+
+func (r *observedEventRepository) FindAfter(ctx context.Context, afterID int, types []string, limit int) ([]*domain.Event, error) {
+	end := r.observers.start(ctx, "outbox_events", "FindAfter")
+	events, err := r.next.FindAfter(ctx, afterID, types, limit)
+	end(err)
+	return events, err
+}
+
+func (r *observedEventRepository) LastID(ctx context.Context) (int, error) {
+	end := r.observers.start(ctx, "outbox_events", "LastID")
+	id, err := r.next.LastID(ctx)
+	end(err)
+	return id, err
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"workshop_4/internal/domain"
+	"workshop_4/logging"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObservedUserRepository(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	type call struct {
+		repository, method string
+		err                error
+	}
+	var calls []call
+	record := func(_ context.Context, repository, method string) func(error) {
+		return func(err error) {
+			calls = append(calls, call{repository, method, err})
+		}
+	}
+	repo := NewObservedUserRepository(NewSQLiteUserRepository(db), record)
+
+	user := createTestUser(t, repo, "observed@example.com", 0)
+	_, err := repo.FindByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ErrVersionConflict, repo.Delete(ctx, user.ID, user.Version+5))
+
+	assert.Equal(t, []call{
+		{"users", "Create", nil},
+		{"users", "FindByID", nil},
+		{"users", "Delete", domain.ErrVersionConflict},
+	}, calls)
+}
+
+func TestLoggingObserver_Levels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	observe := LoggingObserver(logger, 0)
+
+	ctx := context.Background()
+	observe(ctx, "users", "FindByID")(nil)
+	observe(ctx, "users", "Update")(domain.ErrVersionConflict)
+	observe(ctx, "users", "Create")(errors.New("disk I/O error"))
+
+	var levels []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		levels = append(levels, record["level"].(string))
+	}
+	// Expected outcomes such as a version conflict are not failures
+	assert.Equal(t, []string{"DEBUG", "DEBUG", "ERROR"}, levels)
+}
+
+func TestLoggingObserver_UsesRequestLogger(t *testing.T) {
+	var base, request bytes.Buffer
+	observe := LoggingObserver(slog.New(slog.NewJSONHandler(&base, nil)), 0)
+	requestLogger := slog.New(slog.NewJSONHandler(&request, nil)).With("request_id", "req-1")
+
+	ctx := logging.NewContext(context.Background(), requestLogger)
+	observe(ctx, "users", "Create")(errors.New("disk I/O error"))
+
+	assert.Empty(t, base.String())
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(request.Bytes(), &record))
+	assert.Equal(t, "req-1", record["request_id"])
+	assert.Equal(t, "Create", record["method"])
+}
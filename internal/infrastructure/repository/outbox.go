@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"workshop_4/internal/domain"
+)
+
+const insertEventQuery = `INSERT INTO outbox_events (type, user_id, data, created_at) VALUES (?, ?, ?, ?)`
+
+// AppendEvents writes events to the outbox, filling in their IDs. Bound to a
+// transaction by InTransaction, they commit or roll back with it.
+func (r *sqliteUserRepository) AppendEvents(ctx context.Context, events ...*domain.Event) (err error) {
+	if len(events) == 0 {
+		return nil
+	}
+	span := startQuerySpan(ctx, "outbox_events", "AppendEvents", insertEventQuery)
+	defer func() { endQuerySpan(span, err) }()
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertEvents writes events to the outbox through q, filling in their IDs
+func insertEvents(ctx context.Context, q querier, events []*domain.Event) error {
+	for _, event := range events {
+		result, err := q.ExecContext(ctx, insertEventQuery, event.Type, event.UserID, string(event.Data), event.CreatedAt.UTC())
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		event.ID = int(id)
+	}
+	return nil
+}
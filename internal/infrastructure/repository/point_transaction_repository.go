@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// sqlitePointTransactionRepository implements domain.PointTransactionRepository
+type sqlitePointTransactionRepository struct {
+	db *sql.DB
+}
+
+// NewSQLitePointTransactionRepository creates a new SQLite points ledger repository
+func NewSQLitePointTransactionRepository(db *sql.DB) domain.PointTransactionRepository {
+	return &sqlitePointTransactionRepository{db: db}
+}
+
+// Record applies a ledger entry to the user's balance inside a single SQL
+// transaction, along with the member level and outbox events apply sets
+func (r *sqlitePointTransactionRepository) Record(ctx context.Context, pt *domain.PointTransaction, apply func(*domain.User, *domain.PointTransaction) []*domain.Event) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ? AND deleted_at IS NULL`, pt.UserID))
+	if err == sql.ErrNoRows {
+		return domain.ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	newBalance := user.PointBalance + pt.Amount
+	if newBalance < 0 {
+		return domain.ErrInvalidPointBalance
+	}
+
+	now := time.Now()
+	user.PointBalance = newBalance
+	user.UpdatedAt = now
+	user.Version++
+	pt.BalanceAfter = newBalance
+	pt.CreatedAt = now
+	if err := insertPointTransaction(ctx, tx, pt); err != nil {
+		return err
+	}
+
+	var events []*domain.Event
+	if apply != nil {
+		events = apply(user, pt)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET point_balance = ?, member_level = ?, updated_at = ?, version = ? WHERE id = ?`,
+		user.PointBalance, user.MemberLevel, now, user.Version, user.ID); err != nil {
+		return err
+	}
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FindByUserID retrieves the ledger entries of a user, newest first
+func (r *sqlitePointTransactionRepository) FindByUserID(ctx context.Context, userID int) ([]*domain.PointTransaction, error) {
+	query := `SELECT id, user_id, type, amount, balance_after, description, created_at
+	          FROM point_transactions WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []*domain.PointTransaction
+	for rows.Next() {
+		pt := &domain.PointTransaction{}
+		var description sql.NullString
+		err := rows.Scan(
+			&pt.ID,
+			&pt.UserID,
+			&pt.Type,
+			&pt.Amount,
+			&pt.BalanceAfter,
+			&description,
+			&pt.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pt.Description = description.String
+		transactions = append(transactions, pt)
+	}
+
+	return transactions, rows.Err()
+}
+
+// insertPointTransaction appends a ledger entry using the given transaction
+func insertPointTransaction(ctx context.Context, tx *sql.Tx, pt *domain.PointTransaction) error {
+	query := `INSERT INTO point_transactions (user_id, type, amount, balance_after, description, created_at)
+	          VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.ExecContext(ctx, query,
+		pt.UserID,
+		pt.Type,
+		pt.Amount,
+		pt.BalanceAfter,
+		pt.Description,
+		pt.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	pt.ID = int(id)
+	return nil
+}
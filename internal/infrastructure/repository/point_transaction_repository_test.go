@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"workshop_4/database"
+	"workshop_4/internal/domain"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestDB(t *testing.T) (*sql.DB, func()) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	// Every pooled connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+
+	if err := database.InitSchema(db); err != nil {
+		t.Fatalf("Failed to create test schema: %v", err)
+	}
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return db, cleanup
+}
+
+func createTestUser(t *testing.T, repo domain.UserRepository, email string, balance int) *domain.User {
+	ctx := context.Background()
+	now := time.Now()
+	user := &domain.User{
+		FirstName:    "สมชาย",
+		LastName:     "ใจดี",
+		Email:        email,
+		MemberLevel:  "Bronze",
+		PointBalance: balance,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	return user
+}
+
+func TestPointTransactionRepository_Record(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userRepo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	user := createTestUser(t, userRepo, "somchai@example.com", 0)
+
+	pt := &domain.PointTransaction{UserID: user.ID, Type: domain.PointTransactionEarn, Amount: 150}
+	err := pointRepo.Record(ctx, pt, nil)
+
+	assert.NoError(t, err)
+	assert.NotZero(t, pt.ID)
+	assert.Equal(t, 150, pt.BalanceAfter)
+
+	stored, _ := userRepo.FindByID(ctx, user.ID)
+	assert.Equal(t, 150, stored.PointBalance)
+}
+
+func TestPointTransactionRepository_Record_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	// A file, unlike :memory:, is shared by every pooled connection
+	db, err := database.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+	if err := database.InitSchema(db); err != nil {
+		t.Fatalf("Failed to create test schema: %v", err)
+	}
+
+	userRepo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	user := createTestUser(t, userRepo, "somchai@example.com", 0)
+
+	const writers = 50
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- pointRepo.Record(ctx, &domain.PointTransaction{UserID: user.ID, Type: domain.PointTransactionEarn, Amount: 10}, nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	stored, _ := userRepo.FindByID(ctx, user.ID)
+	assert.Equal(t, writers*10, stored.PointBalance)
+}
+
+func TestPointTransactionRepository_Record_LogsEvents(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userRepo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	events := NewSQLiteEventRepository(db)
+	user := createTestUser(t, userRepo, "somchai@example.com", 100)
+	pointsChanged := func(_ *domain.User, pt *domain.PointTransaction) []*domain.Event {
+		return []*domain.Event{{Type: domain.EventUserPointsChanged, UserID: pt.UserID, Data: []byte(`{}`), CreatedAt: time.Now()}}
+	}
+
+	// A rejected transaction logs nothing
+	err := pointRepo.Record(ctx, &domain.PointTransaction{UserID: user.ID, Type: domain.PointTransactionRedeem, Amount: -500}, pointsChanged)
+	assert.Equal(t, domain.ErrInvalidPointBalance, err)
+	logged, _ := events.FindAfter(ctx, 0, nil, 10)
+	assert.Empty(t, logged)
+
+	err = pointRepo.Record(ctx, &domain.PointTransaction{UserID: user.ID, Type: domain.PointTransactionEarn, Amount: 25}, pointsChanged)
+	assert.NoError(t, err)
+	logged, _ = events.FindAfter(ctx, 0, nil, 10)
+	if assert.Len(t, logged, 1) {
+		assert.Equal(t, domain.EventUserPointsChanged, logged[0].Type)
+		assert.Equal(t, user.ID, logged[0].UserID)
+	}
+}
+
+func TestPointTransactionRepository_Record_SavesMemberLevel(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userRepo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	user := createTestUser(t, userRepo, "somchai@example.com", 900)
+
+	var seen domain.User
+	err := pointRepo.Record(ctx, &domain.PointTransaction{UserID: user.ID, Type: domain.PointTransactionEarn, Amount: 200}, func(u *domain.User, _ *domain.PointTransaction) []*domain.Event {
+		seen = *u
+		u.MemberLevel = "Silver"
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1100, seen.PointBalance)
+	assert.Equal(t, "Bronze", seen.MemberLevel)
+
+	stored, _ := userRepo.FindByID(ctx, user.ID)
+	assert.Equal(t, 1100, stored.PointBalance)
+	assert.Equal(t, "Silver", stored.MemberLevel)
+	assert.Equal(t, user.Version+1, stored.Version)
+	assert.Equal(t, seen.Version, stored.Version)
+}
+
+func TestPointTransactionRepository_Record_RejectsNegativeBalance(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userRepo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	user := createTestUser(t, userRepo, "somchai@example.com", 100)
+
+	err := pointRepo.Record(ctx, &domain.PointTransaction{UserID: user.ID, Type: domain.PointTransactionRedeem, Amount: -101}, nil)
+
+	assert.Equal(t, domain.ErrInvalidPointBalance, err)
+
+	stored, _ := userRepo.FindByID(ctx, user.ID)
+	assert.Equal(t, 100, stored.PointBalance)
+	history, _ := pointRepo.FindByUserID(ctx, user.ID)
+	assert.Len(t, history, 1)
+}
+
+func TestPointTransactionRepository_Record_UserNotFound(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	pointRepo := NewSQLitePointTransactionRepository(db)
+
+	err := pointRepo.Record(ctx, &domain.PointTransaction{UserID: 42, Type: domain.PointTransactionEarn, Amount: 10}, nil)
+
+	assert.Equal(t, domain.ErrUserNotFound, err)
+}
+
+func TestUserRepository_Update_RecordsBalanceAdjustment(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userRepo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	user := createTestUser(t, userRepo, "somchai@example.com", 100)
+
+	user.PointBalance = 250
+	user.UpdatedAt = time.Now()
+	assert.NoError(t, userRepo.Update(ctx, user))
+
+	history, err := pointRepo.FindByUserID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, domain.PointTransactionAdjust, history[0].Type)
+	assert.Equal(t, 150, history[0].Amount)
+	assert.Equal(t, 250, history[0].BalanceAfter)
+}
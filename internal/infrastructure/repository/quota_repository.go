@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"workshop_4/internal/domain"
+)
+
+// sqliteQuotaRepository implements domain.QuotaRepository
+type sqliteQuotaRepository struct {
+	db *sql.DB
+
+	// mu guards pruned, the latest day whose earlier counts were deleted
+	mu     sync.Mutex
+	pruned string
+}
+
+// NewSQLiteQuotaRepository creates a new SQLite quota repository
+func NewSQLiteQuotaRepository(db *sql.DB) domain.QuotaRepository {
+	return &sqliteQuotaRepository{db: db}
+}
+
+// Consume counts a request in one statement, so concurrent requests cannot
+// both take the last one left. The upsert returns no row when the update is
+// skipped because the limit is reached.
+func (r *sqliteQuotaRepository) Consume(ctx context.Context, client, day string, limit int) (int, bool, error) {
+	if err := r.prune(ctx, day); err != nil {
+		return 0, false, err
+	}
+
+	query := `INSERT INTO quota_usage (client, day, used) VALUES (?, ?, 1)
+	          ON CONFLICT (client, day) DO UPDATE SET used = used + 1 WHERE used < ?
+	          RETURNING used`
+
+	var used int
+	err := r.db.QueryRowContext(ctx, query, client, day, limit).Scan(&used)
+	if err == sql.ErrNoRows {
+		return limit, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return used, true, nil
+}
+
+// prune deletes the counts of days before day the first time day is seen.
+// Anonymous clients are counted by address, so without it the table would
+// gain a row per address every day.
+func (r *sqliteQuotaRepository) prune(ctx context.Context, day string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if day <= r.pruned {
+		return nil
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM quota_usage WHERE day < ?`, day); err != nil {
+		return err
+	}
+	r.pruned = day
+	return nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaRepository_Consume(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := NewSQLiteQuotaRepository(db)
+
+	for i := 1; i <= 3; i++ {
+		used, ok, err := repo.Consume(ctx, "api_key:1", "2024-01-31", 3)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, i, used)
+	}
+
+	used, ok, err := repo.Consume(ctx, "api_key:1", "2024-01-31", 3)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 3, used)
+
+	// Counts are per client and per day
+	used, ok, _ = repo.Consume(ctx, "api_key:1", "2024-02-01", 3)
+	assert.True(t, ok)
+	assert.Equal(t, 1, used)
+	used, ok, _ = repo.Consume(ctx, "ip:10.0.0.1", "2024-01-31", 3)
+	assert.True(t, ok)
+	assert.Equal(t, 1, used)
+}
+
+func TestQuotaRepository_Consume_DeletesEarlierDays(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := NewSQLiteQuotaRepository(db)
+
+	countRows := func() int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM quota_usage`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	repo.Consume(ctx, "ip:10.0.0.1", "2024-01-30", 3)
+	repo.Consume(ctx, "ip:10.0.0.2", "2024-01-30", 3)
+	assert.Equal(t, 2, countRows())
+
+	used, ok, err := repo.Consume(ctx, "ip:10.0.0.3", "2024-01-31", 3)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, used)
+	assert.Equal(t, 1, countRows())
+
+	// Today's counts are kept
+	used, _, _ = repo.Consume(ctx, "ip:10.0.0.3", "2024-01-31", 3)
+	assert.Equal(t, 2, used)
+}
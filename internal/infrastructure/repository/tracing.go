@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the query spans, children of the span in the caller's
+// context
+var tracer = otel.Tracer("workshop_4/internal/infrastructure/repository")
+
+// startQuerySpan starts the span of a query run by a repository method, named
+// like "users.FindByID". statement may be "" and set later with
+// setStatement when the SQL is built from the arguments. A transaction gets
+// one span, whose statement is the one it exists for.
+func startQuerySpan(ctx context.Context, table, method, statement string) trace.Span {
+	_, span := tracer.Start(ctx, table+"."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBSQLTable(table),
+		),
+	)
+	if statement != "" {
+		setStatement(span, statement)
+	}
+	return span
+}
+
+// setStatement records the SQL statement of a query span and its operation,
+// the statement's first keyword
+func setStatement(span trace.Span, statement string) {
+	span.SetAttributes(semconv.DBStatement(statement))
+	if fields := strings.Fields(statement); len(fields) > 0 {
+		span.SetAttributes(semconv.DBOperation(strings.ToUpper(fields[0])))
+	}
+}
+
+// endQuerySpan ends a query span, marking it failed if the database did;
+// expected outcomes such as version conflicts are recorded as events only
+func endQuerySpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		if IsDatabaseError(err) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestUserRepository_QuerySpans(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	user := createTestUser(t, NewSQLiteUserRepository(db), "trace@example.com", 0)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(context.Background())
+
+	// Through the observing decorator, as main wires it
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	repo := NewObservedUserRepository(NewSQLiteUserRepository(db))
+
+	if _, err := repo.FindByID(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	stale := *user
+	stale.Version = 99
+	assert.Equal(t, domain.ErrVersionConflict, repo.Update(ctx, &stale))
+	parent.End()
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	find, update := spans[0], spans[1]
+
+	assert.Equal(t, "users.FindByID", find.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), find.Parent().SpanID())
+	statement := attr(find, "db.statement")
+	assert.True(t, strings.HasPrefix(statement, "SELECT "), statement)
+	assert.Equal(t, "SELECT", attr(find, "db.operation"))
+	assert.Equal(t, "sqlite", attr(find, "db.system"))
+
+	// A version conflict is an answer, not a failure of the database
+	assert.Equal(t, "users.Update", update.Name())
+	assert.Contains(t, attr(update, "db.statement"), "UPDATE users")
+	assert.Equal(t, codes.Unset, update.Status().Code)
+	assert.Len(t, update.Events(), 1)
+}
+
+func attr(span sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
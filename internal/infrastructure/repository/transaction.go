@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// querier runs statements; *sql.DB and *sql.Tx both satisfy it
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// savepoint names the savepoint a write takes inside a caller's transaction
+const savepoint = "repository_write"
+
+// txScope is the transaction a write that needs several statements runs in.
+// Outside a caller's transaction it is a transaction of its own; inside one
+// it is a savepoint, so a write that fails undoes only itself and leaves the
+// caller's transaction usable.
+type txScope struct {
+	*sql.Tx
+	owned bool
+	done  bool
+}
+
+// beginScope starts a write on db, or within tx when it is not nil
+func beginScope(ctx context.Context, db *sql.DB, tx *sql.Tx) (*txScope, error) {
+	if tx == nil {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &txScope{Tx: tx, owned: true}, nil
+	}
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT `+savepoint); err != nil {
+		return nil, err
+	}
+	return &txScope{Tx: tx}, nil
+}
+
+// Commit commits the write's transaction or releases its savepoint
+func (s *txScope) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	if s.owned {
+		return s.Tx.Commit()
+	}
+	_, err := s.Tx.Exec(`RELEASE ` + savepoint)
+	return err
+}
+
+// Rollback undoes the write unless it was committed; like sql.Tx.Rollback
+// it is safe to defer
+func (s *txScope) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	if s.owned {
+		return s.Tx.Rollback()
+	}
+	if _, err := s.Tx.Exec(`ROLLBACK TO ` + savepoint); err != nil {
+		return err
+	}
+	_, err := s.Tx.Exec(`RELEASE ` + savepoint)
+	return err
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"workshop_4/internal/domain"
+)
+
+// sqliteUserImportRepository implements domain.UserImportRepository
+type sqliteUserImportRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUserImportRepository creates a new SQLite user import repository
+func NewSQLiteUserImportRepository(db *sql.DB) domain.UserImportRepository {
+	return &sqliteUserImportRepository{db: db}
+}
+
+// userImportColumns is the column list of every user_imports SELECT, in
+// scanUserImport order
+const userImportColumns = `id, format, dry_run, total, imported, rejected, created_by, created_at, finished_at`
+
+// scanUserImport scans a row selected with userImportColumns
+func scanUserImport(row rowScanner) (*domain.UserImport, error) {
+	imp := &domain.UserImport{}
+	var createdBy sql.NullString
+	err := row.Scan(
+		&imp.ID,
+		&imp.Format,
+		&imp.DryRun,
+		&imp.Total,
+		&imp.Imported,
+		&imp.Rejected,
+		&createdBy,
+		&imp.CreatedAt,
+		&imp.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	imp.CreatedBy = createdBy.String
+	return imp, nil
+}
+
+// Create stores a started import
+func (r *sqliteUserImportRepository) Create(ctx context.Context, imp *domain.UserImport) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_imports (format, dry_run, created_by, created_at) VALUES (?, ?, ?, ?)`,
+		imp.Format, imp.DryRun, imp.CreatedBy, imp.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	imp.ID = int(id)
+	return nil
+}
+
+// Finish stores the counts of a finished import
+func (r *sqliteUserImportRepository) Finish(ctx context.Context, imp *domain.UserImport) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE user_imports SET total = ?, imported = ?, rejected = ?, finished_at = ? WHERE id = ?`,
+		imp.Total, imp.Imported, imp.Rejected, utcOrNil(imp.FinishedAt), imp.ID,
+	)
+	return err
+}
+
+// FindByID retrieves an import by ID
+func (r *sqliteUserImportRepository) FindByID(ctx context.Context, id int) (*domain.UserImport, error) {
+	imp, err := scanUserImport(r.db.QueryRowContext(ctx, `SELECT `+userImportColumns+` FROM user_imports WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return imp, err
+}
+
+// AddRejections stores rejected rows in one transaction
+func (r *sqliteUserImportRepository) AddRejections(ctx context.Context, importID int, rejections []*domain.ImportRejection) error {
+	if len(rejections) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO user_import_rejections (import_id, line, email, reason) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, rejection := range rejections {
+		if _, err := stmt.ExecContext(ctx, importID, rejection.Line, rejection.Email, rejection.Reason); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// EachRejection streams an import's rejected rows in line order
+func (r *sqliteUserImportRepository) EachRejection(ctx context.Context, importID int, fn func(*domain.ImportRejection) error) error {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT line, email, reason FROM user_import_rejections WHERE import_id = ? ORDER BY line`, importID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rejection := &domain.ImportRejection{}
+		if err := rows.Scan(&rejection.Line, &rejection.Email, &rejection.Reason); err != nil {
+			return err
+		}
+		if err := fn(rejection); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
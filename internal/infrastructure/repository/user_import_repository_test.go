@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserImportRepository(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserImportRepository(db)
+	imp := &domain.UserImport{Format: "csv", DryRun: true, CreatedBy: "u-admin", CreatedAt: time.Now()}
+	assert.NoError(t, repo.Create(ctx, imp))
+	assert.NotZero(t, imp.ID)
+
+	assert.NoError(t, repo.AddRejections(ctx, imp.ID, []*domain.ImportRejection{
+		{Line: 7, Email: "b@example.com", Reason: "email already exists"},
+		{Line: 3, Email: "", Reason: "email is required"},
+	}))
+	assert.NoError(t, repo.AddRejections(ctx, imp.ID, nil))
+
+	finished := time.Now()
+	imp.Total, imp.Imported, imp.Rejected, imp.FinishedAt = 10, 8, 2, &finished
+	assert.NoError(t, repo.Finish(ctx, imp))
+
+	found, err := repo.FindByID(ctx, imp.ID)
+	assert.NoError(t, err)
+	assert.True(t, found.DryRun)
+	assert.Equal(t, "u-admin", found.CreatedBy)
+	assert.Equal(t, 10, found.Total)
+	assert.Equal(t, 2, found.Rejected)
+	assert.NotNil(t, found.FinishedAt)
+
+	var lines []int
+	err = repo.EachRejection(ctx, imp.ID, func(rejection *domain.ImportRejection) error {
+		lines = append(lines, rejection.Line)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 7}, lines)
+
+	missing, err := repo.FindByID(ctx, imp.ID+1)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
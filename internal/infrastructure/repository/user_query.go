@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"workshop_4/internal/domain"
+)
+
+// sortableColumns whitelists the columns that may appear in ORDER BY. Field
+// names come from clients, so they are never interpolated without this check.
+var sortableColumns = func() map[string]bool {
+	columns := make(map[string]bool, len(domain.UserSortFields))
+	for _, field := range domain.UserSortFields {
+		columns[field] = true
+	}
+	return columns
+}()
+
+// buildUserFilter translates a filter into WHERE conditions and their arguments
+func buildUserFilter(f domain.UserFilter) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+
+	if !f.IncludeDeleted {
+		where = append(where, "deleted_at IS NULL")
+	}
+	if f.MemberLevel != "" {
+		where = append(where, "member_level = ?")
+		args = append(args, f.MemberLevel)
+	}
+	if f.PointsMin != nil {
+		where = append(where, "point_balance >= ?")
+		args = append(args, *f.PointsMin)
+	}
+	if f.PointsMax != nil {
+		where = append(where, "point_balance <= ?")
+		args = append(args, *f.PointsMax)
+	}
+	if f.CreatedAfter != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, *f.CreatedBefore)
+	}
+
+	return where, args
+}
+
+// buildOrderBy renders the ORDER BY clause, reversing every key when reading
+// a page backwards from a cursor
+func buildOrderBy(sort []domain.SortField, reverse bool) (string, error) {
+	if len(sort) == 0 {
+		sort = []domain.SortField{{Field: "id", Desc: true}}
+	}
+
+	keys := make([]string, len(sort))
+	for i, s := range sort {
+		if !sortableColumns[s.Field] {
+			return "", domain.ErrInvalidSortField
+		}
+		desc := s.Desc != reverse
+		if desc {
+			keys[i] = s.Field + " DESC"
+		} else {
+			keys[i] = s.Field + " ASC"
+		}
+	}
+
+	return strings.Join(keys, ", "), nil
+}
+
+// buildKeysetCondition renders the condition selecting rows strictly after
+// (or, for a backward cursor, before) the cursor position in sort order:
+//
+//	(k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+//
+// with the comparison flipped for descending keys. The expanded form is used
+// instead of a row-value comparison because keys may mix directions.
+func buildKeysetCondition(sort []domain.SortField, cursor *domain.UserCursor) (string, []interface{}, error) {
+	if len(sort) == 0 || len(cursor.Values) != len(sort) {
+		return "", nil, domain.ErrInvalidCursor
+	}
+
+	var disjuncts []string
+	var args []interface{}
+	for i, s := range sort {
+		if !sortableColumns[s.Field] {
+			return "", nil, domain.ErrInvalidSortField
+		}
+
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, sort[j].Field+" = ?")
+			args = append(args, cursor.Values[j])
+		}
+
+		op := ">"
+		if s.Desc != cursor.Backward {
+			op = "<"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s ?", s.Field, op))
+		args = append(args, cursor.Values[i])
+
+		disjuncts = append(disjuncts, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return "(" + strings.Join(disjuncts, " OR ") + ")", args, nil
+}
+
+// withIDTiebreaker appends an ascending id key unless sort already has one,
+// making the order total so that keyset pagination neither skips nor
+// repeats rows
+func withIDTiebreaker(sort []domain.SortField) []domain.SortField {
+	if len(sort) == 0 {
+		return []domain.SortField{{Field: "id", Desc: true}}
+	}
+	for _, s := range sort {
+		if s.Field == "id" {
+			return sort
+		}
+	}
+	return append(sort[:len(sort):len(sort)], domain.SortField{Field: "id"})
+}
+
+// keysetCursor returns the cursor positioned at user in sort order
+func keysetCursor(user *domain.User, sort []domain.SortField) *domain.UserCursor {
+	values := make([]interface{}, len(sort))
+	for i, s := range sort {
+		switch s.Field {
+		case "id":
+			values[i] = user.ID
+		case "first_name":
+			values[i] = user.FirstName
+		case "last_name":
+			values[i] = user.LastName
+		case "email":
+			values[i] = user.Email
+		case "phone":
+			values[i] = user.Phone
+		case "address":
+			values[i] = user.Address
+		case "avatar":
+			values[i] = user.Avatar
+		case "member_level":
+			values[i] = user.MemberLevel
+		case "point_balance":
+			values[i] = user.PointBalance
+		case "created_at":
+			values[i] = user.CreatedAt
+		case "updated_at":
+			values[i] = user.UpdatedAt
+		}
+	}
+	return &domain.UserCursor{Values: values}
+}
@@ -1,13 +1,22 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"strings"
+	"time"
 	"workshop_4/internal/domain"
+
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // sqliteUserRepository implements domain.UserRepository
 type sqliteUserRepository struct {
 	db *sql.DB
+	// tx is the transaction InTransaction bound this copy to, if any
+	tx *sql.Tx
 }
 
 // NewSQLiteUserRepository creates a new SQLite user repository
@@ -15,49 +24,66 @@ func NewSQLiteUserRepository(db *sql.DB) domain.UserRepository {
 	return &sqliteUserRepository{db: db}
 }
 
-// FindAll retrieves all users from the database
-func (r *sqliteUserRepository) FindAll() ([]*domain.User, error) {
-	query := `SELECT id, first_name, last_name, email, phone, address, avatar, member_level, point_balance, created_at, updated_at 
-	          FROM users ORDER BY id DESC`
+// startSpan starts the span of a query on users
+func (r *sqliteUserRepository) startSpan(ctx context.Context, method, statement string) trace.Span {
+	return startQuerySpan(ctx, "users", method, statement)
+}
+
+// conn returns where statements run: the bound transaction, if any
+func (r *sqliteUserRepository) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// begin starts a write that needs several statements
+func (r *sqliteUserRepository) begin(ctx context.Context) (*txScope, error) {
+	return beginScope(ctx, r.db, r.tx)
+}
+
+// InTransaction runs fn with a copy of the repository bound to one
+// transaction, committed if fn returns nil and rolled back otherwise. Called
+// on a bound repository it joins the transaction already open.
+func (r *sqliteUserRepository) InTransaction(ctx context.Context, fn func(domain.UserRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
 
-	rows, err := r.db.Query(query)
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var users []*domain.User
-	for rows.Next() {
-		user := &domain.User{}
-		err := rows.Scan(
-			&user.ID,
-			&user.FirstName,
-			&user.LastName,
-			&user.Email,
-			&user.Phone,
-			&user.Address,
-			&user.Avatar,
-			&user.MemberLevel,
-			&user.PointBalance,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, user)
+	bound := *r
+	bound.tx = tx
+	if err := fn(&bound); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
-	return users, nil
+// userColumns is the column list shared by every user SELECT, in scanUser order
+const userColumns = `id, first_name, last_name, email, phone, address, avatar, member_level, point_balance, created_at, updated_at, version, deleted_at`
+
+// userColumnsOf qualifies userColumns with a table alias for use in joins
+func userColumnsOf(alias string) string {
+	columns := strings.Split(userColumns, ", ")
+	for i, column := range columns {
+		columns[i] = alias + "." + column
+	}
+	return strings.Join(columns, ", ")
 }
 
-// FindByID retrieves a user by ID
-func (r *sqliteUserRepository) FindByID(id int) (*domain.User, error) {
-	query := `SELECT id, first_name, last_name, email, phone, address, avatar, member_level, point_balance, created_at, updated_at 
-	          FROM users WHERE id = ?`
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	user := &domain.User{}
-	err := r.db.QueryRow(query, id).Scan(
+// userScanDest returns the scan destinations for userColumns
+func userScanDest(user *domain.User) []interface{} {
+	return []interface{}{
 		&user.ID,
 		&user.FirstName,
 		&user.LastName,
@@ -69,8 +95,169 @@ func (r *sqliteUserRepository) FindByID(id int) (*domain.User, error) {
 		&user.PointBalance,
 		&user.CreatedAt,
 		&user.UpdatedAt,
-	)
+		&user.Version,
+		&user.DeletedAt,
+	}
+}
 
+// scanUser scans a row selected with userColumns
+func scanUser(row rowScanner) (*domain.User, error) {
+	user := &domain.User{}
+	if err := row.Scan(userScanDest(user)...); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// isUniqueViolation reports whether err is a UNIQUE constraint failure; on
+// users that can only be the email index over active users
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// FindAll retrieves all active users from the database
+func (r *sqliteUserRepository) FindAll(ctx context.Context) (_ []*domain.User, err error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE deleted_at IS NULL ORDER BY id DESC`
+	span := r.startSpan(ctx, "FindAll", query)
+	defer func() { endQuerySpan(span, err) }()
+
+	rows, err := r.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// FindPage retrieves one page of users with filtering, sorting and offset or
+// keyset pagination applied in SQL
+func (r *sqliteUserRepository) FindPage(ctx context.Context, q domain.UserListQuery) (_ []*domain.User, err error) {
+	span := r.startSpan(ctx, "FindPage", "")
+	defer func() { endQuerySpan(span, err) }()
+
+	where, args := buildUserFilter(q.Filter)
+
+	backward := q.Cursor != nil && q.Cursor.Backward
+	if q.Cursor != nil {
+		cond, cursorArgs, err := buildKeysetCondition(q.Sort, q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, cond)
+		args = append(args, cursorArgs...)
+	}
+
+	orderBy, err := buildOrderBy(q.Sort, backward)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY ` + orderBy + ` LIMIT ? OFFSET ?`
+	args = append(args, q.Limit, q.Offset)
+	setStatement(span, query)
+
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A backward page is read in reverse order; flip it back
+	if backward {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	return users, nil
+}
+
+// eachBatchSize is the number of users Each reads per query
+const eachBatchSize = 500
+
+// Each walks the matching users with keyset pagination rather than one long
+// query, so memory stays flat and no read lock is held while fn runs, for
+// instance while an export waits on a slow client
+func (r *sqliteUserRepository) Each(ctx context.Context, filter domain.UserFilter, sort []domain.SortField, fn func(*domain.User) error) error {
+	return eachUser(ctx, r.FindPage, filter, sort, fn)
+}
+
+// eachUser calls fn with every user matching the filter, reading them
+// eachBatchSize at a time through findPage
+func eachUser(ctx context.Context, findPage func(context.Context, domain.UserListQuery) ([]*domain.User, error),
+	filter domain.UserFilter, sort []domain.SortField, fn func(*domain.User) error) error {
+	sort = withIDTiebreaker(sort)
+	query := domain.UserListQuery{Filter: filter, Sort: sort, Limit: eachBatchSize}
+
+	for {
+		users, err := findPage(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+		if len(users) < eachBatchSize {
+			return nil
+		}
+		query.Cursor = keysetCursor(users[len(users)-1], sort)
+	}
+}
+
+// Count returns the number of users matching the filter
+func (r *sqliteUserRepository) Count(ctx context.Context, filter domain.UserFilter) (_ int, err error) {
+	span := r.startSpan(ctx, "Count", "")
+	defer func() { endQuerySpan(span, err) }()
+
+	where, args := buildUserFilter(filter)
+
+	query := `SELECT COUNT(*) FROM users`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	setStatement(span, query)
+
+	var count int
+	err = r.conn().QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+// FindByID retrieves an active user by ID
+func (r *sqliteUserRepository) FindByID(ctx context.Context, id int) (_ *domain.User, err error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ? AND deleted_at IS NULL`
+	span := r.startSpan(ctx, "FindByID", query)
+	defer func() { endQuerySpan(span, err) }()
+
+	user, err := scanUser(r.conn().QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -81,26 +268,30 @@ func (r *sqliteUserRepository) FindByID(id int) (*domain.User, error) {
 	return user, nil
 }
 
-// FindByEmail retrieves a user by email
-func (r *sqliteUserRepository) FindByEmail(email string) (*domain.User, error) {
-	query := `SELECT id, first_name, last_name, email, phone, address, avatar, member_level, point_balance, created_at, updated_at 
-	          FROM users WHERE email = ?`
+// FindDeletedByID retrieves a soft-deleted user by ID
+func (r *sqliteUserRepository) FindDeletedByID(ctx context.Context, id int) (_ *domain.User, err error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ? AND deleted_at IS NOT NULL`
+	span := r.startSpan(ctx, "FindDeletedByID", query)
+	defer func() { endQuerySpan(span, err) }()
 
-	user := &domain.User{}
-	err := r.db.QueryRow(query, email).Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Phone,
-		&user.Address,
-		&user.Avatar,
-		&user.MemberLevel,
-		&user.PointBalance,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.conn().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// FindByEmail retrieves an active user by email
+func (r *sqliteUserRepository) FindByEmail(ctx context.Context, email string) (_ *domain.User, err error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = ? AND deleted_at IS NULL`
+	span := r.startSpan(ctx, "FindByEmail", query)
+	defer func() { endQuerySpan(span, err) }()
 
+	user, err := scanUser(r.conn().QueryRowContext(ctx, query, email))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -111,12 +302,95 @@ func (r *sqliteUserRepository) FindByEmail(email string) (*domain.User, error) {
 	return user, nil
 }
 
-// Create inserts a new user into the database
-func (r *sqliteUserRepository) Create(user *domain.User) error {
-	query := `INSERT INTO users (first_name, last_name, email, phone, address, avatar, member_level, point_balance, created_at, updated_at) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+// ExistingEmails returns which of emails belong to active users
+func (r *sqliteUserRepository) ExistingEmails(ctx context.Context, emails []string) (_ map[string]bool, err error) {
+	existing := make(map[string]bool)
+	if len(emails) == 0 {
+		return existing, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(emails)), ", ")
+	query := `SELECT email FROM users WHERE deleted_at IS NULL AND email IN (` + placeholders + `)`
+	span := r.startSpan(ctx, "ExistingEmails", query)
+	defer func() { endQuerySpan(span, err) }()
+
+	args := make([]interface{}, len(emails))
+	for i, email := range emails {
+		args[i] = email
+	}
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		existing[email] = true
+	}
+	return existing, rows.Err()
+}
+
+// insertUserQuery inserts a user at version 1
+const insertUserQuery = `INSERT INTO users (first_name, last_name, email, phone, address, avatar, member_level, point_balance, created_at, updated_at, version) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`
+
+// Create inserts a new user into the database. A non-zero opening balance is
+// recorded in the points ledger in the same transaction.
+func (r *sqliteUserRepository) Create(ctx context.Context, user *domain.User) (err error) {
+	span := r.startSpan(ctx, "Create", insertUserQuery)
+	defer func() { endQuerySpan(span, err) }()
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(ctx, tx.Tx, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateBatch inserts the users in one transaction, skipping those whose
+// email is taken
+func (r *sqliteUserRepository) CreateBatch(ctx context.Context, users []*domain.User) (_ []error, err error) {
+	span := r.startSpan(ctx, "CreateBatch", insertUserQuery)
+	defer func() { endQuerySpan(span, err) }()
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// A failed INSERT only undoes itself, so the rest of the batch carries on
+	errs := make([]error, len(users))
+	for i, user := range users {
+		err := insertUser(ctx, tx.Tx, user)
+		if err == domain.ErrDuplicateEmail {
+			errs[i] = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
 
-	result, err := r.db.Exec(query,
+// insertUser inserts a user and its opening balance within tx, filling in
+// its ID and version
+func insertUser(ctx context.Context, tx *sql.Tx, user *domain.User) error {
+	result, err := tx.ExecContext(ctx, insertUserQuery,
 		user.FirstName,
 		user.LastName,
 		user.Email,
@@ -128,6 +402,9 @@ func (r *sqliteUserRepository) Create(user *domain.User) error {
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
+	if isUniqueViolation(err) {
+		return domain.ErrDuplicateEmail
+	}
 	if err != nil {
 		return err
 	}
@@ -137,17 +414,55 @@ func (r *sqliteUserRepository) Create(user *domain.User) error {
 		return err
 	}
 
+	if user.PointBalance != 0 {
+		err := insertPointTransaction(ctx, tx, &domain.PointTransaction{
+			UserID:       int(id),
+			Type:         domain.PointTransactionAdjust,
+			Amount:       user.PointBalance,
+			BalanceAfter: user.PointBalance,
+			Description:  "Opening balance",
+			CreatedAt:    user.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	user.ID = int(id)
+	user.Version = 1
 	return nil
 }
 
-// Update modifies an existing user in the database
-func (r *sqliteUserRepository) Update(user *domain.User) error {
+// Update modifies an existing user in the database if nobody else changed it
+// since it was read, bumping its version. If the point balance changed, the
+// difference is recorded as a ledger adjustment in the same transaction so
+// the balance always matches the ledger.
+func (r *sqliteUserRepository) Update(ctx context.Context, user *domain.User) (err error) {
 	query := `UPDATE users 
-	          SET first_name = ?, last_name = ?, email = ?, phone = ?, address = ?, avatar = ?, member_level = ?, point_balance = ?, updated_at = ? 
-			  WHERE id = ?`
+	          SET first_name = ?, last_name = ?, email = ?, phone = ?, address = ?, avatar = ?, member_level = ?, point_balance = ?, updated_at = ?, version = version + 1 
+			  WHERE id = ? AND version = ? AND deleted_at IS NULL`
+	span := r.startSpan(ctx, "Update", query)
+	defer func() { endQuerySpan(span, err) }()
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var balance, version int
+	err = tx.QueryRowContext(ctx, `SELECT point_balance, version FROM users WHERE id = ? AND deleted_at IS NULL`, user.ID).Scan(&balance, &version)
+	if err == sql.ErrNoRows {
+		return domain.ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if version != user.Version {
+		return domain.ErrVersionConflict
+	}
 
-	_, err := r.db.Exec(query,
+	result, err := tx.ExecContext(ctx, query,
 		user.FirstName,
 		user.LastName,
 		user.Email,
@@ -158,14 +473,148 @@ func (r *sqliteUserRepository) Update(user *domain.User) error {
 		user.PointBalance,
 		user.UpdatedAt,
 		user.ID,
+		user.Version,
 	)
+	if isUniqueViolation(err) {
+		return domain.ErrDuplicateEmail
+	}
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return domain.ErrVersionConflict
+	}
+
+	if diff := user.PointBalance - balance; diff != 0 {
+		err := insertPointTransaction(ctx, tx.Tx, &domain.PointTransaction{
+			UserID:       user.ID,
+			Type:         domain.PointTransactionAdjust,
+			Amount:       diff,
+			BalanceAfter: user.PointBalance,
+			Description:  "Balance set by user update",
+			CreatedAt:    user.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	user.Version++
+	return nil
+}
+
+// Delete soft-deletes a user if its version still matches. The row stays in
+// place, invisible to reads, until Purge removes it.
+func (r *sqliteUserRepository) Delete(ctx context.Context, id int, version int) (err error) {
+	query := `UPDATE users SET deleted_at = ?, updated_at = ?, version = version + 1
+	          WHERE id = ? AND version = ? AND deleted_at IS NULL`
+	span := r.startSpan(ctx, "Delete", query)
+	defer func() { endQuerySpan(span, err) }()
+
+	now := time.Now()
+	result, err := r.conn().ExecContext(ctx, query, now.UTC(), now, id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return r.missingOrConflict(ctx, id, false)
+	}
+	return nil
+}
+
+// Restore brings a soft-deleted user back if its version still matches
+func (r *sqliteUserRepository) Restore(ctx context.Context, id int, version int) (err error) {
+	query := `UPDATE users SET deleted_at = NULL, updated_at = ?, version = version + 1
+	          WHERE id = ? AND version = ? AND deleted_at IS NOT NULL`
+	span := r.startSpan(ctx, "Restore", query)
+	defer func() { endQuerySpan(span, err) }()
 
-	return err
+	result, err := r.conn().ExecContext(ctx, query, time.Now(), id, version)
+	if isUniqueViolation(err) {
+		return domain.ErrDuplicateEmail
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return r.missingOrConflict(ctx, id, true)
+	}
+	return nil
+}
+
+// Purge permanently removes users soft-deleted before the given time. Their
+// ledger entries go first, in the same transaction, as they reference users,
+// and so do their outbox events and the webhook deliveries of those, which
+// hold copies of the users' contact details. deleted_at is stored in UTC so
+// the text comparison orders correctly.
+func (r *sqliteUserRepository) Purge(ctx context.Context, before time.Time) (_ int, err error) {
+	query := `DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	span := r.startSpan(ctx, "Purge", query)
+	defer func() { endQuerySpan(span, err) }()
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	before = before.UTC()
+	purgedUsers := `SELECT id FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	for _, dependent := range []string{
+		`DELETE FROM point_transactions WHERE user_id IN (` + purgedUsers + `)`,
+		`DELETE FROM webhook_deliveries WHERE event_id IN (SELECT id FROM outbox_events WHERE user_id IN (` + purgedUsers + `))`,
+		`DELETE FROM outbox_events WHERE user_id IN (` + purgedUsers + `)`,
+	} {
+		if _, err = tx.ExecContext(ctx, dependent, before); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(purged), nil
 }
 
-// Delete removes a user from the database
-func (r *sqliteUserRepository) Delete(id int) error {
-	query := `DELETE FROM users WHERE id = ?`
-	_, err := r.db.Exec(query, id)
-	return err
+// missingOrConflict explains why a versioned write matched no row; deleted
+// selects whether the write targeted a soft-deleted or an active user
+func (r *sqliteUserRepository) missingOrConflict(ctx context.Context, id int, deleted bool) error {
+	query := `SELECT COUNT(*) FROM users WHERE id = ? AND deleted_at IS NULL`
+	if deleted {
+		query = `SELECT COUNT(*) FROM users WHERE id = ? AND deleted_at IS NOT NULL`
+	}
+
+	var exists int
+	if err := r.conn().QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return domain.ErrUserNotFound
+	}
+	return domain.ErrVersionConflict
 }
@@ -0,0 +1,444 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func seedUsers(t *testing.T, repo domain.UserRepository) {
+	ctx := context.Background()
+	base := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	seed := []struct {
+		email  string
+		level  string
+		points int
+	}{
+		{"a@example.com", "Bronze", 100},
+		{"b@example.com", "Silver", 1500},
+		{"c@example.com", "Gold", 6000},
+		{"d@example.com", "Silver", 1500},
+		{"e@example.com", "Bronze", 0},
+	}
+	for i, s := range seed {
+		created := base.Add(time.Duration(i) * 24 * time.Hour)
+		user := &domain.User{
+			FirstName:    "User",
+			LastName:     s.email[:1],
+			Email:        s.email,
+			MemberLevel:  s.level,
+			PointBalance: s.points,
+			CreatedAt:    created,
+			UpdatedAt:    created,
+		}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to seed user: %v", err)
+		}
+	}
+}
+
+func userIDs(users []*domain.User) []int {
+	ids := make([]int, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func TestUserRepository_FindPage_FilterAndCount(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	seedUsers(t, repo)
+
+	min := 1000
+	after := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	filter := domain.UserFilter{PointsMin: &min, CreatedAfter: &after}
+
+	users, err := repo.FindPage(ctx, domain.UserListQuery{
+		Filter: filter,
+		Sort:   []domain.SortField{{Field: "id"}},
+		Limit:  10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3, 4}, userIDs(users))
+
+	count, err := repo.Count(ctx, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	count, err = repo.Count(ctx, domain.UserFilter{MemberLevel: "Silver"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestUserRepository_FindPage_KeysetMixedDirections(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	seedUsers(t, repo)
+
+	sort := []domain.SortField{{Field: "point_balance", Desc: true}, {Field: "id"}}
+
+	all, err := repo.FindPage(ctx, domain.UserListQuery{Sort: sort, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 2, 4, 1, 5}, userIDs(all))
+
+	// After (1500, 2) comes the other 1500-point user, then the rest
+	next, err := repo.FindPage(ctx, domain.UserListQuery{
+		Sort:   sort,
+		Limit:  2,
+		Cursor: &domain.UserCursor{Values: []interface{}{1500, 2}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 1}, userIDs(next))
+
+	// Reading backwards from (100, 1) returns the rows just before it, in order
+	prev, err := repo.FindPage(ctx, domain.UserListQuery{
+		Sort:   sort,
+		Limit:  2,
+		Cursor: &domain.UserCursor{Values: []interface{}{100, 1}, Backward: true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 4}, userIDs(prev))
+}
+
+func TestUserRepository_FindPage_RejectsUnknownSortField(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+
+	_, err := repo.FindPage(ctx, domain.UserListQuery{
+		Sort:  []domain.SortField{{Field: "1; DROP TABLE users"}},
+		Limit: 10,
+	})
+	assert.Equal(t, domain.ErrInvalidSortField, err)
+}
+
+func TestUserRepository_Update_VersionConflict(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	user := createTestUser(t, repo, "somchai@example.com", 0)
+	assert.Equal(t, 1, user.Version)
+
+	stale := *user
+	user.FirstName = "สมศักดิ์"
+	assert.NoError(t, repo.Update(ctx, user))
+	assert.Equal(t, 2, user.Version)
+
+	stale.LastName = "ใจร้าย"
+	assert.Equal(t, domain.ErrVersionConflict, repo.Update(ctx, &stale))
+
+	stored, _ := repo.FindByID(ctx, user.ID)
+	assert.Equal(t, "ใจดี", stored.LastName)
+	assert.Equal(t, 2, stored.Version)
+}
+
+func TestUserRepository_Delete_Versioned(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	user := createTestUser(t, repo, "somchai@example.com", 0)
+
+	assert.Equal(t, domain.ErrVersionConflict, repo.Delete(ctx, user.ID, 7))
+	assert.Equal(t, domain.ErrUserNotFound, repo.Delete(ctx, 999, 1))
+	assert.NoError(t, repo.Delete(ctx, user.ID, 1))
+}
+
+func TestUserRepository_Delete_IsSoft(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	user := createTestUser(t, repo, "somchai@example.com", 0)
+	createTestUser(t, repo, "somsri@example.com", 0)
+	assert.NoError(t, repo.Delete(ctx, user.ID, 1))
+
+	found, err := repo.FindByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+	found, _ = repo.FindByEmail(ctx, "somchai@example.com")
+	assert.Nil(t, found)
+
+	count, _ := repo.Count(ctx, domain.UserFilter{})
+	assert.Equal(t, 1, count)
+	count, _ = repo.Count(ctx, domain.UserFilter{IncludeDeleted: true})
+	assert.Equal(t, 2, count)
+
+	deleted, err := repo.FindDeletedByID(ctx, user.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, deleted) {
+		assert.True(t, deleted.IsDeleted())
+		assert.Equal(t, 2, deleted.Version)
+	}
+
+	// A deleted user can be neither deleted again nor edited
+	assert.Equal(t, domain.ErrUserNotFound, repo.Delete(ctx, user.ID, 2))
+	deleted.FirstName = "สมศักดิ์"
+	assert.Equal(t, domain.ErrUserNotFound, repo.Update(ctx, deleted))
+}
+
+func TestUserRepository_Restore(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	user := createTestUser(t, repo, "somchai@example.com", 0)
+	assert.NoError(t, repo.Delete(ctx, user.ID, 1))
+
+	assert.Equal(t, domain.ErrVersionConflict, repo.Restore(ctx, user.ID, 1))
+	assert.NoError(t, repo.Restore(ctx, user.ID, 2))
+	assert.Equal(t, domain.ErrUserNotFound, repo.Restore(ctx, user.ID, 3))
+
+	restored, _ := repo.FindByID(ctx, user.ID)
+	if assert.NotNil(t, restored) {
+		assert.False(t, restored.IsDeleted())
+		assert.Equal(t, 3, restored.Version)
+	}
+}
+
+func TestUserRepository_EmailReuseAfterSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	original := createTestUser(t, repo, "somchai@example.com", 0)
+
+	duplicate := &domain.User{FirstName: "สมชาย", LastName: "ซ้ำ", Email: "somchai@example.com"}
+	assert.Equal(t, domain.ErrDuplicateEmail, repo.Create(ctx, duplicate))
+
+	assert.NoError(t, repo.Delete(ctx, original.ID, 1))
+	replacement := createTestUser(t, repo, "somchai@example.com", 0)
+
+	// The original cannot come back while its email is taken
+	assert.Equal(t, domain.ErrDuplicateEmail, repo.Restore(ctx, original.ID, 2))
+	assert.NoError(t, repo.Delete(ctx, replacement.ID, 1))
+	assert.NoError(t, repo.Restore(ctx, original.ID, 2))
+}
+
+func TestUserRepository_Purge(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userRepo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	old := createTestUser(t, userRepo, "old@example.com", 100)
+	recent := createTestUser(t, userRepo, "recent@example.com", 100)
+	active := createTestUser(t, userRepo, "active@example.com", 100)
+
+	assert.NoError(t, userRepo.Delete(ctx, old.ID, 1))
+	_, err := db.Exec(`UPDATE users SET deleted_at = ? WHERE id = ?`, time.Now().UTC().Add(-48*time.Hour), old.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, userRepo.Delete(ctx, recent.ID, 1))
+
+	// The outbox holds copies of both users, one already fanned out
+	webhookRepo := NewSQLiteWebhookRepository(db)
+	assert.NoError(t, webhookRepo.CreateSubscription(ctx, &domain.WebhookSubscription{URL: "https://crm.example.com/hooks", Secret: "whsec_a", CreatedAt: time.Now()}))
+	for _, user := range []*domain.User{old, recent} {
+		assert.NoError(t, userRepo.AppendEvents(ctx, &domain.Event{Type: domain.EventUserDeleted, UserID: user.ID, Data: []byte(`{"user":{"email":"` + user.Email + `"}}`), CreatedAt: time.Now()}))
+	}
+	_, err = webhookRepo.EnqueueDeliveries(ctx, time.Now(), 10)
+	assert.NoError(t, err)
+
+	purged, err := userRepo.Purge(ctx, time.Now().Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	gone, _ := userRepo.FindDeletedByID(ctx, old.ID)
+	assert.Nil(t, gone)
+	history, _ := pointRepo.FindByUserID(ctx, old.ID)
+	assert.Empty(t, history)
+	var events, deliveries int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM outbox_events WHERE user_id = ?`, old.ID).Scan(&events))
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM webhook_deliveries`).Scan(&deliveries))
+	assert.Zero(t, events)
+	assert.Equal(t, 1, deliveries)
+
+	kept, _ := userRepo.FindDeletedByID(ctx, recent.ID)
+	assert.NotNil(t, kept)
+	stillActive, _ := userRepo.FindByID(ctx, active.ID)
+	assert.NotNil(t, stillActive)
+}
+
+func TestUserRepository_HonoursContext(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	user := createTestUser(t, repo, "ctx@example.com", 100)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := repo.FindByID(cancelled, user.ID)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The test database has a single connection; while a transaction holds
+	// it, queries wait until their deadline
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	user.FirstName = "Changed"
+	err = repo.Update(ctx, user)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestUserRepository_CreateBatch(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	createTestUser(t, repo, "taken@example.com", 0)
+
+	now := time.Now()
+	newUser := func(email string, balance int) *domain.User {
+		return &domain.User{FirstName: "Jane", LastName: "Doe", Email: email, MemberLevel: "Bronze",
+			PointBalance: balance, CreatedAt: now, UpdatedAt: now}
+	}
+	users := []*domain.User{newUser("a@example.com", 300), newUser("taken@example.com", 0), newUser("b@example.com", 0)}
+
+	errs, err := repo.CreateBatch(ctx, users)
+	assert.NoError(t, err)
+	assert.Equal(t, []error{nil, domain.ErrDuplicateEmail, nil}, errs)
+	assert.NotZero(t, users[0].ID)
+	assert.Equal(t, 1, users[0].Version)
+	assert.Zero(t, users[1].ID)
+
+	history, _ := pointRepo.FindByUserID(ctx, users[0].ID)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, 300, history[0].Amount)
+	}
+
+	existing, err := repo.ExistingEmails(ctx, []string{"a@example.com", "b@example.com", "c@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a@example.com": true, "b@example.com": true}, existing)
+
+	assert.NoError(t, repo.Delete(ctx, users[2].ID, 1))
+	existing, _ = repo.ExistingEmails(ctx, []string{"b@example.com"})
+	assert.Empty(t, existing)
+}
+
+func TestUserRepository_Each(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+
+	// More than two batches, with many ties on each sort key
+	base := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	users := make([]*domain.User, 2*eachBatchSize+3)
+	for i := range users {
+		created := base.Add(time.Duration(i%5) * time.Hour)
+		users[i] = &domain.User{FirstName: "Jane", LastName: "Doe", Email: fmt.Sprintf("u%d@example.com", i),
+			MemberLevel: "Bronze", PointBalance: i % 7, CreatedAt: created, UpdatedAt: created}
+	}
+	if _, err := repo.CreateBatch(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+
+	min := 1
+	filter := domain.UserFilter{PointsMin: &min}
+	for _, sort := range [][]domain.SortField{
+		{{Field: "point_balance", Desc: true}},
+		{{Field: "created_at"}, {Field: "email", Desc: true}},
+	} {
+		want, err := repo.FindPage(ctx, domain.UserListQuery{Filter: filter, Sort: withIDTiebreaker(sort), Limit: len(users)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []*domain.User
+		err = repo.Each(ctx, filter, sort, func(user *domain.User) error {
+			got = append(got, user)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, userIDs(want), userIDs(got), "sort %v", sort)
+	}
+
+	stop := errors.New("stop")
+	seen := 0
+	err := repo.Each(ctx, domain.UserFilter{}, nil, func(*domain.User) error {
+		seen++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, seen)
+}
+
+func TestUserRepository_InTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	pointRepo := NewSQLitePointTransactionRepository(db)
+	kept := createTestUser(t, repo, "kept@example.com", 0)
+
+	// A failed write inside the transaction undoes only itself
+	err := repo.InTransaction(ctx, func(tx domain.UserRepository) error {
+		stale := *kept
+		kept.PointBalance = 250
+		if err := tx.Update(ctx, kept); err != nil {
+			return err
+		}
+		stale.PointBalance = 999
+		assert.Equal(t, domain.ErrVersionConflict, tx.Update(ctx, &stale))
+
+		// Joining the transaction commits nothing early
+		return tx.InTransaction(ctx, func(nested domain.UserRepository) error {
+			createTestUser(t, nested, "added@example.com", 0)
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+
+	stored, _ := repo.FindByID(ctx, kept.ID)
+	assert.Equal(t, 250, stored.PointBalance)
+	assert.Equal(t, 2, stored.Version)
+	history, _ := pointRepo.FindByUserID(ctx, kept.ID)
+	assert.Len(t, history, 1)
+	added, _ := repo.FindByEmail(ctx, "added@example.com")
+	assert.NotNil(t, added)
+
+	// Any error from fn rolls back everything it wrote
+	failed := errors.New("failed")
+	err = repo.InTransaction(ctx, func(tx domain.UserRepository) error {
+		createTestUser(t, tx, "rolled-back@example.com", 100)
+		assert.NoError(t, tx.Delete(ctx, kept.ID, kept.Version))
+		return failed
+	})
+	assert.Equal(t, failed, err)
+
+	rolledBack, _ := repo.FindByEmail(ctx, "rolled-back@example.com")
+	assert.Nil(t, rolledBack)
+	stored, _ = repo.FindByID(ctx, kept.ID)
+	assert.NotNil(t, stored)
+}
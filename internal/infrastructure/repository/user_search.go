@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	"workshop_4/internal/domain"
+)
+
+// searchFields are the user columns covered by member search, in users_fts order
+var searchFields = []string{"first_name", "last_name", "email", "phone", "address"}
+
+// minTrigramTerm is the shortest term the trigram tokenizer can match
+const minTrigramTerm = 3
+
+// Highlights are HTML: field values are escaped and matches wrapped in
+// <mark></mark>. FTS5 marks matches with these control characters, which
+// escaping leaves alone, before they are replaced with the tags.
+const (
+	ftsMarkOpen  = "\x02"
+	ftsMarkClose = "\x03"
+)
+
+// ftsMarks replaces the control characters FTS5 marked matches with in an
+// escaped value
+var ftsMarks = strings.NewReplacer(ftsMarkOpen, "<mark>", ftsMarkClose, "</mark>")
+
+// searchTerms splits a search query into terms. Zero-width characters are
+// dropped because Thai text often carries U+200B as an invisible word break,
+// which would otherwise prevent a pasted name from matching.
+func searchTerms(query string) []string {
+	query = strings.Map(func(r rune) rune {
+		switch r {
+		case '\u200b', '\u200c', '\u200d', '\ufeff':
+			return -1
+		}
+		return r
+	}, query)
+	return strings.Fields(query)
+}
+
+// Search finds users by any fragment of name, email, phone or address. It
+// uses the users_fts index; terms shorter than a trigram cannot be matched
+// by the index, so those queries fall back to LIKE matching.
+func (r *sqliteUserRepository) Search(ctx context.Context, query string, limit int) ([]*domain.UserSearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, domain.ErrInvalidSearch
+	}
+
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < minTrigramTerm {
+			return r.searchLike(ctx, terms, limit)
+		}
+	}
+	return r.searchFTS(ctx, terms, limit)
+}
+
+// searchFTS ranks matches with bm25, weighting names above contact details
+func (r *sqliteUserRepository) searchFTS(ctx context.Context, terms []string, limit int) (_ []*domain.UserSearchResult, err error) {
+	// Quote every term so user input is never parsed as FTS5 query syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	highlights := make([]string, len(searchFields))
+	for i := range searchFields {
+		highlights[i] = fmt.Sprintf(`highlight(users_fts, %d, char(2), char(3))`, i)
+	}
+
+	query := `SELECT ` + userColumnsOf("u") + `, bm25(users_fts, 10.0, 10.0, 5.0, 5.0, 1.0) AS rank, ` +
+		strings.Join(highlights, ", ") + `
+	          FROM users_fts JOIN users u ON u.id = users_fts.rowid
+	          WHERE users_fts MATCH ? AND u.deleted_at IS NULL ORDER BY rank LIMIT ?`
+	span := r.startSpan(ctx, "Search", query)
+	defer func() { endQuerySpan(span, err) }()
+
+	rows, err := r.conn().QueryContext(ctx, query, strings.Join(quoted, " "), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*domain.UserSearchResult
+	for rows.Next() {
+		user := &domain.User{}
+		result := &domain.UserSearchResult{User: user, Highlights: map[string]string{}}
+		marked := make([]sql.NullString, len(searchFields))
+
+		dest := append(userScanDest(user), &result.Rank)
+		for i := range marked {
+			dest = append(dest, &marked[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		for i, field := range searchFields {
+			if strings.Contains(marked[i].String, ftsMarkOpen) {
+				result.Highlights[field] = ftsMarks.Replace(html.EscapeString(marked[i].String))
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// searchLike matches every term against any search field with LIKE and
+// ranks rows by how many term/field pairs they match
+func (r *sqliteUserRepository) searchLike(ctx context.Context, terms []string, limit int) (_ []*domain.UserSearchResult, err error) {
+	where := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		var fields []string
+		for _, field := range searchFields {
+			fields = append(fields, field+` LIKE ? ESCAPE '\'`)
+			args = append(args, pattern)
+		}
+		where = append(where, "("+strings.Join(fields, " OR ")+")")
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + strings.Join(where, " AND ") + ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+	span := r.startSpan(ctx, "Search", query)
+	defer func() { endQuerySpan(span, err) }()
+
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*domain.UserSearchResult
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &domain.UserSearchResult{User: user, Highlights: map[string]string{}}
+		values := []string{user.FirstName, user.LastName, user.Email, user.Phone, user.Address}
+		for i, field := range searchFields {
+			marked, hits := highlightTerms(values[i], terms)
+			if hits > 0 {
+				result.Highlights[field] = marked
+				result.Rank -= float64(hits)
+			}
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank < results[j].Rank
+	})
+	return results, nil
+}
+
+// escapeLike escapes LIKE wildcards for use with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// highlightTerms HTML-escapes value, wraps case-insensitive occurrences of
+// the terms in <mark></mark> and returns the number of terms found
+func highlightTerms(value string, terms []string) (string, int) {
+	lower := strings.ToLower(value)
+	if len(lower) != len(value) {
+		// Case folding changed byte offsets; match case-sensitively instead
+		lower = value
+	}
+
+	marks := make([]bool, len(value))
+	hits := 0
+	for _, term := range terms {
+		needle := strings.ToLower(term)
+		found := false
+		for start := 0; start <= len(lower)-len(needle); {
+			i := strings.Index(lower[start:], needle)
+			if i < 0 {
+				break
+			}
+			for k := start + i; k < start+i+len(needle); k++ {
+				marks[k] = true
+			}
+			found = true
+			start += i + len(needle)
+		}
+		if found {
+			hits++
+		}
+	}
+	if hits == 0 {
+		return value, 0
+	}
+
+	// Runs of marked and unmarked bytes start and end on term boundaries, so
+	// each is whole UTF-8 and can be escaped on its own
+	var b strings.Builder
+	for start := 0; start < len(value); {
+		end := start + 1
+		for end < len(value) && marks[end] == marks[start] {
+			end++
+		}
+		if marks[start] {
+			b.WriteString("<mark>" + html.EscapeString(value[start:end]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(value[start:end]))
+		}
+		start = end
+	}
+	return b.String(), hits
+}
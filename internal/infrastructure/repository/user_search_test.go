@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func seedSearchUsers(t *testing.T, repo domain.UserRepository) {
+	ctx := context.Background()
+	createTestUser(t, repo, "somchai.jaidee@example.com", 0)
+	user := createTestUser(t, repo, "malee@example.com", 0)
+	user.FirstName = "มาลี"
+	user.LastName = "สุขสันต์"
+	user.Phone = "0812345678"
+	user.Address = "99 ถนนสุขุมวิท กรุงเทพฯ"
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatalf("Failed to update test user: %v", err)
+	}
+}
+
+func TestUserRepository_Search_FTS(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	seedSearchUsers(t, repo)
+
+	// Fragment from the middle of a Thai first name
+	results, err := repo.Search(ctx, "ชาย", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "somchai.jaidee@example.com", results[0].User.Email)
+	assert.Equal(t, "สม<mark>ชาย</mark>", results[0].Highlights["first_name"])
+
+	// The index follows updates made through the triggers
+	results, err = repo.Search(ctx, "สุขุมวิท 2345", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "มาลี", results[0].User.FirstName)
+	assert.Contains(t, results[0].Highlights, "address")
+	assert.Contains(t, results[0].Highlights, "phone")
+
+	// FTS5 query syntax in user input is treated literally
+	results, err = repo.Search(ctx, `"OR* NEAR(`, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestUserRepository_Search_LikeFallback(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	seedSearchUsers(t, repo)
+
+	// Terms shorter than a trigram; a zero-width space inside one is ignored
+	results, err := repo.Search(ctx, "ม\u200bา", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "<mark>มา</mark>ลี", results[0].Highlights["first_name"])
+	}
+
+	results, err = repo.Search(ctx, "EX", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// LIKE wildcards in user input are treated literally
+	results, err = repo.Search(ctx, "0%", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestUserRepository_Search_EscapesHighlights(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewSQLiteUserRepository(db)
+	user := createTestUser(t, repo, "xss@example.com", 0)
+	user.Address = `<img src=x onerror="alert(1)"> Sukhumvit`
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatalf("Failed to update test user: %v", err)
+	}
+
+	// Both the index and the LIKE fallback (for a two-character term)
+	for _, query := range []string{"Sukhumvit", "im"} {
+		results, err := repo.Search(ctx, query, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1, "query: %q", query) {
+			assert.NotContains(t, results[0].Highlights["address"], "<img")
+			assert.Contains(t, results[0].Highlights["address"], "&lt;")
+			assert.Contains(t, results[0].Highlights["address"], "<mark>")
+		}
+	}
+}
+
+func TestHighlightTerms(t *testing.T) {
+	marked, hits := highlightTerms("Somchai Jaidee", []string{"chai", "JAI"})
+
+	assert.Equal(t, 2, hits)
+	assert.Equal(t, "Som<mark>chai</mark> <mark>Jai</mark>dee", marked)
+
+	marked, hits = highlightTerms(`<b>Tom & "Jerry"</b>`, []string{"tom"})
+	assert.Equal(t, 1, hits)
+	assert.Equal(t, "&lt;b&gt;<mark>Tom</mark> &amp; &#34;Jerry&#34;&lt;/b&gt;", marked)
+}
@@ -0,0 +1,365 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// sqliteWebhookRepository implements domain.WebhookRepository
+type sqliteWebhookRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteWebhookRepository creates a new SQLite webhook repository
+func NewSQLiteWebhookRepository(db *sql.DB) domain.WebhookRepository {
+	return &sqliteWebhookRepository{db: db}
+}
+
+// subscriptionColumns is the column list shared by every
+// webhook_subscriptions SELECT, in scanSubscription order
+const subscriptionColumns = `id, url, event_types, description, secret, created_by, created_at`
+
+// scanSubscription scans a row selected with subscriptionColumns
+func scanSubscription(row rowScanner) (*domain.WebhookSubscription, error) {
+	sub := &domain.WebhookSubscription{}
+	var eventTypes string
+	var createdBy sql.NullString
+	err := row.Scan(&sub.ID, &sub.URL, &eventTypes, &sub.Description, &sub.Secret, &createdBy, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	sub.EventTypes = strings.Fields(eventTypes)
+	sub.CreatedBy = createdBy.String
+	return sub, nil
+}
+
+// deliveryColumns is the column list shared by every webhook_deliveries
+// SELECT, joined with its event as e, in scanDelivery order
+const deliveryColumns = `d.id, d.subscription_id, d.status, d.attempts, d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at,
+	e.id, e.type, e.user_id, e.data, e.created_at`
+
+const deliveriesFrom = ` FROM webhook_deliveries d JOIN outbox_events e ON e.id = d.event_id`
+
+// scanDelivery scans a row selected with deliveryColumns
+func scanDelivery(row rowScanner) (*domain.WebhookDelivery, error) {
+	delivery := &domain.WebhookDelivery{Event: &domain.Event{}}
+	var data string
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.SubscriptionID,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+		&delivery.Event.ID,
+		&delivery.Event.Type,
+		&delivery.Event.UserID,
+		&data,
+		&delivery.Event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Event.Data = []byte(data)
+	return delivery, nil
+}
+
+// scanDeliveries scans every row of rows and closes them
+func scanDeliveries(rows *sql.Rows) ([]*domain.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []*domain.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// CreateSubscription stores a new webhook subscription
+func (r *sqliteWebhookRepository) CreateSubscription(ctx context.Context, sub *domain.WebhookSubscription) error {
+	query := `INSERT INTO webhook_subscriptions (url, event_types, description, secret, created_by, created_at)
+	          VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		sub.URL,
+		strings.Join(sub.EventTypes, " "),
+		sub.Description,
+		sub.Secret,
+		sub.CreatedBy,
+		sub.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	sub.ID = int(id)
+	return nil
+}
+
+// FindSubscriptions retrieves every webhook subscription, oldest first
+func (r *sqliteWebhookRepository) FindSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	return findSubscriptions(ctx, r.db)
+}
+
+// findSubscriptions retrieves every webhook subscription through q
+func findSubscriptions(ctx context.Context, q querier) ([]*domain.WebhookSubscription, error) {
+	rows, err := q.QueryContext(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*domain.WebhookSubscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// FindSubscriptionByID retrieves a webhook subscription by ID
+func (r *sqliteWebhookRepository) FindSubscriptionByID(ctx context.Context, id int) (*domain.WebhookSubscription, error) {
+	sub, err := scanSubscription(r.db.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// DeleteSubscription deletes a subscription and its deliveries
+func (r *sqliteWebhookRepository) DeleteSubscription(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE subscription_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrWebhookNotFound
+	}
+	return tx.Commit()
+}
+
+// EnqueueDeliveries fans out the oldest events not yet enqueued, each to the
+// subscriptions that exist at the time
+func (r *sqliteWebhookRepository) EnqueueDeliveries(ctx context.Context, now time.Time, limit int) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, type FROM outbox_events WHERE enqueued_at IS NULL ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return 0, err
+	}
+	type pendingEvent struct {
+		id        int
+		eventType string
+	}
+	var events []pendingEvent
+	for rows.Next() {
+		var event pendingEvent
+		if err := rows.Scan(&event.id, &event.eventType); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	subs, err := findSubscriptions(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	now = now.UTC()
+	for _, event := range events {
+		for _, sub := range subs {
+			if !sub.Wants(event.eventType) {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO webhook_deliveries (subscription_id, event_id, status, next_attempt_at, created_at)
+			                               VALUES (?, ?, ?, ?, ?)`, sub.ID, event.id, domain.DeliveryPending, now, now)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox_events SET enqueued_at = ? WHERE id = ?`, now, event.id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// FindDueDeliveries retrieves pending deliveries due by now, longest due first
+func (r *sqliteWebhookRepository) FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+deliveryColumns+deliveriesFrom+`
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id LIMIT ?`, domain.DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+// UpdateDelivery stores the outcome of a delivery attempt
+func (r *sqliteWebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries
+	          SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, delivered_at = ?
+	          WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query,
+		delivery.Status,
+		delivery.Attempts,
+		utcOrNil(delivery.NextAttemptAt),
+		delivery.LastStatusCode,
+		delivery.LastError,
+		utcOrNil(delivery.DeliveredAt),
+		delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// FindDeliveries retrieves a subscription's deliveries, newest first
+func (r *sqliteWebhookRepository) FindDeliveries(ctx context.Context, subscriptionID int, status string, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + deliveriesFrom + ` WHERE d.subscription_id = ?`
+	args := []interface{}{subscriptionID}
+	if status != "" {
+		query += ` AND d.status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY d.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+// FindDeliveryByID retrieves a delivery by ID
+func (r *sqliteWebhookRepository) FindDeliveryByID(ctx context.Context, id int) (*domain.WebhookDelivery, error) {
+	delivery, err := scanDelivery(r.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+deliveriesFrom+` WHERE d.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return delivery, err
+}
+
+// requeueQuery makes deliveries pending again with a fresh set of attempts;
+// the outcome of the last attempt is kept until the next one replaces it
+const requeueQuery = `UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?, delivered_at = NULL WHERE `
+
+// RequeueDelivery makes a delivery pending again, due at now
+func (r *sqliteWebhookRepository) RequeueDelivery(ctx context.Context, id int, now time.Time) error {
+	result, err := r.db.ExecContext(ctx, requeueQuery+`id = ?`, domain.DeliveryPending, now.UTC(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// RequeueDeadDeliveries makes every dead delivery of a subscription pending
+// again, due at now
+func (r *sqliteWebhookRepository) RequeueDeadDeliveries(ctx context.Context, subscriptionID int, now time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, requeueQuery+`subscription_id = ? AND status = ?`,
+		domain.DeliveryPending, now.UTC(), subscriptionID, domain.DeliveryDead)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// deliveredEvents selects the outbox events created before a time that have
+// been fanned out and have no delivery other than a successful one
+const deliveredEvents = `SELECT id FROM outbox_events e
+	WHERE e.enqueued_at IS NOT NULL AND e.created_at < ?
+	AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = e.id AND d.status != ?)`
+
+// DeleteDeliveredEvents deletes delivered events and their deliveries in
+// one transaction. A pending or dead delivery keeps its event, so it can
+// still be retried or replayed.
+func (r *sqliteWebhookRepository) DeleteDeliveredEvents(ctx context.Context, before time.Time) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	before = before.UTC()
+	_, err = tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE event_id IN (`+deliveredEvents+`)`, before, domain.DeliveryDelivered)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM outbox_events WHERE id IN (`+deliveredEvents+`)`, before, domain.DeliveryDelivered)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(deleted), nil
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserRepository_AppendEvents_JoinsTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := NewSQLiteUserRepository(db)
+
+	event := func(eventType string) *domain.Event {
+		return &domain.Event{Type: eventType, UserID: 1, Data: []byte(`{}`), CreatedAt: time.Now()}
+	}
+	failed := errors.New("change failed")
+	err := repo.InTransaction(ctx, func(tx domain.UserRepository) error {
+		assert.NoError(t, tx.AppendEvents(ctx, event(domain.EventUserDeleted)))
+		return failed
+	})
+	assert.Equal(t, failed, err)
+
+	committed := event(domain.EventUserCreated)
+	assert.NoError(t, repo.InTransaction(ctx, func(tx domain.UserRepository) error {
+		return tx.AppendEvents(ctx, committed)
+	}))
+	assert.NotZero(t, committed.ID)
+
+	// Only the committed event reached the outbox
+	var types []string
+	rows, err := db.Query(`SELECT type FROM outbox_events ORDER BY id`)
+	assert.NoError(t, err)
+	for rows.Next() {
+		var eventType string
+		assert.NoError(t, rows.Scan(&eventType))
+		types = append(types, eventType)
+	}
+	rows.Close()
+	assert.Equal(t, []string{domain.EventUserCreated}, types)
+}
+
+func TestWebhookRepository_Deliveries(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	users := NewSQLiteUserRepository(db)
+	repo := NewSQLiteWebhookRepository(db)
+	now := time.Now()
+
+	all := &domain.WebhookSubscription{URL: "https://crm.example.com/hooks", Secret: "whsec_a", CreatedBy: "admin-1", CreatedAt: now}
+	tiers := &domain.WebhookSubscription{URL: "https://mail.example.com/hooks", EventTypes: []string{domain.EventUserTierChanged}, Secret: "whsec_b", CreatedAt: now}
+	assert.NoError(t, repo.CreateSubscription(ctx, all))
+	assert.NoError(t, repo.CreateSubscription(ctx, tiers))
+
+	found, err := repo.FindSubscriptionByID(ctx, tiers.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, []string{domain.EventUserTierChanged}, found.EventTypes)
+		assert.Equal(t, "whsec_b", found.Secret)
+	}
+
+	created := &domain.Event{Type: domain.EventUserCreated, UserID: 1, Data: []byte(`{"user":{"id":1}}`), CreatedAt: now}
+	tierChanged := &domain.Event{Type: domain.EventUserTierChanged, UserID: 1, Data: []byte(`{}`), CreatedAt: now}
+	assert.NoError(t, users.AppendEvents(ctx, created, tierChanged))
+
+	// Each event goes to the subscriptions that want it, once
+	enqueued, err := repo.EnqueueDeliveries(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, enqueued)
+	enqueued, err = repo.EnqueueDeliveries(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Zero(t, enqueued)
+
+	due, err := repo.FindDueDeliveries(ctx, now.Add(time.Second), 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 3)
+
+	toAll, err := repo.FindDeliveries(ctx, all.ID, "", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, toAll, 2) {
+		// Newest first
+		assert.Equal(t, domain.EventUserTierChanged, toAll[0].Event.Type)
+		assert.Equal(t, `{"user":{"id":1}}`, string(toAll[1].Event.Data))
+	}
+
+	// A dead delivery leaves the due list until it is requeued
+	dead := toAll[0]
+	dead.Status = domain.DeliveryDead
+	dead.Attempts = 8
+	dead.NextAttemptAt = nil
+	dead.LastStatusCode = 500
+	dead.LastError = "endpoint responded 500"
+	assert.NoError(t, repo.UpdateDelivery(ctx, dead))
+
+	due, err = repo.FindDueDeliveries(ctx, now.Add(time.Second), 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 2)
+	deadOnly, err := repo.FindDeliveries(ctx, all.ID, domain.DeliveryDead, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deadOnly, 1)
+
+	requeued, err := repo.RequeueDeadDeliveries(ctx, all.ID, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+	replayed, err := repo.FindDeliveryByID(ctx, dead.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, replayed) {
+		assert.Equal(t, domain.DeliveryPending, replayed.Status)
+		assert.Zero(t, replayed.Attempts)
+		assert.Equal(t, "endpoint responded 500", replayed.LastError)
+	}
+	assert.Equal(t, domain.ErrWebhookDeliveryNotFound, repo.RequeueDelivery(ctx, 999, now))
+
+	// Deleting a subscription drops its deliveries
+	assert.NoError(t, repo.DeleteSubscription(ctx, all.ID))
+	assert.Equal(t, domain.ErrWebhookNotFound, repo.DeleteSubscription(ctx, all.ID))
+	due, err = repo.FindDueDeliveries(ctx, now.Add(time.Second), 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+}
+
+// countRows counts the rows of a table
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+		t.Fatalf("Failed to count %s: %v", table, err)
+	}
+	return n
+}
+
+func TestWebhookRepository_DeleteDeliveredEvents(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	users := NewSQLiteUserRepository(db)
+	repo := NewSQLiteWebhookRepository(db)
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	sub := &domain.WebhookSubscription{URL: "https://crm.example.com/hooks", Secret: "whsec_a", CreatedAt: now}
+	assert.NoError(t, repo.CreateSubscription(ctx, sub))
+	delivered := &domain.Event{Type: domain.EventUserCreated, UserID: 1, Data: []byte(`{}`), CreatedAt: old}
+	failing := &domain.Event{Type: domain.EventUserUpdated, UserID: 1, Data: []byte(`{}`), CreatedAt: old}
+	recent := &domain.Event{Type: domain.EventUserUpdated, UserID: 1, Data: []byte(`{}`), CreatedAt: now}
+	assert.NoError(t, users.AppendEvents(ctx, delivered, failing, recent))
+	_, err := repo.EnqueueDeliveries(ctx, now, 10)
+	assert.NoError(t, err)
+
+	deliveries, err := repo.FindDeliveries(ctx, sub.ID, "", 10)
+	assert.NoError(t, err)
+	for _, delivery := range deliveries {
+		delivery.Status = domain.DeliveryDelivered
+		if delivery.Event.ID == failing.ID {
+			delivery.Status = domain.DeliveryDead
+		}
+		delivery.NextAttemptAt = nil
+		assert.NoError(t, repo.UpdateDelivery(ctx, delivery))
+	}
+
+	// Only the old event delivered everywhere goes; a dead delivery keeps
+	// its event for a replay
+	deleted, err := repo.DeleteDeliveredEvents(ctx, now.Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, 2, countRows(t, db, "outbox_events"))
+	assert.Equal(t, 2, countRows(t, db, "webhook_deliveries"))
+	var gone int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM outbox_events WHERE id = ?`, delivered.ID).Scan(&gone))
+	assert.Zero(t, gone)
+}
@@ -0,0 +1,48 @@
+// Package webhook delivers webhook requests over HTTP
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// userAgent identifies the service to webhook receivers
+const userAgent = "workshop_4-webhooks/1.0"
+
+// maxResponseBody bounds how much of a response is read before the
+// connection is reused
+const maxResponseBody = 64 << 10
+
+// HTTPSender posts webhook deliveries; it implements usecase.WebhookSender
+type HTTPSender struct {
+	client *http.Client
+}
+
+// NewHTTPSender creates a sender giving up on a request after timeout
+func NewHTTPSender(timeout time.Duration) *HTTPSender {
+	return &HTTPSender{client: &http.Client{Timeout: timeout}}
+}
+
+// Send posts body as JSON with the headers and returns the response status
+func (s *HTTPSender) Send(ctx context.Context, url string, headers map[string]string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,94 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"workshop_4/internal/domain"
+	"workshop_4/middleware"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys carrying credentials, as the HTTP headers of the same names
+const (
+	metadataAuthorization = "authorization"
+	metadataAPIKey        = "x-api-key"
+)
+
+// claimsKey is the context key of a call's verified *middleware.Claims
+type claimsKey struct{}
+
+// authenticator verifies the credentials of a call as the HTTP API does: an
+// x-api-key entry is tried first, then an "authorization: Bearer" token
+type authenticator struct {
+	verifier *middleware.JWTVerifier
+	apiKeys  middleware.APIKeyAuthenticator
+}
+
+// authenticate returns ctx carrying the caller's claims, or an
+// Unauthenticated status
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if key := strings.TrimSpace(firstValue(md, metadataAPIKey)); key != "" {
+		claims, err := a.apiKeys(ctx, key)
+		if err != nil {
+			return ctx, err
+		}
+		if claims == nil {
+			return ctx, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		claims.Method = middleware.AuthMethodAPIKey
+		return context.WithValue(ctx, claimsKey{}, claims), nil
+	}
+
+	scheme, token, found := strings.Cut(firstValue(md, metadataAuthorization), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return ctx, status.Error(codes.Unauthenticated, "missing authorization token")
+	}
+	claims, err := a.verifier.Verify(strings.TrimSpace(token))
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, "the access token is invalid")
+	}
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
+
+// firstValue returns the first metadata value of key, or ""
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// claimsFrom returns the claims verified for the call, or nil
+func claimsFrom(ctx context.Context) *middleware.Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*middleware.Claims)
+	return claims
+}
+
+// principalFrom returns the caller verified by the authenticator, or nil.
+// As over HTTP, an API key holds its scopes as permissions and a token its
+// roles.
+func principalFrom(ctx context.Context) *domain.Principal {
+	claims := claimsFrom(ctx)
+	if claims == nil {
+		return nil
+	}
+	if claims.Method == middleware.AuthMethodAPIKey {
+		scopes := make([]domain.Permission, len(claims.Scopes))
+		for i, scope := range claims.Scopes {
+			scopes[i] = domain.Permission(scope)
+		}
+		return &domain.Principal{
+			Subject: claims.Subject,
+			Scopes:  scopes,
+		}
+	}
+	return &domain.Principal{
+		Subject: claims.Subject,
+		Roles:   claims.Roles,
+	}
+}
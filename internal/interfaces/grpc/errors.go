@@ -0,0 +1,58 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"workshop_4/internal/domain"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errVersionRequired fails a write that names no version, which over HTTP
+// would lack an If-Match header
+var errVersionRequired = status.Error(codes.FailedPrecondition, "version is required")
+
+// errorCodes maps the domain errors a caller can fix, or has to know about,
+// to their gRPC status code
+var errorCodes = map[error]codes.Code{
+	domain.ErrUserNotFound:        codes.NotFound,
+	domain.ErrDuplicateEmail:      codes.AlreadyExists,
+	domain.ErrVersionConflict:     codes.Aborted,
+	domain.ErrFirstNameRequired:   codes.InvalidArgument,
+	domain.ErrLastNameRequired:    codes.InvalidArgument,
+	domain.ErrEmailRequired:       codes.InvalidArgument,
+	domain.ErrInvalidEmail:        codes.InvalidArgument,
+	domain.ErrInvalidUserID:       codes.InvalidArgument,
+	domain.ErrInvalidMemberLevel:  codes.InvalidArgument,
+	domain.ErrInvalidPointBalance: codes.InvalidArgument,
+	domain.ErrInvalidSortField:    codes.InvalidArgument,
+	domain.ErrInvalidCursor:       codes.InvalidArgument,
+	domain.ErrInvalidPagination:   codes.InvalidArgument,
+	domain.ErrInvalidFilter:       codes.InvalidArgument,
+}
+
+// statusFor converts the error a call failed with to the status sent to the
+// client. Unexpected errors become a bare Internal status, so their details
+// only reach the log.
+func statusFor(err error) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	if errors.Is(err, domain.ErrForbidden) {
+		return status.New(codes.PermissionDenied, err.Error())
+	}
+	if code, ok := errorCodes[err]; ok {
+		return status.New(code, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.New(codes.DeadlineExceeded, "request timed out")
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.New(codes.Canceled, "request canceled")
+	}
+	return status.New(codes.Internal, "internal error")
+}
@@ -0,0 +1,289 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	userv1 "workshop_4/api/user/v1"
+	"workshop_4/logging"
+	"workshop_4/middleware"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// healthMethodPrefix starts the methods of the health service, which load
+// balancers call without credentials
+const healthMethodPrefix = "/grpc.health.v1.Health/"
+
+// rateLimitGroup is the rate limit group calls count against. The user
+// service mirrors the /api/v1/users routes, so it shares their limits.
+const rateLimitGroup = "users"
+
+// metadataRetryAfter is the header entry telling a rate limited caller how
+// many seconds to wait, as the HTTP Retry-After header does
+const metadataRetryAfter = "retry-after"
+
+// loggerFrom returns the call's logger, or the default logger outside the
+// server's interceptors
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := logging.FromContext(ctx); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// CallMetrics records finished calls. It is satisfied by *metrics.Metrics.
+type CallMetrics interface {
+	GRPCCallHandled(fullMethod string, code codes.Code, elapsed time.Duration)
+}
+
+// ServerConfig configures the gRPC server
+type ServerConfig struct {
+	Logger   *slog.Logger
+	Verifier *middleware.JWTVerifier
+	APIKeys  middleware.APIKeyAuthenticator
+	// Limiter applies the HTTP API's rate limits and daily quotas to every
+	// authenticated call; nil applies none
+	Limiter *middleware.RateLimiter
+	// Metrics records every call, and StatsHandler traces it; nil does
+	// neither
+	Metrics      CallMetrics
+	StatsHandler stats.Handler
+	// Timeout bounds the database work of a unary call, and StreamTimeout
+	// that of a streamed one, as DB_TIMEOUT and EXPORT_TIMEOUT do over HTTP.
+	// Zero disables the deadline.
+	Timeout       time.Duration
+	StreamTimeout time.Duration
+}
+
+// Server serves the user service alongside health checking and server
+// reflection. Every call but a health check must be authenticated, and is
+// rate limited, like a call to the HTTP API.
+type Server struct {
+	cfg    ServerConfig
+	auth   *authenticator
+	server *grpc.Server
+	health *health.Server
+}
+
+// NewServer creates a gRPC server for the user service
+func NewServer(cfg ServerConfig, users *UserService) *Server {
+	s := &Server{
+		cfg:    cfg,
+		auth:   &authenticator{verifier: cfg.Verifier, apiKeys: cfg.APIKeys},
+		health: health.NewServer(),
+	}
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	}
+	if cfg.StatsHandler != nil {
+		opts = append(opts, grpc.StatsHandler(cfg.StatsHandler))
+	}
+	s.server = grpc.NewServer(opts...)
+
+	userv1.RegisterUserServiceServer(s.server, users)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	reflection.Register(s.server)
+	s.health.SetServingStatus(userv1.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	return s
+}
+
+// Serve accepts connections on lis until Shutdown
+func (s *Server) Serve(lis net.Listener) error {
+	err := s.server.Serve(lis)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown reports the server as not serving, stops accepting calls and
+// waits up to timeout for those in flight, then cancels the rest
+func (s *Server) Shutdown(timeout time.Duration) error {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(timeout):
+		s.server.Stop()
+		return context.DeadlineExceeded
+	}
+}
+
+// begin authenticates and rate limits a call and gives its context a logger
+// and a deadline of d. Calls failing to authenticate count against their
+// address's anonymous bucket. Health checks need no credentials, are not limited
+// and have no deadline, as a watch lasts as long as the client wants.
+func (s *Server) begin(ctx context.Context, method string, d time.Duration) (context.Context, context.CancelFunc, error) {
+	logger := s.cfg.Logger.With("grpc_method", method)
+	if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+		logger = logger.With("trace_id", span.TraceID().String())
+	}
+	ctx = logging.NewContext(ctx, logger)
+	if strings.HasPrefix(method, healthMethodPrefix) {
+		return ctx, func() {}, nil
+	}
+
+	if err := s.limitAnonymous(ctx); err != nil {
+		return ctx, func() {}, err
+	}
+	ctx, err := s.auth.authenticate(ctx)
+	if err != nil {
+		if s.cfg.Limiter != nil {
+			client, _ := middleware.RateLimitClient(nil, peerIP(ctx))
+			s.cfg.Limiter.FailedAuth(client, middleware.RateLimitAuthGroup)
+		}
+		return ctx, func() {}, err
+	}
+	claims := claimsFrom(ctx)
+	ctx = logging.NewContext(ctx, loggerFrom(ctx).With(slog.Group("caller",
+		slog.String("subject", claims.Subject),
+		slog.String("method", claims.Method),
+	)))
+	if err := s.limit(ctx, claims); err != nil {
+		return ctx, func() {}, err
+	}
+	if d <= 0 {
+		return ctx, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	return ctx, cancel, nil
+}
+
+// limit takes the call from the caller's rate limit and daily quota, as
+// the HTTP routes of rateLimitGroup do. A rejected call gets
+// ResourceExhausted and a retry-after header entry; a quota store failure
+// lets the call through.
+func (s *Server) limit(ctx context.Context, claims *middleware.Claims) error {
+	if s.cfg.Limiter == nil {
+		return nil
+	}
+	client, tier := middleware.RateLimitClient(claims, peerIP(ctx))
+	result, err := s.cfg.Limiter.Check(ctx, client, tier, rateLimitGroup)
+	if err != nil {
+		loggerFrom(ctx).Warn("quota check failed", "client", client, "error", err)
+	}
+	if result.Allowed {
+		return nil
+	}
+	return rateLimited(ctx, result.RetryAfter, result.Error)
+}
+
+// limitAnonymous rejects a call from an address that failed to
+// authenticate too often before checking its credentials, as
+// LimitAnonymous does over HTTP. Failures of both count alike.
+func (s *Server) limitAnonymous(ctx context.Context) error {
+	if s.cfg.Limiter == nil {
+		return nil
+	}
+	client, _ := middleware.RateLimitClient(nil, peerIP(ctx))
+	if wait := s.cfg.Limiter.AnonymousWait(client, middleware.RateLimitAuthGroup); wait > 0 {
+		return rateLimited(ctx, wait, "Too many unauthenticated requests")
+	}
+	return nil
+}
+
+// rateLimited sets the retry-after header entry of a rejected call and
+// returns its ResourceExhausted status
+func rateLimited(ctx context.Context, retryAfter time.Duration, msg string) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	grpc.SetHeader(ctx, metadata.Pairs(metadataRetryAfter, strconv.Itoa(seconds)))
+	return status.Error(codes.ResourceExhausted, msg)
+}
+
+// peerIP returns the IP address of the caller, or its address as is when
+// it has no host part
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// finish converts a call's error to its status, records the call's metrics
+// and writes one record for the call with its code, latency and the error
+// behind a failure
+func (s *Server) finish(ctx context.Context, method string, start time.Time, err error) error {
+	st := statusFor(err)
+	elapsed := time.Since(start)
+	if s.cfg.Metrics != nil {
+		s.cfg.Metrics.GRPCCallHandled(method, st.Code(), elapsed)
+	}
+	attrs := []slog.Attr{
+		slog.String("code", st.Code().String()),
+		slog.Float64("latency_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	level := slog.LevelInfo
+	switch st.Code() {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+	loggerFrom(ctx).LogAttrs(ctx, level, "grpc call", attrs...)
+	return st.Err()
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx, cancel, err := s.begin(ctx, info.FullMethod, s.cfg.Timeout)
+	defer cancel()
+
+	var resp interface{}
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	return resp, s.finish(ctx, info.FullMethod, start, err)
+}
+
+func (s *Server) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, cancel, err := s.begin(stream.Context(), info.FullMethod, s.cfg.StreamTimeout)
+	defer cancel()
+
+	if err == nil {
+		err = handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+	return s.finish(ctx, info.FullMethod, start, err)
+}
+
+// serverStream replaces a stream's context with the one begin prepared
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,325 @@
+package grpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+	userv1 "workshop_4/api/user/v1"
+	"workshop_4/database"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/infrastructure/repository"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+var testSecret = []byte("grpc-test-secret-grpc-test-secret")
+
+// startTestServer serves the user service over an in-memory connection,
+// backed by an in-memory database, and returns a connection to it. The API
+// key "valid-key" grants users:read only. configure may change the server's
+// configuration before it is created.
+func startTestServer(t *testing.T, configure ...func(*ServerConfig)) *grpc.ClientConn {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	// Every pooled connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	if err := database.InitSchema(db); err != nil {
+		t.Fatalf("Failed to create test schema: %v", err)
+	}
+
+	verifier, err := middleware.NewJWTVerifier(middleware.AuthConfig{Secret: testSecret})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	apiKeys := func(_ context.Context, key string) (*middleware.Claims, error) {
+		if key != "valid-key" {
+			return nil, nil
+		}
+		return &middleware.Claims{Subject: "api_key:1", Scopes: []string{string(domain.PermUsersRead)}}, nil
+	}
+
+	users := usecase.NewUserUseCase(repository.NewSQLiteUserRepository(db))
+	cfg := ServerConfig{
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Verifier: verifier,
+		APIKeys:  apiKeys,
+		Timeout:  5 * time.Second,
+	}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	server := NewServer(cfg, NewUserService(users))
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		server.Shutdown(time.Second)
+		db.Close()
+	})
+	return conn
+}
+
+// withRole returns ctx carrying a bearer token granting role
+func withRole(t *testing.T, ctx context.Context, role string) context.Context {
+	t.Helper()
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "u-" + role,
+		"roles": []string{role},
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+	}).SignedString(testSecret)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func assertCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	assert.Equal(t, code, status.Code(err), "error: %v", err)
+}
+
+func TestUserService_CRUD(t *testing.T) {
+	client := userv1.NewUserServiceClient(startTestServer(t))
+	ctx := withRole(t, context.Background(), "admin")
+
+	created, err := client.CreateUser(ctx, &userv1.CreateUserRequest{
+		FirstName:    "Somchai",
+		LastName:     "Jaidee",
+		Email:        "somchai@example.com",
+		PointBalance: 1500,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotZero(t, created.Id)
+	assert.Equal(t, "Silver", created.MemberLevel)
+	assert.EqualValues(t, 1, created.Version)
+
+	_, err = client.CreateUser(ctx, &userv1.CreateUserRequest{FirstName: "Other", LastName: "User", Email: "somchai@example.com"})
+	assertCode(t, err, codes.AlreadyExists)
+	_, err = client.CreateUser(ctx, &userv1.CreateUserRequest{LastName: "User", Email: "nameless@example.com"})
+	assertCode(t, err, codes.InvalidArgument)
+
+	_, err = client.CreateUser(ctx, &userv1.CreateUserRequest{FirstName: "Somying", LastName: "Rakdee", Email: "somying@example.com"})
+	assert.NoError(t, err)
+
+	got, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: created.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "somchai@example.com", got.Email)
+	assert.True(t, got.CreatedAt.AsTime().Equal(created.CreatedAt.AsTime()))
+
+	// Fields the request leaves unset keep their values
+	updated, err := client.UpdateUser(ctx, &userv1.UpdateUserRequest{
+		Id:      created.Id,
+		Phone:   proto.String("0812345678"),
+		Version: created.Version,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "0812345678", updated.Phone)
+	assert.Equal(t, "Somchai", updated.FirstName)
+	assert.EqualValues(t, 1500, updated.PointBalance)
+	_, err = client.UpdateUser(ctx, &userv1.UpdateUserRequest{Id: created.Id, FirstName: proto.String("Stale"), Version: created.Version})
+	assertCode(t, err, codes.Aborted)
+	_, err = client.UpdateUser(ctx, &userv1.UpdateUserRequest{Id: created.Id, FirstName: proto.String("Unchecked")})
+	assertCode(t, err, codes.FailedPrecondition)
+	_, err = client.DeleteUser(ctx, &userv1.DeleteUserRequest{Id: created.Id})
+	assertCode(t, err, codes.FailedPrecondition)
+
+	page, err := client.ListUsers(ctx, &userv1.ListUsersRequest{PageSize: 1, Sort: "-id"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, page.TotalSize)
+	if assert.Len(t, page.Users, 1) {
+		assert.Equal(t, "somying@example.com", page.Users[0].Email)
+	}
+	next, err := client.ListUsers(ctx, &userv1.ListUsersRequest{PageSize: 1, Sort: "-id", PageToken: page.NextPageToken})
+	assert.NoError(t, err)
+	if assert.Len(t, next.Users, 1) {
+		assert.Equal(t, created.Id, next.Users[0].Id)
+	}
+	_, err = client.ListUsers(ctx, &userv1.ListUsersRequest{Sort: "password"})
+	assertCode(t, err, codes.InvalidArgument)
+
+	pointsMin := int64(1000)
+	stream, err := client.StreamUsers(ctx, &userv1.StreamUsersRequest{Filter: &userv1.UserFilter{PointsMin: &pointsMin}})
+	assert.NoError(t, err)
+	var streamed []string
+	for {
+		user, err := stream.Recv()
+		if errors.Is(err, io.EOF) || !assert.NoError(t, err) {
+			break
+		}
+		streamed = append(streamed, user.Email)
+	}
+	assert.Equal(t, []string{"somchai@example.com"}, streamed)
+
+	_, err = client.DeleteUser(ctx, &userv1.DeleteUserRequest{Id: created.Id, Version: updated.Version})
+	assert.NoError(t, err)
+	_, err = client.GetUser(ctx, &userv1.GetUserRequest{Id: created.Id})
+	assertCode(t, err, codes.NotFound)
+	_, err = client.GetUser(ctx, &userv1.GetUserRequest{Id: 0})
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestServer_Authenticates(t *testing.T) {
+	conn := startTestServer(t)
+	client := userv1.NewUserServiceClient(conn)
+	ctx := context.Background()
+
+	_, err := client.ListUsers(ctx, &userv1.ListUsersRequest{})
+	assertCode(t, err, codes.Unauthenticated)
+	_, err = client.ListUsers(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer not-a-token"), &userv1.ListUsersRequest{})
+	assertCode(t, err, codes.Unauthenticated)
+	_, err = client.ListUsers(metadata.AppendToOutgoingContext(ctx, "x-api-key", "unknown"), &userv1.ListUsersRequest{})
+	assertCode(t, err, codes.Unauthenticated)
+	stream, err := client.StreamUsers(ctx, &userv1.StreamUsersRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assertCode(t, err, codes.Unauthenticated)
+
+	// An API key holds its scopes: reading is allowed, creating is not
+	keyCtx := metadata.AppendToOutgoingContext(ctx, "x-api-key", "valid-key")
+	_, err = client.ListUsers(keyCtx, &userv1.ListUsersRequest{})
+	assert.NoError(t, err)
+	_, err = client.CreateUser(keyCtx, &userv1.CreateUserRequest{FirstName: "A", LastName: "B", Email: "ab@example.com"})
+	assertCode(t, err, codes.PermissionDenied)
+	assert.Contains(t, status.Convert(err).Message(), string(domain.PermUsersCreate))
+
+	// Health checks need no credentials
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: userv1.UserService_ServiceDesc.ServiceName})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
+
+// callRecorder records the calls reported to CallMetrics
+type callRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *callRecorder) GRPCCallHandled(fullMethod string, code codes.Code, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, fullMethod+" "+code.String())
+}
+
+func TestServer_RateLimitsAndRecordsCalls(t *testing.T) {
+	recorder := &callRecorder{}
+	conn := startTestServer(t, func(cfg *ServerConfig) {
+		cfg.Limiter = middleware.NewRateLimiter(middleware.RateLimitConfig{
+			Rules: map[string]middleware.RateLimitRule{"*/users": {Rate: 0.001, Burst: 2}},
+		})
+		cfg.Metrics = recorder
+	})
+	client := userv1.NewUserServiceClient(conn)
+	ctx := withRole(t, context.Background(), "admin")
+
+	_, err := client.ListUsers(ctx, &userv1.ListUsersRequest{})
+	assert.NoError(t, err)
+	_, err = client.GetUser(ctx, &userv1.GetUserRequest{Id: 1})
+	assertCode(t, err, codes.NotFound)
+
+	var header metadata.MD
+	_, err = client.ListUsers(ctx, &userv1.ListUsersRequest{}, grpc.Header(&header))
+	assertCode(t, err, codes.ResourceExhausted)
+	assert.Equal(t, "Rate limit exceeded", status.Convert(err).Message())
+	if assert.Len(t, header.Get(metadataRetryAfter), 1) {
+		assert.NotEqual(t, "0", header.Get(metadataRetryAfter)[0])
+	}
+
+	// Another caller has a bucket of its own, and health checks are not limited
+	_, err = client.ListUsers(withRole(t, context.Background(), "support"), &userv1.ListUsersRequest{})
+	assert.NoError(t, err)
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, []string{
+		"/workshop.user.v1.UserService/ListUsers OK",
+		"/workshop.user.v1.UserService/GetUser NotFound",
+		"/workshop.user.v1.UserService/ListUsers ResourceExhausted",
+		"/workshop.user.v1.UserService/ListUsers OK",
+		"/grpc.health.v1.Health/Check OK",
+	}, recorder.calls)
+}
+
+func TestServer_LimitsFailedAuthentication(t *testing.T) {
+	conn := startTestServer(t, func(cfg *ServerConfig) {
+		cfg.Limiter = middleware.NewRateLimiter(middleware.RateLimitConfig{
+			Rules: map[string]middleware.RateLimitRule{"anonymous/auth": {Rate: 0.001, Burst: 2}},
+		})
+	})
+	client := userv1.NewUserServiceClient(conn)
+	admin := withRole(t, context.Background(), "admin")
+	badToken := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer not-a-token")
+
+	// Authenticated calls take nothing from the address's anonymous bucket
+	for i := 0; i < 3; i++ {
+		_, err := client.ListUsers(admin, &userv1.ListUsersRequest{})
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := client.ListUsers(badToken, &userv1.ListUsersRequest{})
+		assertCode(t, err, codes.Unauthenticated)
+	}
+	_, err := client.ListUsers(badToken, &userv1.ListUsersRequest{})
+	assertCode(t, err, codes.ResourceExhausted)
+	_, err = client.ListUsers(admin, &userv1.ListUsersRequest{})
+	assertCode(t, err, codes.ResourceExhausted)
+}
+
+func TestStatusFor(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+		msg  string
+	}{
+		{nil, codes.OK, ""},
+		{domain.ErrUserNotFound, codes.NotFound, "user not found"},
+		{domain.ErrDuplicateEmail, codes.AlreadyExists, "email already exists"},
+		{domain.ErrVersionConflict, codes.Aborted, "user was modified by another request"},
+		{domain.ErrInvalidCursor, codes.InvalidArgument, "invalid pagination cursor"},
+		{&domain.ForbiddenError{Permission: domain.PermUsersDelete}, codes.PermissionDenied, "missing permission: users:delete"},
+		{context.DeadlineExceeded, codes.DeadlineExceeded, "request timed out"},
+		{status.Error(codes.Unauthenticated, "missing authorization token"), codes.Unauthenticated, "missing authorization token"},
+		{errors.New("database is locked"), codes.Internal, "internal error"},
+	}
+	for _, tt := range tests {
+		st := statusFor(tt.err)
+		assert.Equal(t, tt.code, st.Code(), "%v", tt.err)
+		assert.Equal(t, tt.msg, st.Message(), "%v", tt.err)
+	}
+}
@@ -0,0 +1,198 @@
+package grpc
+
+import (
+	"context"
+	"time"
+	userv1 "workshop_4/api/user/v1"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// UserService serves userv1.UserService from the user use case
+type UserService struct {
+	userv1.UnimplementedUserServiceServer
+	userUseCase *usecase.UserUseCase
+}
+
+// NewUserService creates a new user service
+func NewUserService(userUseCase *usecase.UserUseCase) *UserService {
+	return &UserService{
+		userUseCase: userUseCase,
+	}
+}
+
+// users returns the use case acting for the call's caller and logging with
+// the call's logger
+func (s *UserService) users(ctx context.Context) *usecase.UserUseCase {
+	return s.userUseCase.As(principalFrom(ctx)).WithLogger(loggerFrom(ctx))
+}
+
+// toUser converts a domain user to its message
+func toUser(user *domain.User) *userv1.User {
+	msg := &userv1.User{
+		Id:           int64(user.ID),
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Email:        user.Email,
+		Phone:        user.Phone,
+		Address:      user.Address,
+		Avatar:       user.Avatar,
+		MemberLevel:  user.MemberLevel,
+		PointBalance: int64(user.PointBalance),
+		CreatedAt:    timestamppb.New(user.CreatedAt),
+		UpdatedAt:    timestamppb.New(user.UpdatedAt),
+		Version:      int64(user.Version),
+	}
+	if user.DeletedAt != nil {
+		msg.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+	return msg
+}
+
+// toUserFilter converts a filter message to a domain filter; a missing one
+// filters nothing
+func toUserFilter(msg *userv1.UserFilter) domain.UserFilter {
+	if msg == nil {
+		return domain.UserFilter{}
+	}
+	filter := domain.UserFilter{
+		MemberLevel:    msg.GetMemberLevel(),
+		IncludeDeleted: msg.GetIncludeDeleted(),
+	}
+	if msg.PointsMin != nil {
+		n := int(msg.GetPointsMin())
+		filter.PointsMin = &n
+	}
+	if msg.PointsMax != nil {
+		n := int(msg.GetPointsMax())
+		filter.PointsMax = &n
+	}
+	filter.CreatedAfter = timeOrNil(msg.GetCreatedAfter())
+	filter.CreatedBefore = timeOrNil(msg.GetCreatedBefore())
+	return filter
+}
+
+// timeOrNil converts an optional timestamp
+func timeOrNil(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// ListUsers implements userv1.UserServiceServer
+func (s *UserService) ListUsers(ctx context.Context, req *userv1.ListUsersRequest) (*userv1.ListUsersResponse, error) {
+	page, err := s.users(ctx).ListUsers(ctx, usecase.ListUsersInput{
+		Filter: toUserFilter(req.GetFilter()),
+		Sort:   req.GetSort(),
+		Limit:  int(req.GetPageSize()),
+		Offset: int(req.GetOffset()),
+		Cursor: req.GetPageToken(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &userv1.ListUsersResponse{
+		Users:         make([]*userv1.User, len(page.Users)),
+		TotalSize:     int64(page.Total),
+		NextPageToken: page.NextCursor,
+		PrevPageToken: page.PrevCursor,
+	}
+	for i, user := range page.Users {
+		resp.Users[i] = toUser(user)
+	}
+	return resp, nil
+}
+
+// StreamUsers implements userv1.UserServiceServer. Users are read as they
+// are sent, so a stream of any size uses constant memory.
+func (s *UserService) StreamUsers(req *userv1.StreamUsersRequest, stream userv1.UserService_StreamUsersServer) error {
+	ctx := stream.Context()
+	export, err := s.users(ctx).ExportUsers(usecase.ExportUsersInput{
+		Filter: toUserFilter(req.GetFilter()),
+		Sort:   req.GetSort(),
+	})
+	if err != nil {
+		return err
+	}
+	return export.Each(ctx, func(user *domain.User) error {
+		return stream.Send(toUser(user))
+	})
+}
+
+// GetUser implements userv1.UserServiceServer
+func (s *UserService) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.User, error) {
+	user, err := s.users(ctx).GetUserByID(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+// CreateUser implements userv1.UserServiceServer
+func (s *UserService) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.User, error) {
+	user, err := s.users(ctx).CreateUser(ctx, usecase.CreateUserInput{
+		FirstName:    req.GetFirstName(),
+		LastName:     req.GetLastName(),
+		Email:        req.GetEmail(),
+		Phone:        req.GetPhone(),
+		Address:      req.GetAddress(),
+		Avatar:       req.GetAvatar(),
+		MemberLevel:  req.GetMemberLevel(),
+		PointBalance: int(req.GetPointBalance()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+// optional converts an optional message field to a patch field
+func optional[T any](v *T) usecase.Optional[T] {
+	if v == nil {
+		return usecase.Optional[T]{}
+	}
+	return usecase.Some(*v)
+}
+
+// UpdateUser implements userv1.UserServiceServer. Only the fields the
+// request sets change.
+func (s *UserService) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.User, error) {
+	if req.GetVersion() == 0 {
+		return nil, errVersionRequired
+	}
+	patch := usecase.UserPatch{
+		FirstName:   optional(req.FirstName),
+		LastName:    optional(req.LastName),
+		Email:       optional(req.Email),
+		Phone:       optional(req.Phone),
+		Address:     optional(req.Address),
+		Avatar:      optional(req.Avatar),
+		MemberLevel: optional(req.MemberLevel),
+		Version:     int(req.GetVersion()),
+	}
+	if req.PointBalance != nil {
+		patch.PointBalance = usecase.Some(int(req.GetPointBalance()))
+	}
+
+	user, err := s.users(ctx).PatchUser(ctx, int(req.GetId()), patch)
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+// DeleteUser implements userv1.UserServiceServer
+func (s *UserService) DeleteUser(ctx context.Context, req *userv1.DeleteUserRequest) (*userv1.DeleteUserResponse, error) {
+	if req.GetVersion() == 0 {
+		return nil, errVersionRequired
+	}
+	if err := s.users(ctx).DeleteUser(ctx, int(req.GetId()), int(req.GetVersion())); err != nil {
+		return nil, err
+	}
+	return &userv1.DeleteUserResponse{}, nil
+}
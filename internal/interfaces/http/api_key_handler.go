@@ -0,0 +1,231 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKeyHandler handles HTTP requests for API key administration
+type APIKeyHandler struct {
+	apiKeyUseCase *usecase.APIKeyUseCase
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyUseCase *usecase.APIKeyUseCase) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyUseCase: apiKeyUseCase,
+	}
+}
+
+// apiKeys returns the use case acting for the request's caller and logging
+// with the request's logger
+func (h *APIKeyHandler) apiKeys(c *fiber.Ctx) *usecase.APIKeyUseCase {
+	return h.apiKeyUseCase.As(principalFrom(c)).WithLogger(middleware.Logger(c))
+}
+
+// APIKeyResponse represents the API response for an API key. Secret is only
+// set in the response that issues the key.
+type APIKeyResponse struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	Tier       string   `json:"rate_limit_tier"`
+	Status     string   `json:"status"`
+	CreatedBy  string   `json:"created_by,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	RevokedAt  string   `json:"revoked_at,omitempty"`
+	Secret     string   `json:"secret,omitempty"`
+}
+
+// formatOptionalTime formats t as RFC 3339, or "" when unset
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05Z07:00")
+}
+
+// toAPIKeyResponse converts a domain API key to response
+func toAPIKeyResponse(key *domain.APIKey) APIKeyResponse {
+	resp := APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     make([]string, len(key.Scopes)),
+		Tier:       key.RateLimitTier,
+		Status:     "active",
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ExpiresAt:  formatOptionalTime(key.ExpiresAt),
+		LastUsedAt: formatOptionalTime(key.LastUsedAt),
+		RevokedAt:  formatOptionalTime(key.RevokedAt),
+	}
+	for i, scope := range key.Scopes {
+		resp.Scopes[i] = string(scope)
+	}
+	switch {
+	case key.IsRevoked():
+		resp.Status = "revoked"
+	case key.IsExpired(time.Now()):
+		resp.Status = "expired"
+	}
+	return resp
+}
+
+// IssueAPIKeyRequest represents the request body for issuing an API key.
+// Expiry is optional and given either as a time or as a duration from now.
+type IssueAPIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Tier      string   `json:"rate_limit_tier"`
+	ExpiresAt string   `json:"expires_at"`
+	ExpiresIn string   `json:"expires_in"`
+}
+
+// IssueAPIKey handles POST /api-keys
+func (h *APIKeyHandler) IssueAPIKey(c *fiber.Ctx) error {
+	var req IssueAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+
+	input := usecase.IssueAPIKeyInput{Name: req.Name, RateLimitTier: req.Tier}
+	for _, scope := range req.Scopes {
+		input.Scopes = append(input.Scopes, domain.Permission(scope))
+	}
+
+	switch {
+	case req.ExpiresAt != "" && req.ExpiresIn != "":
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Set expires_at or expires_in, not both",
+		})
+	case req.ExpiresAt != "":
+		expiresAt, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "expires_at must be an RFC 3339 time",
+			})
+		}
+		input.ExpiresAt = &expiresAt
+	case req.ExpiresIn != "":
+		expiresIn, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "expires_in must be a duration such as 720h",
+			})
+		}
+		expiresAt := time.Now().Add(expiresIn)
+		input.ExpiresAt = &expiresAt
+	}
+
+	key, secret, err := h.apiKeys(c).IssueAPIKey(c.UserContext(), input)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrAPIKeyNameRequired || err == domain.ErrAPIKeyScopesRequired || err == domain.ErrAPIKeyTierRequired ||
+		err == domain.ErrInvalidAPIKeyScope || err == domain.ErrInvalidAPIKeyExpiry {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to issue API key",
+		})
+	}
+
+	resp := toAPIKeyResponse(key)
+	resp.Secret = secret
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    resp,
+	})
+}
+
+// ListAPIKeys handles GET /api-keys
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	keys, err := h.apiKeys(c).ListAPIKeys(c.UserContext())
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to fetch API keys",
+		})
+	}
+
+	responses := make([]APIKeyResponse, len(keys))
+	for i, key := range keys {
+		responses[i] = toAPIKeyResponse(key)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    responses,
+	})
+}
+
+// RevokeAPIKey handles DELETE /api-keys/:id
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid API key ID",
+		})
+	}
+
+	key, err := h.apiKeys(c).RevokeAPIKey(c.UserContext(), id)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrAPIKeyNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "API key not found",
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to revoke API key",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    toAPIKeyResponse(key),
+	})
+}
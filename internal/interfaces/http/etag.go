@@ -0,0 +1,140 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"workshop_4/internal/domain"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errPreconditionRequired reports a write without an If-Match header
+var errPreconditionRequired = errors.New("If-Match header is required")
+
+// userETag returns the strong entity tag of a user's current version
+func userETag(user *domain.User) string {
+	return fmt.Sprintf(`"v%d"`, user.Version)
+}
+
+// parseETags splits an If-Match or If-None-Match header into entity tags
+func parseETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// etagVersion extracts the version from a strong tag of the form "v<n>"
+func etagVersion(tag string) (int, bool) {
+	if !strings.HasPrefix(tag, `"v`) || !strings.HasSuffix(tag, `"`) || len(tag) < 4 {
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag[2 : len(tag)-1])
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// ifMatchVersion returns the user version the If-Match header requires, or
+// 0 for "*". If-Match uses strong comparison, so weak tags never match.
+func (h *UserHandler) ifMatchVersion(c *fiber.Ctx, id int) (int, error) {
+	return matchVersion(c, func() (*domain.User, error) {
+		return h.users(c).GetUserByID(c.UserContext(), id)
+	})
+}
+
+// matchVersion resolves If-Match against the user returned by current, which
+// is only loaded when several tags name different versions
+func matchVersion(c *fiber.Ctx, current func() (*domain.User, error)) (int, error) {
+	return ifMatchHeaderVersion(c.Get(fiber.HeaderIfMatch), current)
+}
+
+// ifMatchHeaderVersion is matchVersion for an If-Match value given on its own
+func ifMatchHeaderVersion(header string, current func() (*domain.User, error)) (int, error) {
+	tags := parseETags(header)
+	if len(tags) == 0 {
+		return 0, errPreconditionRequired
+	}
+
+	var versions []int
+	for _, tag := range tags {
+		if tag == "*" {
+			return 0, nil
+		}
+		if version, ok := etagVersion(tag); ok {
+			versions = append(versions, version)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+		return 0, domain.ErrVersionConflict
+	case 1:
+		return versions[0], nil
+	}
+
+	// Several candidate tags: pick the one naming the current version
+	user, err := current()
+	if err != nil {
+		return 0, err
+	}
+	for _, version := range versions {
+		if version == user.Version {
+			return version, nil
+		}
+	}
+	return 0, domain.ErrVersionConflict
+}
+
+// noneMatch reports whether If-None-Match matches the user's entity tag,
+// using weak comparison as RFC 9110 requires for If-None-Match
+func noneMatch(c *fiber.Ctx, user *domain.User) bool {
+	etag := userETag(user)
+	for _, tag := range parseETags(c.Get(fiber.HeaderIfNoneMatch)) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionFailed writes the response for a failed If-Match check
+func preconditionFailed(c *fiber.Ctx, err error) error {
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+
+	switch err {
+	case errPreconditionRequired:
+		return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	case domain.ErrVersionConflict:
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	case domain.ErrUserNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found",
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	middleware.SetErrorCause(c, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"error":   "Failed to check precondition",
+	})
+}
@@ -0,0 +1,23 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEtagVersion(t *testing.T) {
+	version, ok := etagVersion(`"v12"`)
+	assert.True(t, ok)
+	assert.Equal(t, 12, version)
+
+	for _, tag := range []string{`W/"v12"`, `"12"`, `v12`, `"v0"`, `"vx"`, `""`} {
+		_, ok := etagVersion(tag)
+		assert.False(t, ok, tag)
+	}
+}
+
+func TestParseETags(t *testing.T) {
+	assert.Equal(t, []string{`"v1"`, `W/"v2"`}, parseETags(` "v1" , W/"v2",`))
+	assert.Empty(t, parseETags(""))
+}
@@ -0,0 +1,211 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderLastEventID is sent by a reconnecting EventSource with the ID of the
+// last event it received
+const HeaderLastEventID = "Last-Event-ID"
+
+const (
+	// eventStreamBatchSize bounds the events read from the log at once
+	eventStreamBatchSize = 100
+	// eventStreamRetry is the reconnection delay, in milliseconds, suggested
+	// to clients
+	eventStreamRetry = 3000
+)
+
+// EventHandler streams the event log to clients as Server-Sent Events
+type EventHandler struct {
+	eventUseCase *usecase.EventUseCase
+	// pollInterval is how often the log is checked for new events
+	pollInterval time.Duration
+	// heartbeat is how long a quiet stream waits before sending a comment,
+	// which keeps proxies from timing it out and finds clients that left
+	heartbeat time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewEventHandler creates a new event handler checking for new events every
+// pollInterval and sending a heartbeat on streams quiet for heartbeat
+func NewEventHandler(eventUseCase *usecase.EventUseCase, pollInterval, heartbeat time.Duration) *EventHandler {
+	return &EventHandler{
+		eventUseCase: eventUseCase,
+		pollInterval: pollInterval,
+		heartbeat:    heartbeat,
+		done:         make(chan struct{}),
+	}
+}
+
+// Close ends every open stream, which would otherwise keep the server from
+// shutting down. Clients reconnect elsewhere with their Last-Event-ID.
+func (h *EventHandler) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// parseLastEventID reads where a stream resumes: the Last-Event-ID header,
+// or the last_event_id query parameter for clients that cannot set headers.
+// It returns nil when neither is given.
+func parseLastEventID(c *fiber.Ctx) (*int, error) {
+	value := c.Get(HeaderLastEventID)
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || id < 0 {
+		return nil, domain.ErrInvalidLastEventID
+	}
+	return &id, nil
+}
+
+// writeSSEEvent writes event in the text/event-stream format. Its JSON has
+// no newlines, so it fits on a single data line.
+func writeSSEEvent(w io.Writer, event *domain.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, usecase.MarshalEvent(event))
+	return err
+}
+
+// StreamEvents handles GET /events/stream, a text/event-stream of the user
+// events logged after the client's Last-Event-ID, or from now on without
+// one. ?types=user.created,user.deleted streams only those types.
+func (h *EventHandler) StreamEvents(c *fiber.Ctx) error {
+	lastEventID, err := parseLastEventID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	var types []string
+	if value := c.Query("types"); value != "" {
+		types = strings.Split(value, ",")
+	}
+
+	stream, err := h.eventUseCase.As(principalFrom(c)).WithLogger(middleware.Logger(c)).OpenStream(c.UserContext(), usecase.OpenStreamInput{
+		LastEventID: lastEventID,
+		Types:       types,
+	})
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrInvalidEventType || err == domain.ErrInvalidLastEventID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to open event stream",
+		})
+	}
+
+	// As with exports, the stream is written after the handler returns, so
+	// it gets a context of its own and ends by dropping the connection
+	ctx, cancel := middleware.Detach(c)
+	logger := middleware.Logger(c)
+	conn := c.Context().Conn()
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// Keeps nginx from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		err := h.writeStream(ctx, w, stream)
+		var writeErr *streamWriteError
+		if errors.As(err, &writeErr) {
+			logger.Debug("event stream closed by client", "last_event_id", stream.LastID())
+		} else if err != nil {
+			logger.Error("event stream failed", "error", err, "last_event_id", stream.LastID())
+		}
+		conn.Close()
+	})
+	return nil
+}
+
+// streamWriteError is a failure to write to an event stream's client,
+// usually because it went away, as opposed to a failure to read the log
+type streamWriteError struct {
+	err error
+}
+
+func (e *streamWriteError) Error() string { return "writing event stream: " + e.err.Error() }
+
+// writeStream sends the stream's events to w as they are logged until the
+// handler is closed, the log cannot be read or the client goes away, which
+// shows as a failed write
+func (h *EventHandler) writeStream(ctx context.Context, w *bufio.Writer, stream *usecase.EventStream) error {
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry); err != nil {
+		return &streamWriteError{err}
+	}
+	if err := w.Flush(); err != nil {
+		return &streamWriteError{err}
+	}
+
+	poll := time.NewTicker(h.pollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+	for {
+		select {
+		case <-h.done:
+			return nil
+		case <-poll.C:
+		}
+
+		for {
+			events, err := stream.Next(ctx, eventStreamBatchSize)
+			if err != nil {
+				return err
+			}
+			for _, event := range events {
+				if err := writeSSEEvent(w, event); err != nil {
+					return &streamWriteError{err}
+				}
+			}
+			if len(events) > 0 {
+				if err := w.Flush(); err != nil {
+					return &streamWriteError{err}
+				}
+				lastWrite = time.Now()
+			}
+			if len(events) < eventStreamBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastWrite) >= h.heartbeat {
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return &streamWriteError{err}
+			}
+			if err := w.Flush(); err != nil {
+				return &streamWriteError{err}
+			}
+			lastWrite = time.Now()
+		}
+	}
+}
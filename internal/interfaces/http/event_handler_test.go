@@ -0,0 +1,61 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// eventLog serves a fixed event log
+type eventLog []*domain.Event
+
+func (l eventLog) FindAfter(_ context.Context, afterID int, _ []string, limit int) ([]*domain.Event, error) {
+	var found []*domain.Event
+	for _, event := range l {
+		if event.ID > afterID && len(found) < limit {
+			found = append(found, event)
+		}
+	}
+	return found, nil
+}
+
+func (l eventLog) LastID(_ context.Context) (int, error) {
+	return 0, nil
+}
+
+func TestWriteSSEEvent(t *testing.T) {
+	var out bytes.Buffer
+	event := &domain.Event{ID: 7, Type: domain.EventUserDeleted, Data: []byte(`{"user":{"id":3}}`), CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+
+	assert.NoError(t, writeSSEEvent(&out, event))
+	assert.Equal(t, "id: 7\nevent: user.deleted\ndata: {\"id\":7,\"type\":\"user.deleted\",\"created_at\":\"2024-05-01T00:00:00Z\",\"data\":{\"user\":{\"id\":3}}}\n\n", out.String())
+}
+
+func TestWriteStream_SendsEventsAndHeartbeats(t *testing.T) {
+	ctx := context.Background()
+	log := eventLog{
+		{ID: 1, Type: domain.EventUserCreated, Data: []byte(`{}`)},
+		{ID: 2, Type: domain.EventUserPointsChanged, Data: []byte(`{}`)},
+	}
+	stream, err := usecase.NewEventUseCase(log).OpenStream(ctx, usecase.OpenStreamInput{})
+	assert.NoError(t, err)
+
+	h := NewEventHandler(nil, time.Millisecond, 5*time.Millisecond)
+	var out bytes.Buffer
+	time.AfterFunc(50*time.Millisecond, h.Close)
+	assert.NoError(t, h.writeStream(ctx, bufio.NewWriter(&out), stream))
+
+	body := out.String()
+	assert.True(t, strings.HasPrefix(body, "retry: 3000\n\nid: 1\nevent: user.created\n"), body)
+	assert.Contains(t, body, "id: 2\nevent: user.points_changed\n")
+	assert.Contains(t, body, ": heartbeat\n\n")
+	assert.Equal(t, 1, strings.Count(body, "id: 1\n"))
+	assert.Equal(t, 2, stream.LastID())
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"context"
+	"time"
+	"workshop_4/internal/domain"
+	"workshop_4/middleware"
+)
+
+// idempotencyStore adapts a domain.IdempotencyRepository to
+// middleware.IdempotencyStore
+type idempotencyStore struct {
+	repo domain.IdempotencyRepository
+}
+
+// IdempotencyStore stores the keys of middleware.Idempotency in repo
+func IdempotencyStore(repo domain.IdempotencyRepository) middleware.IdempotencyStore {
+	return &idempotencyStore{repo: repo}
+}
+
+func (s *idempotencyStore) Reserve(ctx context.Context, client, key, fingerprint string, now, lockedUntil time.Time) (*middleware.IdempotencyRecord, error) {
+	existing, err := s.repo.Reserve(ctx, &domain.IdempotencyKey{
+		Client:      client,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   lockedUntil,
+	})
+	if existing == nil || err != nil {
+		return nil, err
+	}
+	return &middleware.IdempotencyRecord{
+		Fingerprint: existing.Fingerprint,
+		Status:      existing.Status,
+		Headers:     existing.Headers,
+		Body:        existing.Body,
+	}, nil
+}
+
+func (s *idempotencyStore) Complete(ctx context.Context, client, key string, record middleware.IdempotencyRecord, expiresAt time.Time) error {
+	return s.repo.Complete(ctx, &domain.IdempotencyKey{
+		Client:      client,
+		Key:         key,
+		Fingerprint: record.Fingerprint,
+		Status:      record.Status,
+		Headers:     record.Headers,
+		Body:        record.Body,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+func (s *idempotencyStore) Release(ctx context.Context, client, key string) error {
+	return s.repo.Release(ctx, client, key)
+}
+
+func (s *idempotencyStore) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	return s.repo.DeleteExpired(ctx, before)
+}
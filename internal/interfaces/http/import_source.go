@@ -0,0 +1,231 @@
+package http
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+)
+
+// Import file formats
+const (
+	importFormatCSV    = "csv"
+	importFormatNDJSON = "ndjson"
+)
+
+// maxImportLine bounds one NDJSON record
+const maxImportLine = 1 << 20
+
+// importFields are the user fields an import file can set, named as in the
+// JSON API
+var importFields = []string{"first_name", "last_name", "email", "phone", "address", "avatar", "member_level", "point_balance"}
+
+// parseColumnMapping parses the mapping query parameter, comma-separated
+// field=column pairs such as "first_name=Given Name,email=E-mail", into the
+// column or key each field is read from. Fields not mapped are read from
+// the column or key of their own name.
+func parseColumnMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string, len(importFields))
+	for _, field := range importFields {
+		mapping[field] = field
+	}
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("mapping %q is not field=column", pair)
+		}
+		if _, known := mapping[field]; !known {
+			return nil, fmt.Errorf("mapping names unknown field %q", field)
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// importRecord reads the fields of one record into CreateUserInput. get
+// returns a field's raw value.
+func importRecord(get func(field string) (string, error)) (usecase.CreateUserInput, error) {
+	var input usecase.CreateUserInput
+	targets := map[string]*string{
+		"first_name":   &input.FirstName,
+		"last_name":    &input.LastName,
+		"email":        &input.Email,
+		"phone":        &input.Phone,
+		"address":      &input.Address,
+		"avatar":       &input.Avatar,
+		"member_level": &input.MemberLevel,
+	}
+
+	// Every field is read even after an error, so a rejected row is still
+	// reported with its email
+	var firstErr error
+	for _, field := range importFields {
+		value, err := get(field)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if field == "point_balance" {
+			if value == "" {
+				continue
+			}
+			balance, err := strconv.Atoi(value)
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("point_balance: invalid number %q", value)
+			}
+			input.PointBalance = balance
+			continue
+		}
+		*targets[field] = value
+	}
+	return input, firstErr
+}
+
+// csvImportSource reads users from CSV with a header row. A leading ' that
+// csvCell added to guard a formula is removed, so an export imports as it
+// was written.
+type csvImportSource struct {
+	reader *csv.Reader
+	// columns maps each mapped field to its column index
+	columns map[string]int
+}
+
+// newCSVImportSource reads the header row and resolves the mapped columns.
+// Header names are matched case-insensitively; other columns are ignored.
+func newCSVImportSource(r io.Reader, mapping map[string]string) (*csvImportSource, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: no header row", domain.ErrInvalidImportFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidImportFile, err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	columns := make(map[string]int, len(mapping))
+	for field, column := range mapping {
+		if i, ok := index[strings.ToLower(column)]; ok {
+			columns[field] = i
+		}
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("%w: no %q column", domain.ErrInvalidImportFile, mapping["email"])
+	}
+	return &csvImportSource{reader: reader, columns: columns}, nil
+}
+
+func (s *csvImportSource) Format() string { return importFormatCSV }
+
+// Next reads the next record. A malformed record, such as one with a stray
+// quote, is returned as a rejected row and reading carries on.
+func (s *csvImportSource) Next() (*usecase.ImportRow, error) {
+	for {
+		record, err := s.reader.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return &usecase.ImportRow{Line: parseErr.StartLine, Err: parseErr.Err}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		line, _ := s.reader.FieldPos(0)
+		input, err := importRecord(func(field string) (string, error) {
+			i, ok := s.columns[field]
+			if !ok || i >= len(record) {
+				return "", nil
+			}
+			return csvUncell(record[i]), nil
+		})
+		return &usecase.ImportRow{Line: line, Input: input, Err: err}, nil
+	}
+}
+
+// ndjsonImportSource reads users from newline-delimited JSON objects
+type ndjsonImportSource struct {
+	scanner *bufio.Scanner
+	mapping map[string]string
+	line    int
+}
+
+func newNDJSONImportSource(r io.Reader, mapping map[string]string) *ndjsonImportSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	return &ndjsonImportSource{scanner: scanner, mapping: mapping}
+}
+
+func (s *ndjsonImportSource) Format() string { return importFormatNDJSON }
+
+// Next reads the next object; blank lines are skipped. A line that is not a
+// JSON object is returned as a rejected row.
+func (s *ndjsonImportSource) Next() (*usecase.ImportRow, error) {
+	for s.scanner.Scan() {
+		s.line++
+		data := s.scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return &usecase.ImportRow{Line: s.line, Err: errors.New("not a JSON object")}, nil
+		}
+		input, err := importRecord(func(field string) (string, error) {
+			return jsonScalar(object[s.mapping[field]], field)
+		})
+		return &usecase.ImportRow{Line: s.line, Input: input, Err: err}, nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("%w: line %d is longer than %d bytes", domain.ErrInvalidImportFile, s.line+1, maxImportLine)
+		}
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// jsonScalar returns a JSON string or number as text; a missing key or null
+// is empty
+func jsonScalar(raw json.RawMessage, field string) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String(), nil
+	}
+	return "", fmt.Errorf("%s: must be a string or number", field)
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readAll drains an import source
+func readAll(t *testing.T, source usecase.ImportSource) []*usecase.ImportRow {
+	t.Helper()
+	var rows []*usecase.ImportRow
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			return rows
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestParseColumnMapping(t *testing.T) {
+	mapping, err := parseColumnMapping("first_name=Given Name, email = E-mail")
+	assert.NoError(t, err)
+	assert.Equal(t, "Given Name", mapping["first_name"])
+	assert.Equal(t, "E-mail", mapping["email"])
+	assert.Equal(t, "last_name", mapping["last_name"])
+
+	_, err = parseColumnMapping("nickname=Nick")
+	assert.Error(t, err)
+
+	_, err = parseColumnMapping("email")
+	assert.Error(t, err)
+}
+
+func TestCSVImportSource(t *testing.T) {
+	mapping, _ := parseColumnMapping("first_name=Given Name")
+	file := "\ufeffGiven Name,Last_Name,EMAIL,point_balance,notes\n" +
+		"Jane,Doe,jane@example.com,250,vip\n" +
+		"\n" +
+		"John,Roe,john@example.com,lots,\n" +
+		"Bad,\"Quote\"x,bad@example.com,,\n" +
+		"Ann,Lee,ann@example.com\n"
+
+	source, err := newCSVImportSource(strings.NewReader(file), mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := readAll(t, source)
+
+	if assert.Len(t, rows, 4) {
+		assert.Equal(t, 2, rows[0].Line)
+		assert.Equal(t, usecase.CreateUserInput{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", PointBalance: 250}, rows[0].Input)
+		assert.NoError(t, rows[0].Err)
+
+		assert.Equal(t, 4, rows[1].Line)
+		assert.Equal(t, "john@example.com", rows[1].Input.Email)
+		assert.EqualError(t, rows[1].Err, `point_balance: invalid number "lots"`)
+
+		assert.Equal(t, 5, rows[2].Line)
+		assert.Error(t, rows[2].Err)
+
+		assert.Equal(t, 6, rows[3].Line)
+		assert.Equal(t, "ann@example.com", rows[3].Input.Email)
+		assert.NoError(t, rows[3].Err)
+	}
+}
+
+func TestCSVImportSource_MissingEmailColumn(t *testing.T) {
+	mapping, _ := parseColumnMapping("")
+	_, err := newCSVImportSource(strings.NewReader("first_name,mail\nJane,jane@example.com\n"), mapping)
+	assert.True(t, errors.Is(err, domain.ErrInvalidImportFile))
+
+	_, err = newCSVImportSource(strings.NewReader(""), mapping)
+	assert.True(t, errors.Is(err, domain.ErrInvalidImportFile))
+}
+
+func TestNDJSONImportSource(t *testing.T) {
+	mapping, _ := parseColumnMapping("email=mail")
+	file := `{"first_name":"Jane","last_name":"Doe","mail":"jane@example.com","point_balance":250}` + "\n" +
+		"\n" +
+		`["not","an","object"]` + "\n" +
+		`{"first_name":"John","mail":"john@example.com","point_balance":"100","phone":null}` + "\n" +
+		`{"first_name":{"nested":true},"mail":"x@example.com"}`
+
+	rows := readAll(t, newNDJSONImportSource(strings.NewReader(file), mapping))
+
+	if assert.Len(t, rows, 4) {
+		assert.Equal(t, 1, rows[0].Line)
+		assert.Equal(t, usecase.CreateUserInput{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", PointBalance: 250}, rows[0].Input)
+
+		assert.Equal(t, 3, rows[1].Line)
+		assert.EqualError(t, rows[1].Err, "not a JSON object")
+
+		assert.Equal(t, 4, rows[2].Line)
+		assert.Equal(t, 100, rows[2].Input.PointBalance)
+		assert.NoError(t, rows[2].Err)
+
+		assert.Equal(t, 5, rows[3].Line)
+		assert.Equal(t, "x@example.com", rows[3].Input.Email)
+		assert.EqualError(t, rows[3].Err, "first_name: must be a string or number")
+	}
+}
+
+func TestCSVImportSource_ReadsExport(t *testing.T) {
+	data := writeRows(t, exportFormatCSV, []string{"first_name", "last_name", "email", "phone", "address"},
+		[]interface{}{"=Jane", "'Doe", "jane@example.com", "+66812345678", "-1 Sukhumvit"})
+
+	mapping, _ := parseColumnMapping("")
+	source, err := newCSVImportSource(bytes.NewReader(data), mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := readAll(t, source)
+
+	if assert.Len(t, rows, 1) {
+		assert.NoError(t, rows[0].Err)
+		assert.Equal(t, usecase.CreateUserInput{FirstName: "=Jane", LastName: "'Doe", Email: "jane@example.com", Phone: "+66812345678", Address: "-1 Sukhumvit"}, rows[0].Input)
+	}
+}
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PointHandler handles HTTP requests for the points ledger
+type PointHandler struct {
+	pointUseCase *usecase.PointUseCase
+}
+
+// NewPointHandler creates a new point handler
+func NewPointHandler(pointUseCase *usecase.PointUseCase) *PointHandler {
+	return &PointHandler{
+		pointUseCase: pointUseCase,
+	}
+}
+
+// points returns the use case acting for the request's caller and logging
+// with the request's logger
+func (h *PointHandler) points(c *fiber.Ctx) *usecase.PointUseCase {
+	return h.pointUseCase.As(principalFrom(c)).WithLogger(middleware.Logger(c))
+}
+
+// PointTransactionResponse represents the API response for a ledger entry
+type PointTransactionResponse struct {
+	ID           int    `json:"id"`
+	UserID       int    `json:"user_id"`
+	Type         string `json:"type"`
+	Amount       int    `json:"amount"`
+	BalanceAfter int    `json:"balance_after"`
+	Description  string `json:"description"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// toPointTransactionResponse converts domain point transaction to response
+func toPointTransactionResponse(pt *domain.PointTransaction) PointTransactionResponse {
+	return PointTransactionResponse{
+		ID:           pt.ID,
+		UserID:       pt.UserID,
+		Type:         string(pt.Type),
+		Amount:       pt.Amount,
+		BalanceAfter: pt.BalanceAfter,
+		Description:  pt.Description,
+		CreatedAt:    pt.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// PointRequest represents the request body for a points ledger operation
+type PointRequest struct {
+	Amount      int    `json:"amount"`
+	Description string `json:"description"`
+}
+
+// EarnPoints handles POST /users/:id/points/earn
+func (h *PointHandler) EarnPoints(c *fiber.Ctx) error {
+	return h.handleTransaction(c, h.points(c).EarnPoints)
+}
+
+// RedeemPoints handles POST /users/:id/points/redeem
+func (h *PointHandler) RedeemPoints(c *fiber.Ctx) error {
+	return h.handleTransaction(c, h.points(c).RedeemPoints)
+}
+
+// AdjustPoints handles POST /users/:id/points/adjust
+func (h *PointHandler) AdjustPoints(c *fiber.Ctx) error {
+	return h.handleTransaction(c, h.points(c).AdjustPoints)
+}
+
+// GetPointHistory handles GET /users/:id/points/history
+func (h *PointHandler) GetPointHistory(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+	}
+
+	transactions, err := h.points(c).GetPointHistory(c.UserContext(), id)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrUserNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found",
+		})
+	}
+	if err == domain.ErrInvalidUserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to fetch point history",
+		})
+	}
+
+	responses := make([]PointTransactionResponse, len(transactions))
+	for i, pt := range transactions {
+		responses[i] = toPointTransactionResponse(pt)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    responses,
+	})
+}
+
+func (h *PointHandler) handleTransaction(c *fiber.Ctx, apply func(context.Context, int, usecase.PointInput) (*domain.PointTransaction, error)) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+	}
+
+	var req PointRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+
+	pt, err := apply(c.UserContext(), id, usecase.PointInput{
+		Amount:      req.Amount,
+		Description: req.Description,
+	})
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrUserNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found",
+		})
+	}
+	if err == domain.ErrInvalidUserID || err == domain.ErrInvalidPointAmount {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if err == domain.ErrInvalidPointBalance {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to record point transaction",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    toPointTransactionResponse(pt),
+	})
+}
@@ -0,0 +1,272 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BatchRequest represents the request body of a batch
+type BatchRequest struct {
+	Operations []BatchOperationRequest `json:"operations"`
+}
+
+// BatchOperationRequest is one operation of a batch. User is the body of the
+// matching single-user request: a CreateUserRequest for a create, a complete
+// UpdateUserRequest for an update. IfMatch stands in for the If-Match header
+// that updates and deletes require.
+type BatchOperationRequest struct {
+	Op      string          `json:"op"`
+	ID      int             `json:"id"`
+	IfMatch string          `json:"if_match"`
+	User    json.RawMessage `json:"user"`
+}
+
+// BatchResultResponse is the outcome of one operation of a batch, with the
+// status code its single-user request would have answered
+type BatchResultResponse struct {
+	Index             int               `json:"index"`
+	Op                string            `json:"op"`
+	ID                int               `json:"id,omitempty"`
+	Status            int               `json:"status"`
+	Error             string            `json:"error,omitempty"`
+	MissingPermission domain.Permission `json:"missing_permission,omitempty"`
+	User              *UserResponse     `json:"user,omitempty"`
+}
+
+// BatchUsers handles POST /users/batch, which applies a list of creates,
+// updates and deletes in order.
+//
+// With atomic=true the batch runs in one transaction and the first failure
+// rolls all of it back; the response then has the failing operation's status.
+// Otherwise every operation is tried on its own and the response is 200 with
+// a status for each.
+func (h *UserHandler) BatchUsers(c *fiber.Ctx) error {
+	atomic, err := queryBool(c, "atomic")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	var req BatchRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+
+	// Parsing can look users up, so an oversized batch is refused first
+	if err := usecase.CheckBatchSize(len(req.Operations)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	ops := make([]usecase.BatchOperation, len(req.Operations))
+	for i, opReq := range req.Operations {
+		ops[i] = h.parseBatchOperation(c, opReq)
+	}
+
+	results, err := h.users(c).RunBatch(c.UserContext(), ops, atomic)
+	if errors.Is(err, domain.ErrInvalidBatch) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to run batch",
+		})
+	}
+
+	data := make([]BatchResultResponse, len(results))
+	failed := -1
+	failures := 0
+	for i, result := range results {
+		data[i] = toBatchResultResponse(i, ops[i], result)
+		if result.Err == nil {
+			continue
+		}
+		failures++
+		if failed < 0 && result.Err != domain.ErrBatchRolledBack {
+			failed = i
+		}
+		if data[i].Status == fiber.StatusInternalServerError || data[i].Status == fiber.StatusGatewayTimeout {
+			middleware.SetErrorCause(c, result.Err)
+		}
+	}
+
+	if atomic && failed >= 0 {
+		return c.Status(data[failed].Status).JSON(fiber.Map{
+			"success": false,
+			"error":   fmt.Sprintf("Batch rolled back: operation %d failed: %s", failed, data[failed].Error),
+			"data":    data,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    data,
+		"summary": fiber.Map{
+			"succeeded": len(data) - failures,
+			"failed":    failures,
+		},
+	})
+}
+
+// parseBatchOperation reads one operation of a batch. An operation that
+// cannot be read carries the reason in Err, failing on its own like any
+// other operation.
+func (h *UserHandler) parseBatchOperation(c *fiber.Ctx, req BatchOperationRequest) usecase.BatchOperation {
+	op := usecase.BatchOperation{Kind: req.Op, ID: req.ID}
+
+	switch req.Op {
+	case usecase.BatchCreate:
+		var user CreateUserRequest
+		if err := decodeBatchUser(req.User, &user); err != nil {
+			op.Err = err
+			return op
+		}
+		op.Create = usecase.CreateUserInput{
+			FirstName:    user.FirstName,
+			LastName:     user.LastName,
+			Email:        user.Email,
+			Phone:        user.Phone,
+			Address:      user.Address,
+			Avatar:       user.Avatar,
+			MemberLevel:  user.MemberLevel,
+			PointBalance: user.PointBalance,
+		}
+		return op
+	case usecase.BatchUpdate, usecase.BatchDelete:
+	default:
+		op.Err = fmt.Errorf("%w: op must be create, update or delete", domain.ErrInvalidBatchOperation)
+		return op
+	}
+
+	if req.ID <= 0 {
+		op.Err = domain.ErrInvalidUserID
+		return op
+	}
+	version, err := ifMatchHeaderVersion(req.IfMatch, func() (*domain.User, error) {
+		return h.users(c).GetUserByID(c.UserContext(), req.ID)
+	})
+	if err == errPreconditionRequired {
+		err = errBatchPreconditionRequired
+	}
+	if err != nil {
+		op.Err = err
+		return op
+	}
+	op.Version = version
+	if req.Op == usecase.BatchDelete {
+		return op
+	}
+
+	// As with PUT, an update replaces the whole user
+	var members map[string]json.RawMessage
+	if err := decodeBatchUser(req.User, &members); err != nil {
+		op.Err = err
+		return op
+	}
+	if missing := missingMembers(members, requiredUserFields); len(missing) > 0 {
+		op.Err = fmt.Errorf("%w: missing required fields: %s", domain.ErrInvalidBatchOperation, strings.Join(missing, ", "))
+		return op
+	}
+	var user UpdateUserRequest
+	if err := decodeBatchUser(req.User, &user); err != nil {
+		op.Err = err
+		return op
+	}
+	op.Update = usecase.UpdateUserInput{
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Email:        user.Email,
+		Phone:        user.Phone,
+		Address:      user.Address,
+		Avatar:       user.Avatar,
+		MemberLevel:  user.MemberLevel,
+		PointBalance: user.PointBalance,
+	}
+	return op
+}
+
+// errBatchPreconditionRequired reports an update or delete without if_match
+var errBatchPreconditionRequired = errors.New("if_match is required")
+
+// decodeBatchUser decodes the user object of an operation into v
+func decodeBatchUser(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return fmt.Errorf("%w: user is required", domain.ErrInvalidBatchOperation)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%w: invalid user", domain.ErrInvalidBatchOperation)
+	}
+	return nil
+}
+
+// toBatchResultResponse converts the outcome of an operation for the
+// response
+func toBatchResultResponse(index int, op usecase.BatchOperation, result usecase.BatchResult) BatchResultResponse {
+	resp := BatchResultResponse{Index: index, Op: op.Kind, ID: op.ID}
+	if result.User != nil {
+		user := toUserResponse(result.User)
+		resp.ID = user.ID
+		resp.User = &user
+	}
+
+	resp.Status, resp.Error = batchStatus(op.Kind, result.Err)
+	var forbiddenErr *domain.ForbiddenError
+	if errors.As(result.Err, &forbiddenErr) {
+		resp.MissingPermission = forbiddenErr.Permission
+	}
+	return resp
+}
+
+// batchStatus returns the status code and error message the single-user
+// request for an operation would have answered with err
+func batchStatus(kind string, err error) (int, string) {
+	switch {
+	case err == nil && kind == usecase.BatchCreate:
+		return fiber.StatusCreated, ""
+	case err == nil:
+		return fiber.StatusOK, ""
+	case errors.Is(err, domain.ErrForbidden):
+		return fiber.StatusForbidden, err.Error()
+	case err == domain.ErrUserNotFound:
+		return fiber.StatusNotFound, "User not found"
+	case err == domain.ErrFirstNameRequired || err == domain.ErrLastNameRequired || err == domain.ErrEmailRequired || err == domain.ErrInvalidPointBalance || err == domain.ErrInvalidMemberLevel:
+		return fiber.StatusBadRequest, err.Error()
+	case err == domain.ErrInvalidUserID:
+		return fiber.StatusBadRequest, "Invalid user ID"
+	case errors.Is(err, domain.ErrInvalidBatchOperation):
+		return fiber.StatusBadRequest, err.Error()
+	case err == domain.ErrDuplicateEmail:
+		return fiber.StatusConflict, err.Error()
+	case err == domain.ErrVersionConflict:
+		return fiber.StatusPreconditionFailed, err.Error()
+	case err == errBatchPreconditionRequired:
+		return fiber.StatusPreconditionRequired, err.Error()
+	case err == domain.ErrBatchRolledBack:
+		return fiber.StatusFailedDependency, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return fiber.StatusGatewayTimeout, "Request timed out"
+	}
+	return fiber.StatusInternalServerError, "Failed to " + kind + " user"
+}
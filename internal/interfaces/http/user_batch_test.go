@@ -0,0 +1,98 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchStatus(t *testing.T) {
+	tests := []struct {
+		kind   string
+		err    error
+		status int
+	}{
+		{usecase.BatchCreate, nil, 201},
+		{usecase.BatchDelete, nil, 200},
+		{usecase.BatchDelete, &domain.ForbiddenError{Permission: domain.PermUsersDelete}, 403},
+		{usecase.BatchUpdate, domain.ErrUserNotFound, 404},
+		{usecase.BatchCreate, domain.ErrEmailRequired, 400},
+		{usecase.BatchCreate, fmt.Errorf("%w: user is required", domain.ErrInvalidBatchOperation), 400},
+		{usecase.BatchCreate, domain.ErrDuplicateEmail, 409},
+		{usecase.BatchUpdate, domain.ErrVersionConflict, 412},
+		{usecase.BatchDelete, errBatchPreconditionRequired, 428},
+		{usecase.BatchCreate, domain.ErrBatchRolledBack, 424},
+		{usecase.BatchUpdate, fmt.Errorf("query: %w", context.DeadlineExceeded), 504},
+	}
+	for _, tt := range tests {
+		status, _ := batchStatus(tt.kind, tt.err)
+		assert.Equal(t, tt.status, status, "%s: %v", tt.kind, tt.err)
+	}
+
+	status, message := batchStatus(usecase.BatchUpdate, fmt.Errorf("disk I/O error"))
+	assert.Equal(t, 500, status)
+	assert.Equal(t, "Failed to update user", message)
+}
+
+func TestMissingMembers(t *testing.T) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(`{"first_name":"Jane","email":null,"point_balance":0}`), &members); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"last_name", "email"}, missingMembers(members, requiredUserFields))
+}
+
+func TestIfMatchHeaderVersion(t *testing.T) {
+	noLookup := func() (*domain.User, error) {
+		t.Fatal("unexpected lookup")
+		return nil, nil
+	}
+
+	_, err := ifMatchHeaderVersion("", noLookup)
+	assert.Equal(t, errPreconditionRequired, err)
+
+	version, err := ifMatchHeaderVersion(`"v3"`, noLookup)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	version, err = ifMatchHeaderVersion("*", noLookup)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	_, err = ifMatchHeaderVersion(`W/"v3"`, noLookup)
+	assert.Equal(t, domain.ErrVersionConflict, err)
+
+	version, err = ifMatchHeaderVersion(`"v3", "v4"`, func() (*domain.User, error) {
+		return &domain.User{Version: 4}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, version)
+}
+
+func TestBatchUsers_RejectsSizeBeforeParsing(t *testing.T) {
+	// A nil use case fails the test if any operation is parsed or run
+	app := fiber.New()
+	app.Post("/users/batch", NewUserHandler(nil).BatchUsers)
+
+	op := `{"op":"delete","id":1,"if_match":"*"}`
+	for _, body := range []string{
+		`{"operations":[]}`,
+		`{"operations":[` + strings.Repeat(op+",", usecase.MaxBatchSize) + op + `]}`,
+	} {
+		req := httptest.NewRequest("POST", "/users/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -0,0 +1,347 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Export file formats
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+	exportFormatXLSX   = "xlsx"
+)
+
+// exportFlushRows is how many rows are written between flushes to the
+// client, so a slow export shows progress and a gone client stops it
+const exportFlushRows = 500
+
+// exportColumn is a user field an export can include, named as in the JSON
+// API. value returns a string, an int or a time.Time, or nil for no value.
+type exportColumn struct {
+	name  string
+	value func(*domain.User) interface{}
+}
+
+// exportColumns are the columns an export can include, in their default order
+var exportColumns = []exportColumn{
+	{"id", func(u *domain.User) interface{} { return u.ID }},
+	{"first_name", func(u *domain.User) interface{} { return u.FirstName }},
+	{"last_name", func(u *domain.User) interface{} { return u.LastName }},
+	{"email", func(u *domain.User) interface{} { return u.Email }},
+	{"phone", func(u *domain.User) interface{} { return u.Phone }},
+	{"address", func(u *domain.User) interface{} { return u.Address }},
+	{"avatar", func(u *domain.User) interface{} { return u.Avatar }},
+	{"member_level", func(u *domain.User) interface{} { return u.MemberLevel }},
+	{"point_balance", func(u *domain.User) interface{} { return u.PointBalance }},
+	{"created_at", func(u *domain.User) interface{} { return u.CreatedAt }},
+	{"updated_at", func(u *domain.User) interface{} { return u.UpdatedAt }},
+	{"version", func(u *domain.User) interface{} { return u.Version }},
+	{"deleted_at", func(u *domain.User) interface{} {
+		if u.DeletedAt == nil {
+			return nil
+		}
+		return *u.DeletedAt
+	}},
+}
+
+// parseExportColumns parses the columns query parameter, a comma-separated
+// list of column names. By default every column is exported, deleted_at only
+// when deleted users are included.
+func parseExportColumns(s string, includeDeleted bool) ([]exportColumn, error) {
+	if strings.TrimSpace(s) == "" {
+		var columns []exportColumn
+		for _, column := range exportColumns {
+			if column.name != "deleted_at" || includeDeleted {
+				columns = append(columns, column)
+			}
+		}
+		return columns, nil
+	}
+
+	var columns []exportColumn
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		column, ok := findExportColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("column %q is listed twice", name)
+		}
+		seen[name] = true
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func findExportColumn(name string) (exportColumn, bool) {
+	for _, column := range exportColumns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return exportColumn{}, false
+}
+
+// exportWriter writes the rows of an export file, whose header it has
+// already written
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	// Close finishes the file without closing the underlying writer
+	Close() error
+}
+
+// newExportWriter starts an export file in format with a header naming the
+// columns
+func newExportWriter(w io.Writer, format string, header []string) (exportWriter, error) {
+	switch format {
+	case exportFormatCSV:
+		return newCSVExportWriter(w, header)
+	case exportFormatNDJSON:
+		return &ndjsonExportWriter{w: w, keys: header}, nil
+	case exportFormatXLSX:
+		return newXLSXWriter(w, "Users", header)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// csvFormulaStarts are the characters that make a spreadsheet read a cell
+// as a formula
+const csvFormulaStarts = "=+-@\t\r"
+
+// csvCell escapes a text value for a CSV cell. Spreadsheets run a cell
+// starting with =, +, -, @, a tab or a carriage return as a formula, so a
+// member could plant one in their name for whoever opens the export;
+// prefixing a ' makes the cell plain text.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune(csvFormulaStarts, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// csvUncell reverses csvCell, so an exported file imports unchanged
+func csvUncell(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(csvFormulaStarts, rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// csvExportWriter writes CSV with a header row. Times are RFC 3339 as in
+// the JSON API, and text is escaped with csvCell.
+type csvExportWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVExportWriter(w io.Writer, header []string) (*csvExportWriter, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	return &csvExportWriter{w: writer, record: make([]string, len(header))}, nil
+}
+
+func (e *csvExportWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			e.record[i] = ""
+		case string:
+			e.record[i] = csvCell(v)
+		case int:
+			e.record[i] = strconv.Itoa(v)
+		case time.Time:
+			e.record[i] = v.Format("2006-01-02T15:04:05Z07:00")
+		default:
+			return fmt.Errorf("csv: cannot write %T", value)
+		}
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *csvExportWriter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonExportWriter writes one JSON object per line with the columns as
+// keys, in column order. Missing values are null.
+type ndjsonExportWriter struct {
+	w    io.Writer
+	keys []string
+	buf  []byte
+}
+
+func (e *ndjsonExportWriter) WriteRow(values []interface{}) error {
+	b := append(e.buf[:0], '{')
+	for i, value := range values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		key, _ := json.Marshal(e.keys[i])
+		b = append(b, key...)
+		b = append(b, ':')
+
+		if t, ok := value.(time.Time); ok {
+			value = t.Format("2006-01-02T15:04:05Z07:00")
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		b = append(b, data...)
+	}
+	b = append(b, '}', '\n')
+	e.buf = b
+
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *ndjsonExportWriter) Close() error { return nil }
+
+// exportContentTypes are the media types of the export formats
+var exportContentTypes = map[string]string{
+	exportFormatCSV:    "text/csv; charset=utf-8",
+	exportFormatNDJSON: "application/x-ndjson",
+	exportFormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// ExportUsers handles GET /users/export, a download of every user matching
+// the listing filters as CSV, NDJSON or an XLSX workbook. The file is
+// written as users are read, so exports of any size use constant memory.
+//
+// Query parameters: format (csv by default), columns, sort, member_level,
+// points_min, points_max, created_after, created_before and include_deleted.
+func (h *UserHandler) ExportUsers(c *fiber.Ctx) error {
+	format := strings.ToLower(c.Query("format", exportFormatCSV))
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "format must be csv, ndjson or xlsx",
+		})
+	}
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	columns, err := parseExportColumns(c.Query("columns"), filter.IncludeDeleted)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	export, err := h.users(c).ExportUsers(usecase.ExportUsersInput{Filter: filter, Sort: c.Query("sort")})
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrInvalidSortField || err == domain.ErrInvalidFilter || err == domain.ErrInvalidMemberLevel {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to export users",
+		})
+	}
+
+	// The body is written after the handler returns, once the status and
+	// headers have been sent, so it gets a context of its own and a failure
+	// can only be logged and the connection dropped, which the client sees
+	// as an incomplete download rather than a short file
+	ctx, cancel := middleware.Detach(c)
+	logger := middleware.Logger(c)
+	conn := c.Context().Conn()
+
+	c.Attachment(fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102"), format))
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		err := writeExport(ctx, w, export, format, columns)
+		var writeErr *exportWriteError
+		if errors.As(err, &writeErr) {
+			logger.Warn("export aborted", "error", writeErr.err)
+		} else if err != nil {
+			logger.Error("export failed", "error", err)
+		}
+		if err != nil {
+			conn.Close()
+		}
+	})
+	return nil
+}
+
+// exportWriteError is a failure to write an export to the client, usually
+// because the client went away, as opposed to a failure to read the users
+type exportWriteError struct {
+	err error
+}
+
+func (e *exportWriteError) Error() string { return "writing export: " + e.err.Error() }
+
+// writeExport writes the export file to w, flushing every exportFlushRows
+// rows
+func writeExport(ctx context.Context, w *bufio.Writer, export *usecase.UserExport, format string, columns []exportColumn) error {
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	out, err := newExportWriter(w, format, header)
+	if err != nil {
+		return &exportWriteError{err}
+	}
+
+	values := make([]interface{}, len(columns))
+	rows := 0
+	err = export.Each(ctx, func(user *domain.User) error {
+		for i, column := range columns {
+			values[i] = column.value(user)
+		}
+		if err := out.WriteRow(values); err != nil {
+			return &exportWriteError{err}
+		}
+		if rows++; rows%exportFlushRows == 0 {
+			if err := w.Flush(); err != nil {
+				return &exportWriteError{err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return &exportWriteError{err}
+	}
+	if err := w.Flush(); err != nil {
+		return &exportWriteError{err}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var exportCreated = time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+
+// writeRows writes a header and rows in format
+func writeRows(t *testing.T, format string, header []string, rows ...[]interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newExportWriter(&buf, format, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseExportColumns(t *testing.T) {
+	columns, err := parseExportColumns("", false)
+	assert.NoError(t, err)
+	assert.Len(t, columns, len(exportColumns)-1)
+	assert.Equal(t, "id", columns[0].name)
+
+	columns, _ = parseExportColumns("", true)
+	assert.Equal(t, "deleted_at", columns[len(columns)-1].name)
+
+	columns, err = parseExportColumns("email, point_balance", false)
+	assert.NoError(t, err)
+	if assert.Len(t, columns, 2) {
+		assert.Equal(t, "email", columns[0].name)
+		assert.Equal(t, "point_balance", columns[1].name)
+	}
+
+	_, err = parseExportColumns("email,password", false)
+	assert.EqualError(t, err, `unknown column "password"`)
+
+	_, err = parseExportColumns("email,email", false)
+	assert.Error(t, err)
+}
+
+func TestExportWriter_CSV(t *testing.T) {
+	data := writeRows(t, exportFormatCSV, []string{"id", "email", "created_at", "deleted_at"},
+		[]interface{}{7, "a,b@example.com", exportCreated, nil})
+
+	assert.Equal(t, "id,email,created_at,deleted_at\n7,\"a,b@example.com\",2025-03-01T12:30:00Z,\n", string(data))
+}
+
+func TestExportWriter_CSVEscapesFormulas(t *testing.T) {
+	data := writeRows(t, exportFormatCSV, []string{"first_name", "last_name", "phone", "address", "point_balance"},
+		[]interface{}{`=HYPERLINK("http://evil.example","x")`, "@SUM(A1)", "+66812345678", "-1 Sukhumvit", -5})
+
+	assert.Equal(t, "first_name,last_name,phone,address,point_balance\n"+
+		`"'=HYPERLINK(""http://evil.example"",""x"")",'@SUM(A1),'+66812345678,'-1 Sukhumvit,-5`+"\n", string(data))
+}
+
+func TestCSVCell(t *testing.T) {
+	for _, s := range []string{"=1+1", "+1", "-1", "@A1", "\t=1", "\r=1"} {
+		assert.Equal(t, "'"+s, csvCell(s))
+	}
+	for _, s := range []string{"", "Somchai", "a=b", "สมชาย", "'quoted"} {
+		assert.Equal(t, s, csvCell(s))
+	}
+	for _, s := range []string{"", "Somchai", "=1+1", "+66812345678", "'quoted", "''=1"} {
+		assert.Equal(t, s, csvUncell(csvCell(s)))
+	}
+}
+
+func TestExportWriter_NDJSON(t *testing.T) {
+	data := writeRows(t, exportFormatNDJSON, []string{"email", "id", "created_at", "deleted_at"},
+		[]interface{}{"a@example.com", 7, exportCreated, nil},
+		[]interface{}{"b@example.com", 8, exportCreated, exportCreated})
+
+	assert.Equal(t,
+		`{"email":"a@example.com","id":7,"created_at":"2025-03-01T12:30:00Z","deleted_at":null}`+"\n"+
+			`{"email":"b@example.com","id":8,"created_at":"2025-03-01T12:30:00Z","deleted_at":"2025-03-01T12:30:00Z"}`+"\n",
+		string(data))
+}
+
+// xlsxCell is a cell of a worksheet as read back
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+func TestExportWriter_XLSX(t *testing.T) {
+	data := writeRows(t, exportFormatXLSX, []string{"id", "first_name", "created_at", "deleted_at"},
+		[]interface{}{7, "Somchai <\x01> & Co", exportCreated, nil})
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if assert.Contains(t, parts, name) {
+			assert.NoError(t, xml.Unmarshal(parts[name], new(struct{})), name)
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Ref   string     `xml:"r,attr"`
+			Cells []xlsxCell `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, sheet.Rows, 2) {
+		return
+	}
+
+	header := sheet.Rows[0].Cells
+	if assert.Len(t, header, 4) {
+		assert.Equal(t, xlsxCell{Ref: "A1", Type: "inlineStr", Style: "2", Inline: "id"}, header[0])
+		assert.Equal(t, "D1", header[3].Ref)
+	}
+
+	row := sheet.Rows[1].Cells
+	if assert.Len(t, row, 3) {
+		assert.Equal(t, xlsxCell{Ref: "A2", Value: "7"}, row[0])
+		assert.Equal(t, xlsxCell{Ref: "B2", Type: "inlineStr", Inline: "Somchai <�> & Co"}, row[1])
+		assert.Equal(t, xlsxCell{Ref: "C2", Style: "1", Value: "45717.52083333333"}, row[2])
+	}
+}
+
+func TestAppendColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA", 16383: "XFD"} {
+		assert.Equal(t, want, string(appendColumnName(nil, i)))
+	}
+}
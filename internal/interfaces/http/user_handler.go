@@ -1,9 +1,16 @@
 package http
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 	"workshop_4/internal/domain"
 	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -20,6 +27,12 @@ func NewUserHandler(userUseCase *usecase.UserUseCase) *UserHandler {
 	}
 }
 
+// users returns the use case acting for the request's caller and logging
+// with the request's logger
+func (h *UserHandler) users(c *fiber.Ctx) *usecase.UserUseCase {
+	return h.userUseCase.As(principalFrom(c)).WithLogger(middleware.Logger(c))
+}
+
 // UserResponse represents the API response for user data
 type UserResponse struct {
 	ID           int    `json:"id"`
@@ -33,11 +46,13 @@ type UserResponse struct {
 	PointBalance int    `json:"point_balance"`
 	CreatedAt    string `json:"created_at"`
 	UpdatedAt    string `json:"updated_at"`
+	Version      int    `json:"version"`
+	DeletedAt    string `json:"deleted_at,omitempty"`
 }
 
 // toUserResponse converts domain user to response
 func toUserResponse(user *domain.User) UserResponse {
-	return UserResponse{
+	resp := UserResponse{
 		ID:           user.ID,
 		FirstName:    user.FirstName,
 		LastName:     user.LastName,
@@ -49,24 +64,279 @@ func toUserResponse(user *domain.User) UserResponse {
 		PointBalance: user.PointBalance,
 		CreatedAt:    user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		UpdatedAt:    user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Version:      user.Version,
+	}
+	if user.DeletedAt != nil {
+		resp.DeletedAt = user.DeletedAt.Format("2006-01-02T15:04:05Z07:00")
 	}
+	return resp
+}
+
+// PaginationResponse represents the pagination metadata of a user listing
+type PaginationResponse struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	Next       string `json:"next,omitempty"`
+	Prev       string `json:"prev,omitempty"`
 }
 
 // GetUsers handles GET /users
+//
+// Query parameters: limit, offset, cursor, sort, member_level, points_min,
+// points_max, created_after and created_before.
 func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
-	users, err := h.userUseCase.GetAllUsers()
+	input, err := parseListUsersInput(c)
 	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	page, err := h.users(c).ListUsers(c.UserContext(), input)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrInvalidPagination || err == domain.ErrInvalidCursor || err == domain.ErrInvalidSortField ||
+		err == domain.ErrInvalidFilter || err == domain.ErrInvalidMemberLevel {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to fetch users",
 		})
 	}
 
-	responses := make([]UserResponse, len(users))
-	for i, user := range users {
+	responses := make([]UserResponse, len(page.Users))
+	for i, user := range page.Users {
 		responses[i] = toUserResponse(user)
 	}
 
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"data":       responses,
+		"pagination": toPaginationResponse(c, input, page),
+	})
+}
+
+// parseListUsersInput reads the listing query parameters
+func parseListUsersInput(c *fiber.Ctx) (usecase.ListUsersInput, error) {
+	input := usecase.ListUsersInput{
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+
+	var err error
+	if input.Filter, err = parseUserFilter(c); err != nil {
+		return input, err
+	}
+	if input.Limit, err = queryInt(c, "limit"); err != nil {
+		return input, err
+	}
+	if input.Offset, err = queryInt(c, "offset"); err != nil {
+		return input, err
+	}
+
+	return input, nil
+}
+
+// parseUserFilter reads the filter query parameters shared by listings and
+// exports
+func parseUserFilter(c *fiber.Ctx) (domain.UserFilter, error) {
+	filter := domain.UserFilter{
+		MemberLevel: c.Query("member_level"),
+	}
+
+	var err error
+	if filter.IncludeDeleted, err = queryBool(c, "include_deleted"); err != nil {
+		return filter, err
+	}
+	if filter.PointsMin, err = queryIntPtr(c, "points_min"); err != nil {
+		return filter, err
+	}
+	if filter.PointsMax, err = queryIntPtr(c, "points_max"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedAfter, err = queryTimePtr(c, "created_after"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedBefore, err = queryTimePtr(c, "created_before"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func queryInt(c *fiber.Ctx, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: must be an integer", key)
+	}
+	return n, nil
+}
+
+func queryBool(c *fiber.Ctx, key string) (bool, error) {
+	value := c.Query(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: must be true or false", key)
+	}
+	return b, nil
+}
+
+func queryIntPtr(c *fiber.Ctx, key string) (*int, error) {
+	if c.Query(key) == "" {
+		return nil, nil
+	}
+	n, err := queryInt(c, key)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// queryTimePtr accepts RFC 3339 timestamps or plain YYYY-MM-DD dates
+func queryTimePtr(c *fiber.Ctx, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, ok := parseQueryTime(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s: use RFC 3339 or YYYY-MM-DD", key)
+	}
+	return &t, nil
+}
+
+// parseQueryTime parses an RFC 3339 timestamp or a YYYY-MM-DD date. A query
+// string decodes an unencoded + to a space, so a space before the offset,
+// as in "2024-01-01T00:00:00 07:00", is read as the + it was sent as.
+func parseQueryTime(value string) (time.Time, bool) {
+	if i := strings.LastIndexByte(value, ' '); i > 0 {
+		value = value[:i] + "+" + value[i+1:]
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// toPaginationResponse builds pagination metadata with next/prev links that
+// keep the caller's filters and sort. Links follow the mode of the request:
+// cursor requests get cursor links, everything else gets offset links.
+func toPaginationResponse(c *fiber.Ctx, input usecase.ListUsersInput, page *usecase.UserPage) PaginationResponse {
+	resp := PaginationResponse{
+		Total:      page.Total,
+		Limit:      page.Limit,
+		Offset:     page.Offset,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	}
+
+	params, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+	link := func(set map[string]string) string {
+		q := url.Values{}
+		for k, v := range params {
+			q[k] = v
+		}
+		q.Del("cursor")
+		q.Del("offset")
+		for k, v := range set {
+			q.Set(k, v)
+		}
+		return c.BaseURL() + c.Path() + "?" + q.Encode()
+	}
+
+	if input.Cursor != "" {
+		if page.NextCursor != "" {
+			resp.Next = link(map[string]string{"cursor": page.NextCursor})
+		}
+		if page.PrevCursor != "" {
+			resp.Prev = link(map[string]string{"cursor": page.PrevCursor})
+		}
+		return resp
+	}
+
+	if page.NextCursor != "" {
+		resp.Next = link(map[string]string{"offset": strconv.Itoa(page.Offset + page.Limit)})
+	}
+	if page.Offset > 0 {
+		prev := page.Offset - page.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		resp.Prev = link(map[string]string{"offset": strconv.Itoa(prev)})
+	}
+	return resp
+}
+
+// UserSearchResultResponse represents a ranked member search hit
+type UserSearchResultResponse struct {
+	UserResponse
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchUsers handles GET /users/search?q=
+func (h *UserHandler) SearchUsers(c *fiber.Ctx) error {
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	results, err := h.users(c).SearchUsers(c.UserContext(), c.Query("q"), limit)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrInvalidSearch || err == domain.ErrInvalidPagination {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to search users",
+		})
+	}
+
+	responses := make([]UserSearchResultResponse, len(results))
+	for i, result := range results {
+		responses[i] = UserSearchResultResponse{
+			UserResponse: toUserResponse(result.User),
+			Rank:         result.Rank,
+			Highlights:   result.Highlights,
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    responses,
@@ -83,20 +353,32 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 		})
 	}
 
-	user, err := h.userUseCase.GetUserByID(id)
+	user, err := h.users(c).GetUserByID(c.UserContext(), id)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
 	if err == domain.ErrUserNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"error":   "User not found",
 		})
 	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
 	if err != nil {
+		middleware.SetErrorCause(c, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to fetch user",
 		})
 	}
 
+	c.Set(fiber.HeaderETag, userETag(user))
+	if noneMatch(c, user) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    toUserResponse(user),
@@ -136,8 +418,11 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 		PointBalance: req.PointBalance,
 	}
 
-	user, err := h.userUseCase.CreateUser(input)
-	if err == domain.ErrFirstNameRequired || err == domain.ErrLastNameRequired || err == domain.ErrEmailRequired {
+	user, err := h.users(c).CreateUser(c.UserContext(), input)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrFirstNameRequired || err == domain.ErrLastNameRequired || err == domain.ErrEmailRequired || err == domain.ErrInvalidPointBalance || err == domain.ErrInvalidMemberLevel {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
 			"error":   err.Error(),
@@ -149,13 +434,18 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 			"error":   err.Error(),
 		})
 	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
 	if err != nil {
+		middleware.SetErrorCause(c, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to create user",
 		})
 	}
 
+	c.Set(fiber.HeaderETag, userETag(user))
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"data":    toUserResponse(user),
@@ -184,6 +474,11 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	version, err := h.ifMatchVersion(c, id)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
 	var req UpdateUserRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -192,6 +487,15 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// PUT replaces the whole user, so omitted fields are an error rather
+	// than a silent reset to empty values
+	if missing := missingFields(c, requiredUserFields); len(missing) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Missing required fields: " + strings.Join(missing, ", "),
+		})
+	}
+
 	input := usecase.UpdateUserInput{
 		FirstName:    req.FirstName,
 		LastName:     req.LastName,
@@ -201,28 +505,46 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 		Avatar:       req.Avatar,
 		MemberLevel:  req.MemberLevel,
 		PointBalance: req.PointBalance,
+		Version:      version,
 	}
 
-	user, err := h.userUseCase.UpdateUser(id, input)
+	user, err := h.users(c).UpdateUser(c.UserContext(), id, input)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
 	if err == domain.ErrUserNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"error":   "User not found",
 		})
 	}
-	if err == domain.ErrFirstNameRequired || err == domain.ErrLastNameRequired || err == domain.ErrEmailRequired {
+	if err == domain.ErrFirstNameRequired || err == domain.ErrLastNameRequired || err == domain.ErrEmailRequired || err == domain.ErrInvalidPointBalance || err == domain.ErrInvalidMemberLevel {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
 			"error":   err.Error(),
 		})
 	}
+	if err == domain.ErrVersionConflict {
+		return preconditionFailed(c, err)
+	}
+	if err == domain.ErrDuplicateEmail {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
 	if err != nil {
+		middleware.SetErrorCause(c, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to update user",
 		})
 	}
 
+	c.Set(fiber.HeaderETag, userETag(user))
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    toUserResponse(user),
@@ -239,14 +561,29 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.userUseCase.DeleteUser(id)
+	version, err := h.ifMatchVersion(c, id)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	err = h.users(c).DeleteUser(c.UserContext(), id, version)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrVersionConflict {
+		return preconditionFailed(c, err)
+	}
 	if err == domain.ErrUserNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"error":   "User not found",
 		})
 	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
 	if err != nil {
+		middleware.SetErrorCause(c, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to delete user",
@@ -258,3 +595,63 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 		"message": "User deleted successfully",
 	})
 }
+
+// RestoreUser handles POST /users/:id/restore
+//
+// If-Match is optional here: a deleted user cannot be edited, so there is
+// no lost update to guard against unless the client asks for the check.
+func (h *UserHandler) RestoreUser(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+	}
+
+	version := 0
+	if c.Get(fiber.HeaderIfMatch) != "" {
+		version, err = matchVersion(c, func() (*domain.User, error) {
+			return h.users(c).GetDeletedUserByID(c.UserContext(), id)
+		})
+		if err != nil {
+			return preconditionFailed(c, err)
+		}
+	}
+
+	user, err := h.users(c).RestoreUser(c.UserContext(), id, version)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrVersionConflict {
+		return preconditionFailed(c, err)
+	}
+	if err == domain.ErrUserNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Deleted user not found",
+		})
+	}
+	if err == domain.ErrDuplicateEmail {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to restore user",
+		})
+	}
+
+	c.Set(fiber.HeaderETag, userETag(user))
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    toUserResponse(user),
+	})
+}
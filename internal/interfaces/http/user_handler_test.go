@@ -0,0 +1,54 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTimePtr(t *testing.T) {
+	bangkok := time.FixedZone("", 7*60*60)
+	tests := []struct {
+		query string
+		want  time.Time
+	}{
+		{"created_after=2024-01-01T00:00:00Z", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"created_after=2024-01-01T00:00:00%2B07:00", time.Date(2024, 1, 1, 0, 0, 0, 0, bangkok)},
+		// An unencoded + arrives as a space
+		{"created_after=2024-01-01T00:00:00+07:00", time.Date(2024, 1, 1, 0, 0, 0, 0, bangkok)},
+		{"created_after=2024-01-01T00:00:00-05:00", time.Date(2024, 1, 1, 0, 0, 0, 0, time.FixedZone("", -5*60*60))},
+		{"created_after=2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)},
+	}
+
+	var got *time.Time
+	var gotErr error
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		got, gotErr = queryTimePtr(c, "created_after")
+		return nil
+	})
+	get := func(query string) {
+		if _, err := app.Test(httptest.NewRequest("GET", "/?"+query, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		get(tt.query)
+		if assert.NoError(t, gotErr, tt.query) && assert.NotNil(t, got, tt.query) {
+			assert.True(t, tt.want.Equal(*got), "%s: got %v", tt.query, *got)
+		}
+	}
+
+	for _, query := range []string{"created_after=yesterday", "created_after=2024-01-01+00:00:00"} {
+		get(query)
+		assert.EqualError(t, gotErr, "invalid created_after: use RFC 3339 or YYYY-MM-DD", query)
+	}
+
+	get("")
+	assert.NoError(t, gotErr)
+	assert.Nil(t, got)
+}
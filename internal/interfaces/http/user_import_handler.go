@@ -0,0 +1,276 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UserImportHandler handles HTTP requests for bulk user imports
+type UserImportHandler struct {
+	importUseCase *usecase.UserImportUseCase
+	// maxBytes bounds an import file
+	maxBytes int64
+}
+
+// NewUserImportHandler creates a new user import handler accepting files of
+// up to maxBytes
+func NewUserImportHandler(importUseCase *usecase.UserImportUseCase, maxBytes int64) *UserImportHandler {
+	return &UserImportHandler{
+		importUseCase: importUseCase,
+		maxBytes:      maxBytes,
+	}
+}
+
+// imports returns the use case acting for the request's caller and logging
+// with the request's logger
+func (h *UserImportHandler) imports(c *fiber.Ctx) *usecase.UserImportUseCase {
+	return h.importUseCase.As(principalFrom(c)).WithLogger(middleware.Logger(c))
+}
+
+// UserImportResponse represents the API response for an import
+type UserImportResponse struct {
+	ID         int    `json:"id"`
+	Format     string `json:"format"`
+	DryRun     bool   `json:"dry_run"`
+	Total      int    `json:"total"`
+	Imported   int    `json:"imported"`
+	Rejected   int    `json:"rejected"`
+	CreatedBy  string `json:"created_by,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	// ReportURL downloads the rejected rows as CSV
+	ReportURL string `json:"report_url"`
+}
+
+// toUserImportResponse converts a domain import to response
+func toUserImportResponse(imp *domain.UserImport) UserImportResponse {
+	return UserImportResponse{
+		ID:         imp.ID,
+		Format:     imp.Format,
+		DryRun:     imp.DryRun,
+		Total:      imp.Total,
+		Imported:   imp.Imported,
+		Rejected:   imp.Rejected,
+		CreatedBy:  imp.CreatedBy,
+		CreatedAt:  imp.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		FinishedAt: formatOptionalTime(imp.FinishedAt),
+		ReportURL:  fmt.Sprintf("/api/v1/users/imports/%d/rejections", imp.ID),
+	}
+}
+
+// importFormat picks the file format from the format query parameter or,
+// failing that, the Content-Type
+func importFormat(c *fiber.Ctx) string {
+	if format := strings.ToLower(c.Query("format")); format != "" {
+		return format
+	}
+	mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "text/csv", "application/csv":
+		return importFormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return importFormatNDJSON
+	}
+	return ""
+}
+
+// errImportTooLarge fails the read of an import file past the size limit
+var errImportTooLarge = errors.New("import file is too large")
+
+// limitedBody reads a request body until it passes max bytes, then fails
+// with errImportTooLarge
+type limitedBody struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if b.n > b.max {
+		return n - int(b.n-b.max), errImportTooLarge
+	}
+	return n, err
+}
+
+// requestBody returns the request body, read as it arrives when the server
+// streams it, limited to max bytes
+func requestBody(c *fiber.Ctx, max int64) io.Reader {
+	var body io.Reader
+	if stream := c.Request().BodyStream(); stream != nil {
+		body = stream
+	} else {
+		body = bytes.NewReader(c.Body())
+	}
+	return &limitedBody{r: io.LimitReader(body, max+1), max: max}
+}
+
+// importTooLarge answers 413 for an import file over the limit. The rest of
+// the body is left unread, so the connection is closed.
+func (h *UserImportHandler) importTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"success": false,
+		"error":   fmt.Sprintf("Import file is larger than %d bytes", h.maxBytes),
+	})
+}
+
+// ImportUsers handles POST /users/import. The body is a CSV file with a
+// header row or NDJSON, one user object per line, read as it arrives.
+func (h *UserImportHandler) ImportUsers(c *fiber.Ctx) error {
+	dryRun, err := queryBool(c, "dry_run")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	mapping, err := parseColumnMapping(c.Query("mapping"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	if int64(c.Request().Header.ContentLength()) > h.maxBytes {
+		return h.importTooLarge(c)
+	}
+
+	var source usecase.ImportSource
+	switch importFormat(c) {
+	case importFormatCSV:
+		source, err = newCSVImportSource(requestBody(c, h.maxBytes), mapping)
+	case importFormatNDJSON:
+		source = newNDJSONImportSource(requestBody(c, h.maxBytes), mapping)
+	default:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"success": false,
+			"error":   "Send text/csv or application/x-ndjson, or set format to csv or ndjson",
+		})
+	}
+	if errors.Is(err, errImportTooLarge) {
+		return h.importTooLarge(c)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	imp, err := h.imports(c).ImportUsers(c.UserContext(), source, dryRun)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if errors.Is(err, errImportTooLarge) {
+		return h.importTooLarge(c)
+	}
+	if errors.Is(err, domain.ErrInvalidImportFile) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to import users",
+		})
+	}
+
+	status := fiber.StatusCreated
+	if imp.DryRun {
+		status = fiber.StatusOK
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": true,
+		"data":    toUserImportResponse(imp),
+	})
+}
+
+// GetImport handles GET /users/imports/:id
+func (h *UserImportHandler) GetImport(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid import ID",
+		})
+	}
+
+	imp, err := h.imports(c).GetImport(c.UserContext(), id)
+	if err != nil {
+		return h.importError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    toUserImportResponse(imp),
+	})
+}
+
+// GetRejections handles GET /users/imports/:id/rejections, a CSV download
+// of the rows the import rejected with line, email and reason columns. The
+// email is as the file had it, so it is escaped like an export.
+func (h *UserImportHandler) GetRejections(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid import ID",
+		})
+	}
+
+	var report bytes.Buffer
+	w := csv.NewWriter(&report)
+	w.Write([]string{"line", "email", "reason"})
+	err = h.imports(c).GetRejections(c.UserContext(), id, func(rejection *domain.ImportRejection) error {
+		return w.Write([]string{strconv.Itoa(rejection.Line), csvCell(rejection.Email), csvCell(rejection.Reason)})
+	})
+	if err != nil {
+		return h.importError(c, err)
+	}
+	w.Flush()
+
+	c.Attachment(fmt.Sprintf("import-%d-rejections.csv", id))
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	return c.Send(report.Bytes())
+}
+
+// importError answers a failed import lookup
+func (h *UserImportHandler) importError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrUserImportNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Import not found",
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	middleware.SetErrorCause(c, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"error":   "Failed to fetch import",
+	})
+}
@@ -0,0 +1,375 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Patch document media types
+const (
+	MIMEMergePatch = "application/merge-patch+json" // RFC 7396
+	MIMEJSONPatch  = "application/json-patch+json"  // RFC 6902
+)
+
+// readOnlyUserFields are members of the user representation clients cannot change
+var readOnlyUserFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"version":    true,
+	"deleted_at": true,
+}
+
+// requiredUserFields must be present (and not null) in a PUT body, which
+// replaces the whole resource
+var requiredUserFields = []string{"first_name", "last_name", "email", "point_balance"}
+
+// errPatchTestFailed reports a failed JSON Patch "test" operation
+var errPatchTestFailed = errors.New("json patch test operation failed")
+
+// PatchUser handles PATCH /users/:id
+//
+// The body is an RFC 7396 JSON Merge Patch (application/merge-patch+json or
+// application/json) or an RFC 6902 JSON Patch (application/json-patch+json).
+// A member set to null in a merge patch resets the field to its default.
+func (h *UserHandler) PatchUser(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+	}
+
+	version, err := h.ifMatchVersion(c, id)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	var patch usecase.UserPatch
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	switch mediaType {
+	case MIMEMergePatch, fiber.MIMEApplicationJSON:
+		patch, err = parseMergePatch(c.Body())
+	case MIMEJSONPatch:
+		var user *domain.User
+		user, err = h.users(c).GetUserByID(c.UserContext(), id)
+		if errors.Is(err, domain.ErrForbidden) {
+			return forbidden(c, err)
+		}
+		if err == domain.ErrUserNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "User not found",
+			})
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return middleware.TimedOut(c, err)
+		}
+		if err != nil {
+			middleware.SetErrorCause(c, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Failed to update user",
+			})
+		}
+		patch, err = parseJSONPatch(c.Body(), user)
+	default:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"success": false,
+			"error":   "Content-Type must be " + MIMEMergePatch + " or " + MIMEJSONPatch,
+		})
+	}
+	if err == errPatchTestFailed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	patch.Version = version
+	user, err := h.users(c).PatchUser(c.UserContext(), id, patch)
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrVersionConflict {
+		return preconditionFailed(c, err)
+	}
+	if err == domain.ErrUserNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found",
+		})
+	}
+	if err == domain.ErrFirstNameRequired || err == domain.ErrLastNameRequired || err == domain.ErrEmailRequired || err == domain.ErrInvalidPointBalance || err == domain.ErrInvalidMemberLevel {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if err == domain.ErrDuplicateEmail {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	if err != nil {
+		middleware.SetErrorCause(c, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to update user",
+		})
+	}
+
+	c.Set(fiber.HeaderETag, userETag(user))
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    toUserResponse(user),
+	})
+}
+
+// parseMergePatch reads an RFC 7396 merge patch. The user representation is
+// flat, so the patch must be an object whose members map onto user fields.
+func parseMergePatch(body []byte) (usecase.UserPatch, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return usecase.UserPatch{}, errors.New("merge patch must be a JSON object")
+	}
+	return userPatchFromMembers(members)
+}
+
+// jsonPatchOperation is a single RFC 6902 operation
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// parseJSONPatch applies an RFC 6902 patch to the current representation of
+// the user and returns the fields it changed. Operations apply in order and
+// the patch is all or nothing.
+func parseJSONPatch(body []byte, user *domain.User) (usecase.UserPatch, error) {
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return usecase.UserPatch{}, errors.New("json patch must be an array of operations")
+	}
+
+	original, err := userDocument(user)
+	if err != nil {
+		return usecase.UserPatch{}, err
+	}
+	doc, _ := userDocument(user)
+
+	for i, op := range ops {
+		if err := applyJSONPatchOperation(doc, op); err != nil {
+			if err == errPatchTestFailed {
+				return usecase.UserPatch{}, err
+			}
+			return usecase.UserPatch{}, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	// Collect changed members; removed members become null
+	changed := make(map[string]json.RawMessage)
+	for name, value := range original {
+		patched, ok := doc[name]
+		if !ok {
+			changed[name] = json.RawMessage("null")
+		} else if !jsonEqual(value, patched) {
+			changed[name] = patched
+		}
+	}
+	for name, value := range doc {
+		if _, ok := original[name]; !ok {
+			changed[name] = value
+		}
+	}
+
+	return userPatchFromMembers(changed)
+}
+
+// applyJSONPatchOperation applies one operation to a flat document
+func applyJSONPatchOperation(doc map[string]json.RawMessage, op jsonPatchOperation) error {
+	name, err := parsePointer(op.Path)
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return fmt.Errorf("%s requires a value", op.Op)
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		doc[name] = op.Value
+	case "remove":
+		if _, ok := doc[name]; !ok {
+			return fmt.Errorf("path %s does not exist", op.Path)
+		}
+		delete(doc, name)
+	case "replace":
+		if _, ok := doc[name]; !ok {
+			return fmt.Errorf("path %s does not exist", op.Path)
+		}
+		doc[name] = op.Value
+	case "move", "copy":
+		from, _ := parsePointer(op.From)
+		value, ok := doc[from]
+		if !ok {
+			return fmt.Errorf("path %s does not exist", op.From)
+		}
+		if op.Op == "move" {
+			delete(doc, from)
+		}
+		doc[name] = value
+	case "test":
+		value, ok := doc[name]
+		if !ok || !jsonEqual(value, op.Value) {
+			return errPatchTestFailed
+		}
+	default:
+		return fmt.Errorf("unsupported operation %q", op.Op)
+	}
+
+	return nil
+}
+
+// parsePointer resolves an RFC 6901 pointer to a top-level member name
+func parsePointer(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") || strings.Count(pointer, "/") != 1 {
+		return "", fmt.Errorf("path %q must address a top-level field", pointer)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:]), nil
+}
+
+// userDocument renders the user as the JSON object clients see
+func userDocument(user *domain.User) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(toUserResponse(user))
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]json.RawMessage
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// jsonEqual compares two JSON values semantically
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// userPatchFromMembers maps JSON members onto a UserPatch
+func userPatchFromMembers(members map[string]json.RawMessage) (usecase.UserPatch, error) {
+	var patch usecase.UserPatch
+	var err error
+
+	for name, raw := range members {
+		if readOnlyUserFields[name] {
+			return patch, fmt.Errorf("%s is read-only", name)
+		}
+
+		switch name {
+		case "first_name":
+			patch.FirstName, err = decodeOptional[string](name, raw)
+		case "last_name":
+			patch.LastName, err = decodeOptional[string](name, raw)
+		case "email":
+			patch.Email, err = decodeOptional[string](name, raw)
+		case "phone":
+			patch.Phone, err = decodeOptional[string](name, raw)
+		case "address":
+			patch.Address, err = decodeOptional[string](name, raw)
+		case "avatar":
+			patch.Avatar, err = decodeOptional[string](name, raw)
+		case "member_level":
+			patch.MemberLevel, err = decodeOptional[string](name, raw)
+		case "point_balance":
+			patch.PointBalance, err = decodeOptional[int](name, raw)
+		default:
+			return patch, fmt.Errorf("unknown field %q", name)
+		}
+		if err != nil {
+			return patch, err
+		}
+	}
+
+	return patch, nil
+}
+
+// decodeOptional decodes a member value; JSON null yields a set zero value
+func decodeOptional[T any](name string, raw json.RawMessage) (usecase.Optional[T], error) {
+	var value T
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return usecase.Some(value), nil
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return usecase.Optional[T]{}, fmt.Errorf("invalid value for %s", name)
+	}
+	return usecase.Some(value), nil
+}
+
+// missingFields returns the fields absent or null in a JSON or form body
+func missingFields(c *fiber.Ctx, fields []string) []string {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &members); err == nil {
+		return missingMembers(members, fields)
+	}
+
+	present := make(map[string]bool)
+	c.Request().PostArgs().VisitAll(func(key, _ []byte) {
+		present[string(key)] = true
+	})
+
+	var missing []string
+	for _, field := range fields {
+		if !present[field] {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// missingMembers returns the fields that are absent or null in a JSON object
+func missingMembers(members map[string]json.RawMessage, fields []string) []string {
+	var missing []string
+	for _, field := range fields {
+		raw, ok := members[field]
+		if !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
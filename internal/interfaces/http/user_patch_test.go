@@ -0,0 +1,65 @@
+package http
+
+import (
+	"testing"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMergePatch(t *testing.T) {
+	patch, err := parseMergePatch([]byte(`{"first_name":"Jane","phone":null,"point_balance":200}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, usecase.Some("Jane"), patch.FirstName)
+	assert.Equal(t, usecase.Optional[string]{Set: true}, patch.Phone)
+	assert.Equal(t, usecase.Some(200), patch.PointBalance)
+	assert.False(t, patch.LastName.Set)
+}
+
+func TestParseMergePatch_Invalid(t *testing.T) {
+	_, err := parseMergePatch([]byte(`["first_name"]`))
+	assert.Error(t, err)
+
+	_, err = parseMergePatch([]byte(`{"id":5}`))
+	assert.EqualError(t, err, "id is read-only")
+
+	_, err = parseMergePatch([]byte(`{"nickname":"JJ"}`))
+	assert.Error(t, err)
+
+	_, err = parseMergePatch([]byte(`{"point_balance":"lots"}`))
+	assert.Error(t, err)
+}
+
+func TestParseJSONPatch(t *testing.T) {
+	user := &domain.User{ID: 1, FirstName: "John", LastName: "Doe", Email: "john@example.com", Phone: "0812345678"}
+
+	patch, err := parseJSONPatch([]byte(`[
+		{"op":"test","path":"/first_name","value":"John"},
+		{"op":"replace","path":"/first_name","value":"Jane"},
+		{"op":"move","from":"/phone","path":"/address"}
+	]`), user)
+
+	assert.NoError(t, err)
+	assert.Equal(t, usecase.Some("Jane"), patch.FirstName)
+	assert.Equal(t, usecase.Optional[string]{Set: true}, patch.Phone)
+	assert.Equal(t, usecase.Some("0812345678"), patch.Address)
+	assert.False(t, patch.Email.Set)
+}
+
+func TestParseJSONPatch_Errors(t *testing.T) {
+	user := &domain.User{ID: 1, FirstName: "John"}
+
+	_, err := parseJSONPatch([]byte(`[{"op":"test","path":"/first_name","value":"Jane"}]`), user)
+	assert.Equal(t, errPatchTestFailed, err)
+
+	_, err = parseJSONPatch([]byte(`[{"op":"replace","path":"/id","value":2}]`), user)
+	assert.EqualError(t, err, "id is read-only")
+
+	_, err = parseJSONPatch([]byte(`[{"op":"add","path":"/tags/0","value":"vip"}]`), user)
+	assert.Error(t, err)
+
+	_, err = parseJSONPatch([]byte(`[{"op":"replace","path":"/first_name"}]`), user)
+	assert.Error(t, err)
+}
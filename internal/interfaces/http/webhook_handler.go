@@ -0,0 +1,308 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/usecase"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WebhookHandler handles HTTP requests for webhook subscriptions and their
+// deliveries
+type WebhookHandler struct {
+	webhookUseCase *usecase.WebhookUseCase
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookUseCase *usecase.WebhookUseCase) *WebhookHandler {
+	return &WebhookHandler{
+		webhookUseCase: webhookUseCase,
+	}
+}
+
+// webhooks returns the use case acting for the request's caller and logging
+// with the request's logger
+func (h *WebhookHandler) webhooks(c *fiber.Ctx) *usecase.WebhookUseCase {
+	return h.webhookUseCase.As(principalFrom(c)).WithLogger(middleware.Logger(c))
+}
+
+// WebhookResponse represents the API response for a webhook subscription.
+// Secret is only set in the response that creates it.
+type WebhookResponse struct {
+	ID          int      `json:"id"`
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description,omitempty"`
+	CreatedBy   string   `json:"created_by,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+	Secret      string   `json:"secret,omitempty"`
+}
+
+// toWebhookResponse converts a domain webhook subscription to response
+func toWebhookResponse(sub *domain.WebhookSubscription) WebhookResponse {
+	resp := WebhookResponse{
+		ID:          sub.ID,
+		URL:         sub.URL,
+		EventTypes:  sub.EventTypes,
+		Description: sub.Description,
+		CreatedBy:   sub.CreatedBy,
+		CreatedAt:   sub.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if resp.EventTypes == nil {
+		resp.EventTypes = []string{}
+	}
+	return resp
+}
+
+// WebhookDeliveryResponse represents the API response for a webhook
+// delivery
+type WebhookDeliveryResponse struct {
+	ID             int    `json:"id"`
+	EventID        int    `json:"event_id"`
+	EventType      string `json:"event_type"`
+	UserID         int    `json:"user_id"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  string `json:"next_attempt_at,omitempty"`
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	DeliveredAt    string `json:"delivered_at,omitempty"`
+}
+
+// toWebhookDeliveryResponse converts a domain webhook delivery to response
+func toWebhookDeliveryResponse(delivery *domain.WebhookDelivery) WebhookDeliveryResponse {
+	return WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		EventID:        delivery.Event.ID,
+		EventType:      delivery.Event.Type,
+		UserID:         delivery.Event.UserID,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  formatOptionalTime(delivery.NextAttemptAt),
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		DeliveredAt:    formatOptionalTime(delivery.DeliveredAt),
+	}
+}
+
+// CreateWebhookRequest represents the request body for subscribing a
+// webhook. No event types subscribes to every event.
+type CreateWebhookRequest struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description"`
+}
+
+// webhookFailure answers a request whose webhook call failed with err;
+// action completes "Failed to ..." for unexpected errors
+func webhookFailure(c *fiber.Ctx, err error, action string) error {
+	if errors.Is(err, domain.ErrForbidden) {
+		return forbidden(c, err)
+	}
+	if err == domain.ErrWebhookNotFound || err == domain.ErrWebhookDeliveryNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return middleware.TimedOut(c, err)
+	}
+	middleware.SetErrorCause(c, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"error":   "Failed to " + action,
+	})
+}
+
+// webhookID reads the :id route parameter. An invalid one is answered with
+// 400 here, and the ID returned is 0 along with the error of sending it.
+func webhookID(c *fiber.Ctx) (int, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil || id <= 0 {
+		return 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid webhook ID",
+		})
+	}
+	return id, nil
+}
+
+// CreateWebhook handles POST /webhooks
+func (h *WebhookHandler) CreateWebhook(c *fiber.Ctx) error {
+	var req CreateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+
+	sub, err := h.webhooks(c).CreateSubscription(c.UserContext(), usecase.CreateWebhookInput{
+		URL:         req.URL,
+		EventTypes:  req.EventTypes,
+		Description: req.Description,
+	})
+	if err == domain.ErrInvalidWebhookURL || err == domain.ErrInvalidEventType {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if err != nil {
+		return webhookFailure(c, err, "create webhook")
+	}
+
+	resp := toWebhookResponse(sub)
+	resp.Secret = sub.Secret
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    resp,
+	})
+}
+
+// ListWebhooks handles GET /webhooks
+func (h *WebhookHandler) ListWebhooks(c *fiber.Ctx) error {
+	subs, err := h.webhooks(c).ListSubscriptions(c.UserContext())
+	if err != nil {
+		return webhookFailure(c, err, "fetch webhooks")
+	}
+
+	responses := make([]WebhookResponse, len(subs))
+	for i, sub := range subs {
+		responses[i] = toWebhookResponse(sub)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    responses,
+	})
+}
+
+// GetWebhook handles GET /webhooks/:id
+func (h *WebhookHandler) GetWebhook(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if id == 0 {
+		return err
+	}
+
+	sub, err := h.webhooks(c).GetSubscription(c.UserContext(), id)
+	if err != nil {
+		return webhookFailure(c, err, "fetch webhook")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    toWebhookResponse(sub),
+	})
+}
+
+// DeleteWebhook handles DELETE /webhooks/:id
+func (h *WebhookHandler) DeleteWebhook(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if id == 0 {
+		return err
+	}
+
+	if err := h.webhooks(c).DeleteSubscription(c.UserContext(), id); err != nil {
+		return webhookFailure(c, err, "delete webhook")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// ListWebhookDeliveries handles GET /webhooks/:id/deliveries, newest first,
+// optionally only those with ?status=pending, delivered or dead
+func (h *WebhookHandler) ListWebhookDeliveries(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if id == 0 {
+		return err
+	}
+
+	status := c.Query("status")
+	if status != "" && status != domain.DeliveryPending && status != domain.DeliveryDelivered && status != domain.DeliveryDead {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid status: must be pending, delivered or dead",
+		})
+	}
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	deliveries, err := h.webhooks(c).ListDeliveries(c.UserContext(), id, status, limit)
+	if err != nil {
+		return webhookFailure(c, err, "fetch webhook deliveries")
+	}
+
+	responses := make([]WebhookDeliveryResponse, len(deliveries))
+	for i, delivery := range deliveries {
+		responses[i] = toWebhookDeliveryResponse(delivery)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    responses,
+	})
+}
+
+// ReplayWebhookDelivery handles POST /webhooks/:id/deliveries/:delivery_id/replay
+func (h *WebhookHandler) ReplayWebhookDelivery(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if id == 0 {
+		return err
+	}
+	deliveryID, err := strconv.Atoi(c.Params("delivery_id"))
+	if err != nil || deliveryID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid delivery ID",
+		})
+	}
+
+	delivery, err := h.webhooks(c).ReplayDelivery(c.UserContext(), id, deliveryID)
+	if err == nil && delivery == nil {
+		err = domain.ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return webhookFailure(c, err, "replay webhook delivery")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"data":    toWebhookDeliveryResponse(delivery),
+	})
+}
+
+// ReplayDeadWebhookDeliveries handles POST /webhooks/:id/replay, which
+// queues every dead delivery of the webhook again
+func (h *WebhookHandler) ReplayDeadWebhookDeliveries(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if id == 0 {
+		return err
+	}
+
+	requeued, err := h.webhooks(c).ReplayDeadDeliveries(c.UserContext(), id)
+	if err != nil {
+		return webhookFailure(c, err, "replay webhook deliveries")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"data":    fiber.Map{"requeued": requeued},
+	})
+}
@@ -0,0 +1,228 @@
+package http
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxMaxRows is the most rows a worksheet can hold
+const xlsxMaxRows = 1048576
+
+// Cell styles, indexes into cellXfs of xlsxStyles
+const (
+	xlsxStyleDefault  = 0
+	xlsxStyleDateTime = 1
+	xlsxStyleHeader   = 2
+)
+
+// The fixed parts of a single-sheet workbook. Strings are written inline in
+// the cells rather than to a shared strings table, which would have to be
+// complete before the sheet could be written.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+
+	// xlsxStyles defines the cell styles: default, date and time, and bold
+	// for the header row
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="3">` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+		`</cellXfs>` +
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+		`</styleSheet>`
+
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<sheetData>`
+
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxWriter writes a workbook of one sheet row by row. The package is
+// zipped as it is written and the sheet is the last part, so a workbook of
+// any size is written in constant memory.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+	// buf is reused for each row's XML
+	buf []byte
+}
+
+// newXLSXWriter writes the fixed parts of a workbook with one sheet of the
+// given name and starts the sheet with a bold, frozen header row
+func newXLSXWriter(w io.Writer, sheetName string, header []string) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	workbook := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="` + xmlEscape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxWriter{zip: archive, sheet: bufio.NewWriterSize(sheet, 32*1024)}
+	if _, err := x.sheet.WriteString(xlsxSheetStart); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(header))
+	for i, name := range header {
+		values[i] = name
+	}
+	if err := x.writeRow(values, xlsxStyleHeader); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// WriteRow appends a row. Strings are written as text, ints as numbers and
+// times as dates; nil and empty strings leave the cell empty.
+func (x *xlsxWriter) WriteRow(values []interface{}) error {
+	return x.writeRow(values, xlsxStyleDefault)
+}
+
+func (x *xlsxWriter) writeRow(values []interface{}, style int) error {
+	if x.rows == xlsxMaxRows {
+		return fmt.Errorf("xlsx: a sheet holds at most %d rows", xlsxMaxRows)
+	}
+	x.rows++
+	row := strconv.Itoa(x.rows)
+
+	b := x.buf[:0]
+	b = append(b, `<row r="`...)
+	b = append(b, row...)
+	b = append(b, `">`...)
+	for i, value := range values {
+		if value == nil || value == "" {
+			continue
+		}
+		b = append(b, `<c r="`...)
+		b = appendColumnName(b, i)
+		b = append(b, row...)
+		b = append(b, '"')
+
+		switch v := value.(type) {
+		case int:
+			b = appendStyle(b, style)
+			b = append(b, `><v>`...)
+			b = strconv.AppendInt(b, int64(v), 10)
+			b = append(b, `</v></c>`...)
+		case time.Time:
+			b = appendStyle(b, xlsxStyleDateTime)
+			b = append(b, `><v>`...)
+			b = strconv.AppendFloat(b, excelSerial(v), 'f', -1, 64)
+			b = append(b, `</v></c>`...)
+		case string:
+			b = appendStyle(b, style)
+			b = append(b, ` t="inlineStr"><is><t xml:space="preserve">`...)
+			b = append(b, xmlEscape(v)...)
+			b = append(b, `</t></is></c>`...)
+		default:
+			return fmt.Errorf("xlsx: cannot write %T", value)
+		}
+	}
+	b = append(b, `</row>`...)
+	x.buf = b
+
+	_, err := x.sheet.Write(b)
+	return err
+}
+
+// Close ends the sheet and writes the zip directory. It does not close the
+// underlying writer.
+func (x *xlsxWriter) Close() error {
+	if _, err := x.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+func appendStyle(b []byte, style int) []byte {
+	if style == xlsxStyleDefault {
+		return b
+	}
+	b = append(b, ` s="`...)
+	b = strconv.AppendInt(b, int64(style), 10)
+	return append(b, '"')
+}
+
+// appendColumnName appends the letters of the zero-based column i: A to Z,
+// then AA and so on
+func appendColumnName(b []byte, i int) []byte {
+	var name [4]byte
+	n := len(name)
+	for i++; i > 0; i = (i - 1) / 26 {
+		n--
+		name[n] = byte('A' + (i-1)%26)
+	}
+	return append(b, name[n:]...)
+}
+
+// excelSerial converts t to a spreadsheet date: days since 1899-12-30, in UTC
+func excelSerial(t time.Time) float64 {
+	const secondsPerDay = 24 * 60 * 60
+	const unixEpochSerial = 25569 // 1970-01-01
+	t = t.UTC().Truncate(time.Second)
+	return float64(t.Unix())/secondsPerDay + unixEpochSerial
+}
+
+// xmlEscape escapes s for XML text or attributes. Characters XML cannot
+// carry, such as most control characters, become U+FFFD.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"workshop_4/internal/domain"
+)
+
+// AllPermissions grants a role every permission
+const AllPermissions = "*"
+
+// DefaultRolePermissions returns the standard roles: support staff handle
+// contact details, finance handles points and admins may do anything
+func DefaultRolePermissions() map[string][]domain.Permission {
+	return map[string][]domain.Permission{
+		"admin":   {AllPermissions},
+		"support": {domain.PermUsersRead, domain.PermUsersCreate, domain.PermUsersEditContact},
+		"finance": {domain.PermUsersRead, domain.PermUsersEditPoints},
+	}
+}
+
+// ParseRolePermissions parses role rules in the form
+// "admin=*;support=users:read,users:edit_contact;finance=users:read,users:edit_points".
+// An empty string yields DefaultRolePermissions.
+func ParseRolePermissions(s string) (map[string][]domain.Permission, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultRolePermissions(), nil
+	}
+
+	roles := make(map[string][]domain.Permission)
+	for _, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		role, list, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid role rule %q: expected role=permission,...", part)
+		}
+		var permissions []domain.Permission
+		for _, permission := range strings.Split(list, ",") {
+			if permission = strings.TrimSpace(permission); permission != "" {
+				permissions = append(permissions, domain.Permission(permission))
+			}
+		}
+		roles[strings.TrimSpace(role)] = permissions
+	}
+
+	return roles, nil
+}
+
+// AccessPolicy decides what a principal may do based on its roles
+type AccessPolicy struct {
+	roles map[string]map[domain.Permission]bool
+}
+
+// NewAccessPolicy creates a policy from role rules. Every permission must be
+// known or AllPermissions, so a typo cannot silently grant nothing.
+func NewAccessPolicy(roles map[string][]domain.Permission) (*AccessPolicy, error) {
+	known := make(map[domain.Permission]bool, len(domain.Permissions))
+	for _, permission := range domain.Permissions {
+		known[permission] = true
+	}
+
+	policy := &AccessPolicy{roles: make(map[string]map[domain.Permission]bool, len(roles))}
+	for role, permissions := range roles {
+		if role == "" {
+			return nil, fmt.Errorf("role name is required")
+		}
+		granted := make(map[domain.Permission]bool)
+		for _, permission := range permissions {
+			switch {
+			case permission == AllPermissions:
+				for p := range known {
+					granted[p] = true
+				}
+			case known[permission]:
+				granted[permission] = true
+			default:
+				return nil, fmt.Errorf("role %q: unknown permission %q", role, permission)
+			}
+		}
+		policy.roles[role] = granted
+	}
+
+	return policy, nil
+}
+
+// NewDefaultAccessPolicy creates a policy with the default roles
+func NewDefaultAccessPolicy() *AccessPolicy {
+	policy, _ := NewAccessPolicy(DefaultRolePermissions())
+	return policy
+}
+
+// Can reports whether the principal holds the permission as a scope or
+// through any of its roles
+func (p *AccessPolicy) Can(principal *domain.Principal, permission domain.Permission) bool {
+	if principal == nil {
+		return false
+	}
+	for _, scope := range principal.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	for _, role := range principal.Roles {
+		if p.roles[role][permission] {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize requires every permission, naming the first one missing
+func (p *AccessPolicy) Authorize(principal *domain.Principal, permissions ...domain.Permission) error {
+	for _, permission := range permissions {
+		if !p.Can(principal, permission) {
+			return &domain.ForbiddenError{Permission: permission}
+		}
+	}
+	return nil
+}
+
+// AuthorizeAny requires at least one of the permissions, naming the first
+// when none is granted
+func (p *AccessPolicy) AuthorizeAny(principal *domain.Principal, permissions ...domain.Permission) error {
+	for _, permission := range permissions {
+		if p.Can(principal, permission) {
+			return nil
+		}
+	}
+	return &domain.ForbiddenError{Permission: permissions[0]}
+}
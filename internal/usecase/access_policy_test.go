@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	admin   = &domain.Principal{Subject: "u-admin", Roles: []string{"admin"}}
+	support = &domain.Principal{Subject: "u-support", Roles: []string{"support"}}
+	finance = &domain.Principal{Subject: "u-finance", Roles: []string{"finance"}}
+)
+
+// assertForbidden checks err names the missing permission
+func assertForbidden(t *testing.T, err error, permission domain.Permission) {
+	t.Helper()
+	var forbidden *domain.ForbiddenError
+	if assert.True(t, errors.As(err, &forbidden), "expected ForbiddenError, got %v", err) {
+		assert.Equal(t, permission, forbidden.Permission)
+		assert.True(t, errors.Is(err, domain.ErrForbidden))
+	}
+}
+
+func TestParseRolePermissions(t *testing.T) {
+	roles, err := ParseRolePermissions("admin=*; auditor=users:read,users:read_deleted")
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Permission{"*"}, roles["admin"])
+	assert.Equal(t, []domain.Permission{domain.PermUsersRead, domain.PermUsersReadDeleted}, roles["auditor"])
+
+	roles, err = ParseRolePermissions("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRolePermissions(), roles)
+
+	_, err = ParseRolePermissions("admin")
+	assert.Error(t, err)
+}
+
+func TestNewAccessPolicy_RejectsUnknownPermission(t *testing.T) {
+	_, err := NewAccessPolicy(map[string][]domain.Permission{"support": {"users:raed"}})
+	assert.Error(t, err)
+}
+
+func TestAccessPolicy_DefaultRoles(t *testing.T) {
+	policy := NewDefaultAccessPolicy()
+
+	for _, permission := range domain.Permissions {
+		assert.True(t, policy.Can(admin, permission), permission)
+	}
+	assert.True(t, policy.Can(support, domain.PermUsersEditContact))
+	assert.False(t, policy.Can(support, domain.PermUsersEditPoints))
+	assert.False(t, policy.Can(support, domain.PermUsersDelete))
+	assert.True(t, policy.Can(finance, domain.PermUsersEditPoints))
+	assert.False(t, policy.Can(finance, domain.PermUsersEditContact))
+	assert.False(t, policy.Can(nil, domain.PermUsersRead))
+	assert.False(t, policy.Can(&domain.Principal{Roles: []string{"unknown"}}, domain.PermUsersRead))
+
+	assertForbidden(t, policy.Authorize(support, domain.PermUsersRead, domain.PermUsersDelete), domain.PermUsersDelete)
+	assert.NoError(t, policy.AuthorizeAny(finance, domain.PermUsersEditContact, domain.PermUsersEditPoints))
+}
+
+func TestUserUseCase_FieldLevelPermissions(t *testing.T) {
+	existing := func() *domain.User {
+		return &domain.User{ID: 1, FirstName: "John", LastName: "Doe", Email: "john@example.com",
+			MemberLevel: "Bronze", PointBalance: 100, Version: 2}
+	}
+
+	t.Run("support cannot change points", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("FindByID", 1).Return(existing(), nil)
+
+		_, err := NewUserUseCase(mockRepo).As(support).PatchUser(context.Background(), 1, UserPatch{PointBalance: Some(5000)})
+
+		assertForbidden(t, err, domain.PermUsersEditPoints)
+		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+	})
+
+	t.Run("finance cannot change contact details", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("FindByID", 1).Return(existing(), nil)
+
+		_, err := NewUserUseCase(mockRepo).As(finance).UpdateUser(context.Background(), 1, UpdateUserInput{
+			FirstName: "John", LastName: "Doe", Email: "other@example.com", PointBalance: 100,
+		})
+
+		assertForbidden(t, err, domain.PermUsersEditContact)
+	})
+
+	t.Run("finance may resubmit unchanged contact details", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("FindByID", 1).Return(existing(), nil)
+		mockRepo.On("Update", mock.Anything).Return(nil)
+
+		user, err := NewUserUseCase(mockRepo).As(finance).UpdateUser(context.Background(), 1, UpdateUserInput{
+			FirstName: "John", LastName: "Doe", Email: "john@example.com", PointBalance: 1500,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Silver", user.MemberLevel)
+	})
+
+	t.Run("support can edit contact details", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("FindByID", 1).Return(existing(), nil)
+		mockRepo.On("Update", mock.Anything).Return(nil)
+
+		_, err := NewUserUseCase(mockRepo).As(support).PatchUser(context.Background(), 1, UserPatch{Phone: Some("0812345678")})
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("support cannot create with an opening balance", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+
+		_, err := NewUserUseCase(mockRepo).As(support).CreateUser(context.Background(), CreateUserInput{
+			FirstName: "John", LastName: "Doe", Email: "john@example.com", PointBalance: 100,
+		})
+
+		assertForbidden(t, err, domain.PermUsersEditPoints)
+	})
+
+	t.Run("only admins delete or see deleted users", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		uc := NewUserUseCase(mockRepo)
+
+		assertForbidden(t, uc.As(support).DeleteUser(context.Background(), 1, 0), domain.PermUsersDelete)
+		assertForbidden(t, uc.As(finance).DeleteUser(context.Background(), 1, 0), domain.PermUsersDelete)
+		_, err := uc.As(support).ListUsers(context.Background(), ListUsersInput{Filter: domain.UserFilter{IncludeDeleted: true}})
+		assertForbidden(t, err, domain.PermUsersReadDeleted)
+		mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unauthenticated callers are denied", func(t *testing.T) {
+		_, err := NewUserUseCase(new(MockUserRepository)).As(nil).GetUserByID(context.Background(), 1)
+
+		assertForbidden(t, err, domain.PermUsersRead)
+	})
+}
+
+func TestAccessPolicy_Scopes(t *testing.T) {
+	policy := NewDefaultAccessPolicy()
+	key := &domain.Principal{Subject: "api_key:1", Scopes: []domain.Permission{domain.PermUsersRead}}
+
+	assert.True(t, policy.Can(key, domain.PermUsersRead))
+	assert.False(t, policy.Can(key, domain.PermUsersEditPoints))
+	assertForbidden(t, policy.Authorize(key, domain.PermUsersRead, domain.PermUsersDelete), domain.PermUsersDelete)
+}
@@ -0,0 +1,216 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+const (
+	// apiKeySecretPrefix starts every secret so leaked keys are easy to spot
+	apiKeySecretPrefix = "wk_"
+	// apiKeyDisplayLength is how much of the secret is kept as its prefix
+	apiKeyDisplayLength = len(apiKeySecretPrefix) + 8
+	// apiKeyTouchInterval bounds how often last_used_at is written per key
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyUseCase issues, revokes and authenticates API keys
+type APIKeyUseCase struct {
+	repo   domain.APIKeyRepository
+	policy *AccessPolicy
+	logger *slog.Logger
+	// actor is the principal calls are checked against once restricted
+	actor      *domain.Principal
+	restricted bool
+}
+
+// APIKeyUseCaseOption configures optional APIKeyUseCase dependencies
+type APIKeyUseCaseOption func(*APIKeyUseCase)
+
+// WithAPIKeyAccessPolicy sets the policy principals are checked against.
+// Without it the default roles are used.
+func WithAPIKeyAccessPolicy(policy *AccessPolicy) APIKeyUseCaseOption {
+	return func(uc *APIKeyUseCase) {
+		uc.policy = policy
+	}
+}
+
+// NewAPIKeyUseCase creates a new API key use case acting as the system; use
+// As for calls made on behalf of a caller
+func NewAPIKeyUseCase(repo domain.APIKeyRepository, opts ...APIKeyUseCaseOption) *APIKeyUseCase {
+	uc := &APIKeyUseCase{
+		repo:   repo,
+		policy: NewDefaultAccessPolicy(),
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// WithLogger returns a copy of the use case logging to logger, typically
+// one tagged with the request being served
+func (uc *APIKeyUseCase) WithLogger(logger *slog.Logger) *APIKeyUseCase {
+	scoped := *uc
+	scoped.logger = logger
+	return &scoped
+}
+
+// As returns a copy of the use case acting for principal, whose every call
+// is checked against the access policy
+func (uc *APIKeyUseCase) As(principal *domain.Principal) *APIKeyUseCase {
+	scoped := *uc
+	scoped.actor = principal
+	scoped.restricted = true
+	return &scoped
+}
+
+// authorize requires every permission of the acting principal
+func (uc *APIKeyUseCase) authorize(permissions ...domain.Permission) error {
+	if !uc.restricted {
+		return nil
+	}
+	return uc.policy.Authorize(uc.actor, permissions...)
+}
+
+// IssueAPIKeyInput represents input for issuing an API key
+type IssueAPIKeyInput struct {
+	Name   string
+	Scopes []domain.Permission
+	// RateLimitTier defaults to domain.DefaultRateLimitTier
+	RateLimitTier string
+	ExpiresAt     *time.Time
+}
+
+// IssueAPIKey creates a key and returns it with its secret, which is not
+// stored and cannot be retrieved again. A caller can only grant scopes it
+// holds itself.
+func (uc *APIKeyUseCase) IssueAPIKey(ctx context.Context, input IssueAPIKeyInput) (*domain.APIKey, string, error) {
+	if err := uc.authorize(domain.PermAPIKeysManage); err != nil {
+		return nil, "", err
+	}
+
+	key := &domain.APIKey{
+		Name:          strings.TrimSpace(input.Name),
+		Scopes:        uniqueScopes(input.Scopes),
+		RateLimitTier: strings.TrimSpace(input.RateLimitTier),
+		CreatedAt:     time.Now(),
+		ExpiresAt:     input.ExpiresAt,
+	}
+	if key.RateLimitTier == "" {
+		key.RateLimitTier = domain.DefaultRateLimitTier
+	}
+	if uc.actor != nil {
+		key.CreatedBy = uc.actor.Subject
+	}
+	if err := key.Validate(); err != nil {
+		return nil, "", err
+	}
+	if err := uc.authorize(key.Scopes...); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := generateAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+	key.Prefix = secret[:apiKeyDisplayLength]
+	key.KeyHash = hashAPIKeySecret(secret)
+
+	if err := uc.repo.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	uc.logger.Info("API key issued", "key_id", key.ID, "prefix", key.Prefix, "scopes", key.Scopes, "created_by", key.CreatedBy)
+	return key, secret, nil
+}
+
+// ListAPIKeys returns every key, revoked and expired ones included
+func (uc *APIKeyUseCase) ListAPIKeys(ctx context.Context) ([]*domain.APIKey, error) {
+	if err := uc.authorize(domain.PermAPIKeysManage); err != nil {
+		return nil, err
+	}
+	return uc.repo.FindAll(ctx)
+}
+
+// RevokeAPIKey revokes a key immediately; revoking it again is a no-op
+func (uc *APIKeyUseCase) RevokeAPIKey(ctx context.Context, id int) (*domain.APIKey, error) {
+	if err := uc.authorize(domain.PermAPIKeysManage); err != nil {
+		return nil, err
+	}
+	if err := uc.repo.Revoke(ctx, id, time.Now()); err != nil {
+		return nil, err
+	}
+	uc.logger.Info("API key revoked", "key_id", id)
+
+	key, err := uc.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// Authenticate returns the active key matching secret, or
+// domain.ErrInvalidAPIKey for an unknown, revoked or expired one
+func (uc *APIKeyUseCase) Authenticate(ctx context.Context, secret string) (*domain.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeySecretPrefix) {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	key, err := uc.repo.FindByHash(ctx, hashAPIKeySecret(secret))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key == nil || key.IsRevoked() || key.IsExpired(now) {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	// Recording every request would turn each read into a write
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := uc.repo.TouchLastUsed(ctx, key.ID, now); err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+// generateAPIKeySecret returns a prefixed secret with 256 bits of entropy
+func generateAPIKeySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeySecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAPIKeySecret hashes a secret for storage and lookup. The secret is
+// random and long, so a fast unsalted hash is enough to protect it.
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// uniqueScopes drops repeated scopes, keeping the first occurrence's order
+func uniqueScopes(scopes []domain.Permission) []domain.Permission {
+	seen := make(map[domain.Permission]bool, len(scopes))
+	var unique []domain.Permission
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
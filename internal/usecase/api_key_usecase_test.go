@@ -0,0 +1,176 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAPIKeyRepository is a mock implementation of domain.APIKeyRepository
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) Create(_ context.Context, key *domain.APIKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) FindAll(_ context.Context) ([]*domain.APIKey, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) FindByID(_ context.Context, id int) (*domain.APIKey, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) FindByHash(_ context.Context, hash string) (*domain.APIKey, error) {
+	args := m.Called(hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) Revoke(_ context.Context, id int, at time.Time) error {
+	args := m.Called(id, at)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) TouchLastUsed(_ context.Context, id int, at time.Time) error {
+	args := m.Called(id, at)
+	return args.Error(0)
+}
+
+func TestIssueAPIKey_Success(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	useCase := NewAPIKeyUseCase(mockRepo)
+	admin := &domain.Principal{Subject: "admin-1", Roles: []string{"admin"}}
+
+	var stored *domain.APIKey
+	mockRepo.On("Create", mock.AnythingOfType("*domain.APIKey")).Return(nil).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*domain.APIKey)
+		stored.ID = 7
+	})
+
+	key, secret, err := useCase.As(admin).IssueAPIKey(context.Background(), IssueAPIKeyInput{
+		Name:   " POS ",
+		Scopes: []domain.Permission{domain.PermUsersRead, domain.PermUsersEditPoints, domain.PermUsersRead},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, key.ID)
+	assert.Equal(t, "POS", key.Name)
+	assert.Equal(t, "admin-1", key.CreatedBy)
+	assert.Equal(t, domain.DefaultRateLimitTier, key.RateLimitTier)
+	assert.Equal(t, []domain.Permission{domain.PermUsersRead, domain.PermUsersEditPoints}, key.Scopes)
+	assert.True(t, strings.HasPrefix(secret, "wk_"))
+	assert.True(t, strings.HasPrefix(secret, key.Prefix))
+	// Only the hash is stored
+	assert.Equal(t, hashAPIKeySecret(secret), stored.KeyHash)
+	assert.NotContains(t, stored.KeyHash, secret)
+}
+
+func TestIssueAPIKey_Validation(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	useCase := NewAPIKeyUseCase(mockRepo)
+	past := time.Now().Add(-time.Hour)
+
+	_, _, err := useCase.IssueAPIKey(context.Background(), IssueAPIKeyInput{Scopes: []domain.Permission{domain.PermUsersRead}})
+	assert.Equal(t, domain.ErrAPIKeyNameRequired, err)
+
+	_, _, err = useCase.IssueAPIKey(context.Background(), IssueAPIKeyInput{Name: "shop"})
+	assert.Equal(t, domain.ErrAPIKeyScopesRequired, err)
+
+	_, _, err = useCase.IssueAPIKey(context.Background(), IssueAPIKeyInput{Name: "shop", Scopes: []domain.Permission{"points:everything"}})
+	assert.Equal(t, domain.ErrInvalidAPIKeyScope, err)
+
+	_, _, err = useCase.IssueAPIKey(context.Background(), IssueAPIKeyInput{Name: "shop", Scopes: []domain.Permission{domain.PermUsersRead}, ExpiresAt: &past})
+	assert.Equal(t, domain.ErrInvalidAPIKeyExpiry, err)
+
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestIssueAPIKey_CannotGrantScopesNotHeld(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	roles := DefaultRolePermissions()
+	roles["keymaster"] = []domain.Permission{domain.PermAPIKeysManage, domain.PermUsersRead}
+	policy, err := NewAccessPolicy(roles)
+	assert.NoError(t, err)
+	useCase := NewAPIKeyUseCase(mockRepo, WithAPIKeyAccessPolicy(policy))
+
+	support := &domain.Principal{Subject: "s", Roles: []string{"support"}}
+	_, _, err = useCase.As(support).IssueAPIKey(context.Background(), IssueAPIKeyInput{Name: "shop", Scopes: []domain.Permission{domain.PermUsersRead}})
+	assertForbidden(t, err, domain.PermAPIKeysManage)
+
+	keymaster := &domain.Principal{Subject: "k", Roles: []string{"keymaster"}}
+	_, _, err = useCase.As(keymaster).IssueAPIKey(context.Background(), IssueAPIKeyInput{Name: "shop", Scopes: []domain.Permission{domain.PermUsersRead, domain.PermUsersDelete}})
+	assertForbidden(t, err, domain.PermUsersDelete)
+
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestAuthenticate(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	useCase := NewAPIKeyUseCase(mockRepo)
+	past := time.Now().Add(-time.Minute)
+	recent := time.Now().Add(-time.Second)
+
+	active := &domain.APIKey{ID: 1, Scopes: []domain.Permission{domain.PermUsersRead}}
+	recentlyUsed := &domain.APIKey{ID: 2, LastUsedAt: &recent}
+	revoked := &domain.APIKey{ID: 3, RevokedAt: &past}
+	expired := &domain.APIKey{ID: 4, ExpiresAt: &past}
+	mockRepo.On("FindByHash", hashAPIKeySecret("wk_active")).Return(active, nil)
+	mockRepo.On("FindByHash", hashAPIKeySecret("wk_recent")).Return(recentlyUsed, nil)
+	mockRepo.On("FindByHash", hashAPIKeySecret("wk_revoked")).Return(revoked, nil)
+	mockRepo.On("FindByHash", hashAPIKeySecret("wk_expired")).Return(expired, nil)
+	mockRepo.On("FindByHash", hashAPIKeySecret("wk_unknown")).Return(nil, nil)
+	mockRepo.On("TouchLastUsed", 1, mock.AnythingOfType("time.Time")).Return(nil)
+
+	key, err := useCase.Authenticate(context.Background(), "wk_active")
+	assert.NoError(t, err)
+	assert.Equal(t, active, key)
+	assert.NotNil(t, key.LastUsedAt)
+
+	// Use within the touch interval is not written again
+	key, err = useCase.Authenticate(context.Background(), "wk_recent")
+	assert.NoError(t, err)
+	assert.Equal(t, recentlyUsed, key)
+	mockRepo.AssertNotCalled(t, "TouchLastUsed", 2, mock.Anything)
+
+	for _, secret := range []string{"wk_revoked", "wk_expired", "wk_unknown", "not-a-key"} {
+		key, err = useCase.Authenticate(context.Background(), secret)
+		assert.Nil(t, key, secret)
+		assert.Equal(t, domain.ErrInvalidAPIKey, err, secret)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	useCase := NewAPIKeyUseCase(mockRepo)
+	now := time.Now()
+
+	mockRepo.On("Revoke", 1, mock.AnythingOfType("time.Time")).Return(nil)
+	mockRepo.On("FindByID", 1).Return(&domain.APIKey{ID: 1, RevokedAt: &now}, nil)
+	mockRepo.On("Revoke", 2, mock.AnythingOfType("time.Time")).Return(domain.ErrAPIKeyNotFound)
+
+	key, err := useCase.RevokeAPIKey(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, key.IsRevoked())
+
+	_, err = useCase.RevokeAPIKey(context.Background(), 2)
+	assert.Equal(t, domain.ErrAPIKeyNotFound, err)
+}
@@ -0,0 +1,161 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// eventPayload is how an event is sent to webhooks and streams
+type eventPayload struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// MarshalEvent returns the JSON an event is sent as: its ID, type, creation
+// time and data
+func MarshalEvent(event *domain.Event) []byte {
+	// The data is JSON the use cases wrote, so marshalling cannot fail
+	body, _ := json.Marshal(eventPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt.UTC(),
+		Data:      event.Data,
+	})
+	return body
+}
+
+// EventUseCase reads the log of user events for streaming
+type EventUseCase struct {
+	repo   domain.EventRepository
+	policy *AccessPolicy
+	logger *slog.Logger
+	// actor is the principal calls are checked against once restricted
+	actor      *domain.Principal
+	restricted bool
+}
+
+// EventUseCaseOption configures optional EventUseCase dependencies
+type EventUseCaseOption func(*EventUseCase)
+
+// WithEventAccessPolicy sets the policy principals are checked against.
+// Without it the default roles are used.
+func WithEventAccessPolicy(policy *AccessPolicy) EventUseCaseOption {
+	return func(uc *EventUseCase) {
+		uc.policy = policy
+	}
+}
+
+// NewEventUseCase creates a new event use case acting as the system; use As
+// for calls made on behalf of a caller
+func NewEventUseCase(repo domain.EventRepository, opts ...EventUseCaseOption) *EventUseCase {
+	uc := &EventUseCase{
+		repo:   repo,
+		policy: NewDefaultAccessPolicy(),
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// WithLogger returns a copy of the use case logging to logger, typically
+// one tagged with the request being served
+func (uc *EventUseCase) WithLogger(logger *slog.Logger) *EventUseCase {
+	scoped := *uc
+	scoped.logger = logger
+	return &scoped
+}
+
+// As returns a copy of the use case acting for principal, whose every call
+// is checked against the access policy
+func (uc *EventUseCase) As(principal *domain.Principal) *EventUseCase {
+	scoped := *uc
+	scoped.actor = principal
+	scoped.restricted = true
+	return &scoped
+}
+
+// authorize requires every permission of the acting principal
+func (uc *EventUseCase) authorize(permissions ...domain.Permission) error {
+	if !uc.restricted {
+		return nil
+	}
+	return uc.policy.Authorize(uc.actor, permissions...)
+}
+
+// OpenStreamInput represents input for opening an event stream
+type OpenStreamInput struct {
+	// LastEventID resumes after the event with this ID; nil starts with the
+	// events that follow the stream's opening
+	LastEventID *int
+	// Types are the event types to stream; none means every type
+	Types []string
+}
+
+// EventStream reads events in order from where a stream left off
+type EventStream struct {
+	repo   domain.EventRepository
+	lastID int
+	types  []string
+}
+
+// LastID is the ID of the last event read, or the one the stream started
+// after
+func (s *EventStream) LastID() int {
+	return s.lastID
+}
+
+// Next returns up to limit events following the last one read, none if
+// nothing has happened since
+func (s *EventStream) Next(ctx context.Context, limit int) ([]*domain.Event, error) {
+	events, err := s.repo.FindAfter(ctx, s.lastID, s.types, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > 0 {
+		s.lastID = events[len(events)-1].ID
+	}
+	return events, nil
+}
+
+// OpenStream starts reading the event log. Events carry user details, so
+// this needs PermUsersRead.
+func (uc *EventUseCase) OpenStream(ctx context.Context, input OpenStreamInput) (*EventStream, error) {
+	if err := uc.authorize(domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+
+	stream := &EventStream{repo: uc.repo}
+	for _, t := range input.Types {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !domain.IsEventType(t) {
+			return nil, domain.ErrInvalidEventType
+		}
+		stream.types = append(stream.types, t)
+	}
+
+	if input.LastEventID != nil {
+		if *input.LastEventID < 0 {
+			return nil, domain.ErrInvalidLastEventID
+		}
+		stream.lastID = *input.LastEventID
+		return stream, nil
+	}
+
+	lastID, err := uc.repo.LastID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream.lastID = lastID
+	return stream, nil
+}
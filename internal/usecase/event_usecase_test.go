@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEventRepository serves a fixed event log
+type fakeEventRepository struct {
+	events []*domain.Event
+}
+
+func (r *fakeEventRepository) FindAfter(_ context.Context, afterID int, types []string, limit int) ([]*domain.Event, error) {
+	var found []*domain.Event
+	for _, event := range r.events {
+		if event.ID <= afterID || (len(types) > 0 && !containsString(types, event.Type)) {
+			continue
+		}
+		if len(found) == limit {
+			break
+		}
+		found = append(found, event)
+	}
+	return found, nil
+}
+
+func (r *fakeEventRepository) LastID(_ context.Context) (int, error) {
+	if len(r.events) == 0 {
+		return 0, nil
+	}
+	return r.events[len(r.events)-1].ID, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newFakeEventRepository() *fakeEventRepository {
+	repo := &fakeEventRepository{}
+	for i, eventType := range []string{domain.EventUserCreated, domain.EventUserPointsChanged, domain.EventUserUpdated, domain.EventUserPointsChanged} {
+		repo.events = append(repo.events, &domain.Event{ID: i + 1, Type: eventType, UserID: 3, Data: []byte(`{}`), CreatedAt: time.Now()})
+	}
+	return repo
+}
+
+func eventIDs(events []*domain.Event) []int {
+	ids := make([]int, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func TestOpenStream_StartsAfterLatestEvent(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeEventRepository()
+	stream, err := NewEventUseCase(repo).As(support).OpenStream(ctx, OpenStreamInput{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stream.LastID())
+
+	events, err := stream.Next(ctx, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	repo.events = append(repo.events, &domain.Event{ID: 5, Type: domain.EventUserDeleted, Data: []byte(`{}`)})
+	events, err = stream.Next(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{5}, eventIDs(events))
+	assert.Equal(t, 5, stream.LastID())
+}
+
+func TestOpenStream_ResumesAfterLastEventID(t *testing.T) {
+	ctx := context.Background()
+	lastEventID := 1
+	stream, err := NewEventUseCase(newFakeEventRepository()).OpenStream(ctx, OpenStreamInput{LastEventID: &lastEventID})
+	assert.NoError(t, err)
+
+	events, err := stream.Next(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, eventIDs(events))
+	events, err = stream.Next(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4}, eventIDs(events))
+}
+
+func TestOpenStream_FiltersTypes(t *testing.T) {
+	ctx := context.Background()
+	lastEventID := 0
+	stream, err := NewEventUseCase(newFakeEventRepository()).OpenStream(ctx, OpenStreamInput{
+		LastEventID: &lastEventID,
+		Types:       []string{" user.points_changed ", ""},
+	})
+	assert.NoError(t, err)
+
+	events, err := stream.Next(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 4}, eventIDs(events))
+}
+
+func TestOpenStream_RejectsInvalidInput(t *testing.T) {
+	uc := NewEventUseCase(newFakeEventRepository())
+
+	_, err := uc.OpenStream(context.Background(), OpenStreamInput{Types: []string{"user.renamed"}})
+	assert.Equal(t, domain.ErrInvalidEventType, err)
+
+	lastEventID := -1
+	_, err = uc.OpenStream(context.Background(), OpenStreamInput{LastEventID: &lastEventID})
+	assert.Equal(t, domain.ErrInvalidLastEventID, err)
+}
+
+func TestOpenStream_RequiresRead(t *testing.T) {
+	_, err := NewEventUseCase(newFakeEventRepository()).As(&domain.Principal{Subject: "u-nobody"}).OpenStream(context.Background(), OpenStreamInput{})
+	assertForbidden(t, err, domain.PermUsersRead)
+}
+
+func TestMarshalEvent(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 9, 30, 0, 0, time.FixedZone("ICT", 7*60*60))
+	body := MarshalEvent(&domain.Event{ID: 12, Type: domain.EventUserDeleted, UserID: 3, Data: []byte(`{"user":{"id":3}}`), CreatedAt: createdAt})
+
+	assert.JSONEq(t, `{"id":12,"type":"user.deleted","created_at":"2024-05-01T02:30:00Z","data":{"user":{"id":3}}}`, string(body))
+}
@@ -0,0 +1,62 @@
+package usecase
+
+import "workshop_4/internal/domain"
+
+// BusinessMetrics counts business events as the use cases complete them.
+// The metrics package implements it for Prometheus.
+type BusinessMetrics interface {
+	UserCreated()
+	UserDeleted()
+	UserRestored()
+	UsersPurged(count int)
+	PointsRecorded(txType domain.PointTransactionType, amount int)
+	MemberLevelChanged(from, to string)
+}
+
+// noMetrics discards every event; it is the default until one is configured
+type noMetrics struct{}
+
+func (noMetrics) UserCreated()                                    {}
+func (noMetrics) UserDeleted()                                    {}
+func (noMetrics) UserRestored()                                   {}
+func (noMetrics) UsersPurged(int)                                 {}
+func (noMetrics) PointsRecorded(domain.PointTransactionType, int) {}
+func (noMetrics) MemberLevelChanged(string, string)               {}
+
+// pendingMetrics holds events back until the transaction they happened in
+// commits, so that a rolled back batch counts nothing
+type pendingMetrics struct {
+	events []func(BusinessMetrics)
+}
+
+func (p *pendingMetrics) UserCreated() {
+	p.events = append(p.events, BusinessMetrics.UserCreated)
+}
+
+func (p *pendingMetrics) UserDeleted() {
+	p.events = append(p.events, BusinessMetrics.UserDeleted)
+}
+
+func (p *pendingMetrics) UserRestored() {
+	p.events = append(p.events, BusinessMetrics.UserRestored)
+}
+
+func (p *pendingMetrics) UsersPurged(count int) {
+	p.events = append(p.events, func(m BusinessMetrics) { m.UsersPurged(count) })
+}
+
+func (p *pendingMetrics) PointsRecorded(txType domain.PointTransactionType, amount int) {
+	p.events = append(p.events, func(m BusinessMetrics) { m.PointsRecorded(txType, amount) })
+}
+
+func (p *pendingMetrics) MemberLevelChanged(from, to string) {
+	p.events = append(p.events, func(m BusinessMetrics) { m.MemberLevelChanged(from, to) })
+}
+
+// flush passes the held events on to m
+func (p *pendingMetrics) flush(m BusinessMetrics) {
+	for _, event := range p.events {
+		event(m)
+	}
+	p.events = nil
+}
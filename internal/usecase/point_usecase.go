@@ -0,0 +1,171 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"workshop_4/internal/domain"
+)
+
+// PointUseCase handles points ledger business logic
+type PointUseCase struct {
+	userRepo  domain.UserRepository
+	pointRepo domain.PointTransactionRepository
+	tiers     *TierEngine
+	policy    *AccessPolicy
+	logger    *slog.Logger
+	metrics   BusinessMetrics
+	// actor is the principal calls are checked against once restricted
+	actor      *domain.Principal
+	restricted bool
+}
+
+// PointUseCaseOption configures optional PointUseCase dependencies
+type PointUseCaseOption func(*PointUseCase)
+
+// WithPointAccessPolicy sets the policy principals are checked against.
+// Without it the default roles are used.
+func WithPointAccessPolicy(policy *AccessPolicy) PointUseCaseOption {
+	return func(uc *PointUseCase) {
+		uc.policy = policy
+	}
+}
+
+// WithPointMetrics sets where business events are counted
+func WithPointMetrics(metrics BusinessMetrics) PointUseCaseOption {
+	return func(uc *PointUseCase) {
+		uc.metrics = metrics
+	}
+}
+
+// NewPointUseCase creates a new point use case. Like NewUserUseCase it acts
+// as the system; use As for calls made on behalf of a caller.
+func NewPointUseCase(userRepo domain.UserRepository, pointRepo domain.PointTransactionRepository, tiers *TierEngine, opts ...PointUseCaseOption) *PointUseCase {
+	uc := &PointUseCase{
+		userRepo:  userRepo,
+		pointRepo: pointRepo,
+		tiers:     tiers,
+		policy:    NewDefaultAccessPolicy(),
+		logger:    slog.Default(),
+		metrics:   noMetrics{},
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// WithLogger returns a copy of the use case logging to logger, typically
+// one tagged with the request being served
+func (uc *PointUseCase) WithLogger(logger *slog.Logger) *PointUseCase {
+	scoped := *uc
+	scoped.logger = logger
+	return &scoped
+}
+
+// As returns a copy of the use case acting for principal, whose every call
+// is checked against the access policy
+func (uc *PointUseCase) As(principal *domain.Principal) *PointUseCase {
+	scoped := *uc
+	scoped.actor = principal
+	scoped.restricted = true
+	return &scoped
+}
+
+// authorize requires every permission of the acting principal
+func (uc *PointUseCase) authorize(permissions ...domain.Permission) error {
+	if !uc.restricted {
+		return nil
+	}
+	return uc.policy.Authorize(uc.actor, permissions...)
+}
+
+// PointInput represents input for a points ledger operation
+type PointInput struct {
+	Amount      int
+	Description string
+}
+
+// EarnPoints credits points to a user
+func (uc *PointUseCase) EarnPoints(ctx context.Context, userID int, input PointInput) (*domain.PointTransaction, error) {
+	return uc.record(ctx, userID, domain.PointTransactionEarn, input.Amount, input.Description)
+}
+
+// RedeemPoints debits points from a user. The amount is given as a positive
+// number and fails with domain.ErrInvalidPointBalance if it exceeds the balance.
+func (uc *PointUseCase) RedeemPoints(ctx context.Context, userID int, input PointInput) (*domain.PointTransaction, error) {
+	if input.Amount <= 0 {
+		return nil, domain.ErrInvalidPointAmount
+	}
+	return uc.record(ctx, userID, domain.PointTransactionRedeem, -input.Amount, input.Description)
+}
+
+// AdjustPoints applies a signed manual correction to a user's balance
+func (uc *PointUseCase) AdjustPoints(ctx context.Context, userID int, input PointInput) (*domain.PointTransaction, error) {
+	return uc.record(ctx, userID, domain.PointTransactionAdjust, input.Amount, input.Description)
+}
+
+// GetPointHistory retrieves the ledger entries of a user, newest first
+func (uc *PointUseCase) GetPointHistory(ctx context.Context, userID int) ([]*domain.PointTransaction, error) {
+	if err := uc.authorize(domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	if userID <= 0 {
+		return nil, domain.ErrInvalidUserID
+	}
+
+	user, err := uc.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+
+	return uc.pointRepo.FindByUserID(ctx, userID)
+}
+
+func (uc *PointUseCase) record(ctx context.Context, userID int, txType domain.PointTransactionType, amount int, description string) (*domain.PointTransaction, error) {
+	if err := uc.authorize(domain.PermUsersEditPoints); err != nil {
+		return nil, err
+	}
+
+	pt := &domain.PointTransaction{
+		UserID:      userID,
+		Type:        txType,
+		Amount:      amount,
+		Description: description,
+	}
+
+	// Validate
+	if err := pt.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Save to repository, promoting or demoting the member in the same
+	// transaction if the new balance crosses a threshold
+	var from, to string
+	err := uc.pointRepo.Record(ctx, pt, func(user *domain.User, pt *domain.PointTransaction) []*domain.Event {
+		events := []*domain.Event{newPointsEvent(pt)}
+		level := uc.tiers.TierFor(user.PointBalance)
+		if level == user.MemberLevel {
+			return events
+		}
+		from, to = user.MemberLevel, level
+		user.MemberLevel = level
+		return append(events,
+			newUserEvent(domain.EventUserUpdated, user, userEventData{Changed: []string{"member_level", "point_balance"}}),
+			newUserEvent(domain.EventUserTierChanged, user, userEventData{From: from, To: to}),
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	uc.logger.Info("points recorded", "user_id", userID, "type", pt.Type, "amount", pt.Amount, "balance_after", pt.BalanceAfter)
+	uc.metrics.PointsRecorded(pt.Type, pt.Amount)
+	if from != to {
+		uc.logger.Info("member level changed", "user_id", userID, "from", from, "to", to)
+		uc.metrics.MemberLevelChanged(from, to)
+	}
+
+	return pt, nil
+}
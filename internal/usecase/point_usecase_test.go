@@ -0,0 +1,172 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockPointTransactionRepository is a mock implementation of domain.PointTransactionRepository
+type MockPointTransactionRepository struct {
+	mock.Mock
+	// user is the user entries are recorded for, given the balance of each
+	user *domain.User
+	// events holds the events of the entries recorded
+	events []*domain.Event
+}
+
+func (m *MockPointTransactionRepository) Record(_ context.Context, tx *domain.PointTransaction, apply func(*domain.User, *domain.PointTransaction) []*domain.Event) error {
+	args := m.Called(tx)
+	if args.Error(0) == nil && apply != nil {
+		user := m.user
+		if user == nil {
+			user = &domain.User{ID: tx.UserID, MemberLevel: "Bronze"}
+		}
+		user.PointBalance = tx.BalanceAfter
+		m.events = append(m.events, apply(user, tx)...)
+	}
+	return args.Error(0)
+}
+
+func (m *MockPointTransactionRepository) FindByUserID(_ context.Context, userID int) ([]*domain.PointTransaction, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PointTransaction), args.Error(1)
+}
+
+func TestEarnPoints_Success(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	mockPointRepo.On("Record", mock.AnythingOfType("*domain.PointTransaction")).Return(nil).Run(func(args mock.Arguments) {
+		pt := args.Get(0).(*domain.PointTransaction)
+		pt.ID = 1
+		pt.BalanceAfter = 1100
+	})
+	mockPointRepo.user = &domain.User{ID: 1, MemberLevel: "Silver"}
+
+	pt, err := useCase.EarnPoints(context.Background(), 1, PointInput{Amount: 100, Description: "Purchase"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.PointTransactionEarn, pt.Type)
+	assert.Equal(t, 100, pt.Amount)
+	assert.Equal(t, 1100, pt.BalanceAfter)
+	assert.Equal(t, "Silver", mockPointRepo.user.MemberLevel)
+	if assert.Len(t, mockPointRepo.events, 1) {
+		assert.Equal(t, domain.EventUserPointsChanged, mockPointRepo.events[0].Type)
+	}
+	mockPointRepo.AssertExpectations(t)
+	mockUserRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
+
+func TestEarnPoints_InvalidAmount(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	pt, err := useCase.EarnPoints(context.Background(), 1, PointInput{Amount: 0})
+
+	assert.Nil(t, pt)
+	assert.Equal(t, domain.ErrInvalidPointAmount, err)
+	mockPointRepo.AssertNotCalled(t, "Record", mock.Anything)
+}
+
+func TestRedeemPoints_StoresNegativeAmount(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	mockPointRepo.On("Record", mock.MatchedBy(func(pt *domain.PointTransaction) bool {
+		return pt.Type == domain.PointTransactionRedeem && pt.Amount == -50
+	})).Return(nil)
+
+	pt, err := useCase.RedeemPoints(context.Background(), 1, PointInput{Amount: 50})
+
+	assert.NoError(t, err)
+	assert.Equal(t, -50, pt.Amount)
+	mockPointRepo.AssertExpectations(t)
+}
+
+func TestRedeemPoints_InsufficientBalance(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	mockPointRepo.On("Record", mock.AnythingOfType("*domain.PointTransaction")).Return(domain.ErrInvalidPointBalance)
+
+	pt, err := useCase.RedeemPoints(context.Background(), 1, PointInput{Amount: 5000})
+
+	assert.Nil(t, pt)
+	assert.Equal(t, domain.ErrInvalidPointBalance, err)
+	mockPointRepo.AssertExpectations(t)
+}
+
+func TestAdjustPoints_Negative(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	mockPointRepo.On("Record", mock.AnythingOfType("*domain.PointTransaction")).Return(nil)
+
+	pt, err := useCase.AdjustPoints(context.Background(), 1, PointInput{Amount: -20, Description: "Correction"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.PointTransactionAdjust, pt.Type)
+	assert.Equal(t, -20, pt.Amount)
+	mockPointRepo.AssertExpectations(t)
+}
+
+func TestGetPointHistory_UserNotFound(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	mockUserRepo.On("FindByID", 999).Return(nil, nil)
+
+	transactions, err := useCase.GetPointHistory(context.Background(), 999)
+
+	assert.Nil(t, transactions)
+	assert.Equal(t, domain.ErrUserNotFound, err)
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestEarnPoints_PromotesTier(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	mockPointRepo.On("Record", mock.AnythingOfType("*domain.PointTransaction")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.PointTransaction).BalanceAfter = 5200
+	})
+	mockPointRepo.user = &domain.User{ID: 1, MemberLevel: "Silver"}
+
+	_, err := useCase.EarnPoints(context.Background(), 1, PointInput{Amount: 4200})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Gold", mockPointRepo.user.MemberLevel)
+	assert.Equal(t, []string{domain.EventUserPointsChanged, domain.EventUserUpdated, domain.EventUserTierChanged}, eventTypes(mockPointRepo.events))
+	mockUserRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
+
+func TestRedeemPoints_DemotesTier(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	mockPointRepo.On("Record", mock.AnythingOfType("*domain.PointTransaction")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.PointTransaction).BalanceAfter = 900
+	})
+	mockPointRepo.user = &domain.User{ID: 1, MemberLevel: "Silver"}
+
+	_, err := useCase.RedeemPoints(context.Background(), 1, PointInput{Amount: 200})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Bronze", mockPointRepo.user.MemberLevel)
+	assert.Equal(t, []string{domain.EventUserPointsChanged, domain.EventUserUpdated, domain.EventUserTierChanged}, eventTypes(mockPointRepo.events))
+}
@@ -0,0 +1,123 @@
+package usecase
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"workshop_4/internal/domain"
+)
+
+// Tier represents a member level and the point balance needed to qualify for it
+type Tier struct {
+	Name      string
+	MinPoints int
+}
+
+// DefaultTiers returns the standard member tiers, lowest first
+func DefaultTiers() []Tier {
+	return []Tier{
+		{Name: "Bronze", MinPoints: 0},
+		{Name: "Silver", MinPoints: 1000},
+		{Name: "Gold", MinPoints: 5000},
+		{Name: "Platinum", MinPoints: 10000},
+	}
+}
+
+// ParseTiers parses tier rules in the form "Bronze:0,Silver:1000,Gold:5000".
+// An empty string yields DefaultTiers.
+func ParseTiers(s string) ([]Tier, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultTiers(), nil
+	}
+
+	var tiers []Tier
+	for _, part := range strings.Split(s, ",") {
+		name, threshold, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid tier rule %q: expected name:min_points", part)
+		}
+		minPoints, err := strconv.Atoi(strings.TrimSpace(threshold))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tier rule %q: %w", part, err)
+		}
+		tiers = append(tiers, Tier{Name: strings.TrimSpace(name), MinPoints: minPoints})
+	}
+
+	return tiers, nil
+}
+
+// TierEngine decides which member level a point balance qualifies for
+type TierEngine struct {
+	tiers []Tier
+}
+
+// NewTierEngine creates a tier engine from the given rules. Tiers are ordered
+// by threshold; the lowest tier must start at zero points so every member
+// qualifies for some level.
+func NewTierEngine(tiers []Tier) (*TierEngine, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("at least one tier is required")
+	}
+
+	sorted := make([]Tier, len(tiers))
+	copy(sorted, tiers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].MinPoints < sorted[j].MinPoints
+	})
+
+	seen := make(map[string]bool)
+	for i, tier := range sorted {
+		if tier.Name == "" {
+			return nil, fmt.Errorf("tier name is required")
+		}
+		key := strings.ToLower(tier.Name)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate tier %q", tier.Name)
+		}
+		seen[key] = true
+		if i > 0 && tier.MinPoints == sorted[i-1].MinPoints {
+			return nil, fmt.Errorf("tiers %q and %q share threshold %d", sorted[i-1].Name, tier.Name, tier.MinPoints)
+		}
+	}
+	if sorted[0].MinPoints != 0 {
+		return nil, fmt.Errorf("lowest tier %q must start at 0 points", sorted[0].Name)
+	}
+
+	return &TierEngine{tiers: sorted}, nil
+}
+
+// NewDefaultTierEngine creates a tier engine using DefaultTiers
+func NewDefaultTierEngine() *TierEngine {
+	engine, _ := NewTierEngine(DefaultTiers())
+	return engine
+}
+
+// Tiers returns the configured tiers, lowest first
+func (e *TierEngine) Tiers() []Tier {
+	tiers := make([]Tier, len(e.tiers))
+	copy(tiers, e.tiers)
+	return tiers
+}
+
+// TierFor returns the highest tier the point balance qualifies for
+func (e *TierEngine) TierFor(points int) string {
+	level := e.tiers[0].Name
+	for _, tier := range e.tiers {
+		if points >= tier.MinPoints {
+			level = tier.Name
+		}
+	}
+	return level
+}
+
+// Normalize returns the canonical spelling of a member level, matching
+// case-insensitively, or domain.ErrInvalidMemberLevel if it is unknown
+func (e *TierEngine) Normalize(level string) (string, error) {
+	for _, tier := range e.tiers {
+		if strings.EqualFold(tier.Name, strings.TrimSpace(level)) {
+			return tier.Name, nil
+		}
+	}
+	return "", domain.ErrInvalidMemberLevel
+}
@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTierEngine_TierFor(t *testing.T) {
+	engine := NewDefaultTierEngine()
+
+	assert.Equal(t, "Bronze", engine.TierFor(0))
+	assert.Equal(t, "Bronze", engine.TierFor(999))
+	assert.Equal(t, "Silver", engine.TierFor(1000))
+	assert.Equal(t, "Gold", engine.TierFor(5000))
+	assert.Equal(t, "Platinum", engine.TierFor(250000))
+}
+
+func TestTierEngine_Normalize(t *testing.T) {
+	engine := NewDefaultTierEngine()
+
+	level, err := engine.Normalize("gold")
+	assert.NoError(t, err)
+	assert.Equal(t, "Gold", level)
+
+	_, err = engine.Normalize("Diamond")
+	assert.Equal(t, domain.ErrInvalidMemberLevel, err)
+}
+
+func TestNewTierEngine_Invalid(t *testing.T) {
+	_, err := NewTierEngine(nil)
+	assert.Error(t, err)
+
+	_, err = NewTierEngine([]Tier{{Name: "Silver", MinPoints: 100}})
+	assert.Error(t, err)
+
+	_, err = NewTierEngine([]Tier{{Name: "Bronze", MinPoints: 0}, {Name: "bronze", MinPoints: 10}})
+	assert.Error(t, err)
+}
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers("Member:0, VIP:2500")
+	assert.NoError(t, err)
+	assert.Equal(t, []Tier{{Name: "Member", MinPoints: 0}, {Name: "VIP", MinPoints: 2500}}, tiers)
+
+	tiers, err = ParseTiers("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTiers(), tiers)
+
+	_, err = ParseTiers("Gold=5000")
+	assert.Error(t, err)
+}
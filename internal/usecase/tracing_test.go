@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestUserUseCase_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(context.Background())
+
+	mockRepo := new(MockUserRepository)
+	mockRepo.On("FindByID", 1).Return(&domain.User{ID: 1}, nil)
+	mockRepo.On("FindByID", 2).Return(nil, nil)
+	useCase := NewUserUseCase(mockRepo)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	_, err := useCase.GetUserByID(ctx, 1)
+	assert.NoError(t, err)
+	_, err = useCase.GetUserByID(ctx, 2)
+	assert.Equal(t, domain.ErrUserNotFound, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 3) {
+		assert.Equal(t, "UserUseCase.GetUserByID", spans[0].Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+		assert.Equal(t, codes.Unset, spans[0].Status().Code)
+		assert.Equal(t, codes.Error, spans[1].Status().Code)
+		assert.Equal(t, domain.ErrUserNotFound.Error(), spans[1].Status().Description)
+	}
+}
@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"workshop_4/internal/domain"
+)
+
+// MaxBatchSize bounds the operations of one batch
+const MaxBatchSize = 1000
+
+// CheckBatchSize reports ErrInvalidBatch unless a batch of n operations is
+// within MaxBatchSize, so callers can refuse one before preparing it
+func CheckBatchSize(n int) error {
+	if n == 0 || n > MaxBatchSize {
+		return fmt.Errorf("%w: send between 1 and %d operations", domain.ErrInvalidBatch, MaxBatchSize)
+	}
+	return nil
+}
+
+// Batch operation kinds
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchOperation is one operation of a batch. A create uses Create, an
+// update ID and Update, and a delete ID. Version is the version an update or
+// delete requires; 0 skips the check.
+type BatchOperation struct {
+	Kind    string
+	ID      int
+	Version int
+	Create  CreateUserInput
+	Update  UpdateUserInput
+	// Err is why the operation could not be read; it fails without running
+	Err error
+}
+
+// BatchResult is the outcome of one operation: the user as created or
+// updated, none for a delete, or the error the operation failed with
+type BatchResult struct {
+	User *domain.User
+	Err  error
+}
+
+// RunBatch applies the operations in order, each with the permissions and
+// rules of its single-user counterpart, and returns one result per
+// operation.
+//
+// An atomic batch runs in one transaction. Its first failure stops it and
+// rolls it back: that operation's result carries its error and every other
+// result ErrBatchRolledBack. Otherwise each operation stands on its own and
+// the batch carries on past failures. The error is only for a batch that
+// could not run at all.
+func (uc *UserUseCase) RunBatch(ctx context.Context, ops []BatchOperation, atomic bool) (_ []BatchResult, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.RunBatch")
+	defer func() { endSpan(span, err) }()
+
+	if err := CheckBatchSize(len(ops)); err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(ops))
+	if !atomic {
+		failed := 0
+		for i, op := range ops {
+			results[i] = uc.runBatchOperation(ctx, op)
+			if results[i].Err != nil {
+				failed++
+			}
+		}
+		uc.logger.Info("batch applied", "operations", len(ops), "failed", failed)
+		return results, nil
+	}
+
+	// Business events wait for the commit; a rolled back batch has none
+	pending := &pendingMetrics{}
+	failed := -1
+	err = uc.userRepo.InTransaction(ctx, func(repo domain.UserRepository) error {
+		tx := *uc
+		tx.userRepo = repo
+		tx.metrics = pending
+		for i, op := range ops {
+			results[i] = tx.runBatchOperation(ctx, op)
+			if results[i].Err != nil {
+				failed = i
+				return results[i].Err
+			}
+		}
+		return nil
+	})
+	if failed >= 0 {
+		for i := range results {
+			if i != failed {
+				results[i] = BatchResult{Err: domain.ErrBatchRolledBack}
+			}
+		}
+		uc.logger.Warn("atomic batch rolled back", "operations", len(ops), "failed_operation", failed, "error", results[failed].Err)
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pending.flush(uc.metrics)
+	uc.logger.Info("atomic batch committed", "operations", len(ops))
+	return results, nil
+}
+
+// runBatchOperation applies one operation of a batch
+func (uc *UserUseCase) runBatchOperation(ctx context.Context, op BatchOperation) BatchResult {
+	if op.Err != nil {
+		return BatchResult{Err: op.Err}
+	}
+
+	switch op.Kind {
+	case BatchCreate:
+		user, err := uc.CreateUser(ctx, op.Create)
+		return BatchResult{User: user, Err: err}
+	case BatchUpdate:
+		input := op.Update
+		input.Version = op.Version
+		user, err := uc.UpdateUser(ctx, op.ID, input)
+		return BatchResult{User: user, Err: err}
+	case BatchDelete:
+		return BatchResult{Err: uc.DeleteUser(ctx, op.ID, op.Version)}
+	}
+	return BatchResult{Err: fmt.Errorf("%w: unknown op %q", domain.ErrInvalidBatchOperation, op.Kind)}
+}
@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// countingMetrics counts created and deleted users
+type countingMetrics struct {
+	noMetrics
+	created, deleted int
+}
+
+func (m *countingMetrics) UserCreated() { m.created++ }
+func (m *countingMetrics) UserDeleted() { m.deleted++ }
+
+func batchOperations() []BatchOperation {
+	return []BatchOperation{
+		{Kind: BatchCreate, Create: CreateUserInput{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com"}},
+		{Kind: BatchDelete, ID: 2},
+		{Kind: BatchUpdate, ID: 3, Version: 4, Update: UpdateUserInput{FirstName: "Bo", LastName: "Kim", Email: "bo@example.com"}},
+	}
+}
+
+func expectBatchReads(mockRepo *MockUserRepository) {
+	mockRepo.On("FindByEmail", "jane@example.com").Return(nil, nil)
+	mockRepo.On("Create", mock.AnythingOfType("*domain.User")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.User).ID = 10
+	})
+	mockRepo.On("FindByID", 2).Return(&domain.User{ID: 2, Version: 1}, nil)
+	mockRepo.On("Delete", 2, 1).Return(nil)
+	mockRepo.On("FindByID", 3).Return(&domain.User{ID: 3, Version: 5}, nil)
+}
+
+func TestRunBatch_BestEffort(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	metrics := &countingMetrics{}
+	useCase := NewUserUseCase(mockRepo, WithMetrics(metrics))
+	expectBatchReads(mockRepo)
+
+	ops := append(batchOperations(), BatchOperation{Kind: BatchCreate, Err: domain.ErrInvalidBatchOperation})
+	results, err := useCase.RunBatch(context.Background(), ops, false)
+
+	assert.NoError(t, err)
+	if assert.Len(t, results, 4) {
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, 10, results[0].User.ID)
+		assert.NoError(t, results[1].Err)
+		assert.Nil(t, results[1].User)
+		assert.Equal(t, domain.ErrVersionConflict, results[2].Err)
+		assert.Equal(t, domain.ErrInvalidBatchOperation, results[3].Err)
+	}
+	assert.Equal(t, 1, metrics.created)
+	assert.Equal(t, 1, metrics.deleted)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRunBatch_AtomicRollsBack(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	metrics := &countingMetrics{}
+	useCase := NewUserUseCase(mockRepo, WithMetrics(metrics))
+	expectBatchReads(mockRepo)
+
+	ops := append(batchOperations(), BatchOperation{Kind: BatchDelete, ID: 4})
+	results, err := useCase.RunBatch(context.Background(), ops, true)
+
+	assert.NoError(t, err)
+	if assert.Len(t, results, 4) {
+		assert.Equal(t, domain.ErrBatchRolledBack, results[0].Err)
+		assert.Nil(t, results[0].User)
+		assert.Equal(t, domain.ErrBatchRolledBack, results[1].Err)
+		assert.Equal(t, domain.ErrVersionConflict, results[2].Err)
+		assert.Equal(t, domain.ErrBatchRolledBack, results[3].Err)
+	}
+	// Operations after the failure never ran, and nothing was counted
+	mockRepo.AssertNotCalled(t, "FindByID", 4)
+	assert.Zero(t, metrics.created)
+	assert.Zero(t, metrics.deleted)
+}
+
+func TestRunBatch_AtomicCommits(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	metrics := &countingMetrics{}
+	useCase := NewUserUseCase(mockRepo, WithMetrics(metrics))
+	expectBatchReads(mockRepo)
+
+	results, err := useCase.RunBatch(context.Background(), batchOperations()[:2], true)
+
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, 1, metrics.created)
+	assert.Equal(t, 1, metrics.deleted)
+}
+
+func TestRunBatch_Permissions(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+	expectBatchReads(mockRepo)
+
+	// Support may create but not delete; each operation is checked alone
+	results, err := useCase.As(support).RunBatch(context.Background(), batchOperations()[:2], false)
+
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assertForbidden(t, results[1].Err, domain.PermUsersDelete)
+	mockRepo.AssertNotCalled(t, "Delete", 2, 1)
+}
+
+func TestRunBatch_InvalidBatch(t *testing.T) {
+	useCase := NewUserUseCase(new(MockUserRepository))
+
+	_, err := useCase.RunBatch(context.Background(), nil, false)
+	assert.True(t, errors.Is(err, domain.ErrInvalidBatch))
+
+	_, err = useCase.RunBatch(context.Background(), make([]BatchOperation, MaxBatchSize+1), true)
+	assert.True(t, errors.Is(err, domain.ErrInvalidBatch))
+
+	results, err := useCase.RunBatch(context.Background(), []BatchOperation{{Kind: "upsert"}}, false)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(results[0].Err, domain.ErrInvalidBatchOperation))
+}
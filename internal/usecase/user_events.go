@@ -0,0 +1,166 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// eventUser is a user as event payloads carry it, with the field names of
+// the JSON API
+type eventUser struct {
+	ID           int        `json:"id"`
+	FirstName    string     `json:"first_name"`
+	LastName     string     `json:"last_name"`
+	Email        string     `json:"email"`
+	Phone        string     `json:"phone"`
+	Address      string     `json:"address"`
+	Avatar       string     `json:"avatar"`
+	MemberLevel  string     `json:"member_level"`
+	PointBalance int        `json:"point_balance"`
+	Version      int        `json:"version"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+}
+
+// userEventData is the payload of a user event
+type userEventData struct {
+	User eventUser `json:"user"`
+	// Changed names the fields an update changed
+	Changed []string `json:"changed,omitempty"`
+	// From and To are the member levels of a tier change
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// pointsEventData is the payload of a points change
+type pointsEventData struct {
+	UserID int `json:"user_id"`
+	// TransactionID is the ledger entry of the change, when it is known
+	TransactionID int                         `json:"transaction_id,omitempty"`
+	Type          domain.PointTransactionType `json:"type"`
+	Amount        int                         `json:"amount"`
+	BalanceAfter  int                         `json:"balance_after"`
+	Description   string                      `json:"description,omitempty"`
+}
+
+// newPointsEvent builds the points_changed event of a ledger entry
+func newPointsEvent(pt *domain.PointTransaction) *domain.Event {
+	// Marshalling plain strings and numbers cannot fail
+	payload, _ := json.Marshal(pointsEventData{
+		UserID:        pt.UserID,
+		TransactionID: pt.ID,
+		Type:          pt.Type,
+		Amount:        pt.Amount,
+		BalanceAfter:  pt.BalanceAfter,
+		Description:   pt.Description,
+	})
+	return &domain.Event{
+		Type:      domain.EventUserPointsChanged,
+		UserID:    pt.UserID,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}
+}
+
+// newUserEvent builds an event about user
+func newUserEvent(eventType string, user *domain.User, data userEventData) *domain.Event {
+	data.User = eventUser{
+		ID:           user.ID,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Email:        user.Email,
+		Phone:        user.Phone,
+		Address:      user.Address,
+		Avatar:       user.Avatar,
+		MemberLevel:  user.MemberLevel,
+		PointBalance: user.PointBalance,
+		Version:      user.Version,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		DeletedAt:    user.DeletedAt,
+	}
+	// Marshalling plain strings, numbers and times cannot fail
+	payload, _ := json.Marshal(data)
+	return &domain.Event{
+		Type:      eventType,
+		UserID:    user.ID,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}
+}
+
+// userSavedEvents returns the events of saving after over before: created
+// for a new user, whose before is nil, otherwise updated. points_changed
+// follows for an opening or changed balance, and tier_changed for a changed
+// member level.
+func userSavedEvents(before, after *domain.User) []*domain.Event {
+	if before == nil {
+		events := []*domain.Event{newUserEvent(domain.EventUserCreated, after, userEventData{})}
+		if after.PointBalance != 0 {
+			events = append(events, newPointsEvent(&domain.PointTransaction{
+				UserID:       after.ID,
+				Type:         domain.PointTransactionAdjust,
+				Amount:       after.PointBalance,
+				BalanceAfter: after.PointBalance,
+				Description:  "Opening balance",
+			}))
+		}
+		return events
+	}
+
+	events := []*domain.Event{newUserEvent(domain.EventUserUpdated, after, userEventData{Changed: changedFields(before, after)})}
+	if before.PointBalance != after.PointBalance {
+		// The repository books the change as an adjustment
+		events = append(events, newPointsEvent(&domain.PointTransaction{
+			UserID:       after.ID,
+			Type:         domain.PointTransactionAdjust,
+			Amount:       after.PointBalance - before.PointBalance,
+			BalanceAfter: after.PointBalance,
+			Description:  "Balance set by user update",
+		}))
+	}
+	if before.MemberLevel != after.MemberLevel {
+		events = append(events, newUserEvent(domain.EventUserTierChanged, after, userEventData{From: before.MemberLevel, To: after.MemberLevel}))
+	}
+	return events
+}
+
+// changedFields names the fields that differ between before and after
+func changedFields(before, after *domain.User) []string {
+	fields := []struct {
+		name    string
+		changed bool
+	}{
+		{"first_name", before.FirstName != after.FirstName},
+		{"last_name", before.LastName != after.LastName},
+		{"email", before.Email != after.Email},
+		{"phone", before.Phone != after.Phone},
+		{"address", before.Address != after.Address},
+		{"avatar", before.Avatar != after.Avatar},
+		{"member_level", before.MemberLevel != after.MemberLevel},
+		{"point_balance", before.PointBalance != after.PointBalance},
+	}
+
+	changed := []string{}
+	for _, field := range fields {
+		if field.changed {
+			changed = append(changed, field.name)
+		}
+	}
+	return changed
+}
+
+// saveWithEvents runs save in a transaction together with the outbox events
+// describing it, so an event is recorded exactly when its change is. events
+// is called once save has succeeded, when a new user has its ID.
+func saveWithEvents(ctx context.Context, userRepo domain.UserRepository, save func(domain.UserRepository) error, events func() []*domain.Event) error {
+	return userRepo.InTransaction(ctx, func(repo domain.UserRepository) error {
+		if err := save(repo); err != nil {
+			return err
+		}
+		return repo.AppendEvents(ctx, events()...)
+	})
+}
@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// eventTypes lists the types of the events the mock recorded
+func eventTypes(events []*domain.Event) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestCreateUser_AppendsCreatedEvent(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindByEmail", "john@example.com").Return(nil, nil)
+	mockRepo.On("Create", mock.AnythingOfType("*domain.User")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.User).ID = 7
+	})
+
+	_, err := useCase.CreateUser(context.Background(), CreateUserInput{FirstName: "John", LastName: "Doe", Email: "john@example.com"})
+
+	assert.NoError(t, err)
+	if assert.Equal(t, []string{domain.EventUserCreated}, eventTypes(mockRepo.events)) {
+		event := mockRepo.events[0]
+		assert.Equal(t, 7, event.UserID)
+
+		var data userEventData
+		assert.NoError(t, json.Unmarshal(event.Data, &data))
+		assert.Equal(t, 7, data.User.ID)
+		assert.Equal(t, "john@example.com", data.User.Email)
+	}
+}
+
+func TestCreateUser_FailureAppendsNoEvent(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindByEmail", "john@example.com").Return(nil, nil)
+	mockRepo.On("Create", mock.AnythingOfType("*domain.User")).Return(domain.ErrDuplicateEmail)
+
+	_, err := useCase.CreateUser(context.Background(), CreateUserInput{FirstName: "John", LastName: "Doe", Email: "john@example.com"})
+
+	assert.Equal(t, domain.ErrDuplicateEmail, err)
+	assert.Empty(t, mockRepo.events)
+}
+
+func TestUpdateUser_AppendsPointsAndTierEvents(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindByID", 1).Return(&domain.User{
+		ID: 1, FirstName: "John", LastName: "Doe", Email: "john@example.com",
+		MemberLevel: "Bronze", PointBalance: 100, Version: 2, CreatedAt: time.Now(),
+	}, nil)
+	mockRepo.On("Update", mock.AnythingOfType("*domain.User")).Return(nil)
+
+	_, err := useCase.UpdateUser(context.Background(), 1, UpdateUserInput{
+		FirstName: "John", LastName: "Doe", Email: "john@example.com", PointBalance: 6000,
+	})
+
+	assert.NoError(t, err)
+	if assert.Equal(t, []string{domain.EventUserUpdated, domain.EventUserPointsChanged, domain.EventUserTierChanged}, eventTypes(mockRepo.events)) {
+		var updated, tier userEventData
+		assert.NoError(t, json.Unmarshal(mockRepo.events[0].Data, &updated))
+		assert.Equal(t, []string{"member_level", "point_balance"}, updated.Changed)
+
+		var points pointsEventData
+		assert.NoError(t, json.Unmarshal(mockRepo.events[1].Data, &points))
+		assert.Equal(t, domain.PointTransactionAdjust, points.Type)
+		assert.Equal(t, 5900, points.Amount)
+		assert.Equal(t, 6000, points.BalanceAfter)
+
+		assert.NoError(t, json.Unmarshal(mockRepo.events[2].Data, &tier))
+		assert.Equal(t, "Bronze", tier.From)
+		assert.Equal(t, "Gold", tier.To)
+	}
+}
+
+func TestDeleteUser_AppendsDeletedEvent(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindByID", 1).Return(&domain.User{ID: 1, Version: 3}, nil)
+	mockRepo.On("Delete", 1, 3).Return(nil)
+
+	assert.NoError(t, useCase.DeleteUser(context.Background(), 1, 0))
+	assert.Equal(t, []string{domain.EventUserDeleted}, eventTypes(mockRepo.events))
+}
+
+func TestEarnPoints_AppendsPointsChangedEvent(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockPointRepo := new(MockPointTransactionRepository)
+	useCase := NewPointUseCase(mockUserRepo, mockPointRepo, NewDefaultTierEngine())
+
+	mockPointRepo.On("Record", mock.AnythingOfType("*domain.PointTransaction")).Return(nil).Run(func(args mock.Arguments) {
+		pt := args.Get(0).(*domain.PointTransaction)
+		pt.ID = 4
+		pt.BalanceAfter = 300
+	})
+	mockUserRepo.On("FindByID", 1).Return(&domain.User{ID: 1, MemberLevel: "Bronze", PointBalance: 300}, nil)
+
+	_, err := useCase.EarnPoints(context.Background(), 1, PointInput{Amount: 200, Description: "Purchase"})
+
+	assert.NoError(t, err)
+	if assert.Len(t, mockPointRepo.events, 1) {
+		assert.Equal(t, domain.EventUserPointsChanged, mockPointRepo.events[0].Type)
+		var points pointsEventData
+		assert.NoError(t, json.Unmarshal(mockPointRepo.events[0].Data, &points))
+		assert.Equal(t, pointsEventData{UserID: 1, TransactionID: 4, Type: domain.PointTransactionEarn, Amount: 200, BalanceAfter: 300, Description: "Purchase"}, points)
+	}
+	// The tier did not change, so the user itself was not saved
+	assert.Empty(t, mockUserRepo.events)
+}
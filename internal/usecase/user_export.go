@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"context"
+	"workshop_4/internal/domain"
+)
+
+// ExportUsersInput represents input for exporting users. Filter and Sort are
+// as for ListUsersInput; an export has no pages.
+type ExportUsersInput struct {
+	Filter domain.UserFilter
+	Sort   string
+}
+
+// UserExport is an export whose caller and input have been checked, ready to
+// stream. Checking comes first so that a refused or invalid export can be
+// answered before any of the file is sent.
+type UserExport struct {
+	uc     *UserUseCase
+	filter domain.UserFilter
+	sort   []domain.SortField
+}
+
+// ExportUsers checks an export of the users matching a filter. Including
+// deleted users needs PermUsersReadDeleted.
+func (uc *UserUseCase) ExportUsers(input ExportUsersInput) (*UserExport, error) {
+	if err := uc.authorize(domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	filter, err := uc.checkFilter(input.Filter)
+	if err != nil {
+		return nil, err
+	}
+	sort, err := ParseSort(input.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserExport{uc: uc, filter: filter, sort: sort}, nil
+}
+
+// Each calls fn with every exported user in sort order, stopping at the first
+// error fn returns. Users are read from the repository as fn consumes them,
+// so an export of any size uses constant memory.
+func (e *UserExport) Each(ctx context.Context, fn func(*domain.User) error) (err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.ExportUsers")
+	defer func() { endSpan(span, err) }()
+
+	count := 0
+	err = e.uc.userRepo.Each(ctx, e.filter, e.sort, func(user *domain.User) error {
+		count++
+		return fn(user)
+	})
+	if err != nil {
+		return err
+	}
+
+	e.uc.logger.Info("users exported", "count", count)
+	return nil
+}
@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportUsers(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	filter := domain.UserFilter{MemberLevel: "Gold"}
+	sort := []domain.SortField{{Field: "point_balance", Desc: true}, {Field: "id"}}
+	mockRepo.On("Each", filter, sort).Return([]*domain.User{{ID: 3}, {ID: 1}}, nil)
+
+	export, err := useCase.As(support).ExportUsers(ExportUsersInput{
+		Filter: domain.UserFilter{MemberLevel: "gold"},
+		Sort:   "-point_balance",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	err = export.Each(context.Background(), func(user *domain.User) error {
+		ids = append(ids, user.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 1}, ids)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestExportUsers_StopsOnError(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	mockRepo.On("Each", domain.UserFilter{}, []domain.SortField{{Field: "id", Desc: true}}).
+		Return([]*domain.User{{ID: 3}, {ID: 1}}, nil)
+	export, _ := NewUserUseCase(mockRepo).ExportUsers(ExportUsersInput{})
+
+	gone := errors.New("client gone")
+	calls := 0
+	err := export.Each(context.Background(), func(*domain.User) error {
+		calls++
+		return gone
+	})
+	assert.Equal(t, gone, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestExportUsers_InvalidInput(t *testing.T) {
+	useCase := NewUserUseCase(new(MockUserRepository))
+	min, max := 500, 100
+
+	_, err := useCase.ExportUsers(ExportUsersInput{Filter: domain.UserFilter{PointsMin: &min, PointsMax: &max}})
+	assert.Equal(t, domain.ErrInvalidFilter, err)
+
+	_, err = useCase.ExportUsers(ExportUsersInput{Filter: domain.UserFilter{MemberLevel: "Mithril"}})
+	assert.Equal(t, domain.ErrInvalidMemberLevel, err)
+
+	_, err = useCase.ExportUsers(ExportUsersInput{Sort: "password"})
+	assert.Equal(t, domain.ErrInvalidSortField, err)
+}
+
+func TestExportUsers_Permissions(t *testing.T) {
+	useCase := NewUserUseCase(new(MockUserRepository))
+
+	_, err := useCase.As(nil).ExportUsers(ExportUsersInput{})
+	assertForbidden(t, err, domain.PermUsersRead)
+
+	_, err = useCase.As(support).ExportUsers(ExportUsersInput{Filter: domain.UserFilter{IncludeDeleted: true}})
+	assertForbidden(t, err, domain.PermUsersReadDeleted)
+
+	_, err = useCase.As(admin).ExportUsers(ExportUsersInput{Filter: domain.UserFilter{IncludeDeleted: true}})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,323 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// importBatchSize is how many rows are checked against the database and
+// inserted per transaction
+const importBatchSize = 500
+
+// ImportRow is one record read from an import file
+type ImportRow struct {
+	// Line is the record's line in the file
+	Line  int
+	Input CreateUserInput
+	// Err reports a record that could not be read into Input, such as one
+	// with a malformed number; the row is rejected with it
+	Err error
+}
+
+// ImportSource yields the rows of an import file one at a time
+type ImportSource interface {
+	// Format names the file format, e.g. "csv"
+	Format() string
+	// Next returns the next row, or io.EOF after the last. Any other error
+	// aborts the import.
+	Next() (*ImportRow, error)
+}
+
+// UserImportUseCase handles bulk imports of users
+type UserImportUseCase struct {
+	userRepo   domain.UserRepository
+	importRepo domain.UserImportRepository
+	tiers      *TierEngine
+	policy     *AccessPolicy
+	logger     *slog.Logger
+	metrics    BusinessMetrics
+	// actor is the principal calls are checked against once restricted
+	actor      *domain.Principal
+	restricted bool
+}
+
+// UserImportUseCaseOption configures optional UserImportUseCase dependencies
+type UserImportUseCaseOption func(*UserImportUseCase)
+
+// WithImportAccessPolicy sets the policy principals are checked against.
+// Without it the default roles are used.
+func WithImportAccessPolicy(policy *AccessPolicy) UserImportUseCaseOption {
+	return func(uc *UserImportUseCase) {
+		uc.policy = policy
+	}
+}
+
+// WithImportMetrics sets where business events are counted
+func WithImportMetrics(metrics BusinessMetrics) UserImportUseCaseOption {
+	return func(uc *UserImportUseCase) {
+		uc.metrics = metrics
+	}
+}
+
+// NewUserImportUseCase creates a new user import use case. Like
+// NewUserUseCase it acts as the system; use As for calls made on behalf of
+// a caller.
+func NewUserImportUseCase(userRepo domain.UserRepository, importRepo domain.UserImportRepository, tiers *TierEngine, opts ...UserImportUseCaseOption) *UserImportUseCase {
+	uc := &UserImportUseCase{
+		userRepo:   userRepo,
+		importRepo: importRepo,
+		tiers:      tiers,
+		policy:     NewDefaultAccessPolicy(),
+		logger:     slog.Default(),
+		metrics:    noMetrics{},
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// WithLogger returns a copy of the use case logging to logger, typically
+// one tagged with the request being served
+func (uc *UserImportUseCase) WithLogger(logger *slog.Logger) *UserImportUseCase {
+	scoped := *uc
+	scoped.logger = logger
+	return &scoped
+}
+
+// As returns a copy of the use case acting for principal, whose every call
+// is checked against the access policy
+func (uc *UserImportUseCase) As(principal *domain.Principal) *UserImportUseCase {
+	scoped := *uc
+	scoped.actor = principal
+	scoped.restricted = true
+	return &scoped
+}
+
+// authorize requires every permission of the acting principal
+func (uc *UserImportUseCase) authorize(permissions ...domain.Permission) error {
+	if !uc.restricted {
+		return nil
+	}
+	return uc.policy.Authorize(uc.actor, permissions...)
+}
+
+// ImportUsers creates a user for every valid row of source. Rows are
+// validated like CreateUser input, and rejected when invalid, when their
+// email is taken or repeats an earlier row, or when they set points or a
+// member level without PermUsersEditPoints. Accepted rows are inserted in
+// batches of one transaction each; a dry run inserts nothing but reports
+// the same outcome. Rejected rows are stored for GetRejections.
+//
+// If source fails, the import stops with that error; batches already
+// inserted stay.
+func (uc *UserImportUseCase) ImportUsers(ctx context.Context, source ImportSource, dryRun bool) (_ *domain.UserImport, err error) {
+	ctx, span := startSpan(ctx, "UserImportUseCase.ImportUsers")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersCreate); err != nil {
+		return nil, err
+	}
+
+	imp := &domain.UserImport{
+		Format:    source.Format(),
+		DryRun:    dryRun,
+		CreatedAt: time.Now(),
+	}
+	if uc.actor != nil {
+		imp.CreatedBy = uc.actor.Subject
+	}
+	if err := uc.importRepo.Create(ctx, imp); err != nil {
+		return nil, err
+	}
+
+	run := &importRun{
+		uc:           uc,
+		imp:          imp,
+		pointsDenied: uc.authorize(domain.PermUsersEditPoints),
+		seen:         make(map[string]int),
+	}
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		run.add(row)
+		if len(run.pending) >= importBatchSize {
+			if err := run.flush(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := run.flush(ctx); err != nil {
+		return nil, err
+	}
+
+	finished := time.Now()
+	imp.FinishedAt = &finished
+	if err := uc.importRepo.Finish(ctx, imp); err != nil {
+		return nil, err
+	}
+	uc.logger.Info("users imported", "import_id", imp.ID, "format", imp.Format, "dry_run", imp.DryRun,
+		"total", imp.Total, "imported", imp.Imported, "rejected", imp.Rejected)
+
+	return imp, nil
+}
+
+// GetImport retrieves an import by ID
+func (uc *UserImportUseCase) GetImport(ctx context.Context, id int) (*domain.UserImport, error) {
+	if err := uc.authorize(domain.PermUsersCreate); err != nil {
+		return nil, err
+	}
+
+	imp, err := uc.importRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if imp == nil {
+		return nil, domain.ErrUserImportNotFound
+	}
+	return imp, nil
+}
+
+// GetRejections calls fn with each row the import rejected, in line order
+func (uc *UserImportUseCase) GetRejections(ctx context.Context, id int, fn func(*domain.ImportRejection) error) error {
+	if _, err := uc.GetImport(ctx, id); err != nil {
+		return err
+	}
+	return uc.importRepo.EachRejection(ctx, id, fn)
+}
+
+// importRun is the state of an import in progress
+type importRun struct {
+	uc  *UserImportUseCase
+	imp *domain.UserImport
+	// pointsDenied rejects rows setting points or a member level when the
+	// caller may not
+	pointsDenied error
+	// seen maps each email accepted so far to its line
+	seen map[string]int
+
+	pending    []*pendingUser
+	rejections []*domain.ImportRejection
+}
+
+// pendingUser is a valid row waiting for its batch to be inserted
+type pendingUser struct {
+	line int
+	user *domain.User
+}
+
+// add validates a row, queueing it for insertion or rejecting it
+func (r *importRun) add(row *ImportRow) {
+	r.imp.Total++
+	if row.Err != nil {
+		r.reject(row.Line, row.Input.Email, row.Err.Error())
+		return
+	}
+	if r.pointsDenied != nil && (row.Input.PointBalance != 0 || row.Input.MemberLevel != "") {
+		r.reject(row.Line, row.Input.Email, r.pointsDenied.Error())
+		return
+	}
+
+	user, err := newUser(r.uc.tiers, row.Input)
+	if err != nil {
+		r.reject(row.Line, row.Input.Email, err.Error())
+		return
+	}
+	if line, ok := r.seen[user.Email]; ok {
+		r.reject(row.Line, user.Email, fmt.Sprintf("email repeats line %d", line))
+		return
+	}
+	r.seen[user.Email] = row.Line
+	r.pending = append(r.pending, &pendingUser{line: row.Line, user: user})
+}
+
+// reject records a rejected row for the next flush
+func (r *importRun) reject(line int, email, reason string) {
+	r.imp.Rejected++
+	r.rejections = append(r.rejections, &domain.ImportRejection{Line: line, Email: email, Reason: reason})
+}
+
+// flush rejects the pending users whose email is taken, inserts the rest
+// unless this is a dry run, and stores the rejections so far
+func (r *importRun) flush(ctx context.Context) error {
+	if len(r.pending) > 0 {
+		emails := make([]string, len(r.pending))
+		for i, p := range r.pending {
+			emails[i] = p.user.Email
+		}
+		existing, err := r.uc.userRepo.ExistingEmails(ctx, emails)
+		if err != nil {
+			return err
+		}
+
+		var batch []*pendingUser
+		for _, p := range r.pending {
+			if existing[p.user.Email] {
+				r.reject(p.line, p.user.Email, domain.ErrDuplicateEmail.Error())
+				continue
+			}
+			batch = append(batch, p)
+		}
+		if err := r.insert(ctx, batch); err != nil {
+			return err
+		}
+		r.pending = r.pending[:0]
+	}
+
+	if err := r.uc.importRepo.AddRejections(ctx, r.imp.ID, r.rejections); err != nil {
+		return err
+	}
+	r.rejections = r.rejections[:0]
+	return nil
+}
+
+// insert creates a batch of users; one whose email was taken since it was
+// checked is rejected
+func (r *importRun) insert(ctx context.Context, batch []*pendingUser) error {
+	if r.imp.DryRun {
+		r.imp.Imported += len(batch)
+		return nil
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	users := make([]*domain.User, len(batch))
+	for i, p := range batch {
+		users[i] = p.user
+	}
+	var errs []error
+	err := saveWithEvents(ctx, r.uc.userRepo, func(repo domain.UserRepository) (err error) {
+		errs, err = repo.CreateBatch(ctx, users)
+		return err
+	}, func() []*domain.Event {
+		var events []*domain.Event
+		for i, user := range users {
+			if errs[i] == nil {
+				events = append(events, userSavedEvents(nil, user)...)
+			}
+		}
+		return events
+	})
+	if err != nil {
+		return err
+	}
+	for i, p := range batch {
+		if errs[i] != nil {
+			r.reject(p.line, p.user.Email, errs[i].Error())
+			continue
+		}
+		r.imp.Imported++
+		r.uc.metrics.UserCreated()
+	}
+	return nil
+}
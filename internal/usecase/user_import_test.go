@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockUserImportRepository is a mock implementation of domain.UserImportRepository
+// that keeps the rejections it is given
+type MockUserImportRepository struct {
+	mock.Mock
+	rejections []*domain.ImportRejection
+}
+
+func (m *MockUserImportRepository) Create(_ context.Context, imp *domain.UserImport) error {
+	args := m.Called(imp)
+	return args.Error(0)
+}
+
+func (m *MockUserImportRepository) Finish(_ context.Context, imp *domain.UserImport) error {
+	args := m.Called(imp)
+	return args.Error(0)
+}
+
+func (m *MockUserImportRepository) FindByID(_ context.Context, id int) (*domain.UserImport, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserImport), args.Error(1)
+}
+
+func (m *MockUserImportRepository) AddRejections(_ context.Context, importID int, rejections []*domain.ImportRejection) error {
+	m.rejections = append(m.rejections, rejections...)
+	return nil
+}
+
+func (m *MockUserImportRepository) EachRejection(_ context.Context, importID int, fn func(*domain.ImportRejection) error) error {
+	for _, rejection := range m.rejections {
+		if err := fn(rejection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sliceSource is an ImportSource over a fixed list of rows
+type sliceSource struct {
+	rows []*ImportRow
+	err  error
+}
+
+func (s *sliceSource) Format() string { return "csv" }
+
+func (s *sliceSource) Next() (*ImportRow, error) {
+	if len(s.rows) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	row := s.rows[0]
+	s.rows = s.rows[1:]
+	return row, nil
+}
+
+func importRows() *sliceSource {
+	valid := func(line int, email string) *ImportRow {
+		return &ImportRow{Line: line, Input: CreateUserInput{FirstName: "Jane", LastName: "Doe", Email: email}}
+	}
+	return &sliceSource{rows: []*ImportRow{
+		valid(2, "a@example.com"),
+		{Line: 3, Input: CreateUserInput{LastName: "Doe", Email: "b@example.com"}},
+		valid(4, "a@example.com"),
+		valid(5, "taken@example.com"),
+		{Line: 6, Input: CreateUserInput{Email: "c@example.com"}, Err: errors.New(`point_balance: invalid number "lots"`)},
+		valid(7, "raced@example.com"),
+		valid(8, "d@example.com"),
+	}}
+}
+
+func newImportMocks() (*MockUserRepository, *MockUserImportRepository) {
+	userRepo := new(MockUserRepository)
+	importRepo := new(MockUserImportRepository)
+	importRepo.On("Create", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.UserImport).ID = 9
+	})
+	importRepo.On("Finish", mock.Anything).Return(nil)
+	return userRepo, importRepo
+}
+
+func TestImportUsers(t *testing.T) {
+	userRepo, importRepo := newImportMocks()
+	userRepo.On("ExistingEmails", []string{"a@example.com", "taken@example.com", "raced@example.com", "d@example.com"}).
+		Return(map[string]bool{"taken@example.com": true}, nil)
+	userRepo.On("CreateBatch", mock.Anything).Return([]error{nil, domain.ErrDuplicateEmail, nil}, nil)
+	useCase := NewUserImportUseCase(userRepo, importRepo, NewDefaultTierEngine())
+
+	imp, err := useCase.As(support).ImportUsers(context.Background(), importRows(), false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 9, imp.ID)
+	assert.Equal(t, "u-support", imp.CreatedBy)
+	assert.Equal(t, 7, imp.Total)
+	assert.Equal(t, 2, imp.Imported)
+	assert.Equal(t, 5, imp.Rejected)
+	assert.NotNil(t, imp.FinishedAt)
+	importRepo.AssertCalled(t, "Finish", imp)
+
+	batch := userRepo.Calls[1].Arguments.Get(0).([]*domain.User)
+	if assert.Len(t, batch, 3) {
+		assert.Equal(t, "Bronze", batch[0].MemberLevel)
+	}
+
+	reasons := map[int]string{}
+	for _, rejection := range importRepo.rejections {
+		reasons[rejection.Line] = rejection.Reason
+	}
+	assert.Equal(t, map[int]string{
+		3: domain.ErrFirstNameRequired.Error(),
+		4: "email repeats line 2",
+		5: domain.ErrDuplicateEmail.Error(),
+		6: `point_balance: invalid number "lots"`,
+		7: domain.ErrDuplicateEmail.Error(),
+	}, reasons)
+}
+
+func TestImportUsers_DryRun(t *testing.T) {
+	userRepo, importRepo := newImportMocks()
+	userRepo.On("ExistingEmails", mock.Anything).Return(map[string]bool{"taken@example.com": true}, nil)
+	useCase := NewUserImportUseCase(userRepo, importRepo, NewDefaultTierEngine())
+
+	imp, err := useCase.ImportUsers(context.Background(), importRows(), true)
+
+	assert.NoError(t, err)
+	assert.True(t, imp.DryRun)
+	assert.Equal(t, 3, imp.Imported)
+	assert.Equal(t, 4, imp.Rejected)
+	userRepo.AssertNotCalled(t, "CreateBatch", mock.Anything)
+}
+
+func TestImportUsers_Permissions(t *testing.T) {
+	userRepo, importRepo := newImportMocks()
+	useCase := NewUserImportUseCase(userRepo, importRepo, NewDefaultTierEngine())
+
+	_, err := useCase.As(finance).ImportUsers(context.Background(), importRows(), false)
+	assertForbidden(t, err, domain.PermUsersCreate)
+
+	userRepo.On("ExistingEmails", mock.Anything).Return(map[string]bool{}, nil)
+	source := &sliceSource{rows: []*ImportRow{
+		{Line: 2, Input: CreateUserInput{FirstName: "Jane", LastName: "Doe", Email: "a@example.com", PointBalance: 500}},
+	}}
+	imp, err := useCase.As(support).ImportUsers(context.Background(), source, true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, imp.Rejected)
+	assert.Equal(t, "missing permission: users:edit_points", importRepo.rejections[0].Reason)
+}
+
+func TestImportUsers_SourceError(t *testing.T) {
+	userRepo, importRepo := newImportMocks()
+	useCase := NewUserImportUseCase(userRepo, importRepo, NewDefaultTierEngine())
+	readErr := errors.New("connection reset")
+
+	_, err := useCase.ImportUsers(context.Background(), &sliceSource{err: readErr}, false)
+
+	assert.Equal(t, readErr, err)
+	importRepo.AssertNotCalled(t, "Finish", mock.Anything)
+}
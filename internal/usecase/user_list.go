@@ -0,0 +1,328 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// Page size limits for user listings
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ListUsersInput represents input for listing users. Sort is a comma
+// separated list of fields, each optionally prefixed with "-" or suffixed
+// with ":desc" for descending order. Cursor and Offset are mutually exclusive.
+type ListUsersInput struct {
+	Filter domain.UserFilter
+	Sort   string
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// UserPage is one page of a user listing
+type UserPage struct {
+	Users      []*domain.User
+	Total      int
+	Limit      int
+	Offset     int
+	NextCursor string
+	PrevCursor string
+}
+
+// ListUsers retrieves a filtered, sorted page of users. Including deleted
+// users needs PermUsersReadDeleted.
+func (uc *UserUseCase) ListUsers(ctx context.Context, input ListUsersInput) (_ *UserPage, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.ListUsers")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	filter, err := uc.checkFilter(input.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if input.Limit == 0 {
+		input.Limit = DefaultPageSize
+	}
+	if input.Limit < 0 || input.Limit > MaxPageSize || input.Offset < 0 {
+		return nil, domain.ErrInvalidPagination
+	}
+	if input.Cursor != "" && input.Offset > 0 {
+		return nil, domain.ErrInvalidPagination
+	}
+
+	sort, err := ParseSort(input.Sort)
+	if err != nil {
+		return nil, err
+	}
+	signature := sortSignature(sort)
+
+	query := domain.UserListQuery{
+		Filter: filter,
+		Sort:   sort,
+		Limit:  input.Limit + 1, // one extra row tells us whether another page exists
+		Offset: input.Offset,
+	}
+	if input.Cursor != "" {
+		query.Cursor, err = decodeCursor(input.Cursor, sort, signature)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	users, err := uc.userRepo.FindPage(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	total, err := uc.userRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	backward := query.Cursor != nil && query.Cursor.Backward
+	hasMore := len(users) > input.Limit
+	if hasMore {
+		// The extra row is at the far end in reading direction
+		if backward {
+			users = users[1:]
+		} else {
+			users = users[:input.Limit]
+		}
+	}
+
+	page := &UserPage{
+		Users:  users,
+		Total:  total,
+		Limit:  input.Limit,
+		Offset: input.Offset,
+	}
+	if len(users) == 0 {
+		return page, nil
+	}
+
+	hasNext := hasMore
+	hasPrev := input.Offset > 0 || query.Cursor != nil
+	if backward {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		page.NextCursor = encodeCursor(users[len(users)-1], sort, signature, false)
+	}
+	if hasPrev {
+		page.PrevCursor = encodeCursor(users[0], sort, signature, true)
+	}
+
+	return page, nil
+}
+
+// checkFilter validates a listing filter and normalizes its member level.
+// Including deleted users needs PermUsersReadDeleted.
+func (uc *UserUseCase) checkFilter(filter domain.UserFilter) (domain.UserFilter, error) {
+	if filter.IncludeDeleted {
+		if err := uc.authorize(domain.PermUsersReadDeleted); err != nil {
+			return filter, err
+		}
+	}
+	if filter.MemberLevel != "" {
+		level, err := uc.tiers.Normalize(filter.MemberLevel)
+		if err != nil {
+			return filter, err
+		}
+		filter.MemberLevel = level
+	}
+	if filter.PointsMin != nil && filter.PointsMax != nil && *filter.PointsMin > *filter.PointsMax {
+		return filter, domain.ErrInvalidFilter
+	}
+	if filter.CreatedAfter != nil && filter.CreatedBefore != nil && !filter.CreatedAfter.Before(*filter.CreatedBefore) {
+		return filter, domain.ErrInvalidFilter
+	}
+	return filter, nil
+}
+
+// SearchUsers finds users by any fragment of name, email, phone or address
+func (uc *UserUseCase) SearchUsers(ctx context.Context, query string, limit int) (_ []*domain.UserSearchResult, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.SearchUsers")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(query) == "" {
+		return nil, domain.ErrInvalidSearch
+	}
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	if limit < 0 || limit > MaxPageSize {
+		return nil, domain.ErrInvalidPagination
+	}
+
+	return uc.userRepo.Search(ctx, query, limit)
+}
+
+// ParseSort parses a sort expression such as "-point_balance,last_name:asc".
+// An id key is appended as a tiebreaker when missing so that the order is
+// total; an empty expression sorts by id descending.
+func ParseSort(expr string) ([]domain.SortField, error) {
+	var sort []domain.SortField
+	hasID := false
+
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		field := domain.SortField{Field: part}
+		if strings.HasPrefix(part, "-") {
+			field = domain.SortField{Field: part[1:], Desc: true}
+		} else if name, dir, ok := strings.Cut(part, ":"); ok {
+			switch strings.ToLower(dir) {
+			case "asc":
+				field = domain.SortField{Field: name}
+			case "desc":
+				field = domain.SortField{Field: name, Desc: true}
+			default:
+				return nil, domain.ErrInvalidSortField
+			}
+		}
+
+		if !isUserSortField(field.Field) {
+			return nil, domain.ErrInvalidSortField
+		}
+		if field.Field == "id" {
+			hasID = true
+		}
+		sort = append(sort, field)
+	}
+
+	if len(sort) == 0 {
+		return []domain.SortField{{Field: "id", Desc: true}}, nil
+	}
+	if !hasID {
+		sort = append(sort, domain.SortField{Field: "id"})
+	}
+	return sort, nil
+}
+
+func isUserSortField(field string) bool {
+	for _, f := range domain.UserSortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func sortSignature(sort []domain.SortField) string {
+	keys := make([]string, len(sort))
+	for i, s := range sort {
+		if s.Desc {
+			keys[i] = "-" + s.Field
+		} else {
+			keys[i] = s.Field
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+// cursorPayload is the JSON carried inside an opaque cursor. The sort
+// signature ties a cursor to the ordering it was issued for.
+type cursorPayload struct {
+	Sort     string        `json:"s"`
+	Values   []interface{} `json:"v"`
+	Backward bool          `json:"b,omitempty"`
+}
+
+func encodeCursor(user *domain.User, sort []domain.SortField, signature string, backward bool) string {
+	values := make([]interface{}, len(sort))
+	for i, s := range sort {
+		values[i] = userSortValue(user, s.Field)
+	}
+
+	data, _ := json.Marshal(cursorPayload{Sort: signature, Values: values, Backward: backward})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string, sort []domain.SortField, signature string) (*domain.UserCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+	if payload.Sort != signature || len(payload.Values) != len(sort) {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	// JSON loses the Go types; restore them so SQLite compares like with like
+	values := make([]interface{}, len(sort))
+	for i, s := range sort {
+		switch s.Field {
+		case "id", "point_balance":
+			n, ok := payload.Values[i].(float64)
+			if !ok {
+				return nil, domain.ErrInvalidCursor
+			}
+			values[i] = int(n)
+		case "created_at", "updated_at":
+			str, ok := payload.Values[i].(string)
+			if !ok {
+				return nil, domain.ErrInvalidCursor
+			}
+			t, err := time.Parse(time.RFC3339Nano, str)
+			if err != nil {
+				return nil, domain.ErrInvalidCursor
+			}
+			values[i] = t
+		default:
+			str, ok := payload.Values[i].(string)
+			if !ok {
+				return nil, domain.ErrInvalidCursor
+			}
+			values[i] = str
+		}
+	}
+
+	return &domain.UserCursor{Values: values, Backward: payload.Backward}, nil
+}
+
+// userSortValue returns the value of a sortable field for cursor encoding
+func userSortValue(user *domain.User, field string) interface{} {
+	switch field {
+	case "id":
+		return user.ID
+	case "first_name":
+		return user.FirstName
+	case "last_name":
+		return user.LastName
+	case "email":
+		return user.Email
+	case "phone":
+		return user.Phone
+	case "address":
+		return user.Address
+	case "avatar":
+		return user.Avatar
+	case "member_level":
+		return user.MemberLevel
+	case "point_balance":
+		return user.PointBalance
+	case "created_at":
+		return user.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		return user.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return nil
+}
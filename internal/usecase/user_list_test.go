@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseSort(t *testing.T) {
+	sort, err := ParseSort("-point_balance,last_name:asc")
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.SortField{
+		{Field: "point_balance", Desc: true},
+		{Field: "last_name"},
+		{Field: "id"},
+	}, sort)
+
+	sort, err = ParseSort("")
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.SortField{{Field: "id", Desc: true}}, sort)
+
+	_, err = ParseSort("password")
+	assert.Equal(t, domain.ErrInvalidSortField, err)
+
+	_, err = ParseSort("email:sideways")
+	assert.Equal(t, domain.ErrInvalidSortField, err)
+}
+
+func TestListUsers_FirstPage(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	users := []*domain.User{{ID: 3}, {ID: 2}, {ID: 1}}
+	mockRepo.On("FindPage", mock.MatchedBy(func(q domain.UserListQuery) bool {
+		return q.Limit == 3 && q.Offset == 0 && q.Cursor == nil
+	})).Return(users, nil)
+	mockRepo.On("Count", domain.UserFilter{}).Return(3, nil)
+
+	page, err := useCase.ListUsers(context.Background(), ListUsersInput{Limit: 2})
+
+	assert.NoError(t, err)
+	assert.Len(t, page.Users, 2)
+	assert.Equal(t, 3, page.Total)
+	assert.NotEmpty(t, page.NextCursor)
+	assert.Empty(t, page.PrevCursor)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestListUsers_CursorRoundTrip(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	first := []*domain.User{{ID: 9, PointBalance: 500}, {ID: 4, PointBalance: 300}, {ID: 7, PointBalance: 100}}
+	mockRepo.On("FindPage", mock.MatchedBy(func(q domain.UserListQuery) bool {
+		return q.Cursor == nil
+	})).Return(first, nil)
+	mockRepo.On("FindPage", mock.MatchedBy(func(q domain.UserListQuery) bool {
+		return q.Cursor != nil && !q.Cursor.Backward &&
+			assert.ObjectsAreEqual([]interface{}{300, 4}, q.Cursor.Values)
+	})).Return([]*domain.User{{ID: 7, PointBalance: 100}}, nil)
+	mockRepo.On("Count", mock.Anything).Return(3, nil)
+
+	page, err := useCase.ListUsers(context.Background(), ListUsersInput{Sort: "-point_balance", Limit: 2})
+	assert.NoError(t, err)
+
+	next, err := useCase.ListUsers(context.Background(), ListUsersInput{Sort: "-point_balance", Limit: 2, Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Len(t, next.Users, 1)
+	assert.Empty(t, next.NextCursor)
+	assert.NotEmpty(t, next.PrevCursor)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestListUsers_CursorFromDifferentSort(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindPage", mock.Anything).Return([]*domain.User{{ID: 2}, {ID: 1}}, nil)
+	mockRepo.On("Count", mock.Anything).Return(2, nil)
+
+	page, err := useCase.ListUsers(context.Background(), ListUsersInput{Limit: 1})
+	assert.NoError(t, err)
+
+	_, err = useCase.ListUsers(context.Background(), ListUsersInput{Sort: "email", Limit: 1, Cursor: page.NextCursor})
+	assert.Equal(t, domain.ErrInvalidCursor, err)
+}
+
+func TestListUsers_InvalidInput(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	min, max := 500, 100
+
+	_, err := useCase.ListUsers(context.Background(), ListUsersInput{Limit: MaxPageSize + 1})
+	assert.Equal(t, domain.ErrInvalidPagination, err)
+
+	_, err = useCase.ListUsers(context.Background(), ListUsersInput{Offset: 10, Cursor: "abc"})
+	assert.Equal(t, domain.ErrInvalidPagination, err)
+
+	_, err = useCase.ListUsers(context.Background(), ListUsersInput{Filter: domain.UserFilter{PointsMin: &min, PointsMax: &max}})
+	assert.Equal(t, domain.ErrInvalidFilter, err)
+
+	_, err = useCase.ListUsers(context.Background(), ListUsersInput{Filter: domain.UserFilter{MemberLevel: "Diamond"}})
+	assert.Equal(t, domain.ErrInvalidMemberLevel, err)
+
+	mockRepo.AssertNotCalled(t, "FindPage", mock.Anything)
+}
+
+func TestSearchUsers_Success(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	expected := []*domain.UserSearchResult{{User: &domain.User{ID: 1, FirstName: "สมชาย"}}}
+	mockRepo.On("Search", "สมชาย", DefaultPageSize).Return(expected, nil)
+
+	results, err := useCase.SearchUsers(context.Background(), "สมชาย", 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, results)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSearchUsers_EmptyQuery(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	results, err := useCase.SearchUsers(context.Background(), "   ", 0)
+
+	assert.Nil(t, results)
+	assert.Equal(t, domain.ErrInvalidSearch, err)
+	mockRepo.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,133 @@
+package usecase
+
+import (
+	"context"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// Optional is a patch field that tells an absent field (Set false) apart from
+// one explicitly given. An explicit null is Set with the zero Value, which
+// resets the field to its default: empty text, zero points, or for
+// MemberLevel the tier the point balance qualifies for.
+type Optional[T any] struct {
+	Set   bool
+	Value T
+}
+
+// Some returns an Optional holding value
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{Set: true, Value: value}
+}
+
+// UserPatch represents a partial update of a user; only set fields change
+type UserPatch struct {
+	FirstName    Optional[string]
+	LastName     Optional[string]
+	Email        Optional[string]
+	Phone        Optional[string]
+	Address      Optional[string]
+	Avatar       Optional[string]
+	MemberLevel  Optional[string]
+	PointBalance Optional[int]
+	// Version is the version the caller last read; 0 skips the check
+	Version int
+}
+
+// PatchUser applies a partial update to an existing user and validates the
+// merged result. As with UpdateUser, each changed group of fields needs its
+// edit permission.
+func (uc *UserUseCase) PatchUser(ctx context.Context, id int, patch UserPatch) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.PatchUser")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorizeAny(domain.PermUsersEditContact, domain.PermUsersEditPoints); err != nil {
+		return nil, err
+	}
+	if id <= 0 {
+		return nil, domain.ErrInvalidUserID
+	}
+
+	// Get existing user
+	user, err := uc.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if patch.Version != 0 && patch.Version != user.Version {
+		return nil, domain.ErrVersionConflict
+	}
+
+	// Resolve member level: an explicit level wins, while a null level or a
+	// point change without one re-derives the tier
+	balance := user.PointBalance
+	if patch.PointBalance.Set {
+		balance = patch.PointBalance.Value
+	}
+	level := user.MemberLevel
+	switch {
+	case patch.MemberLevel.Set && patch.MemberLevel.Value != "":
+		level, err = uc.tiers.Normalize(patch.MemberLevel.Value)
+		if err != nil {
+			return nil, err
+		}
+	case patch.MemberLevel.Set, balance != user.PointBalance:
+		level = uc.tiers.TierFor(balance)
+	}
+
+	emailChanged := patch.Email.Set && patch.Email.Value != user.Email
+
+	// Merge fields
+	before := *user
+	if patch.FirstName.Set {
+		user.FirstName = patch.FirstName.Value
+	}
+	if patch.LastName.Set {
+		user.LastName = patch.LastName.Value
+	}
+	if patch.Email.Set {
+		user.Email = patch.Email.Value
+	}
+	if patch.Phone.Set {
+		user.Phone = patch.Phone.Value
+	}
+	if patch.Address.Set {
+		user.Address = patch.Address.Value
+	}
+	if patch.Avatar.Set {
+		user.Avatar = patch.Avatar.Value
+	}
+	user.MemberLevel = level
+	user.PointBalance = balance
+	user.UpdatedAt = time.Now()
+
+	if err := uc.authorizeChanges(&before, user); err != nil {
+		return nil, err
+	}
+
+	// Validate
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Check the new email is not taken
+	if emailChanged {
+		existing, err := uc.userRepo.FindByEmail(ctx, user.Email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.ID != user.ID {
+			return nil, domain.ErrDuplicateEmail
+		}
+	}
+
+	// Save to repository
+	if err := uc.saveUpdate(ctx, &before, user); err != nil {
+		return nil, err
+	}
+	uc.logSaved("user updated", &before, user)
+
+	return user, nil
+}
@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func existingPatchUser() *domain.User {
+	return &domain.User{
+		ID:           1,
+		FirstName:    "John",
+		LastName:     "Doe",
+		Email:        "john@example.com",
+		Phone:        "0812345678",
+		MemberLevel:  "Silver",
+		PointBalance: 1500,
+	}
+}
+
+func TestPatchUser_OnlySetFieldsChange(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindByID", 1).Return(existingPatchUser(), nil)
+	mockRepo.On("Update", mock.AnythingOfType("*domain.User")).Return(nil)
+
+	user, err := useCase.PatchUser(context.Background(), 1, UserPatch{
+		FirstName: Some("Jane"),
+		Phone:     Some(""),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane", user.FirstName)
+	assert.Equal(t, "Doe", user.LastName)
+	assert.Equal(t, "", user.Phone)
+	assert.Equal(t, 1500, user.PointBalance)
+	assert.Equal(t, "Silver", user.MemberLevel)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPatchUser_ValidatesMergedResult(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindByID", 1).Return(existingPatchUser(), nil)
+
+	user, err := useCase.PatchUser(context.Background(), 1, UserPatch{LastName: Some("")})
+
+	assert.Nil(t, user)
+	assert.Equal(t, domain.ErrLastNameRequired, err)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
+
+func TestPatchUser_NullMemberLevelRederivesTier(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	existing := existingPatchUser()
+	existing.MemberLevel = "Platinum"
+	mockRepo.On("FindByID", 1).Return(existing, nil)
+	mockRepo.On("Update", mock.AnythingOfType("*domain.User")).Return(nil)
+
+	user, err := useCase.PatchUser(context.Background(), 1, UserPatch{MemberLevel: Optional[string]{Set: true}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Silver", user.MemberLevel)
+}
+
+func TestPatchUser_DuplicateEmail(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindByID", 1).Return(existingPatchUser(), nil)
+	mockRepo.On("FindByEmail", "taken@example.com").Return(&domain.User{ID: 2}, nil)
+
+	user, err := useCase.PatchUser(context.Background(), 1, UserPatch{Email: Some("taken@example.com")})
+
+	assert.Nil(t, user)
+	assert.Equal(t, domain.ErrDuplicateEmail, err)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
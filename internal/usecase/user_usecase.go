@@ -1,6 +1,8 @@
 package usecase
 
 import (
+	"context"
+	"log/slog"
 	"time"
 	"workshop_4/internal/domain"
 )
@@ -8,27 +10,156 @@ import (
 // UserUseCase handles user business logic
 type UserUseCase struct {
 	userRepo domain.UserRepository
+	tiers    *TierEngine
+	policy   *AccessPolicy
+	logger   *slog.Logger
+	metrics  BusinessMetrics
+	// actor is the principal calls are checked against once restricted
+	actor      *domain.Principal
+	restricted bool
 }
 
-// NewUserUseCase creates a new user use case
-func NewUserUseCase(userRepo domain.UserRepository) *UserUseCase {
-	return &UserUseCase{
+// UserUseCaseOption configures optional UserUseCase dependencies
+type UserUseCaseOption func(*UserUseCase)
+
+// WithTierEngine sets the tier engine used to assign member levels.
+// Without it the default tiers are used.
+func WithTierEngine(tiers *TierEngine) UserUseCaseOption {
+	return func(uc *UserUseCase) {
+		uc.tiers = tiers
+	}
+}
+
+// WithAccessPolicy sets the policy principals are checked against.
+// Without it the default roles are used.
+func WithAccessPolicy(policy *AccessPolicy) UserUseCaseOption {
+	return func(uc *UserUseCase) {
+		uc.policy = policy
+	}
+}
+
+// WithMetrics sets where business events are counted
+func WithMetrics(metrics BusinessMetrics) UserUseCaseOption {
+	return func(uc *UserUseCase) {
+		uc.metrics = metrics
+	}
+}
+
+// NewUserUseCase creates a new user use case. It acts as the system and is
+// not restricted; use As for calls made on behalf of a caller.
+func NewUserUseCase(userRepo domain.UserRepository, opts ...UserUseCaseOption) *UserUseCase {
+	uc := &UserUseCase{
 		userRepo: userRepo,
+		tiers:    NewDefaultTierEngine(),
+		policy:   NewDefaultAccessPolicy(),
+		logger:   slog.Default(),
+		metrics:  noMetrics{},
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// WithLogger returns a copy of the use case logging to logger, typically
+// one tagged with the request being served
+func (uc *UserUseCase) WithLogger(logger *slog.Logger) *UserUseCase {
+	scoped := *uc
+	scoped.logger = logger
+	return &scoped
+}
+
+// saveUpdate stores the changes of before into user along with their events
+func (uc *UserUseCase) saveUpdate(ctx context.Context, before, user *domain.User) error {
+	return saveWithEvents(ctx, uc.userRepo, func(repo domain.UserRepository) error {
+		return repo.Update(ctx, user)
+	}, func() []*domain.Event {
+		return userSavedEvents(before, user)
+	})
+}
+
+// logSaved records a created or changed user, noting a change of tier
+func (uc *UserUseCase) logSaved(msg string, before, after *domain.User) {
+	uc.logger.Info(msg, "user_id", after.ID, "email", after.Email, "version", after.Version)
+	if before == nil {
+		uc.metrics.UserCreated()
 	}
+	if before != nil && before.MemberLevel != after.MemberLevel {
+		uc.logger.Info("member level changed", "user_id", after.ID, "from", before.MemberLevel, "to", after.MemberLevel)
+		uc.metrics.MemberLevelChanged(before.MemberLevel, after.MemberLevel)
+	}
+}
+
+// As returns a copy of the use case acting for principal, whose every call
+// is checked against the access policy. A nil principal is denied everything.
+func (uc *UserUseCase) As(principal *domain.Principal) *UserUseCase {
+	scoped := *uc
+	scoped.actor = principal
+	scoped.restricted = true
+	return &scoped
+}
+
+// authorize requires every permission of the acting principal
+func (uc *UserUseCase) authorize(permissions ...domain.Permission) error {
+	if !uc.restricted {
+		return nil
+	}
+	return uc.policy.Authorize(uc.actor, permissions...)
+}
+
+// authorizeAny requires one of the permissions of the acting principal
+func (uc *UserUseCase) authorizeAny(permissions ...domain.Permission) error {
+	if !uc.restricted {
+		return nil
+	}
+	return uc.policy.AuthorizeAny(uc.actor, permissions...)
+}
+
+// authorizeChanges requires the edit permissions covering the fields in
+// which after differs from before: contact details need
+// PermUsersEditContact, points and member level PermUsersEditPoints
+func (uc *UserUseCase) authorizeChanges(before, after *domain.User) error {
+	var required []domain.Permission
+	if before.FirstName != after.FirstName || before.LastName != after.LastName ||
+		before.Email != after.Email || before.Phone != after.Phone ||
+		before.Address != after.Address || before.Avatar != after.Avatar {
+		required = append(required, domain.PermUsersEditContact)
+	}
+	if before.PointBalance != after.PointBalance || before.MemberLevel != after.MemberLevel {
+		required = append(required, domain.PermUsersEditPoints)
+	}
+	return uc.authorize(required...)
 }
 
 // GetAllUsers retrieves all users
-func (uc *UserUseCase) GetAllUsers() ([]*domain.User, error) {
-	return uc.userRepo.FindAll()
+func (uc *UserUseCase) GetAllUsers(ctx context.Context) (_ []*domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.GetAllUsers")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	return uc.userRepo.FindAll(ctx)
 }
 
 // GetUserByID retrieves a user by ID
-func (uc *UserUseCase) GetUserByID(id int) (*domain.User, error) {
+func (uc *UserUseCase) GetUserByID(ctx context.Context, id int) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.GetUserByID")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	return uc.findUser(ctx, id)
+}
+
+// findUser loads an active user without an access check
+func (uc *UserUseCase) findUser(ctx context.Context, id int) (*domain.User, error) {
 	if id <= 0 {
 		return nil, domain.ErrInvalidUserID
 	}
 
-	user, err := uc.userRepo.FindByID(id)
+	user, err := uc.userRepo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -51,34 +182,28 @@ type CreateUserInput struct {
 	PointBalance int
 }
 
-// CreateUser creates a new user
-func (uc *UserUseCase) CreateUser(input CreateUserInput) (*domain.User, error) {
-	// Set defaults
-	if input.MemberLevel == "" {
-		input.MemberLevel = "Bronze"
-	}
+// CreateUser creates a new user. An opening balance or an explicit member
+// level also needs PermUsersEditPoints.
+func (uc *UserUseCase) CreateUser(ctx context.Context, input CreateUserInput) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.CreateUser")
+	defer func() { endSpan(span, err) }()
 
-	// Create user entity
-	user := &domain.User{
-		FirstName:    input.FirstName,
-		LastName:     input.LastName,
-		Email:        input.Email,
-		Phone:        input.Phone,
-		Address:      input.Address,
-		Avatar:       input.Avatar,
-		MemberLevel:  input.MemberLevel,
-		PointBalance: input.PointBalance,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+	if err := uc.authorize(domain.PermUsersCreate); err != nil {
+		return nil, err
+	}
+	if input.PointBalance != 0 || input.MemberLevel != "" {
+		if err := uc.authorize(domain.PermUsersEditPoints); err != nil {
+			return nil, err
+		}
 	}
 
-	// Validate
-	if err := user.Validate(); err != nil {
+	user, err := newUser(uc.tiers, input)
+	if err != nil {
 		return nil, err
 	}
 
 	// Check if email already exists
-	existing, err := uc.userRepo.FindByEmail(input.Email)
+	existing, err := uc.userRepo.FindByEmail(ctx, input.Email)
 	if err != nil {
 		return nil, err
 	}
@@ -87,13 +212,52 @@ func (uc *UserUseCase) CreateUser(input CreateUserInput) (*domain.User, error) {
 	}
 
 	// Save to repository
-	if err := uc.userRepo.Create(user); err != nil {
+	err = saveWithEvents(ctx, uc.userRepo, func(repo domain.UserRepository) error {
+		return repo.Create(ctx, user)
+	}, func() []*domain.Event {
+		return userSavedEvents(nil, user)
+	})
+	if err != nil {
 		return nil, err
 	}
+	uc.logSaved("user created", nil, user)
 
 	return user, nil
 }
 
+// newUser builds and validates the user described by input. An explicit
+// member level must be a known tier; otherwise the tier follows the opening
+// point balance.
+func newUser(tiers *TierEngine, input CreateUserInput) (*domain.User, error) {
+	if input.MemberLevel != "" {
+		level, err := tiers.Normalize(input.MemberLevel)
+		if err != nil {
+			return nil, err
+		}
+		input.MemberLevel = level
+	} else {
+		input.MemberLevel = tiers.TierFor(input.PointBalance)
+	}
+
+	now := time.Now()
+	user := &domain.User{
+		FirstName:    input.FirstName,
+		LastName:     input.LastName,
+		Email:        input.Email,
+		Phone:        input.Phone,
+		Address:      input.Address,
+		Avatar:       input.Avatar,
+		MemberLevel:  input.MemberLevel,
+		PointBalance: input.PointBalance,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // UpdateUserInput represents input for updating a user
 type UpdateUserInput struct {
 	FirstName    string
@@ -104,61 +268,215 @@ type UpdateUserInput struct {
 	Avatar       string
 	MemberLevel  string
 	PointBalance int
+	// Version is the version the caller last read; 0 skips the check
+	Version int
 }
 
-// UpdateUser updates an existing user
-func (uc *UserUseCase) UpdateUser(id int, input UpdateUserInput) (*domain.User, error) {
+// UpdateUser updates an existing user. The caller needs the edit
+// permission of every group of fields that actually changes.
+func (uc *UserUseCase) UpdateUser(ctx context.Context, id int, input UpdateUserInput) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.UpdateUser")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorizeAny(domain.PermUsersEditContact, domain.PermUsersEditPoints); err != nil {
+		return nil, err
+	}
 	if id <= 0 {
 		return nil, domain.ErrInvalidUserID
 	}
 
 	// Get existing user
-	user, err := uc.userRepo.FindByID(id)
+	user, err := uc.userRepo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if user == nil {
 		return nil, domain.ErrUserNotFound
 	}
+	if input.Version != 0 && input.Version != user.Version {
+		return nil, domain.ErrVersionConflict
+	}
+
+	// Resolve member level: an explicit change of level wins, otherwise the
+	// tier is recalculated whenever the point balance changes
+	level := user.MemberLevel
+	if input.MemberLevel != "" {
+		level, err = uc.tiers.Normalize(input.MemberLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if level == user.MemberLevel && (input.PointBalance != user.PointBalance || level == "") {
+		level = uc.tiers.TierFor(input.PointBalance)
+	}
 
 	// Update fields
+	before := *user
 	user.FirstName = input.FirstName
 	user.LastName = input.LastName
 	user.Email = input.Email
 	user.Phone = input.Phone
 	user.Address = input.Address
 	user.Avatar = input.Avatar
-	user.MemberLevel = input.MemberLevel
+	user.MemberLevel = level
 	user.PointBalance = input.PointBalance
 	user.UpdatedAt = time.Now()
 
+	if err := uc.authorizeChanges(&before, user); err != nil {
+		return nil, err
+	}
+
 	// Validate
 	if err := user.Validate(); err != nil {
 		return nil, err
 	}
 
 	// Save to repository
-	if err := uc.userRepo.Update(user); err != nil {
+	if err := uc.saveUpdate(ctx, &before, user); err != nil {
 		return nil, err
 	}
+	uc.logSaved("user updated", &before, user)
 
 	return user, nil
 }
 
-// DeleteUser deletes a user by ID
-func (uc *UserUseCase) DeleteUser(id int) error {
+// DeleteUser deletes a user by ID. A non-zero version must match the
+// stored version.
+func (uc *UserUseCase) DeleteUser(ctx context.Context, id int, version int) (err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.DeleteUser")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersDelete); err != nil {
+		return err
+	}
 	if id <= 0 {
 		return domain.ErrInvalidUserID
 	}
 
 	// Check if user exists
-	user, err := uc.userRepo.FindByID(id)
+	user, err := uc.userRepo.FindByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if user == nil {
 		return domain.ErrUserNotFound
 	}
+	if version == 0 {
+		version = user.Version
+	}
+	if version != user.Version {
+		return domain.ErrVersionConflict
+	}
+
+	err = saveWithEvents(ctx, uc.userRepo, func(repo domain.UserRepository) error {
+		return repo.Delete(ctx, id, version)
+	}, func() []*domain.Event {
+		return []*domain.Event{newUserEvent(domain.EventUserDeleted, user, userEventData{})}
+	})
+	if err != nil {
+		return err
+	}
+	uc.logger.Info("user deleted", "user_id", id)
+	uc.metrics.UserDeleted()
+	return nil
+}
+
+// GetDeletedUserByID retrieves a soft-deleted user by ID
+func (uc *UserUseCase) GetDeletedUserByID(ctx context.Context, id int) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.GetDeletedUserByID")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersReadDeleted); err != nil {
+		return nil, err
+	}
+	return uc.findDeletedUser(ctx, id)
+}
+
+// findDeletedUser loads a soft-deleted user without an access check
+func (uc *UserUseCase) findDeletedUser(ctx context.Context, id int) (*domain.User, error) {
+	if id <= 0 {
+		return nil, domain.ErrInvalidUserID
+	}
 
-	return uc.userRepo.Delete(id)
+	user, err := uc.userRepo.FindDeletedByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// RestoreUser undoes a soft delete. A non-zero version must match the stored
+// version. The email must not have been taken by another user in the meantime.
+func (uc *UserUseCase) RestoreUser(ctx context.Context, id int, version int) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.RestoreUser")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersDelete); err != nil {
+		return nil, err
+	}
+
+	user, err := uc.findDeletedUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		version = user.Version
+	}
+	if version != user.Version {
+		return nil, domain.ErrVersionConflict
+	}
+
+	existing, err := uc.userRepo.FindByEmail(ctx, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, domain.ErrDuplicateEmail
+	}
+
+	var restored *domain.User
+	err = saveWithEvents(ctx, uc.userRepo, func(repo domain.UserRepository) error {
+		if err := repo.Restore(ctx, id, version); err != nil {
+			return err
+		}
+		restored, err = repo.FindByID(ctx, id)
+		if err == nil && restored == nil {
+			err = domain.ErrUserNotFound
+		}
+		return err
+	}, func() []*domain.Event {
+		return []*domain.Event{newUserEvent(domain.EventUserRestored, restored, userEventData{})}
+	})
+	if err != nil {
+		return nil, err
+	}
+	uc.logger.Info("user restored", "user_id", id)
+	uc.metrics.UserRestored()
+
+	return restored, nil
+}
+
+// PurgeDeletedUsers permanently removes users soft-deleted before the given
+// time and returns how many were removed
+func (uc *UserUseCase) PurgeDeletedUsers(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.PurgeDeletedUsers")
+	defer func() { endSpan(span, err) }()
+
+	if err := uc.authorize(domain.PermUsersDelete); err != nil {
+		return 0, err
+	}
+
+	purged, err := uc.userRepo.Purge(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		uc.logger.Info("purged deleted users", "count", purged, "deleted_before", before)
+		uc.metrics.UsersPurged(purged)
+	}
+	return purged, nil
 }
@@ -1,6 +1,7 @@
 package usecase
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -13,9 +14,11 @@ import (
 // MockUserRepository is a mock implementation of domain.UserRepository
 type MockUserRepository struct {
 	mock.Mock
+	// events holds what AppendEvents recorded
+	events []*domain.Event
 }
 
-func (m *MockUserRepository) FindAll() ([]*domain.User, error) {
+func (m *MockUserRepository) FindAll(_ context.Context) ([]*domain.User, error) {
 	args := m.Called()
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -23,7 +26,20 @@ func (m *MockUserRepository) FindAll() ([]*domain.User, error) {
 	return args.Get(0).([]*domain.User), args.Error(1)
 }
 
-func (m *MockUserRepository) FindByID(id int) (*domain.User, error) {
+func (m *MockUserRepository) FindPage(_ context.Context, query domain.UserListQuery) ([]*domain.User, error) {
+	args := m.Called(query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) Count(_ context.Context, filter domain.UserFilter) (int, error) {
+	args := m.Called(filter)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockUserRepository) FindByID(_ context.Context, id int) (*domain.User, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -31,7 +47,7 @@ func (m *MockUserRepository) FindByID(id int) (*domain.User, error) {
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
-func (m *MockUserRepository) FindByEmail(email string) (*domain.User, error) {
+func (m *MockUserRepository) FindByEmail(_ context.Context, email string) (*domain.User, error) {
 	args := m.Called(email)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -39,21 +55,87 @@ func (m *MockUserRepository) FindByEmail(email string) (*domain.User, error) {
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
-func (m *MockUserRepository) Create(user *domain.User) error {
+func (m *MockUserRepository) Search(_ context.Context, query string, limit int) ([]*domain.UserSearchResult, error) {
+	args := m.Called(query, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.UserSearchResult), args.Error(1)
+}
+
+func (m *MockUserRepository) Create(_ context.Context, user *domain.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) Update(user *domain.User) error {
+func (m *MockUserRepository) CreateBatch(_ context.Context, users []*domain.User) ([]error, error) {
+	args := m.Called(users)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]error), args.Error(1)
+}
+
+func (m *MockUserRepository) ExistingEmails(_ context.Context, emails []string) (map[string]bool, error) {
+	args := m.Called(emails)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]bool), args.Error(1)
+}
+
+// Each calls fn with the users it is set up to return
+func (m *MockUserRepository) Each(_ context.Context, filter domain.UserFilter, sort []domain.SortField, fn func(*domain.User) error) error {
+	args := m.Called(filter, sort)
+	if users, ok := args.Get(0).([]*domain.User); ok {
+		for _, user := range users {
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+// InTransaction runs fn on the mock itself, which has no transactions
+func (m *MockUserRepository) InTransaction(_ context.Context, fn func(domain.UserRepository) error) error {
+	return fn(m)
+}
+
+// AppendEvents keeps the events for tests to inspect
+func (m *MockUserRepository) AppendEvents(_ context.Context, events ...*domain.Event) error {
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *MockUserRepository) Update(_ context.Context, user *domain.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) Delete(id int) error {
+func (m *MockUserRepository) Delete(_ context.Context, id int, version int) error {
+	args := m.Called(id, version)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) FindDeletedByID(_ context.Context, id int) (*domain.User, error) {
 	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) Restore(_ context.Context, id int, version int) error {
+	args := m.Called(id, version)
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) Purge(_ context.Context, before time.Time) (int, error) {
+	args := m.Called(before)
+	return args.Int(0), args.Error(1)
+}
+
 func TestGetAllUsers_Success(t *testing.T) {
 	mockRepo := new(MockUserRepository)
 	useCase := NewUserUseCase(mockRepo)
@@ -74,7 +156,7 @@ func TestGetAllUsers_Success(t *testing.T) {
 
 	mockRepo.On("FindAll").Return(expectedUsers, nil)
 
-	users, err := useCase.GetAllUsers()
+	users, err := useCase.GetAllUsers(context.Background())
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedUsers, users)
@@ -88,7 +170,7 @@ func TestGetAllUsers_Error(t *testing.T) {
 	expectedError := errors.New("database error")
 	mockRepo.On("FindAll").Return(nil, expectedError)
 
-	users, err := useCase.GetAllUsers()
+	users, err := useCase.GetAllUsers(context.Background())
 
 	assert.Error(t, err)
 	assert.Nil(t, users)
@@ -114,7 +196,7 @@ func TestGetUserByID_Success(t *testing.T) {
 
 	mockRepo.On("FindByID", 1).Return(expectedUser, nil)
 
-	user, err := useCase.GetUserByID(1)
+	user, err := useCase.GetUserByID(context.Background(), 1)
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedUser, user)
@@ -127,7 +209,7 @@ func TestGetUserByID_NotFound(t *testing.T) {
 
 	mockRepo.On("FindByID", 999).Return(nil, domain.ErrUserNotFound)
 
-	user, err := useCase.GetUserByID(999)
+	user, err := useCase.GetUserByID(context.Background(), 999)
 
 	assert.Error(t, err)
 	assert.Nil(t, user)
@@ -153,7 +235,7 @@ func TestCreateUser_Success(t *testing.T) {
 		user.ID = 1
 	})
 
-	user, err := useCase.CreateUser(input)
+	user, err := useCase.CreateUser(context.Background(), input)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
@@ -174,7 +256,7 @@ func TestCreateUser_MissingFirstName(t *testing.T) {
 		Email:    "john@example.com",
 	}
 
-	user, err := useCase.CreateUser(input)
+	user, err := useCase.CreateUser(context.Background(), input)
 
 	assert.Error(t, err)
 	assert.Nil(t, user)
@@ -190,7 +272,7 @@ func TestCreateUser_MissingLastName(t *testing.T) {
 		Email:     "john@example.com",
 	}
 
-	user, err := useCase.CreateUser(input)
+	user, err := useCase.CreateUser(context.Background(), input)
 
 	assert.Error(t, err)
 	assert.Nil(t, user)
@@ -206,7 +288,7 @@ func TestCreateUser_MissingEmail(t *testing.T) {
 		LastName:  "Doe",
 	}
 
-	user, err := useCase.CreateUser(input)
+	user, err := useCase.CreateUser(context.Background(), input)
 
 	assert.Error(t, err)
 	assert.Nil(t, user)
@@ -230,7 +312,7 @@ func TestCreateUser_DuplicateEmail(t *testing.T) {
 
 	mockRepo.On("FindByEmail", input.Email).Return(existingUser, nil)
 
-	user, err := useCase.CreateUser(input)
+	user, err := useCase.CreateUser(context.Background(), input)
 
 	assert.Error(t, err)
 	assert.Nil(t, user)
@@ -266,7 +348,7 @@ func TestUpdateUser_Success(t *testing.T) {
 	mockRepo.On("FindByID", 1).Return(existingUser, nil)
 	mockRepo.On("Update", mock.AnythingOfType("*domain.User")).Return(nil)
 
-	user, err := useCase.UpdateUser(1, input)
+	user, err := useCase.UpdateUser(context.Background(), 1, input)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
@@ -289,7 +371,7 @@ func TestUpdateUser_NotFound(t *testing.T) {
 
 	mockRepo.On("FindByID", 999).Return(nil, domain.ErrUserNotFound)
 
-	user, err := useCase.UpdateUser(999, input)
+	user, err := useCase.UpdateUser(context.Background(), 999, input)
 
 	assert.Error(t, err)
 	assert.Nil(t, user)
@@ -309,12 +391,13 @@ func TestDeleteUser_Success(t *testing.T) {
 		Email:     "john@example.com",
 		CreatedAt: now,
 		UpdatedAt: now,
+		Version:   3,
 	}
 
 	mockRepo.On("FindByID", 1).Return(existingUser, nil)
-	mockRepo.On("Delete", 1).Return(nil)
+	mockRepo.On("Delete", 1, 3).Return(nil)
 
-	err := useCase.DeleteUser(1)
+	err := useCase.DeleteUser(context.Background(), 1, 3)
 
 	assert.NoError(t, err)
 	mockRepo.AssertExpectations(t)
@@ -326,7 +409,7 @@ func TestDeleteUser_NotFound(t *testing.T) {
 
 	mockRepo.On("FindByID", 999).Return(nil, domain.ErrUserNotFound)
 
-	err := useCase.DeleteUser(999)
+	err := useCase.DeleteUser(context.Background(), 999, 0)
 
 	assert.Error(t, err)
 
@@ -334,3 +417,156 @@ func TestDeleteUser_NotFound(t *testing.T) {
 	assert.Equal(t, domain.ErrUserNotFound, err)
 	mockRepo.AssertExpectations(t)
 }
+
+func TestCreateUser_InvalidMemberLevel(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	input := CreateUserInput{
+		FirstName:   "John",
+		LastName:    "Doe",
+		Email:       "john@example.com",
+		MemberLevel: "Diamond",
+	}
+
+	user, err := useCase.CreateUser(context.Background(), input)
+
+	assert.Nil(t, user)
+	assert.Equal(t, domain.ErrInvalidMemberLevel, err)
+}
+
+func TestCreateUser_TierFromOpeningBalance(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	input := CreateUserInput{
+		FirstName:    "John",
+		LastName:     "Doe",
+		Email:        "john@example.com",
+		PointBalance: 6000,
+	}
+
+	mockRepo.On("FindByEmail", input.Email).Return(nil, nil)
+	mockRepo.On("Create", mock.AnythingOfType("*domain.User")).Return(nil)
+
+	user, err := useCase.CreateUser(context.Background(), input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Gold", user.MemberLevel)
+}
+
+func TestUpdateUser_PointChangeRecalculatesTier(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	tiers, _ := NewTierEngine([]Tier{{Name: "Member", MinPoints: 0}, {Name: "VIP", MinPoints: 500}})
+	useCase := NewUserUseCase(mockRepo, WithTierEngine(tiers))
+
+	existingUser := &domain.User{
+		ID:           1,
+		FirstName:    "John",
+		LastName:     "Doe",
+		Email:        "john@example.com",
+		MemberLevel:  "VIP",
+		PointBalance: 800,
+	}
+
+	input := UpdateUserInput{
+		FirstName:    "John",
+		LastName:     "Doe",
+		Email:        "john@example.com",
+		MemberLevel:  "VIP",
+		PointBalance: 100,
+	}
+
+	mockRepo.On("FindByID", 1).Return(existingUser, nil)
+	mockRepo.On("Update", mock.AnythingOfType("*domain.User")).Return(nil)
+
+	user, err := useCase.UpdateUser(context.Background(), 1, input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Member", user.MemberLevel)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateUser_VersionConflict(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	existingUser := &domain.User{
+		ID:        1,
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "john@example.com",
+		Version:   4,
+	}
+
+	mockRepo.On("FindByID", 1).Return(existingUser, nil)
+
+	user, err := useCase.UpdateUser(context.Background(), 1, UpdateUserInput{FirstName: "Jane", LastName: "Doe", Email: "john@example.com", Version: 3})
+
+	assert.Nil(t, user)
+	assert.Equal(t, domain.ErrVersionConflict, err)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
+
+func TestDeleteUser_VersionConflict(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindByID", 1).Return(&domain.User{ID: 1, Version: 2}, nil)
+
+	err := useCase.DeleteUser(context.Background(), 1, 1)
+
+	assert.Equal(t, domain.ErrVersionConflict, err)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
+func TestRestoreUser_Success(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	deletedAt := time.Now()
+	deleted := &domain.User{ID: 1, Email: "john@example.com", Version: 4, DeletedAt: &deletedAt}
+	restored := &domain.User{ID: 1, Email: "john@example.com", Version: 5}
+
+	mockRepo.On("FindDeletedByID", 1).Return(deleted, nil)
+	mockRepo.On("FindByEmail", "john@example.com").Return(nil, nil)
+	mockRepo.On("Restore", 1, 4).Return(nil)
+	mockRepo.On("FindByID", 1).Return(restored, nil)
+
+	user, err := useCase.RestoreUser(context.Background(), 1, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, user.Version)
+	assert.False(t, user.IsDeleted())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRestoreUser_EmailTaken(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	deletedAt := time.Now()
+	deleted := &domain.User{ID: 1, Email: "john@example.com", Version: 4, DeletedAt: &deletedAt}
+
+	mockRepo.On("FindDeletedByID", 1).Return(deleted, nil)
+	mockRepo.On("FindByEmail", "john@example.com").Return(&domain.User{ID: 2, Email: "john@example.com"}, nil)
+
+	user, err := useCase.RestoreUser(context.Background(), 1, 4)
+
+	assert.Nil(t, user)
+	assert.Equal(t, domain.ErrDuplicateEmail, err)
+	mockRepo.AssertNotCalled(t, "Restore", 1, 4)
+}
+
+func TestRestoreUser_NotDeleted(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	useCase := NewUserUseCase(mockRepo)
+
+	mockRepo.On("FindDeletedByID", 1).Return(nil, nil)
+
+	user, err := useCase.RestoreUser(context.Background(), 1, 0)
+
+	assert.Nil(t, user)
+	assert.Equal(t, domain.ErrUserNotFound, err)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,449 @@
+package usecase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"workshop_4/internal/domain"
+)
+
+// Webhook request headers
+const (
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookDelivery  = "X-Webhook-Delivery"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	// HeaderWebhookSignature carries "sha256=" and the hex HMAC-SHA256,
+	// keyed with the subscription's secret, of the timestamp, a dot and the
+	// body
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+const (
+	// webhookSecretPrefix starts every webhook signing secret
+	webhookSecretPrefix = "whsec_"
+	// webhookBatchSize bounds the events fanned out and the deliveries
+	// attempted per dispatch
+	webhookBatchSize = 100
+	// webhookConcurrency bounds the deliveries attempted at once
+	webhookConcurrency = 4
+	// webhookMaxBackoff caps the wait between two attempts
+	webhookMaxBackoff = 6 * time.Hour
+	// webhookMaxErrorLength bounds the error kept with a failed attempt
+	webhookMaxErrorLength = 500
+	// MaxWebhookDeliveries bounds the deliveries listed at once
+	MaxWebhookDeliveries = 100
+)
+
+// WebhookSender posts a delivery to a subscriber's endpoint
+type WebhookSender interface {
+	// Send posts body with the headers to url and returns the response
+	// status. An error means no response was received.
+	Send(ctx context.Context, url string, headers map[string]string, body []byte) (int, error)
+}
+
+// WebhookUseCase manages webhook subscriptions and delivers outbox events
+// to them
+type WebhookUseCase struct {
+	repo   domain.WebhookRepository
+	sender WebhookSender
+	policy *AccessPolicy
+	logger *slog.Logger
+	// actor is the principal calls are checked against once restricted
+	actor      *domain.Principal
+	restricted bool
+	// maxAttempts is how many times a delivery is tried before it is dead
+	maxAttempts int
+	// retryBase is the wait after the first failed attempt, doubled after
+	// each further one
+	retryBase time.Duration
+}
+
+// WebhookUseCaseOption configures optional WebhookUseCase dependencies
+type WebhookUseCaseOption func(*WebhookUseCase)
+
+// WithWebhookAccessPolicy sets the policy principals are checked against.
+// Without it the default roles are used.
+func WithWebhookAccessPolicy(policy *AccessPolicy) WebhookUseCaseOption {
+	return func(uc *WebhookUseCase) {
+		uc.policy = policy
+	}
+}
+
+// WithWebhookRetries sets how many times a delivery is tried and the wait
+// after its first failure. The defaults are 8 attempts and 30 seconds.
+func WithWebhookRetries(maxAttempts int, base time.Duration) WebhookUseCaseOption {
+	return func(uc *WebhookUseCase) {
+		uc.maxAttempts = maxAttempts
+		uc.retryBase = base
+	}
+}
+
+// NewWebhookUseCase creates a new webhook use case acting as the system; use
+// As for calls made on behalf of a caller
+func NewWebhookUseCase(repo domain.WebhookRepository, sender WebhookSender, opts ...WebhookUseCaseOption) *WebhookUseCase {
+	uc := &WebhookUseCase{
+		repo:        repo,
+		sender:      sender,
+		policy:      NewDefaultAccessPolicy(),
+		logger:      slog.Default(),
+		maxAttempts: 8,
+		retryBase:   30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// WithLogger returns a copy of the use case logging to logger, typically
+// one tagged with the request being served
+func (uc *WebhookUseCase) WithLogger(logger *slog.Logger) *WebhookUseCase {
+	scoped := *uc
+	scoped.logger = logger
+	return &scoped
+}
+
+// As returns a copy of the use case acting for principal, whose every call
+// is checked against the access policy
+func (uc *WebhookUseCase) As(principal *domain.Principal) *WebhookUseCase {
+	scoped := *uc
+	scoped.actor = principal
+	scoped.restricted = true
+	return &scoped
+}
+
+// authorize requires every permission of the acting principal
+func (uc *WebhookUseCase) authorize(permissions ...domain.Permission) error {
+	if !uc.restricted {
+		return nil
+	}
+	return uc.policy.Authorize(uc.actor, permissions...)
+}
+
+// CreateWebhookInput represents input for subscribing a webhook
+type CreateWebhookInput struct {
+	URL string
+	// EventTypes are the events to deliver; none means every event
+	EventTypes  []string
+	Description string
+}
+
+// CreateSubscription subscribes an endpoint to events. The subscription is
+// returned with the secret its deliveries are signed with.
+func (uc *WebhookUseCase) CreateSubscription(ctx context.Context, input CreateWebhookInput) (*domain.WebhookSubscription, error) {
+	if err := uc.authorize(domain.PermWebhooksManage); err != nil {
+		return nil, err
+	}
+
+	sub := &domain.WebhookSubscription{
+		URL:         strings.TrimSpace(input.URL),
+		EventTypes:  uniqueEventTypes(input.EventTypes),
+		Description: strings.TrimSpace(input.Description),
+		CreatedAt:   time.Now(),
+	}
+	if uc.actor != nil {
+		sub.CreatedBy = uc.actor.Subject
+	}
+	if err := sub.Validate(); err != nil {
+		return nil, err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = secret
+
+	if err := uc.repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	uc.logger.Info("webhook subscribed", "webhook_id", sub.ID, "url", sub.URL, "event_types", sub.EventTypes, "created_by", sub.CreatedBy)
+	return sub, nil
+}
+
+// ListSubscriptions returns every webhook subscription
+func (uc *WebhookUseCase) ListSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	if err := uc.authorize(domain.PermWebhooksManage); err != nil {
+		return nil, err
+	}
+	return uc.repo.FindSubscriptions(ctx)
+}
+
+// GetSubscription returns a webhook subscription by ID
+func (uc *WebhookUseCase) GetSubscription(ctx context.Context, id int) (*domain.WebhookSubscription, error) {
+	if err := uc.authorize(domain.PermWebhooksManage); err != nil {
+		return nil, err
+	}
+	return uc.findSubscription(ctx, id)
+}
+
+// findSubscription loads a subscription without an access check
+func (uc *WebhookUseCase) findSubscription(ctx context.Context, id int) (*domain.WebhookSubscription, error) {
+	sub, err := uc.repo.FindSubscriptionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, domain.ErrWebhookNotFound
+	}
+	return sub, nil
+}
+
+// DeleteSubscription unsubscribes a webhook; its pending deliveries are
+// dropped
+func (uc *WebhookUseCase) DeleteSubscription(ctx context.Context, id int) error {
+	if err := uc.authorize(domain.PermWebhooksManage); err != nil {
+		return err
+	}
+	if err := uc.repo.DeleteSubscription(ctx, id); err != nil {
+		return err
+	}
+	uc.logger.Info("webhook unsubscribed", "webhook_id", id)
+	return nil
+}
+
+// ListDeliveries returns up to limit of a subscription's deliveries, newest
+// first, only those in status unless it is empty
+func (uc *WebhookUseCase) ListDeliveries(ctx context.Context, subscriptionID int, status string, limit int) ([]*domain.WebhookDelivery, error) {
+	if err := uc.authorize(domain.PermWebhooksManage); err != nil {
+		return nil, err
+	}
+	if _, err := uc.findSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxWebhookDeliveries {
+		limit = MaxWebhookDeliveries
+	}
+	return uc.repo.FindDeliveries(ctx, subscriptionID, status, limit)
+}
+
+// ReplayDelivery queues a delivery of the subscription to be sent again
+// right away, whatever its state, with a fresh set of attempts
+func (uc *WebhookUseCase) ReplayDelivery(ctx context.Context, subscriptionID, deliveryID int) (*domain.WebhookDelivery, error) {
+	if err := uc.authorize(domain.PermWebhooksManage); err != nil {
+		return nil, err
+	}
+
+	delivery, err := uc.repo.FindDeliveryByID(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil || delivery.SubscriptionID != subscriptionID {
+		return nil, domain.ErrWebhookDeliveryNotFound
+	}
+	if err := uc.repo.RequeueDelivery(ctx, deliveryID, time.Now()); err != nil {
+		return nil, err
+	}
+	uc.logger.Info("webhook delivery replayed", "webhook_id", subscriptionID, "delivery_id", deliveryID)
+
+	return uc.repo.FindDeliveryByID(ctx, deliveryID)
+}
+
+// ReplayDeadDeliveries queues every dead delivery of the subscription to be
+// sent again and returns how many there were
+func (uc *WebhookUseCase) ReplayDeadDeliveries(ctx context.Context, subscriptionID int) (int, error) {
+	if err := uc.authorize(domain.PermWebhooksManage); err != nil {
+		return 0, err
+	}
+	if _, err := uc.findSubscription(ctx, subscriptionID); err != nil {
+		return 0, err
+	}
+
+	requeued, err := uc.repo.RequeueDeadDeliveries(ctx, subscriptionID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	uc.logger.Info("dead webhook deliveries replayed", "webhook_id", subscriptionID, "count", requeued)
+	return requeued, nil
+}
+
+// DispatchWebhooks fans new outbox events out to the subscriptions that
+// want them and attempts the deliveries that are due. A failed attempt is
+// retried with exponential backoff until the delivery runs out of attempts
+// and is dead. It returns how many deliveries succeeded.
+func (uc *WebhookUseCase) DispatchWebhooks(ctx context.Context) (_ int, err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.DispatchWebhooks")
+	defer func() { endSpan(span, err) }()
+
+	for {
+		enqueued, err := uc.repo.EnqueueDeliveries(ctx, time.Now(), webhookBatchSize)
+		if err != nil {
+			return 0, err
+		}
+		if enqueued < webhookBatchSize {
+			break
+		}
+	}
+
+	due, err := uc.repo.FindDueDeliveries(ctx, time.Now(), webhookBatchSize)
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	subs := make(map[int]*domain.WebhookSubscription)
+	for _, delivery := range due {
+		if _, ok := subs[delivery.SubscriptionID]; ok {
+			continue
+		}
+		sub, err := uc.findSubscription(ctx, delivery.SubscriptionID)
+		if err != nil {
+			return 0, err
+		}
+		subs[sub.ID] = sub
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		delivered int
+		firstErr  error
+	)
+	slots := make(chan struct{}, webhookConcurrency)
+	for _, delivery := range due {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(delivery *domain.WebhookDelivery) {
+			defer func() { <-slots; wg.Done() }()
+
+			uc.attempt(ctx, subs[delivery.SubscriptionID], delivery)
+			err := uc.repo.UpdateDelivery(ctx, delivery)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if err == nil && delivery.Status == domain.DeliveryDelivered {
+				delivered++
+			}
+		}(delivery)
+	}
+	wg.Wait()
+	return delivered, firstErr
+}
+
+// PruneDeliveredEvents deletes the outbox events created before the given
+// time once every delivery of theirs has succeeded, with those deliveries,
+// and returns how many events were deleted. Events with a pending or dead
+// delivery are kept for retries and replays.
+func (uc *WebhookUseCase) PruneDeliveredEvents(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.PruneDeliveredEvents")
+	defer func() { endSpan(span, err) }()
+
+	deleted, err := uc.repo.DeleteDeliveredEvents(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	if deleted > 0 {
+		uc.logger.Info("pruned delivered events", "count", deleted, "created_before", before)
+	}
+	return deleted, nil
+}
+
+// attempt sends a delivery once and records the outcome on it: delivered on
+// a 2xx response, otherwise pending until the next attempt or dead after the
+// last one
+func (uc *WebhookUseCase) attempt(ctx context.Context, sub *domain.WebhookSubscription, delivery *domain.WebhookDelivery) {
+	body, headers := webhookRequest(sub, delivery, time.Now())
+	status, err := uc.sender.Send(ctx, sub.URL, headers, body)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = status
+	delivery.LastError = ""
+	if err == nil && status >= 200 && status < 300 {
+		delivery.Status = domain.DeliveryDelivered
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	if err != nil {
+		delivery.LastError = err.Error()
+	} else {
+		delivery.LastError = fmt.Sprintf("endpoint responded %d", status)
+	}
+	if len(delivery.LastError) > webhookMaxErrorLength {
+		delivery.LastError = delivery.LastError[:webhookMaxErrorLength]
+	}
+
+	if delivery.Attempts >= uc.maxAttempts {
+		delivery.Status = domain.DeliveryDead
+		delivery.NextAttemptAt = nil
+		uc.logger.Warn("webhook delivery dead", "webhook_id", sub.ID, "delivery_id", delivery.ID, "event_id", delivery.Event.ID, "attempts", delivery.Attempts, "error", delivery.LastError)
+		return
+	}
+	next := now.Add(webhookBackoff(uc.retryBase, delivery.Attempts))
+	delivery.Status = domain.DeliveryPending
+	delivery.NextAttemptAt = &next
+	uc.logger.Info("webhook delivery failed", "webhook_id", sub.ID, "delivery_id", delivery.ID, "attempts", delivery.Attempts, "next_attempt_at", next, "error", delivery.LastError)
+}
+
+// webhookBackoff returns the wait after the given number of failed
+// attempts: base, doubled after each further failure, up to
+// webhookMaxBackoff
+func webhookBackoff(base time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return wait
+}
+
+// webhookRequest builds the signed body and headers of a delivery
+func webhookRequest(sub *domain.WebhookSubscription, delivery *domain.WebhookDelivery, now time.Time) ([]byte, map[string]string) {
+	body := MarshalEvent(delivery.Event)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	return body, map[string]string{
+		HeaderWebhookEvent:     delivery.Event.Type,
+		HeaderWebhookDelivery:  strconv.Itoa(delivery.ID),
+		HeaderWebhookTimestamp: timestamp,
+		HeaderWebhookSignature: SignWebhook(sub.Secret, timestamp, body),
+	}
+}
+
+// SignWebhook returns the X-Webhook-Signature value of a body sent at
+// timestamp. Receivers recompute it with their secret to verify a delivery.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateWebhookSecret returns a prefixed secret with 256 bits of entropy
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// uniqueEventTypes trims event types and drops repeated and empty ones,
+// keeping the first occurrence's order
+func uniqueEventTypes(eventTypes []string) []string {
+	seen := make(map[string]bool, len(eventTypes))
+	var unique []string
+	for _, eventType := range eventTypes {
+		eventType = strings.TrimSpace(eventType)
+		if eventType != "" && !seen[eventType] {
+			seen[eventType] = true
+			unique = append(unique, eventType)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,189 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWebhookRepository holds one subscription and its due deliveries; the
+// methods dispatching does not use are left to the embedded nil interface
+type fakeWebhookRepository struct {
+	domain.WebhookRepository
+	sub      *domain.WebhookSubscription
+	due      []*domain.WebhookDelivery
+	enqueued int
+	updated  []domain.WebhookDelivery
+}
+
+func (r *fakeWebhookRepository) EnqueueDeliveries(_ context.Context, _ time.Time, _ int) (int, error) {
+	r.enqueued++
+	return 0, nil
+}
+
+func (r *fakeWebhookRepository) FindDueDeliveries(_ context.Context, _ time.Time, _ int) ([]*domain.WebhookDelivery, error) {
+	return r.due, nil
+}
+
+func (r *fakeWebhookRepository) FindSubscriptionByID(_ context.Context, id int) (*domain.WebhookSubscription, error) {
+	if r.sub.ID != id {
+		return nil, nil
+	}
+	return r.sub, nil
+}
+
+func (r *fakeWebhookRepository) UpdateDelivery(_ context.Context, delivery *domain.WebhookDelivery) error {
+	r.updated = append(r.updated, *delivery)
+	return nil
+}
+
+// fakeSender answers every request with status, or fails with err
+type fakeSender struct {
+	status  int
+	err     error
+	headers map[string]string
+	body    []byte
+}
+
+func (s *fakeSender) Send(_ context.Context, _ string, headers map[string]string, body []byte) (int, error) {
+	s.headers, s.body = headers, body
+	return s.status, s.err
+}
+
+func dueDelivery(attempts int) *domain.WebhookDelivery {
+	return &domain.WebhookDelivery{
+		ID:             5,
+		SubscriptionID: 1,
+		Status:         domain.DeliveryPending,
+		Attempts:       attempts,
+		Event:          &domain.Event{ID: 9, Type: domain.EventUserCreated, UserID: 3, Data: []byte(`{"user":{"id":3}}`), CreatedAt: time.Now()},
+	}
+}
+
+func newFakeWebhookRepository(deliveries ...*domain.WebhookDelivery) *fakeWebhookRepository {
+	return &fakeWebhookRepository{
+		sub: &domain.WebhookSubscription{ID: 1, URL: "https://crm.example.com/hooks", Secret: "whsec_test"},
+		due: deliveries,
+	}
+}
+
+func TestDispatchWebhooks_DeliversSigned(t *testing.T) {
+	repo := newFakeWebhookRepository(dueDelivery(0))
+	sender := &fakeSender{status: 204}
+	useCase := NewWebhookUseCase(repo, sender)
+
+	delivered, err := useCase.DispatchWebhooks(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, 1, repo.enqueued)
+	if assert.Len(t, repo.updated, 1) {
+		assert.Equal(t, domain.DeliveryDelivered, repo.updated[0].Status)
+		assert.Equal(t, 1, repo.updated[0].Attempts)
+		assert.NotNil(t, repo.updated[0].DeliveredAt)
+		assert.Nil(t, repo.updated[0].NextAttemptAt)
+	}
+
+	assert.Equal(t, domain.EventUserCreated, sender.headers[HeaderWebhookEvent])
+	assert.Equal(t, "5", sender.headers[HeaderWebhookDelivery])
+	timestamp := sender.headers[HeaderWebhookTimestamp]
+	assert.Equal(t, SignWebhook("whsec_test", timestamp, sender.body), sender.headers[HeaderWebhookSignature])
+	assert.Contains(t, string(sender.body), `"type":"user.created"`)
+	assert.Contains(t, string(sender.body), `"data":{"user":{"id":3}}`)
+}
+
+func TestDispatchWebhooks_RetriesWithBackoff(t *testing.T) {
+	repo := newFakeWebhookRepository(dueDelivery(2))
+	useCase := NewWebhookUseCase(repo, &fakeSender{status: 503}, WithWebhookRetries(5, time.Minute))
+
+	delivered, err := useCase.DispatchWebhooks(context.Background())
+
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+	if assert.Len(t, repo.updated, 1) {
+		delivery := repo.updated[0]
+		assert.Equal(t, domain.DeliveryPending, delivery.Status)
+		assert.Equal(t, 3, delivery.Attempts)
+		assert.Equal(t, 503, delivery.LastStatusCode)
+		assert.Equal(t, "endpoint responded 503", delivery.LastError)
+		// The third failure waits four times the base
+		assert.WithinDuration(t, time.Now().Add(4*time.Minute), *delivery.NextAttemptAt, 5*time.Second)
+	}
+}
+
+func TestDispatchWebhooks_DeadAfterLastAttempt(t *testing.T) {
+	repo := newFakeWebhookRepository(dueDelivery(4))
+	useCase := NewWebhookUseCase(repo, &fakeSender{err: errors.New("connection refused")}, WithWebhookRetries(5, time.Minute))
+
+	_, err := useCase.DispatchWebhooks(context.Background())
+
+	assert.NoError(t, err)
+	if assert.Len(t, repo.updated, 1) {
+		assert.Equal(t, domain.DeliveryDead, repo.updated[0].Status)
+		assert.Equal(t, 5, repo.updated[0].Attempts)
+		assert.Zero(t, repo.updated[0].LastStatusCode)
+		assert.Equal(t, "connection refused", repo.updated[0].LastError)
+		assert.Nil(t, repo.updated[0].NextAttemptAt)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhookBackoff(30*time.Second, 1))
+	assert.Equal(t, 2*time.Minute, webhookBackoff(30*time.Second, 3))
+	assert.Equal(t, webhookMaxBackoff, webhookBackoff(30*time.Second, 40))
+}
+
+func TestCreateSubscription(t *testing.T) {
+	repo := &fakeSubscriptionCreator{}
+	useCase := NewWebhookUseCase(repo, &fakeSender{})
+
+	sub, err := useCase.As(admin).CreateSubscription(context.Background(), CreateWebhookInput{
+		URL:        " https://crm.example.com/hooks ",
+		EventTypes: []string{domain.EventUserCreated, domain.EventUserCreated, " "},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://crm.example.com/hooks", sub.URL)
+	assert.Equal(t, []string{domain.EventUserCreated}, sub.EventTypes)
+	assert.True(t, strings.HasPrefix(sub.Secret, webhookSecretPrefix))
+	assert.Equal(t, admin.Subject, sub.CreatedBy)
+	assert.Same(t, sub, repo.created)
+}
+
+func TestCreateSubscription_Invalid(t *testing.T) {
+	useCase := NewWebhookUseCase(&fakeSubscriptionCreator{}, &fakeSender{})
+
+	_, err := useCase.CreateSubscription(context.Background(), CreateWebhookInput{URL: "ftp://crm.example.com"})
+	assert.Equal(t, domain.ErrInvalidWebhookURL, err)
+
+	_, err = useCase.CreateSubscription(context.Background(), CreateWebhookInput{URL: "https://crm.example.com", EventTypes: []string{"user.renamed"}})
+	assert.Equal(t, domain.ErrInvalidEventType, err)
+}
+
+func TestWebhooks_RequirePermission(t *testing.T) {
+	useCase := NewWebhookUseCase(&fakeSubscriptionCreator{}, &fakeSender{}).As(support)
+
+	_, err := useCase.CreateSubscription(context.Background(), CreateWebhookInput{URL: "https://crm.example.com"})
+	assertForbidden(t, err, domain.PermWebhooksManage)
+
+	_, err = useCase.ReplayDeadDeliveries(context.Background(), 1)
+	assertForbidden(t, err, domain.PermWebhooksManage)
+}
+
+// fakeSubscriptionCreator records the subscription it is asked to
+// create
+type fakeSubscriptionCreator struct {
+	domain.WebhookRepository
+	created *domain.WebhookSubscription
+}
+
+func (r *fakeSubscriptionCreator) CreateSubscription(_ context.Context, sub *domain.WebhookSubscription) error {
+	sub.ID = 1
+	r.created = sub
+	return nil
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// EventPruner deletes outbox events, created before a given time, that
+// every subscriber has received
+type EventPruner interface {
+	PruneDeliveredEvents(ctx context.Context, before time.Time) (int, error)
+}
+
+// OutboxWorker periodically deletes delivered outbox events whose retention
+// period has passed, so the copies of users they hold are not kept forever
+type OutboxWorker struct {
+	pruner    EventPruner
+	retention time.Duration
+	interval  time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewOutboxWorker creates an outbox worker; call Start to run it
+func NewOutboxWorker(pruner EventPruner, retention, interval time.Duration) *OutboxWorker {
+	return &OutboxWorker{
+		pruner:    pruner,
+		retention: retention,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start prunes immediately and then once every interval until Stop
+func (w *OutboxWorker) Start() {
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			w.RunOnce()
+			select {
+			case <-ticker.C:
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the worker to finish and waits for a running prune to end
+func (w *OutboxWorker) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// RunOnce deletes the delivered events older than the retention period
+func (w *OutboxWorker) RunOnce() {
+	if _, err := w.pruner.PruneDeliveredEvents(context.Background(), time.Now().Add(-w.retention)); err != nil {
+		slog.Error("failed to prune delivered events", "error", err)
+	}
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPruner struct {
+	mu      sync.Mutex
+	cutoffs []time.Time
+}
+
+func (p *recordingPruner) PruneDeliveredEvents(_ context.Context, before time.Time) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cutoffs = append(p.cutoffs, before)
+	return 0, nil
+}
+
+func TestOutboxWorker_PrunesPastRetention(t *testing.T) {
+	pruner := &recordingPruner{}
+	worker := NewOutboxWorker(pruner, 7*24*time.Hour, time.Hour)
+
+	worker.Start()
+	worker.Stop()
+
+	pruner.mu.Lock()
+	defer pruner.mu.Unlock()
+	if assert.Len(t, pruner.cutoffs, 1) {
+		assert.WithinDuration(t, time.Now().Add(-7*24*time.Hour), pruner.cutoffs[0], time.Minute)
+	}
+}
@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// UserPurger permanently removes users soft-deleted before a given time
+type UserPurger interface {
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error)
+}
+
+// PurgeWorker periodically purges users whose soft-delete retention period
+// has passed
+type PurgeWorker struct {
+	purger    UserPurger
+	retention time.Duration
+	interval  time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPurgeWorker creates a purge worker; call Start to run it
+func NewPurgeWorker(purger UserPurger, retention, interval time.Duration) *PurgeWorker {
+	return &PurgeWorker{
+		purger:    purger,
+		retention: retention,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs a purge immediately and then once every interval until Stop
+func (w *PurgeWorker) Start() {
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			w.RunOnce()
+			select {
+			case <-ticker.C:
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the worker to finish and waits for a running purge to end
+func (w *PurgeWorker) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// RunOnce purges the users deleted longer ago than the retention period
+func (w *PurgeWorker) RunOnce() {
+	// The purger logs what it removed. A purge is not cancelled by Stop but
+	// allowed to finish.
+	if _, err := w.purger.PurgeDeletedUsers(context.Background(), time.Now().Add(-w.retention)); err != nil {
+		slog.Error("failed to purge deleted users", "error", err)
+	}
+}
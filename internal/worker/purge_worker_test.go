@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPurger struct {
+	mu      sync.Mutex
+	cutoffs []time.Time
+}
+
+func (p *recordingPurger) PurgeDeletedUsers(_ context.Context, before time.Time) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cutoffs = append(p.cutoffs, before)
+	return 0, nil
+}
+
+func TestPurgeWorker_PurgesPastRetention(t *testing.T) {
+	purger := &recordingPurger{}
+	worker := NewPurgeWorker(purger, 24*time.Hour, time.Hour)
+
+	worker.Start()
+	worker.Stop()
+
+	purger.mu.Lock()
+	defer purger.mu.Unlock()
+	if assert.Len(t, purger.cutoffs, 1) {
+		assert.WithinDuration(t, time.Now().Add(-24*time.Hour), purger.cutoffs[0], time.Minute)
+	}
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// WebhookDispatcher delivers the webhook deliveries that are due
+type WebhookDispatcher interface {
+	DispatchWebhooks(ctx context.Context) (int, error)
+}
+
+// WebhookWorker periodically dispatches outbox events to webhook
+// subscriptions
+type WebhookWorker struct {
+	dispatcher WebhookDispatcher
+	interval   time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewWebhookWorker creates a webhook worker; call Start to run it
+func NewWebhookWorker(dispatcher WebhookDispatcher, interval time.Duration) *WebhookWorker {
+	return &WebhookWorker{
+		dispatcher: dispatcher,
+		interval:   interval,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start dispatches immediately and then once every interval until Stop
+func (w *WebhookWorker) Start() {
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			w.RunOnce()
+			select {
+			case <-ticker.C:
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the worker to finish and waits for a running dispatch to end
+func (w *WebhookWorker) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// RunOnce attempts the deliveries that are due
+func (w *WebhookWorker) RunOnce() {
+	// The dispatcher logs failed deliveries. Deliveries already sent when
+	// Stop is called are allowed to finish.
+	if _, err := w.dispatcher.DispatchWebhooks(context.Background()); err != nil {
+		slog.Error("failed to dispatch webhooks", "error", err)
+	}
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingDispatcher struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (d *countingDispatcher) DispatchWebhooks(_ context.Context) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+	return 0, nil
+}
+
+func TestWebhookWorker_DispatchesOnStart(t *testing.T) {
+	dispatcher := &countingDispatcher{}
+	worker := NewWebhookWorker(dispatcher, time.Hour)
+
+	worker.Start()
+	worker.Stop()
+
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	assert.Equal(t, 1, dispatcher.calls)
+}
@@ -0,0 +1,124 @@
+// Package logging builds the application's structured JSON logger. Every
+// record passes through PII masking, so member emails, phone numbers and
+// addresses never reach the log output. A request's logger travels in its
+// context, so layers without access to the request log under its ID.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// New creates a JSON logger writing records at level or above to w
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: MaskPII,
+	}))
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error", defaulting to info
+func ParseLevel(s string) (slog.Level, bool) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo, false
+	}
+	return level, true
+}
+
+// Discard returns a logger that drops every record, for tests and for
+// components created without one
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// contextKey is the context key of a request's *slog.Logger
+type contextKey struct{}
+
+// NewContext returns ctx carrying the logger of the request or call it
+// belongs to
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger NewContext stored in ctx, if any
+func FromContext(ctx context.Context) (*slog.Logger, bool) {
+	logger, ok := ctx.Value(contextKey{}).(*slog.Logger)
+	return logger, ok
+}
+
+// emailPattern finds email addresses embedded in free text such as errors
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// phonePattern finds Thai phone numbers embedded in free text: nine or ten
+// digits starting with 0, or +66 and eight or nine digits, optionally
+// separated by spaces or dashes, e.g. "081-234-5678" or "+66 2 123 4567"
+var phonePattern = regexp.MustCompile(`(?:\+66[\s-]?|\b0)\d(?:[\s-]?\d){7,8}\b`)
+
+// MaskPII is a slog ReplaceAttr function. Attributes named email, phone or
+// address, in any group, are masked by key; email addresses and phone
+// numbers inside any other string or error are masked wherever they appear.
+func MaskPII(groups []string, a slog.Attr) slog.Attr {
+	// Error messages are free text too, and often quote the offending value
+	if err, ok := a.Value.Any().(error); ok && a.Value.Kind() == slog.KindAny {
+		a.Value = slog.StringValue(err.Error())
+	}
+	if a.Value.Kind() != slog.KindString {
+		return a
+	}
+	value := a.Value.String()
+	switch strings.ToLower(a.Key) {
+	case "email":
+		return slog.String(a.Key, MaskEmail(value))
+	case "phone":
+		return slog.String(a.Key, MaskPhone(value))
+	case "address":
+		return slog.String(a.Key, MaskAddress(value))
+	}
+	masked := value
+	if strings.Contains(masked, "@") {
+		masked = emailPattern.ReplaceAllStringFunc(masked, MaskEmail)
+	}
+	masked = phonePattern.ReplaceAllStringFunc(masked, MaskPhone)
+	if masked != value {
+		return slog.String(a.Key, masked)
+	}
+	return a
+}
+
+// MaskEmail keeps the first character of the local part and the domain, so
+// "somchai@example.com" becomes "s***@example.com"
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+	return local[:1] + "***@" + domain
+}
+
+// MaskPhone keeps only the last two digits, so "081-234-5678" becomes
+// "********78"
+func MaskPhone(phone string) string {
+	var digits []rune
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) <= 2 {
+		return strings.Repeat("*", len(digits))
+	}
+	return strings.Repeat("*", len(digits)-2) + string(digits[len(digits)-2:])
+}
+
+// MaskAddress hides an address entirely; even part of one can identify a
+// member
+func MaskAddress(address string) string {
+	if address == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskPII(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	logger.Info("user created",
+		slog.Group("user", "id", 7, "email", "somchai@example.com", "phone", "081-234-5678", "address", "1 Sukhumvit Rd"),
+		"error", errors.New("email already exists: somchai@example.com"),
+		"cause", "lookup of jane.doe@example.co.th failed",
+		"conflict", "phone 089 876 5432 is taken, as is +66-2-123-4567",
+		"request_id", "0a1b2c3d4e5f",
+	)
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	user := record["user"].(map[string]interface{})
+	assert.Equal(t, float64(7), user["id"])
+	assert.Equal(t, "s***@example.com", user["email"])
+	assert.Equal(t, "********78", user["phone"])
+	assert.Equal(t, "[REDACTED]", user["address"])
+	assert.Equal(t, "lookup of j***@example.co.th failed", record["cause"])
+	assert.Equal(t, "phone ********32 is taken, as is ********67", record["conflict"])
+	assert.Equal(t, "0a1b2c3d4e5f", record["request_id"])
+	assert.NotContains(t, buf.String(), "somchai@")
+	assert.NotContains(t, buf.String(), "5678")
+	assert.NotContains(t, buf.String(), "Sukhumvit")
+}
+
+func TestMaskPII_PhoneNumbersInText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"call 0812345678", "call ********78"},
+		{"call 081-234-5678", "call ********78"},
+		{"office 02-123-4567", "office *******67"},
+		{"intl +66812345678", "intl *********78"},
+		{"order 12345678901", "order 12345678901"},
+		{"took 0.0812345678s", "took 0.0812345678s"},
+		{"2026-10-18T05:14:43Z", "2026-10-18T05:14:43Z"},
+	}
+	for _, tt := range tests {
+		got := MaskPII(nil, slog.String("msg", tt.in))
+		assert.Equal(t, tt.want, got.Value.String(), tt.in)
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	assert.Equal(t, "a***@b.com", MaskEmail("a@b.com"))
+	assert.Equal(t, "***", MaskEmail("not-an-email"))
+}
+
+func TestParseLevel(t *testing.T) {
+	level, ok := ParseLevel("debug")
+	assert.True(t, ok)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	level, ok = ParseLevel("loud")
+	assert.False(t, ok)
+	assert.Equal(t, slog.LevelInfo, level)
+}
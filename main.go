@@ -1,42 +1,167 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 	"workshop_4/config"
 	"workshop_4/database"
+	"workshop_4/health"
+	"workshop_4/internal/domain"
 	"workshop_4/internal/infrastructure/repository"
+	"workshop_4/internal/infrastructure/webhook"
+	grpcserver "workshop_4/internal/interfaces/grpc"
 	httphandler "workshop_4/internal/interfaces/http"
 	"workshop_4/internal/usecase"
+	"workshop_4/internal/worker"
+	"workshop_4/logging"
+	"workshop_4/metrics"
+	"workshop_4/middleware"
+	"workshop_4/tracing"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	// Load configuration
 	cfg := config.LoadConfig()
 
+	// Structured JSON logging; the log package is routed through it too
+	level, ok := logging.ParseLevel(cfg.LogLevel)
+	logger := logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
+	if !ok {
+		logger.Warn("invalid LOG_LEVEL, using info", "value", cfg.LogLevel)
+	}
+
+	// OpenTelemetry tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TraceExporter,
+		File:        cfg.TraceFile,
+		ServiceName: cfg.AppName,
+	})
+	if err != nil {
+		fatal("Invalid tracing configuration", err)
+	}
+
 	// Initialize database
 	if err := database.InitDB(); err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		fatal("Failed to initialize database", err)
 	}
-	defer database.CloseDB()
 
 	// Initialize Clean Architecture layers
-	// Infrastructure Layer - Repository
-	userRepo := repository.NewSQLiteUserRepository(database.DB)
+	// Prometheus metrics
+	appMetrics := metrics.New(database.DB, "users")
+
+	// Infrastructure Layer - Repository, with every call logged and timed
+	queryLog := repository.LoggingObserver(logger, cfg.SlowQueryThreshold)
+	queryMetrics := appMetrics.QueryObserver()
+	userRepo := repository.NewObservedUserRepository(repository.NewSQLiteUserRepository(database.DB), queryLog, queryMetrics)
+	pointRepo := repository.NewObservedPointTransactionRepository(repository.NewSQLitePointTransactionRepository(database.DB), queryLog, queryMetrics)
+	apiKeyRepo := repository.NewObservedAPIKeyRepository(repository.NewSQLiteAPIKeyRepository(database.DB), queryLog, queryMetrics)
+	importRepo := repository.NewObservedUserImportRepository(repository.NewSQLiteUserImportRepository(database.DB), queryLog, queryMetrics)
+	quotaRepo := repository.NewObservedQuotaRepository(repository.NewSQLiteQuotaRepository(database.DB), queryLog, queryMetrics)
+	idempotencyRepo := repository.NewObservedIdempotencyRepository(repository.NewSQLiteIdempotencyRepository(database.DB), queryLog, queryMetrics)
+	webhookRepo := repository.NewObservedWebhookRepository(repository.NewSQLiteWebhookRepository(database.DB), queryLog, queryMetrics)
+	eventRepo := repository.NewObservedEventRepository(repository.NewSQLiteEventRepository(database.DB), queryLog, queryMetrics)
 
 	// Use Case Layer - Business Logic
-	userUseCase := usecase.NewUserUseCase(userRepo)
+	tiers, err := usecase.ParseTiers(cfg.MemberTiers)
+	if err != nil {
+		fatal("Invalid MEMBER_TIERS", err)
+	}
+	tierEngine, err := usecase.NewTierEngine(tiers)
+	if err != nil {
+		fatal("Invalid MEMBER_TIERS", err)
+	}
+	roles, err := usecase.ParseRolePermissions(cfg.RolePermissions)
+	if err != nil {
+		fatal("Invalid ROLE_PERMISSIONS", err)
+	}
+	policy, err := usecase.NewAccessPolicy(roles)
+	if err != nil {
+		fatal("Invalid ROLE_PERMISSIONS", err)
+	}
+	userUseCase := usecase.NewUserUseCase(userRepo, usecase.WithTierEngine(tierEngine), usecase.WithAccessPolicy(policy), usecase.WithMetrics(appMetrics))
+	pointUseCase := usecase.NewPointUseCase(userRepo, pointRepo, tierEngine, usecase.WithPointAccessPolicy(policy), usecase.WithPointMetrics(appMetrics))
+	importUseCase := usecase.NewUserImportUseCase(userRepo, importRepo, tierEngine, usecase.WithImportAccessPolicy(policy), usecase.WithImportMetrics(appMetrics))
+	apiKeyUseCase := usecase.NewAPIKeyUseCase(apiKeyRepo, usecase.WithAPIKeyAccessPolicy(policy))
+	webhookUseCase := usecase.NewWebhookUseCase(webhookRepo, webhook.NewHTTPSender(cfg.WebhookTimeout),
+		usecase.WithWebhookAccessPolicy(policy), usecase.WithWebhookRetries(cfg.WebhookMaxAttempts, cfg.WebhookRetryBase))
+	eventUseCase := usecase.NewEventUseCase(eventRepo, usecase.WithEventAccessPolicy(policy))
+
+	// Background workers
+	purgeWorker := worker.NewPurgeWorker(userUseCase, cfg.SoftDeleteRetention, cfg.PurgeInterval)
+	purgeWorker.Start()
+	webhookWorker := worker.NewWebhookWorker(webhookUseCase, cfg.WebhookPollInterval)
+	webhookWorker.Start()
+	outboxWorker := worker.NewOutboxWorker(webhookUseCase, cfg.OutboxRetention, cfg.PurgeInterval)
+	outboxWorker.Start()
 
 	// Interface Layer - HTTP Handlers
 	userHandler := httphandler.NewUserHandler(userUseCase)
+	pointHandler := httphandler.NewPointHandler(pointUseCase)
+	apiKeyHandler := httphandler.NewAPIKeyHandler(apiKeyUseCase)
+	importHandler := httphandler.NewUserImportHandler(importUseCase, int64(cfg.ImportMaxBytes))
+	webhookHandler := httphandler.NewWebhookHandler(webhookUseCase)
+	eventHandler := httphandler.NewEventHandler(eventUseCase, cfg.EventStreamPollInterval, cfg.EventStreamHeartbeat)
+
+	// Authentication: service clients send an API key, everyone else a JWT
+	apiKeys := httphandler.APIKeyAuthenticator(apiKeyUseCase)
+	verifier, err := middleware.NewJWTVerifier(middleware.AuthConfig{
+		Secret:    []byte(cfg.JWTSecret),
+		JWKSFile:  cfg.JWTJWKSFile,
+		Issuer:    cfg.JWTIssuer,
+		Audience:  cfg.JWTAudience,
+		ClockSkew: cfg.JWTClockSkew,
+		Realm:     cfg.AppName,
+	})
+	if err != nil {
+		fatal("Invalid JWT configuration (set JWT_SECRET or JWT_JWKS_FILE)", err)
+	}
+
+	// Rate limiting
+	rateLimits, err := middleware.ParseRateLimits(cfg.RateLimits)
+	if err != nil {
+		fatal("Invalid RATE_LIMITS", err)
+	}
+	quotas, err := middleware.ParseQuotas(cfg.RateLimitQuotas)
+	if err != nil {
+		fatal("Invalid RATE_LIMIT_QUOTAS", err)
+	}
+	limiter := middleware.NewRateLimiter(middleware.RateLimitConfig{
+		Rules:  rateLimits,
+		Quotas: quotas,
+		Store:  quotaRepo,
+	})
+
+	// Replays of retried POSTs that carry an Idempotency-Key
+	idempotent := middleware.Idempotency(middleware.IdempotencyConfig{
+		Store: httphandler.IdempotencyStore(idempotencyRepo),
+		TTL:   cfg.IdempotencyTTL,
+	})
 
 	// Create a new Fiber instance
 	app := fiber.New(fiber.Config{
 		AppName: cfg.AppName,
+		// The banner is not JSON; the "server starting" record replaces it
+		DisableStartupMessage: true,
+		// Request bodies are streamed so that imports can read theirs as it
+		// arrives; BodyLimit below reads every other body into memory and
+		// refuses those over the limit
+		StreamRequestBody: true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -48,44 +173,194 @@ func main() {
 		},
 	})
 
-	// Middleware
+	// Middleware; the request log wraps recover so panics are logged too,
+	// and tracing and metrics wrap the log so they see the status it
+	// settles on
+	app.Use(middleware.RequestID())
+	app.Use(tracing.Middleware())
+	app.Use(appMetrics.Middleware())
+	app.Use(middleware.LoggingMiddleware(logger))
 	app.Use(recover.New())
-	app.Use(logger.New(logger.Config{
-		Format: "[${time}] ${status} - ${method} ${path}\n",
-	}))
+	app.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, isImport))
+	app.Use(middleware.Timeout(cfg.DBTimeout))
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-API-Key, X-Request-ID, If-Match, If-None-Match, Idempotency-Key, Last-Event-ID, traceparent, tracestate",
+		ExposeHeaders: "ETag, WWW-Authenticate, X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, X-Quota-Limit, X-Quota-Remaining, Idempotent-Replayed",
 	}))
 
+	// Prometheus scrape endpoint
+	app.Get("/metrics", appMetrics.Handler())
+
+	// Liveness and readiness probes
+	probes := health.NewChecker(cfg.ReadinessTimeout)
+	probes.Add("database", health.DatabaseCheck(database.DB))
+	probes.Add("migrations", health.MigrationsCheck(database.DB))
+	probes.Add("disk", health.DiskSpaceCheck(database.Path, uint64(cfg.ReadinessMinFreeDiskMB)<<20))
+	app.Get("/healthz", probes.Liveness())
+	app.Get("/readyz", probes.Readiness())
+
 	// Setup routes
-	setupRoutes(app, userHandler)
+	setupRoutes(app, cfg, verifier, apiKeys, limiter, idempotent, policy, userHandler, pointHandler, apiKeyHandler, importHandler, webhookHandler, eventHandler)
+
+	// gRPC user service, authenticated, limited, measured and traced like
+	// the HTTP API
+	grpcServer := grpcserver.NewServer(grpcserver.ServerConfig{
+		Logger:        logger,
+		Verifier:      verifier,
+		APIKeys:       apiKeys,
+		Limiter:       limiter,
+		Metrics:       appMetrics,
+		StatsHandler:  tracing.GRPCStatsHandler(),
+		Timeout:       cfg.DBTimeout,
+		StreamTimeout: cfg.ExportTimeout,
+	}, grpcserver.NewUserService(userUseCase))
+	grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		fatal("Failed to start gRPC server", err)
+	}
+
+	// Start servers
+	logger.Info("server starting", "port", cfg.Port, "grpc_port", cfg.GRPCPort, "environment", cfg.Environment)
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- app.Listen(":" + cfg.Port)
+	}()
+	go func() {
+		serverErr <- grpcServer.Serve(grpcListener)
+	}()
+
+	// Serve until SIGINT or SIGTERM
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		fatal("Failed to start server", err)
+	case sig := <-signals:
+		logger.Info("shutting down", "signal", sig.String(), "timeout", cfg.ShutdownTimeout.String())
+	}
+
+	// Fail readiness first so load balancers stop routing here, then stop
+	// accepting connections and let in-flight requests finish. Event
+	// streams never finish on their own, so they are ended first.
+	probes.SetShuttingDown()
+	time.Sleep(cfg.ShutdownDelay)
+	eventHandler.Close()
+	grpcStopped := make(chan error, 1)
+	go func() {
+		grpcStopped <- grpcServer.Shutdown(cfg.ShutdownTimeout)
+	}()
+	if err := app.ShutdownWithTimeout(cfg.ShutdownTimeout); err != nil {
+		logger.Error("requests still in flight at shutdown timeout", "error", err)
+	}
+	if err := <-grpcStopped; err != nil {
+		logger.Error("gRPC calls still in flight at shutdown timeout", "error", err)
+	}
 
-	// Start server
-	log.Printf("🚀 Server starting on port %s (Environment: %s)", cfg.Port, cfg.Environment)
-	if err := app.Listen(":" + cfg.Port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// Background workers finish their current run before the database goes
+	purgeWorker.Stop()
+	webhookWorker.Stop()
+	outboxWorker.Stop()
+	database.CloseDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("failed to flush traces", "error", err)
 	}
+	logger.Info("server stopped")
+}
+
+// isImport reports whether c is a bulk import, whose body the handler
+// streams and bounds by IMPORT_MAX_BYTES
+func isImport(c *fiber.Ctx) bool {
+	return c.Method() == fiber.MethodPost && strings.TrimSuffix(c.Path(), "/") == "/api/v1/users/import"
 }
 
-func setupRoutes(app *fiber.App, userHandler *httphandler.UserHandler) {
-	// Root endpoint
-	app.Get("/", func(c *fiber.Ctx) error {
+// fatal logs a startup failure and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func setupRoutes(app *fiber.App, cfg *config.Config, verifier *middleware.JWTVerifier, apiKeys middleware.APIKeyAuthenticator, limiter *middleware.RateLimiter, idempotent fiber.Handler, policy *usecase.AccessPolicy, userHandler *httphandler.UserHandler, pointHandler *httphandler.PointHandler, apiKeyHandler *httphandler.APIKeyHandler, importHandler *httphandler.UserImportHandler, webhookHandler *httphandler.WebhookHandler, eventHandler *httphandler.EventHandler) {
+	// Root endpoint, limited per IP address
+	app.Get("/", limiter.Limit("public"), func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
 			"message": "Welcome to Workshop 4 API",
 			"status":  "running",
 		})
 	})
 
-	// API v1 routes
-	api := app.Group("/api/v1")
+	// API v1 routes, all requiring an API key or a bearer token. Addresses
+	// failing to authenticate too often are turned away before the
+	// credentials are checked.
+	api := app.Group("/api/v1",
+		limiter.LimitAnonymous(middleware.RateLimitAuthGroup),
+		middleware.APIKeyMiddleware(apiKeys),
+		middleware.AuthMiddleware(verifier),
+	)
+
+	// Route-level permission checks; the use cases enforce the field-level rules
+	canRead := httphandler.RequirePermission(policy, domain.PermUsersRead)
+	canCreate := httphandler.RequirePermission(policy, domain.PermUsersCreate)
+	canEdit := httphandler.RequireAnyPermission(policy, domain.PermUsersEditContact, domain.PermUsersEditPoints)
+	canEditPoints := httphandler.RequirePermission(policy, domain.PermUsersEditPoints)
+	canDelete := httphandler.RequirePermission(policy, domain.PermUsersDelete)
+	canWrite := httphandler.RequireAnyPermission(policy, domain.PermUsersCreate, domain.PermUsersEditContact, domain.PermUsersEditPoints, domain.PermUsersDelete)
+	canManageKeys := httphandler.RequirePermission(policy, domain.PermAPIKeysManage)
+	canManageWebhooks := httphandler.RequirePermission(policy, domain.PermWebhooksManage)
 
-	// User routes
+	// Rate limits per route group, applied before the permission checks
+	limitUsers := limiter.Limit("users")
+	limitPoints := limiter.Limit("points")
+	limitKeys := limiter.Limit("api_keys")
+	limitWebhooks := limiter.Limit("webhooks")
+	limitEvents := limiter.Limit("events")
+
+	// User routes. A POST retried with the same Idempotency-Key gets the first
+	// response replayed; imports keep their own record instead.
 	users := api.Group("/users")
-	users.Get("/", userHandler.GetUsers)
-	users.Get("/:id", userHandler.GetUser)
-	users.Post("/", userHandler.CreateUser)
-	users.Put("/:id", userHandler.UpdateUser)
-	users.Delete("/:id", userHandler.DeleteUser)
+	users.Get("/", limitUsers, canRead, userHandler.GetUsers)
+	users.Get("/search", limitUsers, canRead, userHandler.SearchUsers) // before /:id so "search" is not read as an ID
+	users.Get("/export", limitUsers, canRead, middleware.Timeout(cfg.ExportTimeout), userHandler.ExportUsers)
+	users.Post("/import", limitUsers, canCreate, middleware.Timeout(cfg.ImportTimeout), importHandler.ImportUsers)
+	users.Get("/imports/:id", limitUsers, canCreate, importHandler.GetImport)
+	users.Get("/imports/:id/rejections", limitUsers, canCreate, importHandler.GetRejections)
+	users.Post("/batch", limitUsers, canWrite, idempotent, userHandler.BatchUsers)
+	users.Get("/:id", limitUsers, canRead, userHandler.GetUser)
+	users.Post("/", limitUsers, canCreate, idempotent, userHandler.CreateUser)
+	users.Put("/:id", limitUsers, canEdit, userHandler.UpdateUser)
+	users.Patch("/:id", limitUsers, canEdit, userHandler.PatchUser)
+	users.Delete("/:id", limitUsers, canDelete, userHandler.DeleteUser)
+	users.Post("/:id/restore", limitUsers, canDelete, idempotent, userHandler.RestoreUser)
+
+	// Points ledger routes
+	users.Post("/:id/points/earn", limitPoints, canEditPoints, idempotent, pointHandler.EarnPoints)
+	users.Post("/:id/points/redeem", limitPoints, canEditPoints, idempotent, pointHandler.RedeemPoints)
+	users.Post("/:id/points/adjust", limitPoints, canEditPoints, idempotent, pointHandler.AdjustPoints)
+	users.Get("/:id/points/history", limitPoints, canRead, pointHandler.GetPointHistory)
+
+	// API key administration. Issuing a key takes no Idempotency-Key, as the
+	// stored response would hold the secret.
+	apiKeyRoutes := api.Group("/api-keys", limitKeys, canManageKeys)
+	apiKeyRoutes.Get("/", apiKeyHandler.ListAPIKeys)
+	apiKeyRoutes.Post("/", apiKeyHandler.IssueAPIKey)
+	apiKeyRoutes.Delete("/:id", apiKeyHandler.RevokeAPIKey)
+
+	// Webhook subscriptions, which receive user events from the outbox. As
+	// with API keys, creating one takes no Idempotency-Key.
+	webhookRoutes := api.Group("/webhooks", limitWebhooks, canManageWebhooks)
+	webhookRoutes.Get("/", webhookHandler.ListWebhooks)
+	webhookRoutes.Post("/", webhookHandler.CreateWebhook)
+	webhookRoutes.Get("/:id", webhookHandler.GetWebhook)
+	webhookRoutes.Delete("/:id", webhookHandler.DeleteWebhook)
+	webhookRoutes.Get("/:id/deliveries", webhookHandler.ListWebhookDeliveries)
+	webhookRoutes.Post("/:id/deliveries/:delivery_id/replay", webhookHandler.ReplayWebhookDelivery)
+	webhookRoutes.Post("/:id/replay", webhookHandler.ReplayDeadWebhookDeliveries)
+
+	// Server-Sent Events stream of the same user events. A stream stays open
+	// indefinitely, so it has no request deadline.
+	api.Get("/events/stream", limitEvents, canRead, middleware.Timeout(0), eventHandler.StreamEvents)
 }
@@ -0,0 +1,261 @@
+// Package metrics exposes the application's Prometheus metrics. Names and
+// labels are part of the operational contract; dashboards and alerts
+// depend on them, so change them only with a migration plan.
+//
+// HTTP, labelled by method, route template (e.g. "/api/v1/users/:id") and
+// status code:
+//
+//	http_requests_total                 counter
+//	http_request_duration_seconds       histogram
+//	http_requests_in_flight             gauge, unlabelled
+//
+// gRPC, labelled by service (e.g. "workshop.user.v1.UserService"), method and
+// status code name (e.g. "OK", "NotFound"):
+//
+//	grpc_server_handled_total           counter
+//	grpc_server_handling_seconds        histogram
+//
+// Repositories, labelled by repository (table), method (Go method name)
+// and outcome ("ok", or "error" when the database failed; not found and
+// version conflicts are "ok"):
+//
+//	repository_query_duration_seconds   histogram
+//
+// Connection pool, from database/sql's DB.Stats, labelled by db_name:
+//
+//	go_sql_max_open_connections, go_sql_open_connections,
+//	go_sql_in_use_connections, go_sql_idle_connections,
+//	go_sql_wait_count_total, go_sql_wait_duration_seconds_total,
+//	go_sql_max_idle_closed_total, go_sql_max_idle_time_closed_total,
+//	go_sql_max_lifetime_closed_total
+//
+// Business events:
+//
+//	users_created_total                 counter
+//	users_deleted_total                 counter, soft deletes
+//	users_restored_total                counter
+//	users_purged_total                  counter, permanent removals
+//	point_transactions_total            counter, labelled by type (earn, redeem, adjust)
+//	points_earned_total                 counter, points credited by earn transactions
+//	points_redeemed_total               counter, points debited by redeem transactions
+//	member_level_changes_total          counter, labelled by from and to tier
+//
+// The Go runtime and process collectors are registered as well.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+	"workshop_4/internal/domain"
+	"workshop_4/internal/infrastructure/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/codes"
+)
+
+// Metrics holds the application's collectors in its own registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+
+	grpcHandled  *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+
+	queryDuration *prometheus.HistogramVec
+
+	usersCreated       prometheus.Counter
+	usersDeleted       prometheus.Counter
+	usersRestored      prometheus.Counter
+	usersPurged        prometheus.Counter
+	pointTransactions  *prometheus.CounterVec
+	pointsEarned       prometheus.Counter
+	pointsRedeemed     prometheus.Counter
+	memberLevelChanges *prometheus.CounterVec
+}
+
+// New creates and registers every metric. db, when not nil, has its
+// connection pool statistics exported under dbName.
+func New(db *sql.DB, dbName string) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests served, by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency, by method, route template and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests currently being served.",
+		}),
+
+		grpcHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "gRPC calls completed, by service, method and status code.",
+		}, []string{"grpc_service", "grpc_method", "grpc_code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "gRPC call latency, by service, method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"grpc_service", "grpc_method", "grpc_code"}),
+
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "repository_query_duration_seconds",
+			Help:    "Repository method latency, by repository, method and outcome.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"repository", "method", "outcome"}),
+
+		usersCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "users_created_total",
+			Help: "Users created.",
+		}),
+		usersDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "users_deleted_total",
+			Help: "Users soft-deleted.",
+		}),
+		usersRestored: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "users_restored_total",
+			Help: "Soft-deleted users restored.",
+		}),
+		usersPurged: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "users_purged_total",
+			Help: "Soft-deleted users permanently removed.",
+		}),
+		pointTransactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "point_transactions_total",
+			Help: "Points ledger transactions recorded, by type.",
+		}, []string{"type"}),
+		pointsEarned: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "points_earned_total",
+			Help: "Points credited by earn transactions.",
+		}),
+		pointsRedeemed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "points_redeemed_total",
+			Help: "Points debited by redeem transactions.",
+		}),
+		memberLevelChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "member_level_changes_total",
+			Help: "Member tier changes, by previous and new tier.",
+		}, []string{"from", "to"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration, m.httpInFlight,
+		m.grpcHandled, m.grpcDuration,
+		m.queryDuration,
+		m.usersCreated, m.usersDeleted, m.usersRestored, m.usersPurged,
+		m.pointTransactions, m.pointsEarned, m.pointsRedeemed,
+		m.memberLevelChanges,
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+	}
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware records every request under its route template, so IDs in
+// paths do not create new series. It runs outside LoggingMiddleware, which
+// turns handler errors into responses, so the final status is recorded.
+func (m *Metrics) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		m.httpInFlight.Inc()
+		defer m.httpInFlight.Dec()
+
+		err := c.Next()
+
+		labels := prometheus.Labels{
+			"method": c.Method(),
+			"route":  c.Route().Path,
+			"status": strconv.Itoa(c.Response().StatusCode()),
+		}
+		m.httpRequests.With(labels).Inc()
+		m.httpDuration.With(labels).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// GRPCCallHandled records a finished gRPC call under its full method name,
+// e.g. "/workshop.user.v1.UserService/GetUser"
+func (m *Metrics) GRPCCallHandled(fullMethod string, code codes.Code, elapsed time.Duration) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	labels := prometheus.Labels{
+		"grpc_service": service,
+		"grpc_method":  method,
+		"grpc_code":    code.String(),
+	}
+	m.grpcHandled.With(labels).Inc()
+	m.grpcDuration.With(labels).Observe(elapsed.Seconds())
+}
+
+// QueryObserver returns a repository observer timing every method call
+func (m *Metrics) QueryObserver() repository.Observer {
+	return func(_ context.Context, repo, method string) func(error) {
+		start := time.Now()
+		return func(err error) {
+			outcome := "ok"
+			if repository.IsDatabaseError(err) {
+				outcome = "error"
+			}
+			m.queryDuration.WithLabelValues(repo, method, outcome).Observe(time.Since(start).Seconds())
+		}
+	}
+}
+
+// UserCreated counts a created user
+func (m *Metrics) UserCreated() {
+	m.usersCreated.Inc()
+}
+
+// UserDeleted counts a soft-deleted user
+func (m *Metrics) UserDeleted() {
+	m.usersDeleted.Inc()
+}
+
+// UserRestored counts a restored user
+func (m *Metrics) UserRestored() {
+	m.usersRestored.Inc()
+}
+
+// UsersPurged counts permanently removed users
+func (m *Metrics) UsersPurged(count int) {
+	m.usersPurged.Add(float64(count))
+}
+
+// PointsRecorded counts a ledger transaction and the points it moved
+func (m *Metrics) PointsRecorded(txType domain.PointTransactionType, amount int) {
+	m.pointTransactions.WithLabelValues(string(txType)).Inc()
+	switch txType {
+	case domain.PointTransactionEarn:
+		m.pointsEarned.Add(float64(amount))
+	case domain.PointTransactionRedeem:
+		m.pointsRedeemed.Add(float64(-amount))
+	}
+}
+
+// MemberLevelChanged counts a tier change
+func (m *Metrics) MemberLevelChanged(from, to string) {
+	m.memberLevelChanges.WithLabelValues(from, to).Inc()
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"workshop_4/internal/domain"
+
+	"github.com/gofiber/fiber/v2"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+)
+
+func TestMiddleware_LabelsByRouteTemplate(t *testing.T) {
+	m := New(nil, "")
+	app := fiber.New()
+	app.Use(m.Middleware())
+	app.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/metrics", m.Handler())
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/3"} {
+		app.Test(httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/users/:id", "200")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.httpDuration))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `http_requests_total{method="GET",route="/users/:id",status="200"} 3`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestGRPCCallHandled(t *testing.T) {
+	m := New(nil, "")
+
+	m.GRPCCallHandled("/workshop.user.v1.UserService/GetUser", codes.OK, time.Millisecond)
+	m.GRPCCallHandled("/workshop.user.v1.UserService/GetUser", codes.NotFound, time.Millisecond)
+	m.GRPCCallHandled("/workshop.user.v1.UserService/GetUser", codes.NotFound, time.Millisecond)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.grpcHandled.WithLabelValues("workshop.user.v1.UserService", "GetUser", "OK")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.grpcHandled.WithLabelValues("workshop.user.v1.UserService", "GetUser", "NotFound")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.grpcDuration))
+}
+
+func TestQueryObserver_Outcome(t *testing.T) {
+	m := New(nil, "")
+	observe := m.QueryObserver()
+
+	ctx := context.Background()
+	observe(ctx, "users", "FindByID")(nil)
+	observe(ctx, "users", "Update")(domain.ErrVersionConflict)
+	observe(ctx, "users", "Update")(errors.New("database is locked"))
+
+	// A version conflict is an answer from the database, not a failure
+	assert.Equal(t, uint64(1), sampleCount(t, m, "users", "FindByID", "ok"))
+	assert.Equal(t, uint64(1), sampleCount(t, m, "users", "Update", "ok"))
+	assert.Equal(t, uint64(1), sampleCount(t, m, "users", "Update", "error"))
+}
+
+// sampleCount returns how many observations a repository_query_duration_seconds
+// series holds
+func sampleCount(t *testing.T, m *Metrics, repo, method, outcome string) uint64 {
+	var metric dto.Metric
+	if err := m.queryDuration.WithLabelValues(repo, method, outcome).(prometheus.Histogram).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestBusinessCounters(t *testing.T) {
+	m := New(nil, "")
+
+	m.UserCreated()
+	m.UsersPurged(3)
+	m.PointsRecorded(domain.PointTransactionEarn, 100)
+	m.PointsRecorded(domain.PointTransactionRedeem, -40)
+	m.PointsRecorded(domain.PointTransactionAdjust, -5)
+	m.MemberLevelChanged("Bronze", "Silver")
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.usersCreated))
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.usersPurged))
+	assert.Equal(t, float64(100), testutil.ToFloat64(m.pointsEarned))
+	assert.Equal(t, float64(40), testutil.ToFloat64(m.pointsRedeemed))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.pointTransactions.WithLabelValues("adjust")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.memberLevelChanges.WithLabelValues("Bronze", "Silver")))
+}
+
+func TestDBStats(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(3)
+
+	m := New(db, "users")
+	count, err := testutil.GatherAndCount(m.registry, "go_sql_max_open_connections", "go_sql_in_use_connections")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderAPIKey carries the key of a service-to-service client
+const HeaderAPIKey = "X-API-Key"
+
+// Ways a request can be authenticated, as recorded in Claims.Method
+const (
+	AuthMethodBearer = "bearer"
+	AuthMethodAPIKey = "api_key"
+)
+
+// APIKeyAuthenticator resolves an API key to the claims it grants. It
+// returns nil claims, and no error, for an unknown, revoked or expired key.
+type APIKeyAuthenticator func(ctx context.Context, key string) (*Claims, error)
+
+// APIKeyMiddleware authenticates requests carrying an X-API-Key header and
+// stores the key's claims in Locals under LocalsClaims. Requests without the
+// header pass through untouched, so it is installed in front of
+// AuthMiddleware to accept either credential.
+func APIKeyMiddleware(authenticate APIKeyAuthenticator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := strings.TrimSpace(c.Get(HeaderAPIKey))
+		if key == "" {
+			return c.Next()
+		}
+
+		claims, err := authenticate(c.UserContext(), key)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return TimedOut(c, err)
+		}
+		if err != nil {
+			SetErrorCause(c, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Failed to verify API key",
+			})
+		}
+		if claims == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid API key",
+			})
+		}
+
+		claims.Method = AuthMethodAPIKey
+		c.Locals(LocalsClaims, claims)
+		return c.Next()
+	}
+}
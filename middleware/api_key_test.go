@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func apiKeyApp(t *testing.T) *fiber.App {
+	verifier, err := NewJWTVerifier(AuthConfig{Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticate := func(_ context.Context, key string) (*Claims, error) {
+		switch key {
+		case "wk_good":
+			return &Claims{Subject: "api_key:1", Scopes: []string{"users:read"}}, nil
+		case "wk_broken":
+			return nil, errors.New("database is locked")
+		}
+		return nil, nil
+	}
+
+	app := fiber.New()
+	app.Use(APIKeyMiddleware(authenticate), AuthMiddleware(verifier))
+	app.Get("/", func(c *fiber.Ctx) error {
+		claims := GetClaims(c)
+		return c.JSON(fiber.Map{"sub": claims.Subject, "method": claims.Method})
+	})
+	return app
+}
+
+func apiKeyRequest(t *testing.T, app *fiber.App, key, token string) int {
+	req := httptest.NewRequest("GET", "/", nil)
+	if key != "" {
+		req.Header.Set(HeaderAPIKey, key)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	app := apiKeyApp(t)
+	claims := validClaims()
+	delete(claims, "iss")
+	delete(claims, "aud")
+	token := signToken(t, jwt.SigningMethodHS256, "", testSecret, claims)
+
+	assert.Equal(t, 200, apiKeyRequest(t, app, "wk_good", ""))
+	assert.Equal(t, 401, apiKeyRequest(t, app, "wk_unknown", ""))
+	assert.Equal(t, 500, apiKeyRequest(t, app, "wk_broken", ""))
+
+	// Without a key the bearer token is required as before
+	assert.Equal(t, 200, apiKeyRequest(t, app, "", token))
+	assert.Equal(t, 401, apiKeyRequest(t, app, "", ""))
+
+	// A bad key is not rescued by a good token
+	assert.Equal(t, 401, apiKeyRequest(t, app, "wk_unknown", token))
+}
+
+func TestAPIKeyMiddleware_SetsMethod(t *testing.T) {
+	app := apiKeyApp(t)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderAPIKey, "wk_good")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "api_key:1", body["sub"])
+	assert.Equal(t, AuthMethodAPIKey, body["method"])
+}
@@ -1,32 +1,228 @@
 package middleware
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthMiddleware is a sample authentication middleware
-func AuthMiddleware() fiber.Handler {
+// LocalsClaims is the fiber.Ctx.Locals key holding the verified *Claims
+const LocalsClaims = "auth.claims"
+
+// AuthConfig configures JWT verification
+type AuthConfig struct {
+	// Secret verifies HS256 tokens without a kid
+	Secret []byte
+	// JWKSFile is a local JWK Set verifying RS256, ES256 and HS256 tokens
+	// by kid. It is reloaded when it changes, which is how keys are rotated.
+	JWKSFile string
+	// Issuer and Audience are required to match when set
+	Issuer   string
+	Audience string
+	// ClockSkew is the tolerance applied to exp, nbf and iat
+	ClockSkew time.Duration
+	// Realm is reported in WWW-Authenticate challenges
+	Realm string
+}
+
+// Claims are the verified claims of a request's access token
+type Claims struct {
+	// Method is AuthMethodBearer or AuthMethodAPIKey
+	Method    string
+	Subject   string
+	Roles     []string
+	Scopes    []string
+	ExpiresAt time.Time
+	// Tier selects the caller's rate limits; empty means RateLimitDefaultTier
+	Tier string
+}
+
+// HasRole reports whether the token grants the role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token grants the scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GetClaims returns the claims verified by AuthMiddleware, or nil
+func GetClaims(c *fiber.Ctx) *Claims {
+	claims, _ := c.Locals(LocalsClaims).(*Claims)
+	return claims
+}
+
+// stringList accepts a JSON array of strings or a single space-separated
+// string, the two shapes roles and scopes are issued in
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("must be a string or an array of strings")
+	}
+	*l = strings.Fields(s)
+	return nil
+}
+
+// tokenClaims is the JWT payload as issued
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Roles stringList `json:"roles,omitempty"`
+	// Scope is the RFC 8693 space-separated form, Scp the array form
+	Scope stringList `json:"scope,omitempty"`
+	Scp   stringList `json:"scp,omitempty"`
+	// Tier is the caller's rate limit tier
+	Tier string `json:"tier,omitempty"`
+}
+
+// JWTVerifier validates bearer tokens
+type JWTVerifier struct {
+	cfg    AuthConfig
+	jwks   *jwksFile
+	parser *jwt.Parser
+}
+
+// NewJWTVerifier creates a verifier; at least one of Secret and JWKSFile
+// must be configured
+func NewJWTVerifier(cfg AuthConfig) (*JWTVerifier, error) {
+	if len(cfg.Secret) == 0 && cfg.JWKSFile == "" {
+		return nil, errors.New("no JWT verification key configured")
+	}
+	if cfg.Realm == "" {
+		cfg.Realm = "api"
+	}
+
+	v := &JWTVerifier{cfg: cfg}
+	if cfg.JWKSFile != "" {
+		jwks, err := loadJWKSFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.jwks = jwks
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+		jwt.WithLeeway(cfg.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify parses and validates a compact JWT
+func (v *JWTVerifier) Verify(token string) (*Claims, error) {
+	var tc tokenClaims
+	if _, err := v.parser.ParseWithClaims(token, &tc, v.keyFor); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{
+		Method:  AuthMethodBearer,
+		Subject: tc.Subject,
+		Roles:   tc.Roles,
+		Scopes:  append(append([]string{}, tc.Scope...), tc.Scp...),
+		Tier:    tc.Tier,
+	}
+	if tc.ExpiresAt != nil {
+		claims.ExpiresAt = tc.ExpiresAt.Time
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// keyFor selects the verification key. Tokens with a kid are verified by
+// the JWKS; the shared secret only verifies HS256 tokens without one. jwt
+// rejects a key whose type does not match the algorithm, so an RSA public
+// key can never be used as an HMAC secret.
+func (v *JWTVerifier) keyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid != "" {
+		if v.jwks == nil {
+			return nil, errors.New("token has a kid but no JWKS is configured")
+		}
+		key, ok := v.jwks.key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return key, nil
+	}
+
+	if token.Method.Alg() == "HS256" && len(v.cfg.Secret) > 0 {
+		return v.cfg.Secret, nil
+	}
+	return nil, errors.New("token has no kid")
+}
+
+// AuthMiddleware requires a valid bearer token and stores its claims in
+// Locals under LocalsClaims. Failures are answered with 401 and an RFC 6750
+// WWW-Authenticate challenge. Requests already authenticated by
+// APIKeyMiddleware are let through.
+func AuthMiddleware(verifier *JWTVerifier) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get token from header
-		token := c.Get("Authorization")
+		if GetClaims(c) != nil {
+			return c.Next()
+		}
 
-		// TODO: Implement token validation
-		if token == "" {
+		// Get token from header
+		header := c.Get(fiber.HeaderAuthorization)
+		scheme, token, found := strings.Cut(header, " ")
+		if header == "" || !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer realm=%q`, verifier.cfg.Realm))
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"success": false,
 				"error":   "Missing authorization token",
 			})
 		}
 
-		// Continue to next handler
-		return c.Next()
-	}
-}
+		claims, err := verifier.Verify(strings.TrimSpace(token))
+		if err != nil {
+			description := "The access token is invalid"
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				description = "The access token expired"
+			}
+			c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer realm=%q, error="invalid_token", error_description=%q`, verifier.cfg.Realm, description))
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   description,
+			})
+		}
 
-// LoggingMiddleware logs request details
-func LoggingMiddleware() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		// Process request
+		c.Locals(LocalsClaims, claims)
+
+		// Continue to next handler
 		return c.Next()
 	}
 }
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSecret = []byte("test-secret-with-enough-entropy!")
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "user-42",
+		"iss":   "https://auth.example.com",
+		"aud":   "workshop-api",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"roles": []string{"admin"},
+		"scope": "users:read users:write",
+	}
+}
+
+func testApp(t *testing.T, cfg AuthConfig) *fiber.App {
+	cfg.Issuer = "https://auth.example.com"
+	cfg.Audience = "workshop-api"
+	cfg.ClockSkew = 30 * time.Second
+	verifier, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(AuthMiddleware(verifier))
+	app.Get("/", func(c *fiber.Ctx) error {
+		claims := GetClaims(c)
+		return c.JSON(fiber.Map{"sub": claims.Subject, "roles": claims.Roles, "scopes": claims.Scopes})
+	})
+	return app
+}
+
+func request(t *testing.T, app *fiber.App, token string) (int, string, map[string]interface{}) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, resp.Header.Get("WWW-Authenticate"), body
+}
+
+func TestAuthMiddleware_HS256(t *testing.T) {
+	app := testApp(t, AuthConfig{Secret: testSecret})
+
+	status, _, body := request(t, app, signToken(t, jwt.SigningMethodHS256, "", testSecret, validClaims()))
+
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "user-42", body["sub"])
+	assert.Equal(t, []interface{}{"admin"}, body["roles"])
+	assert.Equal(t, []interface{}{"users:read", "users:write"}, body["scopes"])
+}
+
+func TestAuthMiddleware_MissingToken(t *testing.T) {
+	app := testApp(t, AuthConfig{Secret: testSecret})
+
+	status, challenge, _ := request(t, app, "")
+
+	assert.Equal(t, 401, status)
+	assert.Equal(t, `Bearer realm="api"`, challenge)
+}
+
+func TestAuthMiddleware_RejectsInvalidTokens(t *testing.T) {
+	app := testApp(t, AuthConfig{Secret: testSecret})
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	skewed := validClaims()
+	skewed["exp"] = time.Now().Add(-10 * time.Second).Unix()
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "https://evil.example.com"
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "other-api"
+	noExpiry := validClaims()
+	delete(noExpiry, "exp")
+
+	status, challenge, body := request(t, app, signToken(t, jwt.SigningMethodHS256, "", testSecret, expired))
+	assert.Equal(t, 401, status)
+	assert.Contains(t, challenge, `error="invalid_token"`)
+	assert.Equal(t, "The access token expired", body["error"])
+
+	// Within the clock skew tolerance
+	status, _, _ = request(t, app, signToken(t, jwt.SigningMethodHS256, "", testSecret, skewed))
+	assert.Equal(t, 200, status)
+
+	for _, claims := range []jwt.MapClaims{wrongIssuer, wrongAudience, noExpiry} {
+		status, _, _ = request(t, app, signToken(t, jwt.SigningMethodHS256, "", testSecret, claims))
+		assert.Equal(t, 401, status)
+	}
+
+	status, _, _ = request(t, app, signToken(t, jwt.SigningMethodHS256, "", []byte("some-other-secret-of-enough-size"), validClaims()))
+	assert.Equal(t, 401, status)
+
+	unsigned := signToken(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validClaims())
+	status, _, _ = request(t, app, unsigned)
+	assert.Equal(t, 401, status)
+}
+
+func TestAuthMiddleware_JWKSRotation(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	nextKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa-1", rsaKey), ecJWK("ec-1", ecKey))
+	app := testApp(t, AuthConfig{JWKSFile: path})
+
+	status, _, _ := request(t, app, signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()))
+	assert.Equal(t, 200, status)
+	status, _, _ = request(t, app, signToken(t, jwt.SigningMethodES256, "ec-1", ecKey, validClaims()))
+	assert.Equal(t, 200, status)
+
+	// A token signed by a key not yet published is rejected...
+	rotated := signToken(t, jwt.SigningMethodRS256, "rsa-2", nextKey, validClaims())
+	status, _, _ = request(t, app, rotated)
+	assert.Equal(t, 401, status)
+
+	// ...and accepted once the key is added to the file
+	writeJWKS(t, path, rsaJWK("rsa-2", nextKey))
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	status, _, _ = request(t, app, rotated)
+	assert.Equal(t, 200, status)
+
+	// A token claiming HS256 signed with the RSA public key must not verify
+	confused := signToken(t, jwt.SigningMethodHS256, "rsa-2", nextKey.PublicKey.N.Bytes(), validClaims())
+	status, _, _ = request(t, app, confused)
+	assert.Equal(t, 401, status)
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit reads a streamed request body into memory and answers 413 once
+// it passes limit bytes. The server streams request bodies so that bulk
+// imports can read theirs as it arrives; this gives every other route its
+// body whole, as c.Body() and BodyParser expect, and no larger than limit.
+// Requests for which stream reports true are left to read and bound the
+// stream themselves.
+func BodyLimit(limit int, stream func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := c.Request()
+		if !req.IsBodyStream() || (stream != nil && stream(c)) {
+			return c.Next()
+		}
+
+		if req.Header.ContentLength() > limit {
+			return bodyTooLarge(c)
+		}
+		body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(limit)+1))
+		if err != nil {
+			c.Context().SetConnectionClose()
+			return fiber.ErrBadRequest
+		}
+		if len(body) > limit {
+			return bodyTooLarge(c)
+		}
+		req.SetBody(body)
+		return c.Next()
+	}
+}
+
+// bodyTooLarge answers 413 for a body left partly unread, closing the
+// connection so the rest of it is not taken for the next request
+func bodyTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return fiber.ErrRequestEntityTooLarge
+}
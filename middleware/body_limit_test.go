@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func bodyLimitApp() *fiber.App {
+	app := fiber.New(fiber.Config{StreamRequestBody: true, BodyLimit: 16})
+	app.Use(BodyLimit(16, func(c *fiber.Ctx) bool { return c.Path() == "/stream" }))
+	echo := func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	}
+	app.Post("/", echo)
+	app.Post("/stream", echo)
+	return app
+}
+
+func TestBodyLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"under the limit", "/", "small body", fiber.StatusOK},
+		{"at the limit", "/", strings.Repeat("a", 16), fiber.StatusOK},
+		{"over the limit", "/", strings.Repeat("a", 17), fiber.StatusRequestEntityTooLarge},
+		{"streamed route", "/stream", strings.Repeat("a", 64), fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := bodyLimitApp().Test(httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			if tt.status == fiber.StatusOK {
+				assert.Equal(t, tt.body, string(body))
+			}
+		})
+	}
+}
+
+func TestBodyLimit_Chunked(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader(strings.Repeat("a", 10)), strings.NewReader(strings.Repeat("b", 10))))
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+
+	resp, err := bodyLimitApp().Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, resp.StatusCode)
+}
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderIdempotencyKey names the request header carrying a client's key
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// HeaderIdempotentReplayed marks a response replayed for a retried request
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength bounds the keys clients may send
+const maxIdempotencyKeyLength = 255
+
+// idempotencyLockTimeout is how long a request holds its key before it is
+// presumed lost, so a crash does not leave the key blocked until it expires
+const idempotencyLockTimeout = time.Minute
+
+// idempotencySweepInterval bounds how often expired keys are deleted
+const idempotencySweepInterval = 10 * time.Minute
+
+// idempotencyHeaders are the response headers stored with a response and
+// replayed with it
+var idempotencyHeaders = []string{fiber.HeaderContentType, fiber.HeaderETag, fiber.HeaderLocation}
+
+// IdempotencyRecord is what an IdempotencyStore holds for a key
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request the key was first sent with
+	Fingerprint string
+	// Status is the response status, or 0 while the request is running
+	Status  int
+	Headers map[string]string
+	Body    []byte
+}
+
+// IdempotencyStore persists Idempotency-Key values per client
+type IdempotencyStore interface {
+	// Reserve records key as running for the request with fingerprint until
+	// lockedUntil, unless the client holds an unexpired key of that name,
+	// whose record it returns instead
+	Reserve(ctx context.Context, client, key, fingerprint string, now, lockedUntil time.Time) (*IdempotencyRecord, error)
+	// Complete stores the response to replay for a reserved key until
+	// expiresAt
+	Complete(ctx context.Context, client, key string, record IdempotencyRecord, expiresAt time.Time) error
+	// Release drops a reserved key, so the request can be tried afresh
+	Release(ctx context.Context, client, key string) error
+	// DeleteExpired deletes the keys that expired before the given time
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+// IdempotencyConfig configures Idempotency
+type IdempotencyConfig struct {
+	Store IdempotencyStore
+	// TTL is how long a response is replayed for its key
+	TTL time.Duration
+}
+
+// Idempotency makes a route safe to retry. The first request with an
+// Idempotency-Key header runs and its response is stored under the key,
+// per client; a retry with the same key gets the stored response back,
+// marked with Idempotent-Replayed, without running again. Reusing a key for
+// a different request (method, URL or body) fails with 422, and retrying
+// while the first request still runs fails with 409. Requests without the
+// header run as usual.
+//
+// Responses that a retry might change, 5xx, 408 and 429, are not stored.
+// It must run after the authentication middleware, which identifies the
+// client.
+func Idempotency(cfg IdempotencyConfig) fiber.Handler {
+	var mu sync.Mutex
+	lastSweep := time.Now()
+
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Idempotency-Key must be at most 255 characters",
+			})
+		}
+
+		client, _ := clientOf(c)
+		fingerprint := requestFingerprint(c)
+		now := time.Now()
+
+		mu.Lock()
+		sweep := now.Sub(lastSweep) >= idempotencySweepInterval
+		if sweep {
+			lastSweep = now
+		}
+		mu.Unlock()
+		if sweep {
+			if _, err := cfg.Store.DeleteExpired(c.UserContext(), now); err != nil {
+				Logger(c).Warn("failed to delete expired idempotency keys", "error", err)
+			}
+		}
+
+		existing, err := cfg.Store.Reserve(c.UserContext(), client, key, fingerprint, now, now.Add(idempotencyLockTimeout))
+		if errors.Is(err, context.DeadlineExceeded) {
+			return TimedOut(c, err)
+		}
+		if err != nil {
+			SetErrorCause(c, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Failed to check Idempotency-Key",
+			})
+		}
+		if existing != nil {
+			return replayIdempotent(c, existing, fingerprint)
+		}
+
+		// Storing the outcome must not fail with the request's context, which
+		// may have timed out by now
+		ctx := context.WithoutCancel(c.UserContext())
+		if err := c.Next(); err != nil {
+			releaseIdempotencyKey(ctx, c, cfg.Store, client, key)
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= 500 || status == fiber.StatusRequestTimeout || status == fiber.StatusTooManyRequests || c.Response().IsBodyStream() {
+			releaseIdempotencyKey(ctx, c, cfg.Store, client, key)
+			return nil
+		}
+
+		record := IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      status,
+			Headers:     make(map[string]string),
+			Body:        append([]byte(nil), c.Response().Body()...),
+		}
+		for _, name := range idempotencyHeaders {
+			if value := c.GetRespHeader(name); value != "" {
+				record.Headers[name] = value
+			}
+		}
+		if err := cfg.Store.Complete(ctx, client, key, record, time.Now().Add(cfg.TTL)); err != nil {
+			// The response still goes out; a retry within the lock timeout
+			// is refused and a later one runs again
+			Logger(c).Error("failed to store idempotent response", "error", err)
+		}
+		return nil
+	}
+}
+
+// requestFingerprint hashes what identifies a request: its method, URL and
+// body
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{0})
+	h.Write([]byte(c.OriginalURL()))
+	h.Write([]byte{0})
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayIdempotent answers a request whose key is already held
+func replayIdempotent(c *fiber.Ctx, existing *IdempotencyRecord, fingerprint string) error {
+	if existing.Fingerprint != fingerprint {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"success": false,
+			"error":   "Idempotency-Key was already used for a different request",
+		})
+	}
+	if existing.Status == 0 {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "A request with this Idempotency-Key is still in progress",
+		})
+	}
+
+	for name, value := range existing.Headers {
+		c.Set(name, value)
+	}
+	c.Set(HeaderIdempotentReplayed, "true")
+	return c.Status(existing.Status).Send(existing.Body)
+}
+
+// releaseIdempotencyKey drops the key of a request whose response is not
+// stored, logging rather than failing the request if that fails
+func releaseIdempotencyKey(ctx context.Context, c *fiber.Ctx, store IdempotencyStore, client, key string) {
+	if err := store.Release(ctx, client, key); err != nil {
+		Logger(c).Warn("failed to release idempotency key", "error", err)
+	}
+}
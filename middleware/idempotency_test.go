@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryIdempotencyStore keeps idempotency keys in memory
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) Reserve(_ context.Context, client, key, fingerprint string, _, _ time.Time) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[client+"|"+key]; ok {
+		copied := *existing
+		return &copied, nil
+	}
+	s.records[client+"|"+key] = &IdempotencyRecord{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, client, key string, record IdempotencyRecord, _ time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[client+"|"+key] = &record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, client, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, client+"|"+key)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) DeleteExpired(context.Context, time.Time) (int, error) {
+	return 0, nil
+}
+
+// idempotencyApp counts the requests that reach its handlers. POST /users
+// answers 201 with the count, POST /flaky 503.
+func idempotencyApp(store IdempotencyStore) (*fiber.App, *int) {
+	calls := 0
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(LocalsClaims, &Claims{Method: AuthMethodAPIKey, Subject: c.Get("X-Client", "api_key:1")})
+		return c.Next()
+	})
+	idempotent := Idempotency(IdempotencyConfig{Store: store, TTL: time.Hour})
+	app.Post("/users", idempotent, func(c *fiber.Ctx) error {
+		calls++
+		c.Set(fiber.HeaderETag, `"v1"`)
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"call": calls})
+	})
+	app.Post("/flaky", idempotent, func(c *fiber.Ctx) error {
+		calls++
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	})
+	return app, &calls
+}
+
+func idempotentRequest(t *testing.T, app *fiber.App, path, key, body string, header ...string) (int, string, map[string]string) {
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	headers := map[string]string{}
+	for _, name := range []string{fiber.HeaderETag, fiber.HeaderContentType, HeaderIdempotentReplayed} {
+		headers[name] = resp.Header.Get(name)
+	}
+	return resp.StatusCode, string(data), headers
+}
+
+func TestIdempotency_Replays(t *testing.T) {
+	app, calls := idempotencyApp(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}})
+
+	status, body, headers := idempotentRequest(t, app, "/users", "k1", `{"email":"a@example.com"}`)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, `{"call":1}`, body)
+	assert.Empty(t, headers[HeaderIdempotentReplayed])
+
+	status, body, headers = idempotentRequest(t, app, "/users", "k1", `{"email":"a@example.com"}`)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, `{"call":1}`, body)
+	assert.Equal(t, "true", headers[HeaderIdempotentReplayed])
+	assert.Equal(t, `"v1"`, headers[fiber.HeaderETag])
+	assert.Equal(t, fiber.MIMEApplicationJSON, headers[fiber.HeaderContentType])
+	assert.Equal(t, 1, *calls)
+
+	// Another client's key of the same name, and requests without a key, run
+	status, body, _ = idempotentRequest(t, app, "/users", "k1", `{"email":"a@example.com"}`, "X-Client", "api_key:2")
+	assert.Equal(t, `{"call":2}`, body)
+	assert.Equal(t, fiber.StatusCreated, status)
+	idempotentRequest(t, app, "/users", "", `{"email":"a@example.com"}`)
+	idempotentRequest(t, app, "/users", "", `{"email":"a@example.com"}`)
+	assert.Equal(t, 4, *calls)
+}
+
+func TestIdempotency_DifferentRequest(t *testing.T) {
+	app, calls := idempotencyApp(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}})
+
+	idempotentRequest(t, app, "/users", "k1", `{"email":"a@example.com"}`)
+	status, _, _ := idempotentRequest(t, app, "/users", "k1", `{"email":"b@example.com"}`)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	status, _, _ = idempotentRequest(t, app, "/users?dry_run=true", "k1", `{"email":"a@example.com"}`)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	assert.Equal(t, 1, *calls)
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}
+	app, calls := idempotencyApp(store)
+
+	fingerprintApp := fiber.New()
+	var fingerprint string
+	fingerprintApp.Post("/users", func(c *fiber.Ctx) error {
+		fingerprint = requestFingerprint(c)
+		return nil
+	})
+	idempotentRequest(t, fingerprintApp, "/users", "", `{}`)
+	store.records["api_key:1|k1"] = &IdempotencyRecord{Fingerprint: fingerprint}
+
+	status, _, _ := idempotentRequest(t, app, "/users", "k1", `{}`)
+	assert.Equal(t, fiber.StatusConflict, status)
+	assert.Zero(t, *calls)
+}
+
+func TestIdempotency_FailuresAreNotStored(t *testing.T) {
+	app, calls := idempotencyApp(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}})
+
+	for i := 0; i < 2; i++ {
+		status, _, headers := idempotentRequest(t, app, "/flaky", "k1", `{}`)
+		assert.Equal(t, fiber.StatusServiceUnavailable, status)
+		assert.Empty(t, headers[HeaderIdempotentReplayed])
+	}
+	assert.Equal(t, 2, *calls)
+
+	status, _, _ := idempotentRequest(t, app, "/users", strings.Repeat("k", 256), `{}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
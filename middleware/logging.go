@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+	"workshop_4/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderRequestID carries the ID correlating a request across services
+const HeaderRequestID = "X-Request-ID"
+
+// fiber.Ctx.Locals keys set by RequestID and LoggingMiddleware
+const (
+	LocalsRequestID  = "request.id"
+	LocalsLogger     = "request.logger"
+	LocalsErrorCause = "request.error"
+)
+
+// maxRequestIDLength bounds propagated request IDs
+const maxRequestIDLength = 128
+
+// RequestID propagates a caller's X-Request-ID or generates one, and echoes
+// it in the response
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Locals(LocalsRequestID, id)
+		c.Set(HeaderRequestID, id)
+		return c.Next()
+	}
+}
+
+// validRequestID accepts IDs of safe characters only, since they are copied
+// into logs and response headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// GetRequestID returns the ID assigned by RequestID, or ""
+func GetRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(LocalsRequestID).(string)
+	return id
+}
+
+// Logger returns the request's logger, which tags every record with the
+// request ID, or the default logger outside LoggingMiddleware
+func Logger(c *fiber.Ctx) *slog.Logger {
+	if logger, ok := c.Locals(LocalsLogger).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// SetErrorCause records the error behind a failed response, which handlers
+// otherwise hide from the client, for the request log
+func SetErrorCause(c *fiber.Ctx, err error) {
+	c.Locals(LocalsErrorCause, err)
+}
+
+// LoggingMiddleware writes one structured record per request with its ID,
+// route template, status, latency, caller and error cause. It runs after
+// RequestID and before authentication, whose outcome it reports. Inside a
+// traced request every record also carries the trace ID. The request's
+// logger is also stored in its user context for the layers below.
+func LoggingMiddleware(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		requestLogger := logger.With("request_id", GetRequestID(c))
+		if span := trace.SpanContextFromContext(c.UserContext()); span.HasTraceID() {
+			requestLogger = requestLogger.With("trace_id", span.TraceID().String())
+		}
+		c.Locals(LocalsLogger, requestLogger)
+		c.SetUserContext(logging.NewContext(c.UserContext(), requestLogger))
+
+		// Let the error handler write the response so its status is logged
+		if err := c.Next(); err != nil {
+			SetErrorCause(c, err)
+			if err := c.App().Config().ErrorHandler(c, err); err != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		attrs := []slog.Attr{
+			slog.String("method", c.Method()),
+			slog.String("route", c.Route().Path),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", c.IP()),
+		}
+		// A streamed body, such as an export, is written after this and
+		// reading it here would buffer all of it
+		if !c.Response().IsBodyStream() {
+			attrs = append(attrs, slog.Int("bytes", len(c.Response().Body())))
+		}
+		if claims := GetClaims(c); claims != nil {
+			attrs = append(attrs, slog.Group("caller",
+				slog.String("subject", claims.Subject),
+				slog.String("method", claims.Method),
+			))
+		}
+		if cause, ok := c.Locals(LocalsErrorCause).(error); ok {
+			attrs = append(attrs, slog.String("error", cause.Error()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		Logger(c).LogAttrs(c.UserContext(), level, "request", attrs...)
+		return nil
+	}
+}
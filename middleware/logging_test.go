@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"workshop_4/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func loggingApp(buf *bytes.Buffer) *fiber.App {
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+	app := fiber.New()
+	app.Use(RequestID(), LoggingMiddleware(logger))
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		c.Locals(LocalsClaims, &Claims{Method: AuthMethodBearer, Subject: "user-42"})
+		Logger(c).Info("inside handler")
+		if logger, ok := logging.FromContext(c.UserContext()); ok {
+			logger.Info("below handler")
+		}
+		return c.SendString("ok")
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		SetErrorCause(c, errors.New("database is locked"))
+		return c.Status(fiber.StatusInternalServerError).SendString("failed")
+	})
+	app.Get("/error", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusTeapot, "short and stout")
+	})
+	return app
+}
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	app := loggingApp(&buf)
+
+	req := httptest.NewRequest("GET", "/users/7", nil)
+	req.Header.Set(HeaderRequestID, "req-123")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "req-123", resp.Header.Get(HeaderRequestID))
+
+	records := logRecords(t, &buf)
+	if assert.Len(t, records, 3) {
+		// Records written during the request carry its ID, also when the
+		// logger is taken from the user context
+		assert.Equal(t, "inside handler", records[0]["msg"])
+		assert.Equal(t, "req-123", records[0]["request_id"])
+		assert.Equal(t, "below handler", records[1]["msg"])
+		assert.Equal(t, "req-123", records[1]["request_id"])
+
+		request := records[2]
+		assert.Equal(t, "INFO", request["level"])
+		assert.Equal(t, "req-123", request["request_id"])
+		assert.Equal(t, "/users/:id", request["route"])
+		assert.Equal(t, "/users/7", request["path"])
+		assert.Equal(t, float64(200), request["status"])
+		assert.Contains(t, request, "latency_ms")
+		assert.Equal(t, map[string]interface{}{"subject": "user-42", "method": "bearer"}, request["caller"])
+	}
+}
+
+func TestLoggingMiddleware_ErrorCause(t *testing.T) {
+	var buf bytes.Buffer
+	app := loggingApp(&buf)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/fail", nil))
+	assert.Equal(t, 500, resp.StatusCode)
+	resp, _ = app.Test(httptest.NewRequest("GET", "/error", nil))
+	assert.Equal(t, 418, resp.StatusCode)
+
+	records := logRecords(t, &buf)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "ERROR", records[0]["level"])
+		assert.Equal(t, "database is locked", records[0]["error"])
+		// Errors returned by handlers are answered and logged with their status
+		assert.Equal(t, "WARN", records[1]["level"])
+		assert.Equal(t, float64(418), records[1]["status"])
+		assert.Equal(t, "short and stout", records[1]["error"])
+	}
+}
+
+func TestRequestID_GeneratesWhenMissingOrInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	app := loggingApp(&buf)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/users/1", nil))
+	generated := resp.Header.Get(HeaderRequestID)
+	assert.Len(t, generated, 32)
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set(HeaderRequestID, "bad id\r\nwith newline")
+	resp, _ = app.Test(req)
+	assert.NotEqual(t, "bad id\r\nwith newline", resp.Header.Get(HeaderRequestID))
+	assert.Len(t, resp.Header.Get(HeaderRequestID), 32)
+}
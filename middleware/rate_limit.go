@@ -0,0 +1,409 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Rate limit tiers clients fall into when not assigned one
+const (
+	// RateLimitDefaultTier applies to API keys and tokens without a tier
+	RateLimitDefaultTier = "standard"
+	// RateLimitAnonymousTier applies to requests without credentials
+	RateLimitAnonymousTier = "anonymous"
+)
+
+// RateLimitAuthGroup is the group of the anonymous buckets LimitAnonymous
+// keeps per IP address for requests that fail to authenticate
+const RateLimitAuthGroup = "auth"
+
+// rateLimitSweepInterval bounds how often idle buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitRule is a token bucket holding up to Burst requests and refilled
+// at Rate requests per second
+type RateLimitRule struct {
+	Rate  float64
+	Burst int
+}
+
+// QuotaStore persists daily request counts. It is satisfied by
+// domain.QuotaRepository.
+type QuotaStore interface {
+	Consume(ctx context.Context, client, day string, limit int) (int, bool, error)
+}
+
+// RateLimitConfig configures a RateLimiter
+type RateLimitConfig struct {
+	// Rules are keyed by "tier/group", where either part may be "*". The most
+	// specific rule applies; requests matching none are not limited.
+	Rules map[string]RateLimitRule
+	// Quotas are daily request limits by tier, counted per client across all
+	// groups and reset at midnight UTC. Tiers without one are unlimited.
+	Quotas map[string]int
+	// Store persists quota usage; quotas are not enforced without one
+	Store QuotaStore
+}
+
+// DefaultRateLimits returns the rules used when none are configured
+func DefaultRateLimits() map[string]RateLimitRule {
+	return map[string]RateLimitRule{
+		"*/*":                         {Rate: 10, Burst: 20},
+		RateLimitAnonymousTier + "/*": {Rate: 1, Burst: 5},
+	}
+}
+
+// ParseRateLimits parses rules in the form "tier/group=rate:burst;...", e.g.
+// "*/*=10:20;partner/*=50:100;standard/users=300/m:10". A rate is per second
+// unless suffixed with /s, /m or /h. An empty string yields DefaultRateLimits.
+func ParseRateLimits(s string) (map[string]RateLimitRule, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultRateLimits(), nil
+	}
+
+	rules := make(map[string]RateLimitRule)
+	for _, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		tier, group, scoped := strings.Cut(strings.TrimSpace(key), "/")
+		if !ok || !scoped || tier == "" || group == "" {
+			return nil, fmt.Errorf("invalid rate limit %q: expected tier/group=rate:burst", part)
+		}
+		rateText, burstText, ok := strings.Cut(strings.TrimSpace(value), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q: expected tier/group=rate:burst", part)
+		}
+		rate, err := parseRate(rateText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q: %w", part, err)
+		}
+		burst, err := strconv.Atoi(strings.TrimSpace(burstText))
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", part)
+		}
+		rules[strings.TrimSpace(key)] = RateLimitRule{Rate: rate, Burst: burst}
+	}
+
+	return rules, nil
+}
+
+// parseRate parses "10", "10/s", "600/m" or "36000/h" into requests per second
+func parseRate(s string) (float64, error) {
+	count, unit, _ := strings.Cut(strings.TrimSpace(s), "/")
+	rate, err := strconv.ParseFloat(count, 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("rate must be a positive number")
+	}
+	switch unit {
+	case "", "s":
+		return rate, nil
+	case "m":
+		return rate / 60, nil
+	case "h":
+		return rate / 3600, nil
+	}
+	return 0, fmt.Errorf("unknown rate unit %q", unit)
+}
+
+// ParseQuotas parses daily quotas in the form "tier=requests;...", e.g.
+// "standard=50000;anonymous=1000". An empty string means no quotas.
+func ParseQuotas(s string) (map[string]int, error) {
+	quotas := make(map[string]int)
+	for _, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		tier, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || strings.TrimSpace(tier) == "" || err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid quota %q: expected tier=requests", part)
+		}
+		quotas[strings.TrimSpace(tier)] = limit
+	}
+	return quotas, nil
+}
+
+// tokenBucket is the state of one client's bucket for one group
+type tokenBucket struct {
+	rule   RateLimitRule
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the bucket was last used
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.rule.Burst), b.tokens+now.Sub(b.last).Seconds()*b.rule.Rate)
+	b.last = now
+}
+
+// take refills the bucket up to now and removes a token if one is left
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// until returns how long the bucket takes to hold n tokens
+func (b *tokenBucket) until(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rule.Rate * float64(time.Second))
+}
+
+// RateLimiter enforces per-client token buckets and daily quotas. Clients
+// are identified by API key, token subject or, failing both, IP address,
+// so Limit must run after APIKeyMiddleware and AuthMiddleware to see them;
+// LimitAnonymous runs ahead of them.
+type RateLimiter struct {
+	cfg RateLimitConfig
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a rate limiter; use Limit to apply it to routes
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		cfg:       cfg,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// rule returns the most specific rule for the tier and group
+func (l *RateLimiter) rule(tier, group string) (RateLimitRule, bool) {
+	for _, key := range []string{tier + "/" + group, tier + "/*", "*/" + group, "*/*"} {
+		if rule, ok := l.cfg.Rules[key]; ok {
+			return rule, true
+		}
+	}
+	return RateLimitRule{}, false
+}
+
+// take consumes a token from the client's bucket for the group and returns
+// a copy of the bucket afterwards
+func (l *RateLimiter) take(client, group string, rule RateLimitRule, now time.Time) (tokenBucket, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.bucket(client, group, rule, now)
+	allowed := bucket.take(now)
+	return *bucket, allowed
+}
+
+// peek returns a copy of the client's bucket for the group as of now
+// without consuming a token
+func (l *RateLimiter) peek(client, group string, rule RateLimitRule, now time.Time) tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.bucket(client, group, rule, now)
+	bucket.refill(now)
+	return *bucket
+}
+
+// bucket returns the client's bucket for the group, creating a full one
+// when there is none or the rule changed. l.mu must be held.
+func (l *RateLimiter) bucket(client, group string, rule RateLimitRule, now time.Time) *tokenBucket {
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	key := client + "|" + group
+	bucket, ok := l.buckets[key]
+	if !ok || bucket.rule != rule {
+		bucket = &tokenBucket{rule: rule, tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// sweep drops buckets that have refilled completely, which are the same as
+// a fresh bucket, so idle clients do not accumulate
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= bucket.until(float64(bucket.rule.Burst)) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientOf identifies the caller of a request and its tier
+func clientOf(c *fiber.Ctx) (client, tier string) {
+	return RateLimitClient(GetClaims(c), c.IP())
+}
+
+// RateLimitClient identifies a caller and its tier from its verified claims,
+// or from its IP address when it has none. Token subjects are prefixed so
+// they cannot collide with API key subjects.
+func RateLimitClient(claims *Claims, ip string) (client, tier string) {
+	if claims == nil {
+		return "ip:" + ip, RateLimitAnonymousTier
+	}
+
+	client = "user:" + claims.Subject
+	if claims.Method == AuthMethodAPIKey {
+		client = claims.Subject
+	}
+	tier = claims.Tier
+	if tier == "" {
+		tier = RateLimitDefaultTier
+	}
+	return client, tier
+}
+
+// AnonymousWait reports how long the client must wait before it may try
+// to authenticate again: zero while its anonymous bucket for the group has
+// a token left. It takes no token; FailedAuth does.
+func (l *RateLimiter) AnonymousWait(client, group string) time.Duration {
+	rule, ok := l.rule(RateLimitAnonymousTier, group)
+	if !ok {
+		return 0
+	}
+	bucket := l.peek(client, group, rule, time.Now())
+	return bucket.until(1)
+}
+
+// FailedAuth takes a token from the client's anonymous bucket for the group
+// after a request of it failed to authenticate
+func (l *RateLimiter) FailedAuth(client, group string) {
+	if rule, ok := l.rule(RateLimitAnonymousTier, group); ok {
+		l.take(client, group, rule, time.Now())
+	}
+}
+
+// LimitAnonymous returns middleware for routes requiring credentials, to
+// run ahead of APIKeyMiddleware and AuthMiddleware. A request that fails to
+// authenticate is anonymous and takes a token from its IP address's bucket
+// in the anonymous tier for the group; once the bucket is empty, requests
+// from the address get 429 with Retry-After before authentication runs, so
+// floods and credential guessing never reach the API key lookups.
+// Authenticated requests take no token, so clients sharing an address are
+// not limited by each other's traffic.
+func (l *RateLimiter) LimitAnonymous(group string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		client, _ := RateLimitClient(nil, c.IP())
+		if wait := l.AnonymousWait(client, group); wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, ceilSeconds(wait))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"success": false,
+				"error":   "Too many unauthenticated requests",
+			})
+		}
+
+		err := c.Next()
+		if GetClaims(c) == nil {
+			l.FailedAuth(client, group)
+		}
+		return err
+	}
+}
+
+// RateLimitResult is the outcome of Check. A zero RuleLimit means no rule
+// applied, and a zero QuotaLimit that no quota did.
+type RateLimitResult struct {
+	Allowed bool
+	// Error explains a rejection: "Rate limit exceeded" or "Daily quota exceeded"
+	Error string
+	// RetryAfter is how long a rejected client should wait
+	RetryAfter time.Duration
+
+	RuleLimit     int
+	RuleRemaining int
+	RuleReset     time.Duration
+
+	QuotaLimit     int
+	QuotaRemaining int
+}
+
+// Check consumes one request of the client in the tier from the group's
+// bucket and from the tier's daily quota. It serves callers other than
+// HTTP routes, which use Limit. A quota store failure allows the request and
+// is returned for the caller to log.
+func (l *RateLimiter) Check(ctx context.Context, client, tier, group string) (RateLimitResult, error) {
+	result := RateLimitResult{Allowed: true}
+	now := time.Now()
+
+	if rule, ok := l.rule(tier, group); ok {
+		bucket, allowed := l.take(client, group, rule, now)
+		result.RuleLimit = rule.Burst
+		result.RuleRemaining = int(bucket.tokens)
+		result.RuleReset = bucket.until(float64(rule.Burst))
+		if !allowed {
+			result.Allowed = false
+			result.Error = "Rate limit exceeded"
+			result.RetryAfter = bucket.until(1)
+			return result, nil
+		}
+	}
+
+	if limit, ok := l.cfg.Quotas[tier]; ok && l.cfg.Store != nil {
+		used, allowed, err := l.cfg.Store.Consume(ctx, client, now.UTC().Format("2006-01-02"), limit)
+		if err != nil {
+			return result, err
+		}
+		result.QuotaLimit = limit
+		result.QuotaRemaining = limit - used
+		if !allowed {
+			midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			result.Allowed = false
+			result.Error = "Daily quota exceeded"
+			result.RetryAfter = midnight.Sub(now)
+		}
+	}
+
+	return result, nil
+}
+
+// Limit returns middleware applying the limits of a route group. Responses
+// carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers;
+// rejected requests get 429 with Retry-After.
+func (l *RateLimiter) Limit(group string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		client, tier := clientOf(c)
+		result, err := l.Check(c.UserContext(), client, tier, group)
+		if err != nil {
+			// A quota store failure should not take the API down with it
+			Logger(c).Warn("quota check failed", "client", client, "error", err)
+		}
+
+		if result.RuleLimit > 0 {
+			c.Set("RateLimit-Limit", strconv.Itoa(result.RuleLimit))
+			c.Set("RateLimit-Remaining", strconv.Itoa(result.RuleRemaining))
+			c.Set("RateLimit-Reset", ceilSeconds(result.RuleReset))
+		}
+		if result.QuotaLimit > 0 {
+			c.Set("X-Quota-Limit", strconv.Itoa(result.QuotaLimit))
+			c.Set("X-Quota-Remaining", strconv.Itoa(result.QuotaRemaining))
+		}
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, ceilSeconds(result.RetryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"success": false,
+				"error":   result.Error,
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// ceilSeconds formats a duration as whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
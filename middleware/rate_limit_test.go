@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryQuotaStore counts quota usage in memory
+type memoryQuotaStore map[string]int
+
+func (s memoryQuotaStore) Consume(_ context.Context, client, day string, limit int) (int, bool, error) {
+	key := client + "|" + day
+	if s[key] >= limit {
+		return s[key], false, nil
+	}
+	s[key]++
+	return s[key], true, nil
+}
+
+// rateLimitApp authenticates requests by the client named in X-Client, so
+// tests can act as several callers
+func rateLimitApp(cfg RateLimitConfig) *fiber.App {
+	limiter := NewRateLimiter(cfg)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if client := c.Get("X-Client"); client != "" {
+			c.Locals(LocalsClaims, &Claims{Method: AuthMethodAPIKey, Subject: client, Tier: c.Get("X-Tier")})
+		}
+		return c.Next()
+	})
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Get("/users", limiter.Limit("users"), ok)
+	app.Get("/points", limiter.Limit("points"), ok)
+	return app
+}
+
+func limitedRequest(t *testing.T, app *fiber.App, path, client, tier string) (int, map[string]string) {
+	req := httptest.NewRequest("GET", path, nil)
+	if client != "" {
+		req.Header.Set("X-Client", client)
+		req.Header.Set("X-Tier", tier)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{}
+	for _, name := range []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Quota-Remaining"} {
+		headers[name] = resp.Header.Get(name)
+	}
+	return resp.StatusCode, headers
+}
+
+func TestParseRateLimits(t *testing.T) {
+	rules, err := ParseRateLimits("*/*=10:20; partner/users=600/m:5")
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimitRule{Rate: 10, Burst: 20}, rules["*/*"])
+	assert.Equal(t, RateLimitRule{Rate: 10, Burst: 5}, rules["partner/users"])
+
+	rules, err = ParseRateLimits("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRateLimits(), rules)
+
+	for _, bad := range []string{"users=1:1", "*/*=1", "*/*=0:5", "*/*=1/d:5", "*/*=1:0"} {
+		_, err = ParseRateLimits(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParseQuotas(t *testing.T) {
+	quotas, err := ParseQuotas("standard=50000; anonymous=100")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"standard": 50000, "anonymous": 100}, quotas)
+
+	_, err = ParseQuotas("standard=lots")
+	assert.Error(t, err)
+}
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	app := rateLimitApp(RateLimitConfig{Rules: map[string]RateLimitRule{
+		"*/*":            {Rate: 0.01, Burst: 2},
+		"partner/*":      {Rate: 0.01, Burst: 3},
+		"anonymous/*":    {Rate: 0.01, Burst: 1},
+		"standard/users": {Rate: 0.01, Burst: 1},
+	}})
+
+	status, headers := limitedRequest(t, app, "/points", "api_key:1", "")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "2", headers["RateLimit-Limit"])
+	assert.Equal(t, "1", headers["RateLimit-Remaining"])
+	assert.Equal(t, "100", headers["RateLimit-Reset"])
+
+	status, _ = limitedRequest(t, app, "/points", "api_key:1", "")
+	assert.Equal(t, 200, status)
+	status, headers = limitedRequest(t, app, "/points", "api_key:1", "")
+	assert.Equal(t, 429, status)
+	assert.Equal(t, "0", headers["RateLimit-Remaining"])
+	assert.Equal(t, "100", headers["Retry-After"])
+
+	// Buckets are per client and per group, with the most specific rule
+	status, _ = limitedRequest(t, app, "/users", "api_key:1", "")
+	assert.Equal(t, 200, status)
+	status, _ = limitedRequest(t, app, "/users", "api_key:1", "")
+	assert.Equal(t, 429, status)
+	status, headers = limitedRequest(t, app, "/points", "api_key:2", "partner")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "3", headers["RateLimit-Limit"])
+
+	// Requests without credentials are limited by IP address
+	status, _ = limitedRequest(t, app, "/points", "", "")
+	assert.Equal(t, 200, status)
+	status, _ = limitedRequest(t, app, "/points", "", "")
+	assert.Equal(t, 429, status)
+}
+
+func TestRateLimiter_DailyQuota(t *testing.T) {
+	store := memoryQuotaStore{}
+	app := rateLimitApp(RateLimitConfig{
+		Quotas: map[string]int{"standard": 2},
+		Store:  store,
+	})
+
+	for i := 1; i >= 0; i-- {
+		status, headers := limitedRequest(t, app, "/users", "api_key:1", "")
+		assert.Equal(t, 200, status)
+		assert.Equal(t, strconv.Itoa(i), headers["X-Quota-Remaining"])
+		// No rules means no token bucket headers
+		assert.Empty(t, headers["RateLimit-Limit"])
+	}
+
+	status, headers := limitedRequest(t, app, "/points", "api_key:1", "")
+	assert.Equal(t, 429, status)
+	retryAfter, _ := strconv.Atoi(headers["Retry-After"])
+	assert.True(t, retryAfter > 0 && retryAfter <= 86400)
+
+	// Tiers without a quota are unlimited
+	status, _ = limitedRequest(t, app, "/users", "api_key:2", "partner")
+	assert.Equal(t, 200, status)
+}
+
+func TestRateLimiter_LimitAnonymous(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{Rules: map[string]RateLimitRule{
+		"anonymous/auth": {Rate: 0.01, Burst: 2},
+	}})
+	app := fiber.New()
+	// Requests naming a client in X-Client authenticate; the rest get 401
+	app.Use(limiter.LimitAnonymous(RateLimitAuthGroup), func(c *fiber.Ctx) error {
+		client := c.Get("X-Client")
+		if client == "" {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		c.Locals(LocalsClaims, &Claims{Method: AuthMethodAPIKey, Subject: client})
+		return c.Next()
+	})
+	app.Get("/users", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	// Authenticated requests take no token
+	for i := 0; i < 5; i++ {
+		status, _ := limitedRequest(t, app, "/users", "api_key:1", "")
+		assert.Equal(t, 200, status)
+	}
+
+	for i := 0; i < 2; i++ {
+		status, _ := limitedRequest(t, app, "/users", "", "")
+		assert.Equal(t, 401, status)
+	}
+	status, headers := limitedRequest(t, app, "/users", "", "")
+	assert.Equal(t, 429, status)
+	assert.Equal(t, "100", headers["Retry-After"])
+
+	// Once the address is limited, credentials are not checked at all
+	status, _ = limitedRequest(t, app, "/users", "api_key:1", "")
+	assert.Equal(t, 429, status)
+}
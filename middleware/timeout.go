@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// localsTimeoutParent holds the user context as it was before the first
+// Timeout, which later ones derive their deadline from
+const localsTimeoutParent = "timeout.parent"
+
+// Timeout bounds the time a request may spend waiting on the database. It
+// sets a deadline of d on the request's user context, which repositories
+// honour, so a slow or locked database fails the request with
+// context.DeadlineExceeded instead of holding the connection. A zero d
+// disables the deadline. It runs after tracing, whose span context the
+// deadline context keeps.
+//
+// A Timeout on a route replaces the application-wide one, so long-running
+// routes such as imports can be given more time.
+func Timeout(d time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		parent, ok := c.Locals(localsTimeoutParent).(context.Context)
+		if !ok {
+			parent = c.UserContext()
+			c.Locals(localsTimeoutParent, parent)
+		}
+		if d <= 0 {
+			c.SetUserContext(parent)
+			return c.Next()
+		}
+		ctx, cancel := context.WithTimeout(parent, d)
+		defer cancel()
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// TimedOut answers 504 for a request whose deadline passed before its
+// queries finished, recording err as the cause
+func TimedOut(c *fiber.Ctx, err error) error {
+	SetErrorCause(c, err)
+	return c.Status(fiber.StatusGatewayTimeout).JSON(fiber.Map{
+		"success": false,
+		"error":   "Request timed out",
+	})
+}
+
+// Detach returns a context for work that carries on after the handler
+// returns, such as writing a streamed response body. It keeps the values and
+// deadline of the request's user context, but is not cancelled when the
+// handler returns; call cancel once the work is done.
+func Detach(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	ctx := c.UserContext()
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowQuery waits for ctx like a query against a locked database
+func slowQuery(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+func timeoutApp(d time.Duration) *fiber.App {
+	app := fiber.New()
+	app.Use(Timeout(d))
+	app.Get("/", func(c *fiber.Ctx) error {
+		err := slowQuery(c.UserContext())
+		if errors.Is(err, context.DeadlineExceeded) {
+			return TimedOut(c, err)
+		}
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func TestTimeout(t *testing.T) {
+	resp, err := timeoutApp(20 * time.Millisecond).Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, fiber.StatusGatewayTimeout, resp.StatusCode)
+	assert.JSONEq(t, `{"success":false,"error":"Request timed out"}`, string(body))
+}
+
+func TestTimeout_Disabled(t *testing.T) {
+	app := fiber.New()
+	app.Use(Timeout(0))
+	app.Get("/", func(c *fiber.Ctx) error {
+		_, ok := c.UserContext().Deadline()
+		assert.False(t, ok)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+}
+
+func TestTimeout_RouteOverride(t *testing.T) {
+	app := fiber.New()
+	app.Use(Timeout(time.Millisecond))
+	app.Get("/", Timeout(time.Hour), func(c *fiber.Ctx) error {
+		deadline, ok := c.UserContext().Deadline()
+		assert.True(t, ok)
+		assert.True(t, time.Until(deadline) > time.Minute)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+}
+
+func TestDetach(t *testing.T) {
+	var detached context.Context
+	var cancel context.CancelFunc
+	app := fiber.New()
+	app.Use(Timeout(time.Hour))
+	app.Get("/", func(c *fiber.Ctx) error {
+		detached, cancel = Detach(c)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, detached.Err())
+	deadline, ok := detached.Deadline()
+	assert.True(t, ok)
+	assert.True(t, time.Until(deadline) > time.Minute)
+
+	cancel()
+	assert.Equal(t, context.Canceled, detached.Err())
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"workshop_4/database"
+)
+
+const migrateUsage = `Usage: workshop4 migrate <command>
+
+Commands:
+  status    List migrations and whether they are applied
+  up        Apply all pending migrations
+  down N    Roll back the N most recent migrations (default 1)
+  redo      Roll back the most recent migration and apply it again
+`
+
+// runMigrate implements the "migrate" subcommand and returns the exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err := database.OpenDB(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open database:", err)
+		return 1
+	}
+	defer database.CloseDB()
+	if err := database.CheckFTS5(database.DB); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open database:", err)
+		return 1
+	}
+
+	migrator, err := database.NewMigrator(database.DB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load migrations:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			break
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\tNOTE")
+		for _, s := range statuses {
+			appliedAt, note := "pending", ""
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05Z07:00")
+			}
+			switch {
+			case s.Unknown:
+				note = "unknown to this build"
+			case s.Modified:
+				note = "modified since applied"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, appliedAt, note)
+		}
+		w.Flush()
+	case "up":
+		var n int
+		if n, err = migrator.Up(); err == nil {
+			fmt.Printf("Applied %d migration(s)\n", n)
+		}
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "down takes a positive number of migrations")
+				return 2
+			}
+		}
+		if n, err = migrator.Down(n); err == nil {
+			fmt.Printf("Rolled back %d migration(s)\n", n)
+		}
+	case "redo":
+		if err = migrator.Redo(); err == nil {
+			fmt.Println("Redid the latest migration")
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Migration failed:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,189 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are created for each
+// HTTP request by Middleware, for each gRPC call by GRPCStatsHandler, for
+// each UserUseCase method and for each user repository query, and
+// propagated to and from callers with the W3C traceparent header or
+// metadata entry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"workshop_4/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/stats"
+)
+
+// instrumentationName names the tracer of the HTTP layer
+const instrumentationName = "workshop_4/tracing"
+
+// Exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// Config selects where spans are exported
+type Config struct {
+	// Exporter is "none", "stdout", "file" or "otlp"
+	Exporter string
+	// File is the file the file exporter appends spans to, one JSON object
+	// per line
+	File string
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator, and returns a function flushing pending spans and closing the
+// exporter. With the "none" exporter spans are not recorded, but incoming
+// trace context is still honoured.
+//
+// The OTLP exporter sends over HTTP and reads its endpoint, headers and
+// timeout from the standard OTEL_EXPORTER_OTLP_* variables.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	var err error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("the file exporter needs a file")
+		}
+		var file *os.File
+		file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		closer = file
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := sdkresource.Merge(sdkresource.Default(), sdkresource.NewSchemaless(
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// headerCarrier adapts fasthttp request headers to a propagation.TextMapCarrier
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.c.Request().Header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	var keys []string
+	h.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// Middleware starts a server span for each request, continuing the trace of
+// an incoming traceparent header, and stores the span's context as the
+// request's user context for the layers below. The span is named after the
+// route template once routing has settled it, e.g. "PUT /api/v1/users/:id".
+// It runs after RequestID, whose ID it records, and outside the request log
+// so the status it records is final.
+func Middleware() fiber.Handler {
+	tracer := otel.Tracer(instrumentationName)
+	return func(c *fiber.Ctx) error {
+		// Attributes outlive the request, so strings backed by fasthttp's
+		// buffers are copied
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{c})
+		ctx, span := tracer.Start(ctx, c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(utils.CopyString(c.Path())),
+				semconv.ClientAddress(c.IP()),
+			),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(status),
+		)
+		if id := middleware.GetRequestID(c); id != "" {
+			span.SetAttributes(attribute.String("request.id", utils.CopyString(id)))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+		return err
+	}
+}
+
+// GRPCStatsHandler starts a server span for each gRPC call, continuing the
+// trace of an incoming traceparent metadata entry, and gives the call's
+// context the span so the use case and repository spans nest under it.
+// Spans are named after the full method, e.g.
+// "workshop.user.v1.UserService/GetUser", and record the status code.
+func GRPCStatsHandler() stats.Handler {
+	return otelgrpc.NewServerHandler()
+}